@@ -0,0 +1,130 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminOnly rejects callers acting as a specific user; admin endpoints
+// need a full-access token
+func AdminOnly(c *fiber.Ctx) error {
+	if handlers.CurrentUserID(c) != 0 {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+			Error:   "forbidden",
+			Message: "Admin endpoints need a full-access token without " + UserHeader,
+		})
+	}
+	return c.Next()
+}
+
+// BackupSupported rejects backup requests unless the database is SQLite
+func BackupSupported(c *fiber.Ctx) error {
+	if !db.BackupSupported() {
+		return backupError(c, db.ErrBackupUnsupported)
+	}
+	return c.Next()
+}
+
+// Backup streams a consistent snapshot of the SQLite database
+func Backup(c *fiber.Ctx) error {
+	dir, err := os.MkdirTemp("", "koffan-backup-")
+	if err != nil {
+		return backupError(c, err)
+	}
+	// The open file stays readable after its directory is removed
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	if err := db.BackupTo(path); err != nil {
+		return backupError(c, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return backupError(c, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return backupError(c, err)
+	}
+
+	filename := "koffan-" + time.Now().UTC().Format("20060102-150405") + ".db"
+	c.Set(fiber.HeaderContentType, "application/vnd.sqlite3")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	// The response closes the file once it has been sent
+	return c.SendStream(f, int(info.Size()))
+}
+
+// Restore replaces the database with an uploaded backup, sent either as the
+// "file" field of a multipart form or as the raw request body.
+// The current database is saved to BACKUP_DIR first, if it is set.
+func Restore(c *fiber.Ctx) error {
+	dir, err := os.MkdirTemp("", "koffan-restore-")
+	if err != nil {
+		return backupError(c, err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "upload.db")
+	if file, err := c.FormFile("file"); err == nil {
+		err = c.SaveFile(file, path)
+		if err != nil {
+			return backupError(c, err)
+		}
+	} else if len(c.Body()) > 0 {
+		if err := os.WriteFile(path, c.Body(), 0o600); err != nil {
+			return backupError(c, err)
+		}
+	} else {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "validation_error",
+			Message: "Upload the backup as the \"file\" form field or as the request body",
+		})
+	}
+
+	if err := db.ValidateBackup(path); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_backup",
+			Message: err.Error(),
+		})
+	}
+
+	if backupDir := db.BackupDir(); backupDir != "" {
+		saved, err := db.Snapshot(backupDir, 0)
+		if err != nil {
+			return backupError(c, err)
+		}
+		log.Printf("Saved database to %s before restoring", saved)
+	}
+
+	if err := db.Restore(path); err != nil {
+		return backupError(c, err)
+	}
+	log.Println("Database restored from uploaded backup")
+
+	// Everything may have changed; connected clients reload
+	handlers.BroadcastUpdate("database_restored", nil)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func backupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, db.ErrBackupUnsupported) {
+		return c.Status(fiber.StatusNotImplemented).JSON(ErrorResponse{
+			Error:   "unsupported",
+			Message: err.Error(),
+		})
+	}
+	log.Printf("Backup/restore failed: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+		Error:   "backup_failed",
+		Message: "Backup or restore failed",
+	})
+}
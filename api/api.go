@@ -2,28 +2,35 @@ package api
 
 import (
 	"log"
+	"shopping-list/db"
+	"shopping-list/service"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// Register conditionally registers the API routes if API_TOKEN is set
-func Register(app *fiber.App) {
-	if !IsAPIEnabled() {
-		log.Println("REST API is disabled (API_TOKEN not set)")
-		// Register catch-all handler that returns 503 for all API requests
-		app.All("/api/v1/*", func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusServiceUnavailable).JSON(ErrorResponse{
-				Error:   "api_disabled",
-				Message: "API is not enabled on this server",
-			})
-		})
-		return
+// store is where all API handlers read data
+var store db.Store
+
+// svc performs the changes to lists, sections and items
+var svc *service.Service
+
+// Register adds the API routes. They answer only while API_TOKEN is set or
+// API tokens exist (see EnabledMiddleware).
+// The handlers read from s and make changes through sv.
+func Register(app *fiber.App, s db.Store, sv *service.Service) {
+	store = s
+	svc = sv
+
+	if IsAPIEnabled() {
+		log.Println("REST API is enabled")
+	} else {
+		log.Println("REST API is disabled until API_TOKEN is set or a token is created with create-token")
 	}
 
-	log.Println("REST API is enabled")
+	initRateLimits()
 
-	// Create API group with version prefix and token auth middleware
-	v1 := app.Group("/api/v1", TokenAuthMiddleware)
+	// Create API group with version prefix, rate limits and token auth middleware
+	v1 := app.Group("/api/v1", EnabledMiddleware, IPRateLimitMiddleware, TokenAuthMiddleware, TokenRateLimitMiddleware)
 
 	// Lists endpoints
 	v1.Get("/lists", GetLists)
@@ -34,6 +41,11 @@ func Register(app *fiber.App) {
 	v1.Get("/lists/:id/sections", GetListSections)
 	v1.Post("/lists/:id/move-up", MoveListUp)
 	v1.Post("/lists/:id/move-down", MoveListDown)
+	v1.Get("/lists/:id/permissions", GetListPermissions)
+	v1.Put("/lists/:id/permissions", UpdateListPermissions)
+	v1.Get("/lists/:id/export", ExportListText)
+	v1.Post("/lists/:id/import-text", ImportListText)
+	v1.Get("/lists/:id/pdf", GetListPDF)
 
 	// Sections endpoints
 	v1.Get("/sections/:id", GetSection)
@@ -58,9 +70,45 @@ func Register(app *fiber.App) {
 	// Batch endpoint
 	v1.Post("/batch", BatchCreate)
 
+	// To-do list endpoints (Home Assistant todo entities)
+	v1.Get("/todo/lists", GetTodoLists)
+	v1.Get("/todo/lists/:id/items", GetTodoItems)
+	v1.Post("/todo/lists/:id/items", CreateTodoItem)
+	v1.Post("/todo/lists/:id/items/delete", DeleteTodoItems)
+	v1.Patch("/todo/lists/:id/items/:uid", UpdateTodoItem)
+	v1.Put("/todo/lists/:id/items/:uid", UpdateTodoItem)
+	v1.Delete("/todo/lists/:id/items/:uid", DeleteTodoItem)
+
 	// History endpoints (suggestions)
 	v1.Get("/history", GetHistory)
 	v1.Post("/history", CreateHistory)
 	v1.Delete("/history/:id", DeleteHistory)
 	v1.Post("/history/batch-delete", BatchDeleteHistory)
+
+	// Sessions endpoints (logged-in devices)
+	v1.Get("/sessions", GetSessions)
+	v1.Delete("/sessions/:id", RevokeSession)
+
+	// Export and import of all data as JSON
+	v1.Get("/export", Export)
+	v1.Post("/import", Import)
+
+	// Import from other shopping-list apps (csv, text, keep, todoist)
+	v1.Post("/import/:format/preview", PreviewImportFormat)
+	v1.Post("/import/:format", ImportFormat)
+
+	// Admin endpoints (database backup and restore, webhooks, inbound hooks)
+	admin := v1.Group("/admin", AdminOnly)
+	admin.Get("/backup", BackupSupported, Backup)
+	admin.Post("/restore", BackupSupported, Restore)
+	admin.Get("/webhooks", GetWebhooks)
+	admin.Post("/webhooks", CreateWebhook)
+	admin.Get("/webhooks/:id", GetWebhook)
+	admin.Put("/webhooks/:id", UpdateWebhook)
+	admin.Delete("/webhooks/:id", DeleteWebhook)
+	admin.Get("/webhooks/:id/deliveries", GetWebhookDeliveries)
+	admin.Post("/webhooks/:id/test", TestWebhook)
+	admin.Get("/hooks", GetHooks)
+	admin.Post("/hooks", CreateHook)
+	admin.Delete("/hooks/:id", DeleteHook)
 }
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"shopping-list/handlers"
+	"shopping-list/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Export returns all data visible to the caller in the versioned JSON export format
+func Export(c *fiber.Ctx) error {
+	export, err := svc.Export(handlers.CurrentUserID(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	filename := "koffan-" + export.ExportedAt.Format("20060102-150405") + ".json"
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.JSON(export)
+}
+
+// Import creates the data of a JSON export. With ?mode=replace all lists,
+// templates and history are deleted first, along with the webhooks and inbound
+// hooks of those lists; the default mode=merge adds to them.
+func Import(c *fiber.Ctx) error {
+	var data service.Export
+	if err := json.Unmarshal(c.Body(), &data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_json",
+			Message: "Failed to parse request body",
+		})
+	}
+
+	result, err := svc.Import(handlers.CurrentUserID(c), &data, c.Query("mode"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+	log.Printf("Imported %d lists, %d templates and %d history entries (%s)",
+		result.Lists, result.Templates, result.History, result.Mode)
+	if n := len(result.RemovedWebhooks) + len(result.RemovedInboundHooks); n > 0 {
+		log.Printf("Import removed %d webhooks and inbound hooks bound to the replaced lists", n)
+	}
+	return c.JSON(result)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"shopping-list/db"
+	"shopping-list/handlers"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -24,7 +25,7 @@ type BatchDeleteHistoryRequest struct {
 
 // GetHistory returns all history items
 func GetHistory(c *fiber.Ctx) error {
-	items, err := db.GetItemHistoryList()
+	items, err := store.GetItemHistoryList()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
 			Error:   "db_error",
@@ -49,36 +50,8 @@ func CreateHistory(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
-	}
-
-	if len(req.Name) > MaxItemNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 200 characters",
-		})
-	}
-
-	// If section_id provided, verify it exists
-	if req.SectionID != 0 {
-		_, err := db.GetSectionByID(req.SectionID)
-		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
-		}
-	}
-
-	if err := db.SaveItemHistory(req.Name, req.SectionID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "create_failed",
-			Message: "Failed to save history",
-		})
+	if err := svc.SaveHistory(handlers.CurrentUserID(c), req.Name, req.SectionID); err != nil {
+		return serviceError(c, err)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
@@ -97,11 +70,8 @@ func DeleteHistory(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := db.DeleteItemHistory(int64(id)); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-			Error:   "not_found",
-			Message: "History entry not found",
-		})
+	if err := svc.DeleteHistory(int64(id)); err != nil {
+		return serviceError(c, err)
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
@@ -117,19 +87,9 @@ func BatchDeleteHistory(c *fiber.Ctx) error {
 		})
 	}
 
-	if len(req.IDs) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "IDs array is required",
-		})
-	}
-
-	deleted, err := db.DeleteItemHistoryBatch(req.IDs)
+	deleted, err := svc.DeleteHistoryBatch(req.IDs)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "delete_failed",
-			Message: "Failed to delete history entries",
-		})
+		return serviceError(c, err)
 	}
 
 	return c.JSON(fiber.Map{
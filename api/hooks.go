@@ -0,0 +1,62 @@
+package api
+
+import (
+	"shopping-list/handlers"
+	"shopping-list/service"
+	"shopping-list/smtpd"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetHooks returns all inbound hooks, without their tokens
+func GetHooks(c *fiber.Ctx) error {
+	hooks, err := svc.InboundHooks(handlers.CurrentUserID(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(hooks)
+}
+
+// CreateHook adds an inbound hook and returns its token and URL. The token
+// can't be shown again.
+func CreateHook(c *fiber.Ctx) error {
+	var req CreateHookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_json",
+			Message: "Failed to parse request body",
+		})
+	}
+
+	hook, token, err := svc.CreateInboundHook(handlers.CurrentUserID(c), service.NewInboundHook{
+		Name:      req.Name,
+		ListID:    req.ListID,
+		SectionID: req.SectionID,
+		AllowGet:  req.AllowGet,
+	})
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(HookResponse{
+		InboundHook: hook,
+		Token:       token,
+		URL:         c.BaseURL() + "/hook/" + token + "/add",
+		Email:       smtpd.Address(hook),
+	})
+}
+
+// DeleteHook revokes an inbound hook
+func DeleteHook(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid hook ID",
+		})
+	}
+
+	if err := svc.DeleteInboundHook(handlers.CurrentUserID(c), int64(id)); err != nil {
+		return serviceError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
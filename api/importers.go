@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"shopping-list/handlers"
+	"shopping-list/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImportPreview shows what importing a file would create
+type ImportPreview struct {
+	Format   string               `json:"format"`
+	Requests []BatchCreateRequest `json:"requests"`
+	Lists    int                  `json:"lists"`
+	Sections int                  `json:"sections"`
+	Items    int                  `json:"items"`
+	Skipped  int                  `json:"skipped"`
+}
+
+// ImportFormatResponse holds what an import from another app created
+type ImportFormatResponse struct {
+	Results []BatchCreateResponse `json:"results"`
+	Skipped int                   `json:"skipped"`
+}
+
+// PreviewImportFormat parses a file exported by another app and returns the
+// batch requests an import would run, without creating anything
+func PreviewImportFormat(c *fiber.Ctx) error {
+	plan, err := planImportUpload(c)
+	if err != nil || plan == nil {
+		return err
+	}
+
+	preview := &ImportPreview{Format: plan.Format, Requests: []BatchCreateRequest{}, Skipped: plan.Skipped}
+	if plan.ListID != 0 {
+		preview.Requests = append(preview.Requests, BatchCreateRequest{ListID: plan.ListID, Sections: sectionInputs(plan.Sections)})
+	}
+	for _, l := range plan.Lists {
+		preview.Requests = append(preview.Requests, BatchCreateRequest{List: &BatchListInput{Name: l.Name, Icon: l.Icon, Sections: sectionInputs(l.Sections)}})
+	}
+	preview.Lists, preview.Sections, preview.Items = plan.Counts()
+	return c.JSON(preview)
+}
+
+// ImportFormat creates the lists of a file exported by another app, all in
+// one transaction. With ?list_id= everything is added to an existing list.
+func ImportFormat(c *fiber.Ctx) error {
+	plan, err := planImportUpload(c)
+	if err != nil || plan == nil {
+		return err
+	}
+
+	results, err := svc.RunImport(handlers.CurrentUserID(c), plan)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	response := ImportFormatResponse{Results: []BatchCreateResponse{}, Skipped: plan.Skipped}
+	for _, result := range results {
+		response.Results = append(response.Results, batchResponse(result))
+	}
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// planImportUpload parses the uploaded file. A nil plan means the error
+// response has already been sent.
+func planImportUpload(c *fiber.Ctx) (*service.ImportPlan, error) {
+	data, err := importUpload(c)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+	}
+
+	plan, err := svc.PlanImport(handlers.CurrentUserID(c), c.Params("format"), data, c.Query("list"), int64(c.QueryInt("list_id")))
+	if err != nil {
+		return nil, serviceError(c, err)
+	}
+	return plan, nil
+}
+
+// importUpload returns the uploaded file, sent either as the "file" field of a
+// multipart form or as the raw request body
+func importUpload(c *fiber.Ctx) ([]byte, error) {
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	if len(c.Body()) == 0 {
+		return nil, errors.New("upload the file as the \"file\" form field or as the request body")
+	}
+	return c.Body(), nil
+}
+
+func sectionInputs(sections []service.NewSection) []BatchSectionInput {
+	inputs := make([]BatchSectionInput, len(sections))
+	for i, s := range sections {
+		inputs[i] = BatchSectionInput{Name: s.Name, Items: make([]BatchItemInput, len(s.Items))}
+		for j, item := range s.Items {
+			inputs[i].Items[j] = BatchItemInput{Name: item.Name, Description: item.Description}
+		}
+	}
+	return inputs
+}
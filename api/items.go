@@ -4,15 +4,11 @@ import (
 	"database/sql"
 	"shopping-list/db"
 	"shopping-list/handlers"
+	"shopping-list/service"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-const (
-	MaxItemNameLength    = 200
-	MaxDescriptionLength = 500
-)
-
 // GetItem returns a single item by ID
 func GetItem(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
@@ -23,7 +19,11 @@ func GetItem(c *fiber.Ctx) error {
 		})
 	}
 
-	item, err := db.GetItemByID(int64(id))
+	if _, status, errResp := itemRoleError(c, int64(id), db.RoleViewer); errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	item, err := store.GetItemByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
@@ -50,13 +50,6 @@ func CreateItem(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
-	}
-
 	if req.SectionID == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
 			Error:   "validation_error",
@@ -64,47 +57,10 @@ func CreateItem(c *fiber.Ctx) error {
 		})
 	}
 
-	if len(req.Name) > MaxItemNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 200 characters",
-		})
-	}
-
-	if len(req.Description) > MaxDescriptionLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Description exceeds maximum length of 500 characters",
-		})
-	}
-
-	// Check if section exists
-	_, err := db.GetSectionByID(req.SectionID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
-	}
-
-	item, err := db.CreateItem(req.SectionID, req.Name, req.Description)
+	item, err := svc.CreateItem(handlers.CurrentUserID(c), req.SectionID, req.Name, req.Description)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "create_failed",
-			Message: "Failed to create item",
-		})
+		return serviceError(c, err)
 	}
-
-	// Save to item history for suggestions
-	db.SaveItemHistory(req.Name, req.SectionID)
-
-	handlers.BroadcastUpdate("item_created", item)
 	return c.Status(fiber.StatusCreated).JSON(item)
 }
 
@@ -126,53 +82,20 @@ func UpdateItem(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get existing item
-	existing, err := db.GetItemByID(int64(id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
-	}
-
-	name := req.Name
-	if name == "" {
-		name = existing.Name
+	// An empty name keeps the current one; an empty description
+	// clears it unless only the name is being changed
+	var update service.ItemUpdate
+	if req.Name != "" {
+		update.Name = &req.Name
 	}
-	description := req.Description
-	if description == "" && req.Name != "" {
-		description = existing.Description
-	}
-
-	if len(name) > MaxItemNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 200 characters",
-		})
-	}
-
-	if len(description) > MaxDescriptionLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Description exceeds maximum length of 500 characters",
-		})
+	if req.Description != "" || req.Name == "" {
+		update.Description = &req.Description
 	}
 
-	item, err := db.UpdateItem(int64(id), name, description)
+	item, err := svc.UpdateItem(handlers.CurrentUserID(c), int64(id), update)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "update_failed",
-			Message: "Failed to update item",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("item_updated", item)
 	return c.JSON(item)
 }
 
@@ -186,29 +109,9 @@ func DeleteItem(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if item exists
-	_, err = db.GetItemByID(int64(id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
-	}
-
-	if err := db.DeleteItem(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "delete_failed",
-			Message: "Failed to delete item",
-		})
+	if err := svc.DeleteItem(handlers.CurrentUserID(c), int64(id)); err != nil {
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("item_deleted", map[string]int64{"id": int64(id)})
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
@@ -222,30 +125,10 @@ func ToggleItemCompleted(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if item exists
-	_, err = db.GetItemByID(int64(id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
-	}
-
-	item, err := db.ToggleItemCompleted(int64(id))
+	item, err := svc.ToggleItemCompleted(handlers.CurrentUserID(c), int64(id))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "toggle_failed",
-			Message: "Failed to toggle item",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("item_toggled", item)
 	return c.JSON(item)
 }
 
@@ -259,30 +142,10 @@ func ToggleItemUncertain(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if item exists
-	_, err = db.GetItemByID(int64(id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
-	}
-
-	item, err := db.ToggleItemUncertain(int64(id))
+	item, err := svc.ToggleItemUncertain(handlers.CurrentUserID(c), int64(id))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "toggle_failed",
-			Message: "Failed to toggle item",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("item_updated", item)
 	return c.JSON(item)
 }
 
@@ -304,52 +167,10 @@ func MoveItem(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.SectionID == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "section_id is required",
-		})
-	}
-
-	// Check if item exists
-	_, err = db.GetItemByID(int64(id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
-	}
-
-	// Check if target section exists
-	_, err = db.GetSectionByID(req.SectionID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Target section not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
-	}
-
-	item, err := db.MoveItemToSection(int64(id), req.SectionID)
+	item, err := svc.MoveItemToSection(handlers.CurrentUserID(c), int64(id), req.SectionID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move item",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("item_moved", item)
 	return c.JSON(item)
 }
 
@@ -363,32 +184,11 @@ func MoveItemUp(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if item exists
-	item, err := db.GetItemByID(int64(id))
+	item, err := svc.MoveItemUp(handlers.CurrentUserID(c), int64(id))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
-	}
-
-	if err := db.MoveItemUp(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move item",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("items_reordered", map[string]int64{"section_id": item.SectionID})
-
-	updatedItem, _ := db.GetItemByID(int64(id))
-	return c.JSON(updatedItem)
+	return c.JSON(item)
 }
 
 // MoveItemDown moves an item down in sort order
@@ -401,30 +201,9 @@ func MoveItemDown(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if item exists
-	item, err := db.GetItemByID(int64(id))
+	item, err := svc.MoveItemDown(handlers.CurrentUserID(c), int64(id))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
+		return serviceError(c, err)
 	}
-
-	if err := db.MoveItemDown(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move item",
-		})
-	}
-
-	handlers.BroadcastUpdate("items_reordered", map[string]int64{"section_id": item.SectionID})
-
-	updatedItem, _ := db.GetItemByID(int64(id))
-	return c.JSON(updatedItem)
+	return c.JSON(item)
 }
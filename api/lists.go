@@ -4,18 +4,14 @@ import (
 	"database/sql"
 	"shopping-list/db"
 	"shopping-list/handlers"
+	"shopping-list/service"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-const (
-	MaxListNameLength = 100
-	MaxIconLength     = 20
-)
-
 // GetLists returns all lists
 func GetLists(c *fiber.Ctx) error {
-	lists, err := db.GetAllLists()
+	lists, err := store.GetAllLists(handlers.CurrentUserID(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
 			Error:   "db_error",
@@ -35,7 +31,11 @@ func GetList(c *fiber.Ctx) error {
 		})
 	}
 
-	list, err := db.GetListByID(int64(id))
+	if status, errResp := listRoleError(c, int64(id), db.RoleViewer); errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	list, err := store.GetListByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
@@ -49,6 +49,7 @@ func GetList(c *fiber.Ctx) error {
 		})
 	}
 
+	list.Role, _ = handlers.ListRole(c, list.ID)
 	return c.JSON(list)
 }
 
@@ -62,37 +63,10 @@ func CreateList(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
-	}
-
-	if len(req.Name) > MaxListNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 100 characters",
-		})
-	}
-
-	if len(req.Icon) > MaxIconLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Icon exceeds maximum length of 20 characters",
-		})
-	}
-
-	icon := NormalizeIcon(req.Icon)
-	list, err := db.CreateList(req.Name, icon)
+	list, err := svc.CreateList(handlers.CurrentUserID(c), req.Name, req.Icon)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "create_failed",
-			Message: "Failed to create list",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("list_created", list)
 	return c.Status(fiber.StatusCreated).JSON(list)
 }
 
@@ -114,48 +88,16 @@ func UpdateList(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get existing list to check if it exists and for default values
-	existing, err := db.GetListByID(int64(id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+	// Omitted fields keep their current value
+	update := service.ListUpdate{Icon: &req.Icon}
+	if req.Name != "" {
+		update.Name = &req.Name
 	}
 
-	name := req.Name
-	if name == "" {
-		name = existing.Name
-	}
-	icon := req.Icon
-	if icon == "" {
-		icon = existing.Icon
-	} else {
-		icon = NormalizeIcon(icon)
-	}
-
-	if len(name) > MaxListNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 100 characters",
-		})
-	}
-
-	list, err := db.UpdateList(int64(id), name, icon)
+	list, err := svc.UpdateList(handlers.CurrentUserID(c), int64(id), update)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "update_failed",
-			Message: "Failed to update list",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("list_updated", list)
 	return c.JSON(list)
 }
 
@@ -169,29 +111,9 @@ func DeleteList(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if list exists
-	_, err = db.GetListByID(int64(id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
-	}
-
-	if err := db.DeleteList(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "delete_failed",
-			Message: "Failed to delete list",
-		})
+	if err := svc.DeleteList(handlers.CurrentUserID(c), int64(id)); err != nil {
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("list_deleted", map[string]int64{"id": int64(id)})
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
@@ -205,8 +127,12 @@ func GetListSections(c *fiber.Ctx) error {
 		})
 	}
 
+	if status, errResp := listRoleError(c, int64(id), db.RoleViewer); errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
 	// Check if list exists
-	_, err = db.GetListByID(int64(id))
+	_, err = store.GetListByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
@@ -220,7 +146,7 @@ func GetListSections(c *fiber.Ctx) error {
 		})
 	}
 
-	sections, err := db.GetSectionsByList(int64(id))
+	sections, err := store.GetSectionsByList(int64(id))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
 			Error:   "db_error",
@@ -241,31 +167,10 @@ func MoveListUp(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if list exists
-	_, err = db.GetListByID(int64(id))
+	list, err := svc.MoveListUp(handlers.CurrentUserID(c), int64(id))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return serviceError(c, err)
 	}
-
-	if err := db.MoveListUp(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move list",
-		})
-	}
-
-	handlers.BroadcastUpdate("lists_reordered", nil)
-
-	list, _ := db.GetListByID(int64(id))
 	return c.JSON(list)
 }
 
@@ -279,30 +184,9 @@ func MoveListDown(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if list exists
-	_, err = db.GetListByID(int64(id))
+	list, err := svc.MoveListDown(handlers.CurrentUserID(c), int64(id))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return serviceError(c, err)
 	}
-
-	if err := db.MoveListDown(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move list",
-		})
-	}
-
-	handlers.BroadcastUpdate("lists_reordered", nil)
-
-	list, _ := db.GetListByID(int64(id))
 	return c.JSON(list)
 }
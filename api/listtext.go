@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"shopping-list/handlers"
+	"shopping-list/service"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImportTextRequest holds pasted list text
+type ImportTextRequest struct {
+	Text string `json:"text"`
+}
+
+// ImportTextResponse holds what an import of pasted text created
+type ImportTextResponse struct {
+	BatchCreateResponse
+	Skipped int `json:"skipped"`
+}
+
+// ExportListText returns a list as Markdown, todo.txt or plain text
+func ExportListText(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid list ID",
+		})
+	}
+
+	format := c.Query("format", service.TextMarkdown)
+	text, err := svc.ExportListText(handlers.CurrentUserID(c), int64(id), format)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	if format == service.TextMarkdown {
+		c.Set("Content-Type", "text/markdown; charset=utf-8")
+	} else {
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	return c.SendString(text)
+}
+
+// ImportListText adds the sections and items of Markdown, todo.txt or plain
+// text to a list. The body is JSON {"text": "..."} or the text itself.
+func ImportListText(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid list ID",
+		})
+	}
+
+	text := string(c.Body())
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		var req ImportTextRequest
+		if err := json.Unmarshal(c.Body(), &req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error:   "invalid_json",
+				Message: "Failed to parse request body",
+			})
+		}
+		text = req.Text
+	}
+
+	result, skipped, err := svc.ImportListText(handlers.CurrentUserID(c), int64(id), text)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(ImportTextResponse{
+		BatchCreateResponse: batchResponse(result),
+		Skipped:             skipped,
+	})
+}
@@ -1,32 +1,97 @@
 package api
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
 	"os"
+	"shopping-list/handlers"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// UserHeader lets API clients act as a specific user
+const UserHeader = "X-Koffan-User"
+
 // GetAPIToken returns the API token from environment, empty if not set
 func GetAPIToken() string {
 	return os.Getenv("API_TOKEN")
 }
 
-// IsAPIEnabled returns true if API_TOKEN is set
+// IsAPIEnabled returns true if API_TOKEN is set or tokens have been created
+// with the create-token command
 func IsAPIEnabled() bool {
-	return GetAPIToken() != ""
+	if GetAPIToken() != "" {
+		return true
+	}
+	if store == nil {
+		return false
+	}
+	tokens, err := store.GetAPITokens()
+	return err == nil && len(tokens) > 0
 }
 
-// TokenAuthMiddleware validates Bearer token in Authorization header
-func TokenAuthMiddleware(c *fiber.Ctx) error {
-	expectedToken := GetAPIToken()
-	if expectedToken == "" {
+// EnabledMiddleware answers 503 while the API is disabled. It is checked on
+// every request, so tokens created or revoked with the CLI while the server
+// runs take effect at once.
+func EnabledMiddleware(c *fiber.Ctx) error {
+	if !IsAPIEnabled() {
 		return c.Status(fiber.StatusServiceUnavailable).JSON(ErrorResponse{
 			Error:   "api_disabled",
 			Message: "API is not enabled on this server",
 		})
 	}
+	return c.Next()
+}
+
+// tokenPrefix marks tokens created with create-token, so they are easy to recognize
+const tokenPrefix = "koffan_"
+
+// NewToken returns a random API token and the hash to store for it
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = tokenPrefix + hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash stored for a token; the token itself is never stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
+// tokenTouchInterval limits how often last_used_at is written for a token
+const tokenTouchInterval = 60
+
+// TokenUserID checks a token and returns the user it acts as, 0 for full
+// access. API_TOKEN has full access; a created token may belong to a user.
+func TokenUserID(token string) (int64, bool) {
+	expectedToken := GetAPIToken()
+	if expectedToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expectedToken)) == 1 {
+		return 0, true
+	}
+	t, err := store.GetAPITokenByHash(HashToken(token))
+	if err != nil {
+		return 0, false
+	}
+	if now := time.Now().Unix(); now-t.LastUsedAt >= tokenTouchInterval {
+		if err := store.TouchAPIToken(t.ID, now); err != nil {
+			log.Printf("Failed to record use of API token %q: %v", t.Name, err)
+		}
+	}
+	return t.UserID, true
+}
+
+// TokenAuthMiddleware validates Bearer token in Authorization header.
+// It accepts API_TOKEN and tokens created with the create-token command.
+func TokenAuthMiddleware(c *fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
@@ -37,19 +102,46 @@ func TokenAuthMiddleware(c *fiber.Ctx) error {
 
 	// Expect "Bearer <token>"
 	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" || parts[1] == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
 			Error:   "invalid_format",
 			Message: "Authorization header must be in format: Bearer <token>",
 		})
 	}
 
-	if parts[1] != expectedToken {
+	tokenUserID, ok := TokenUserID(parts[1])
+	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
 			Error:   "invalid_token",
 			Message: "Invalid API token",
 		})
 	}
 
+	username := strings.TrimSpace(c.Get(UserHeader))
+	if tokenUserID != 0 {
+		// A user's token always acts as that user
+		if username != "" {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+				Error:   "forbidden",
+				Message: "Tokens of a user cannot be used with " + UserHeader,
+			})
+		}
+		c.Locals(handlers.UserIDLocal, tokenUserID)
+		return c.Next()
+	}
+
+	// A full-access token acts as a specific user if the caller asks to,
+	// in which case that user's list permissions apply
+	if username != "" {
+		user, err := store.GetUserByUsername(username)
+		if err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+				Error:   "unknown_user",
+				Message: "Unknown user in " + UserHeader + " header",
+			})
+		}
+		c.Locals(handlers.UserIDLocal, user.ID)
+	}
+
 	return c.Next()
 }
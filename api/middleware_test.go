@@ -0,0 +1,46 @@
+package api
+
+import (
+	"shopping-list/db"
+	"shopping-list/service"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAPIEnabledPerRequest(t *testing.T) {
+	t.Setenv("API_TOKEN", "")
+	s := db.NewMemoryStore()
+	app := fiber.New()
+	Register(app, s, service.New(s))
+
+	if resp := getLists(t, app, "anything"); resp.StatusCode != 503 {
+		t.Fatalf("request without any token configured = %d", resp.StatusCode)
+	}
+
+	// A token created while the server runs enables the API at once
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	must(s.CreateAPIToken("phone", hash, 0))
+	if resp := getLists(t, app, token); resp.StatusCode != 200 {
+		t.Errorf("request with a new token = %d", resp.StatusCode)
+	}
+	if resp := getLists(t, app, "wrong"); resp.StatusCode != 401 {
+		t.Errorf("request with a wrong token = %d", resp.StatusCode)
+	}
+
+	// Revoking the last token disables it again
+	if err := s.DeleteAPIToken("phone"); err != nil {
+		t.Fatal(err)
+	}
+	if resp := getLists(t, app, token); resp.StatusCode != 503 {
+		t.Errorf("request after revoking the last token = %d", resp.StatusCode)
+	}
+
+	t.Setenv("API_TOKEN", "full-access")
+	if resp := getLists(t, app, "full-access"); resp.StatusCode != 200 {
+		t.Errorf("request with API_TOKEN = %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// serviceError responds with the status and error of a failed service call
+func serviceError(c *fiber.Ctx, err error) error {
+	e := service.AsError(err)
+	return c.Status(e.Status()).JSON(ErrorResponse{
+		Error:   e.Code,
+		Message: e.Message,
+	})
+}
+
+// listRoleError returns the response to reject the request with,
+// or nil if the API caller has at least the min role on the list.
+// Lists the caller can't see are reported as not found.
+func listRoleError(c *fiber.Ctx, listID int64, min string) (int, *ErrorResponse) {
+	return roleError(svc.RequireListRole(handlers.CurrentUserID(c), listID, min))
+}
+
+// sectionRoleError is listRoleError for the list a section belongs to
+func sectionRoleError(c *fiber.Ctx, sectionID int64, min string) (int64, int, *ErrorResponse) {
+	listID, err := svc.RequireSectionRole(handlers.CurrentUserID(c), sectionID, min)
+	status, errResp := roleError(err)
+	return listID, status, errResp
+}
+
+// itemRoleError is listRoleError for the list an item belongs to
+func itemRoleError(c *fiber.Ctx, itemID int64, min string) (int64, int, *ErrorResponse) {
+	listID, err := svc.RequireItemRole(handlers.CurrentUserID(c), itemID, min)
+	status, errResp := roleError(err)
+	return listID, status, errResp
+}
+
+func roleError(err error) (int, *ErrorResponse) {
+	if err == nil {
+		return 0, nil
+	}
+	e := service.AsError(err)
+	return e.Status(), &ErrorResponse{Error: e.Code, Message: e.Message}
+}
+
+// GetListPermissions returns the sharing settings of a list
+func GetListPermissions(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid list ID",
+		})
+	}
+
+	if status, errResp := listRoleError(c, int64(id), db.RoleOwner); errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	permissions, err := handlers.LoadListPermissions(int64(id))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "db_error",
+			Message: "Failed to fetch permissions",
+		})
+	}
+
+	return c.JSON(permissions)
+}
+
+// UpdateListPermissions replaces the sharing settings of a list
+func UpdateListPermissions(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid list ID",
+		})
+	}
+
+	var req handlers.ListPermissionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_json",
+			Message: "Failed to parse request body",
+		})
+	}
+
+	if _, err := svc.UpdateListPermissions(handlers.CurrentUserID(c), int64(id), req.Private, req.MemberRoles()); err != nil {
+		return serviceError(c, err)
+	}
+
+	permissions, err := handlers.LoadListPermissions(int64(id))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "db_error",
+			Message: "Failed to fetch permissions",
+		})
+	}
+	return c.JSON(permissions)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetListPDF returns a list as a printable PDF (?columns=, ?hide_completed=, ?paper=a4|letter)
+func GetListPDF(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid list ID",
+		})
+	}
+
+	data, err := svc.ListPDF(handlers.CurrentUserID(c), int64(id), handlers.PrintOptions(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf(`inline; filename="list-%d.pdf"`, id))
+	return c.Send(data)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"shopping-list/handlers"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	DefaultRateLimit       = 120
+	DefaultIPRateLimit     = 240
+	DefaultRateLimitWindow = 60 * time.Second
+)
+
+var (
+	// tokenLimiter counts requests per API token, ipLimiter per client address
+	tokenLimiter *handlers.RateLimiter
+	ipLimiter    *handlers.RateLimiter
+)
+
+// initRateLimits reads API_RATE_LIMIT, API_IP_RATE_LIMIT and API_RATE_WINDOW_SECONDS.
+// A limit of 0 disables that limiter.
+func initRateLimits() {
+	window := DefaultRateLimitWindow
+	if seconds, err := strconv.Atoi(os.Getenv("API_RATE_WINDOW_SECONDS")); err == nil && seconds > 0 {
+		window = time.Duration(seconds) * time.Second
+	}
+
+	if limit := envLimit("API_RATE_LIMIT", DefaultRateLimit); limit > 0 {
+		tokenLimiter = handlers.NewRateLimiter("api-token", handlers.RateLimitConfig{Limit: limit, Window: window})
+	}
+	if limit := envLimit("API_IP_RATE_LIMIT", DefaultIPRateLimit); limit > 0 {
+		ipLimiter = handlers.NewRateLimiter("api-ip", handlers.RateLimitConfig{Limit: limit, Window: window})
+	}
+
+	log.Printf("[RATE LIMIT] API: %d requests per token, %d per IP every %v",
+		envLimit("API_RATE_LIMIT", DefaultRateLimit), envLimit("API_IP_RATE_LIMIT", DefaultIPRateLimit), window)
+}
+
+func envLimit(key string, defaultVal int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	limit, err := strconv.Atoi(val)
+	if err != nil || limit < 0 {
+		return defaultVal
+	}
+	return limit
+}
+
+// IPRateLimitMiddleware limits requests per client IP, including ones with a wrong token.
+// Runs before TokenAuthMiddleware.
+func IPRateLimitMiddleware(c *fiber.Ctx) error {
+	if ipLimiter == nil {
+		return c.Next()
+	}
+	return applyRateLimit(c, ipLimiter, handlers.ClientIP(c))
+}
+
+// TokenRateLimitMiddleware limits requests per API token.
+// Runs after TokenAuthMiddleware so only valid tokens are counted.
+func TokenRateLimitMiddleware(c *fiber.Ctx) error {
+	parts := strings.SplitN(c.Get("Authorization"), " ", 2)
+	return LimitToken(c, parts[len(parts)-1])
+}
+
+// LimitToken counts a request against the limit of a valid API token and
+// continues if it is within it. CalDAV uses it for tokens sent as passwords.
+func LimitToken(c *fiber.Ctx, token string) error {
+	if tokenLimiter == nil {
+		return c.Next()
+	}
+	return applyRateLimit(c, tokenLimiter, tokenKey(token))
+}
+
+// tokenKey avoids keeping the token itself in memory or the database
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+func applyRateLimit(c *fiber.Ctx, limiter *handlers.RateLimiter, key string) error {
+	result := limiter.Hit(key)
+	handlers.SetRateLimitHeaders(c, result)
+	if !result.Allowed {
+		return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{
+			Error:   "rate_limited",
+			Message: "Too many requests. Please try again later.",
+		})
+	}
+	return c.Next()
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"shopping-list/db"
+	"shopping-list/service"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newLimitedAPI serves the API with the rate limit settings in env
+func newLimitedAPI(t *testing.T, env map[string]string) (*fiber.App, *db.MemoryStore) {
+	t.Setenv("API_TOKEN", "full-access")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	t.Cleanup(func() { tokenLimiter, ipLimiter = nil, nil })
+
+	s := db.NewMemoryStore()
+	app := fiber.New()
+	Register(app, s, service.New(s))
+	return app, s
+}
+
+func getLists(t *testing.T, app *fiber.App, token string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/v1/lists", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestTokenRateLimit(t *testing.T) {
+	app, s := newLimitedAPI(t, map[string]string{"API_RATE_LIMIT": "3", "API_IP_RATE_LIMIT": "0", "API_RATE_WINDOW_SECONDS": "1"})
+
+	var reset int64
+	for i := 1; i <= 3; i++ {
+		resp := getLists(t, app, "full-access")
+		if resp.StatusCode != 200 {
+			t.Fatalf("request %d = %d", i, resp.StatusCode)
+		}
+		if limit := resp.Header.Get("X-RateLimit-Limit"); limit != "3" {
+			t.Errorf("X-RateLimit-Limit = %q", limit)
+		}
+		if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != strconv.Itoa(3-i) {
+			t.Errorf("X-RateLimit-Remaining of request %d = %q", i, remaining)
+		}
+		reset, _ = strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if now := time.Now().Unix(); reset < now || reset > now+1 {
+			t.Errorf("X-RateLimit-Reset = %d at %d", reset, now)
+		}
+	}
+
+	resp := getLists(t, app, "full-access")
+	var body ErrorResponse
+	if resp.StatusCode != 429 || json.NewDecoder(resp.Body).Decode(&body) != nil || body.Error != "rate_limited" {
+		t.Fatalf("request over the limit = %d %+v", resp.StatusCode, body)
+	}
+	if remaining, retry := resp.Header.Get("X-RateLimit-Remaining"), resp.Header.Get("Retry-After"); remaining != "0" || retry != "1" {
+		t.Errorf("over the limit: X-RateLimit-Remaining %q, Retry-After %q", remaining, retry)
+	}
+
+	// Other tokens have their own budget
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	must(s.CreateAPIToken("phone", hash, 0))
+	if resp := getLists(t, app, token); resp.StatusCode != 200 || resp.Header.Get("X-RateLimit-Remaining") != "2" {
+		t.Errorf("request with another token = %d, remaining %q", resp.StatusCode, resp.Header.Get("X-RateLimit-Remaining"))
+	}
+
+	// A new window starts after the reset time
+	time.Sleep(time.Until(time.Unix(reset, 0)) + 100*time.Millisecond)
+	if resp := getLists(t, app, "full-access"); resp.StatusCode != 200 || resp.Header.Get("X-RateLimit-Remaining") != "2" {
+		t.Errorf("request after the reset = %d, remaining %q", resp.StatusCode, resp.Header.Get("X-RateLimit-Remaining"))
+	}
+}
+
+func TestIPRateLimit(t *testing.T) {
+	app, _ := newLimitedAPI(t, map[string]string{"API_RATE_LIMIT": "0", "API_IP_RATE_LIMIT": "2"})
+
+	// Guessed tokens count against the address
+	for i := 1; i <= 2; i++ {
+		if resp := getLists(t, app, "guess"); resp.StatusCode != 401 || resp.Header.Get("X-RateLimit-Remaining") != strconv.Itoa(2-i) {
+			t.Errorf("guess %d = %d, remaining %q", i, resp.StatusCode, resp.Header.Get("X-RateLimit-Remaining"))
+		}
+	}
+	if resp := getLists(t, app, "full-access"); resp.StatusCode != 429 || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("request after the guesses = %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestUnlimitedAPI(t *testing.T) {
+	app, _ := newLimitedAPI(t, map[string]string{"API_RATE_LIMIT": "0", "API_IP_RATE_LIMIT": "0"})
+	for i := 0; i < 5; i++ {
+		if resp := getLists(t, app, "full-access"); resp.StatusCode != 200 || resp.Header.Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("request %d = %d, limit %q", i, resp.StatusCode, resp.Header.Get("X-RateLimit-Limit"))
+		}
+	}
+}
+
+func TestTokenUserID(t *testing.T) {
+	t.Setenv("API_TOKEN", "full-access")
+	s := db.NewMemoryStore()
+	store = s
+	alice := must(s.GetOrCreateUser("alice"))
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	must(s.CreateAPIToken("alice's phone", hash, alice.ID))
+
+	tests := []struct {
+		token  string
+		userID int64
+		ok     bool
+	}{
+		{"full-access", 0, true},
+		{token, alice.ID, true},
+		{"full-acces", 0, false},
+		{"full-access2", 0, false},
+		{"", 0, false},
+		{token[:len(token)-1], 0, false},
+	}
+	for _, tt := range tests {
+		if userID, ok := TokenUserID(tt.token); userID != tt.userID || ok != tt.ok {
+			t.Errorf("TokenUserID(%q) = %d, %v", tt.token, userID, ok)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package api
 
 import (
 	"shopping-list/db"
-	"unicode"
+	"shopping-list/service"
 )
 
 // ErrorResponse represents an API error
@@ -26,6 +26,11 @@ type ItemsResponse struct {
 	Items []db.Item `json:"items"`
 }
 
+// SessionsResponse wraps multiple sessions
+type SessionsResponse struct {
+	Sessions []db.Session `json:"sessions"`
+}
+
 // BatchCreateRequest represents the request body for batch creation
 type BatchCreateRequest struct {
 	// Option 1: Create new list with nested sections/items
@@ -109,96 +114,77 @@ type MoveItemRequest struct {
 	SectionID int64 `json:"section_id"`
 }
 
-// iconAliases maps string aliases to emoji icons
-var iconAliases = map[string]string{
-	"cart":      "🛒",
-	"shopping":  "🛒",
-	"home":      "🏠",
-	"house":     "🏠",
-	"gift":      "🎁",
-	"present":   "🎁",
-	"christmas": "🎄",
-	"xmas":      "🎄",
-	"birthday":  "🎂",
-	"cake":      "🎂",
-	"food":      "🍕",
-	"pizza":     "🍕",
-	"salad":     "🥗",
-	"healthy":   "🥗",
-	"medicine":  "💊",
-	"health":    "💊",
-	"pills":     "💊",
-	"pet":       "🐕",
-	"pets":      "🐕",
-	"dog":       "🐕",
-	"cleaning":  "🧹",
-	"clean":     "🧹",
-	"package":   "📦",
-	"packages":  "📦",
-	"box":       "📦",
-	"travel":    "✈️",
-	"trip":      "✈️",
-	"flight":    "✈️",
-	"fitness":   "🏋️",
-	"gym":       "🏋️",
-	"workout":   "🏋️",
-	"books":     "📚",
-	"book":      "📚",
-	"reading":   "📚",
-	"tools":     "🛠️",
-	"tool":      "🛠️",
-	"work":      "💼",
-	"office":    "💼",
-	"business":  "💼",
-}
-
-// DefaultIcon is the fallback icon when invalid input is provided
-const DefaultIcon = "🛒"
-
-// isEmoji checks if a string starts with an emoji character
-func isEmoji(s string) bool {
-	if s == "" {
-		return false
-	}
-	for _, r := range s {
-		// Check for common emoji ranges
-		if r >= 0x1F300 && r <= 0x1F9FF { // Miscellaneous Symbols and Pictographs, Emoticons, etc.
-			return true
-		}
-		if r >= 0x2600 && r <= 0x26FF { // Miscellaneous Symbols
-			return true
-		}
-		if r >= 0x2700 && r <= 0x27BF { // Dingbats
-			return true
-		}
-		if r >= 0x1F600 && r <= 0x1F64F { // Emoticons
-			return true
-		}
-		if r >= 0x1F680 && r <= 0x1F6FF { // Transport and Map Symbols
-			return true
-		}
-		// If first rune is a letter or digit, it's not an emoji
-		if unicode.IsLetter(r) || unicode.IsDigit(r) {
-			return false
-		}
-	}
-	return false
-}
-
-// NormalizeIcon converts string aliases to emoji, validates emoji input,
-// or returns default icon for invalid input
-func NormalizeIcon(icon string) string {
-	if icon == "" {
-		return ""
-	}
-	// Check if it's a known alias
-	if emoji, ok := iconAliases[icon]; ok {
-		return emoji
-	}
-	// Check if it's already a valid emoji
-	if isEmoji(icon) {
-		return icon
-	}
-	// Invalid input - return default icon
-	return DefaultIcon
+// CreateWebhookRequest for adding a webhook; a missing secret is generated
+type CreateWebhookRequest struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"`
+	ListID int64    `json:"list_id,omitempty"`
+}
+
+// UpdateWebhookRequest for changing a webhook; omitted fields are kept
+type UpdateWebhookRequest struct {
+	Name    *string   `json:"name,omitempty"`
+	URL     *string   `json:"url,omitempty"`
+	Secret  *string   `json:"secret,omitempty"`
+	Events  *[]string `json:"events,omitempty"`
+	ListID  *int64    `json:"list_id,omitempty"`
+	Enabled *bool     `json:"enabled,omitempty"`
+}
+
+// WebhookResponse is a webhook with its signing secret, returned when the
+// secret is set
+type WebhookResponse struct {
+	*db.Webhook
+	Secret string `json:"secret"`
+}
+
+// CreateHookRequest for adding an inbound hook
+type CreateHookRequest struct {
+	Name      string `json:"name"`
+	ListID    int64  `json:"list_id"`
+	SectionID int64  `json:"section_id,omitempty"`
+	AllowGet  bool   `json:"allow_get,omitempty"`
+}
+
+// HookResponse is a new inbound hook with its token, the URL to call and,
+// if the SMTP receiver is on, the address to mail
+type HookResponse struct {
+	*db.InboundHook
+	Token string `json:"token"`
+	URL   string `json:"url"`
+	Email string `json:"email,omitempty"`
+}
+
+// TodoListsResponse wraps the lists as to-do lists
+type TodoListsResponse struct {
+	Lists []service.TodoList `json:"lists"`
+}
+
+// TodoItemsResponse wraps the items of a to-do list
+type TodoItemsResponse struct {
+	UID   string             `json:"uid"`
+	Items []service.TodoItem `json:"items"`
+}
+
+// CreateTodoItemRequest for adding a to-do item; without a section_id it
+// goes to the section it was last added to
+type CreateTodoItemRequest struct {
+	Summary     string `json:"summary"`
+	Description string `json:"description,omitempty"`
+	Status      string `json:"status,omitempty"`
+	SectionID   int64  `json:"section_id,omitempty"`
+}
+
+// UpdateTodoItemRequest for changing a to-do item; omitted fields are kept
+type UpdateTodoItemRequest struct {
+	Summary     *string `json:"summary,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Status      *string `json:"status,omitempty"`
+}
+
+// DeleteTodoItemsRequest for deleting several to-do items
+type DeleteTodoItemsRequest struct {
+	UIDs []string `json:"uids"`
 }
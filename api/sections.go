@@ -8,10 +8,6 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-const (
-	MaxSectionNameLength = 100
-)
-
 // GetSection returns a single section by ID
 func GetSection(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
@@ -22,7 +18,11 @@ func GetSection(c *fiber.Ctx) error {
 		})
 	}
 
-	section, err := db.GetSectionByID(int64(id))
+	if _, status, errResp := sectionRoleError(c, int64(id), db.RoleViewer); errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
+	section, err := store.GetSectionByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
@@ -49,13 +49,6 @@ func CreateSection(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
-	}
-
 	if req.ListID == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
 			Error:   "validation_error",
@@ -63,37 +56,10 @@ func CreateSection(c *fiber.Ctx) error {
 		})
 	}
 
-	if len(req.Name) > MaxSectionNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 100 characters",
-		})
-	}
-
-	// Check if list exists
-	_, err := db.GetListByID(req.ListID)
+	section, err := svc.CreateSection(handlers.CurrentUserID(c), req.ListID, req.Name)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
-	}
-
-	section, err := db.CreateSectionForList(req.ListID, req.Name)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "create_failed",
-			Message: "Failed to create section",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("section_created", section)
 	return c.Status(fiber.StatusCreated).JSON(section)
 }
 
@@ -115,44 +81,10 @@ func UpdateSection(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
-	}
-
-	if len(req.Name) > MaxSectionNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 100 characters",
-		})
-	}
-
-	// Check if section exists
-	_, err = db.GetSectionByID(int64(id))
+	section, err := svc.UpdateSection(handlers.CurrentUserID(c), int64(id), req.Name)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
-	}
-
-	section, err := db.UpdateSection(int64(id), req.Name)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "update_failed",
-			Message: "Failed to update section",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("section_updated", section)
 	return c.JSON(section)
 }
 
@@ -166,29 +98,9 @@ func DeleteSection(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if section exists
-	_, err = db.GetSectionByID(int64(id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+	if err := svc.DeleteSection(handlers.CurrentUserID(c), int64(id)); err != nil {
+		return serviceError(c, err)
 	}
-
-	if err := db.DeleteSection(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "delete_failed",
-			Message: "Failed to delete section",
-		})
-	}
-
-	handlers.BroadcastUpdate("section_deleted", map[string]int64{"id": int64(id)})
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
@@ -202,8 +114,12 @@ func GetSectionItems(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, status, errResp := sectionRoleError(c, int64(id), db.RoleViewer); errResp != nil {
+		return c.Status(status).JSON(errResp)
+	}
+
 	// Check if section exists
-	_, err = db.GetSectionByID(int64(id))
+	_, err = store.GetSectionByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
@@ -217,7 +133,7 @@ func GetSectionItems(c *fiber.Ctx) error {
 		})
 	}
 
-	items, err := db.GetItemsBySection(int64(id))
+	items, err := store.GetItemsBySection(int64(id))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
 			Error:   "db_error",
@@ -238,31 +154,10 @@ func MoveSectionUp(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if section exists
-	_, err = db.GetSectionByID(int64(id))
+	section, err := svc.MoveSectionUp(handlers.CurrentUserID(c), int64(id))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
-	}
-
-	if err := db.MoveSectionUp(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move section",
-		})
+		return serviceError(c, err)
 	}
-
-	handlers.BroadcastUpdate("sections_reordered", nil)
-
-	section, _ := db.GetSectionByID(int64(id))
 	return c.JSON(section)
 }
 
@@ -276,30 +171,9 @@ func MoveSectionDown(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if section exists
-	_, err = db.GetSectionByID(int64(id))
+	section, err := svc.MoveSectionDown(handlers.CurrentUserID(c), int64(id))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+		return serviceError(c, err)
 	}
-
-	if err := db.MoveSectionDown(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move section",
-		})
-	}
-
-	handlers.BroadcastUpdate("sections_reordered", nil)
-
-	section, _ := db.GetSectionByID(int64(id))
 	return c.JSON(section)
 }
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetSessions returns the logged-in devices.
+// Without X-Koffan-User the sessions of all users are returned.
+func GetSessions(c *fiber.Ctx) error {
+	sessions, err := store.GetSessions(handlers.CurrentUserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "db_error",
+			Message: "Failed to fetch sessions",
+		})
+	}
+
+	return c.JSON(SessionsResponse{Sessions: sessions})
+}
+
+// RevokeSession logs out a device
+func RevokeSession(c *fiber.Ctx) error {
+	if err := handlers.RevokeSessionByPublicID(c.Params("id"), handlers.CurrentUserID(c)); err != nil {
+		if fe, ok := err.(*fiber.Error); ok {
+			return c.Status(fe.Code).JSON(ErrorResponse{
+				Error:   "not_found",
+				Message: fe.Message,
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "revoke_failed",
+			Message: "Failed to revoke session",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
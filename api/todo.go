@@ -0,0 +1,175 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"shopping-list/handlers"
+	"shopping-list/service"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTodoLists returns the lists as to-do lists
+func GetTodoLists(c *fiber.Ctx) error {
+	lists, err := svc.TodoLists(handlers.CurrentUserID(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return sendWithETag(c, TodoListsResponse{Lists: lists})
+}
+
+// GetTodoItems returns the items of a list as to-do items. Clients polling
+// for changes send the ETag back in If-None-Match and get 304 while nothing
+// has changed.
+func GetTodoItems(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidTodoListID(c)
+	}
+
+	items, err := svc.TodoItems(handlers.CurrentUserID(c), int64(id))
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return sendWithETag(c, TodoItemsResponse{UID: strconv.Itoa(id), Items: items})
+}
+
+// CreateTodoItem adds an item to a list
+func CreateTodoItem(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidTodoListID(c)
+	}
+
+	var req CreateTodoItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_json",
+			Message: "Failed to parse request body",
+		})
+	}
+
+	item, err := svc.CreateTodoItem(handlers.CurrentUserID(c), int64(id), req.SectionID, req.Summary, req.Description, req.Status)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(item)
+}
+
+// UpdateTodoItem changes the summary, description or status of an item
+func UpdateTodoItem(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidTodoListID(c)
+	}
+	uid, err := strconv.ParseInt(c.Params("uid"), 10, 64)
+	if err != nil {
+		return invalidTodoUID(c)
+	}
+
+	var req UpdateTodoItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_json",
+			Message: "Failed to parse request body",
+		})
+	}
+
+	item, err := svc.UpdateTodoItem(handlers.CurrentUserID(c), int64(id), uid, service.TodoItemUpdate{
+		Summary:     req.Summary,
+		Description: req.Description,
+		Status:      req.Status,
+	})
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(item)
+}
+
+// DeleteTodoItem deletes an item of a list
+func DeleteTodoItem(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidTodoListID(c)
+	}
+	uid, err := strconv.ParseInt(c.Params("uid"), 10, 64)
+	if err != nil {
+		return invalidTodoUID(c)
+	}
+
+	if err := svc.DeleteTodoItems(handlers.CurrentUserID(c), int64(id), []int64{uid}); err != nil {
+		return serviceError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// DeleteTodoItems deletes several items of a list, given as {"uids": [...]}
+func DeleteTodoItems(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidTodoListID(c)
+	}
+
+	var req DeleteTodoItemsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_json",
+			Message: "Failed to parse request body",
+		})
+	}
+	uids := make([]int64, 0, len(req.UIDs))
+	for _, s := range req.UIDs {
+		uid, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return invalidTodoUID(c)
+		}
+		uids = append(uids, uid)
+	}
+
+	if err := svc.DeleteTodoItems(handlers.CurrentUserID(c), int64(id), uids); err != nil {
+		return serviceError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// sendWithETag sends v as JSON with an ETag of its content, or 304 if the
+// client already has it
+func sendWithETag(c *fiber.Ctx, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "encode_failed",
+			Message: "Failed to encode response",
+		})
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+
+	for _, tag := range strings.Split(c.Get(fiber.HeaderIfNoneMatch), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(body)
+}
+
+func invalidTodoListID(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+		Error:   "invalid_id",
+		Message: "Invalid list ID",
+	})
+}
+
+func invalidTodoUID(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+		Error:   "invalid_id",
+		Message: "Invalid item UID",
+	})
+}
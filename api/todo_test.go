@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"shopping-list/db"
+	"shopping-list/service"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// todoClient polls the to-do endpoints the way Home Assistant does, sending
+// back the ETag of the last response it got for each path
+type todoClient struct {
+	t     *testing.T
+	app   *fiber.App
+	token string
+	etags map[string]string
+}
+
+func newTodoTest(t *testing.T) (*db.MemoryStore, *todoClient) {
+	t.Setenv("API_TOKEN", "full-access")
+	s := db.NewMemoryStore()
+	list := must(s.CreateList("Groceries", "", 0))
+	if err := s.SetActiveList(0, list.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	Register(app, s, service.New(s))
+	return s, &todoClient{t: t, app: app, token: "full-access", etags: make(map[string]string)}
+}
+
+// must returns v, failing the test by panicking if err is set
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// as returns a client for the same server using another token
+func (tc *todoClient) as(token string) *todoClient {
+	return &todoClient{t: tc.t, app: tc.app, token: token, etags: make(map[string]string)}
+}
+
+// poll fetches path into v and reports whether it changed since the last poll
+func (tc *todoClient) poll(path string, v interface{}) bool {
+	tc.t.Helper()
+	req := httptest.NewRequest("GET", "/api/v1"+path, nil)
+	req.Header.Set("Authorization", "Bearer "+tc.token)
+	if etag := tc.etags[path]; etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := tc.app.Test(req, -1)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 304:
+		return false
+	case 200:
+		tc.etags[path] = resp.Header.Get("ETag")
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			tc.t.Fatal(err)
+		}
+		return true
+	}
+	body, _ := io.ReadAll(resp.Body)
+	tc.t.Fatalf("GET %s = %d %s", path, resp.StatusCode, body)
+	return false
+}
+
+// send makes a change and returns the status and body
+func (tc *todoClient) send(method, path, body string) (int, string) {
+	tc.t.Helper()
+	req := httptest.NewRequest(method, "/api/v1"+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+tc.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tc.app.Test(req, -1)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func TestTodoPolling(t *testing.T) {
+	_, client := newTodoTest(t)
+
+	var lists TodoListsResponse
+	if !client.poll("/todo/lists", &lists) || len(lists.Lists) != 1 {
+		t.Fatalf("lists = %+v", lists)
+	}
+	path := "/todo/lists/" + lists.Lists[0].UID + "/items"
+
+	var items TodoItemsResponse
+	if !client.poll(path, &items) || len(items.Items) != 0 {
+		t.Fatalf("items = %+v", items)
+	}
+	if client.poll(path, &items) {
+		t.Error("unchanged items were sent again")
+	}
+
+	status, body := client.send("POST", path, `{"summary":"Milk","description":"2 l"}`)
+	if status != 201 {
+		t.Fatalf("create = %d %s", status, body)
+	}
+	var created service.TodoItem
+	if err := json.Unmarshal([]byte(body), &created); err != nil {
+		t.Fatal(err)
+	}
+	if !client.poll(path, &items) || len(items.Items) != 1 || items.Items[0] != created {
+		t.Fatalf("items after create = %+v, want %+v", items, created)
+	}
+	if client.poll("/todo/lists", &lists); lists.Lists[0].Open != 1 {
+		t.Errorf("open items = %d, want 1", lists.Lists[0].Open)
+	}
+
+	status, body = client.send("PATCH", path+"/"+created.UID, `{"status":"completed"}`)
+	if status != 200 {
+		t.Fatalf("complete = %d %s", status, body)
+	}
+	if !client.poll(path, &items) || items.Items[0].Status != service.TodoCompleted {
+		t.Errorf("items after completing = %+v", items)
+	}
+}
+
+func TestTodoUpdateChangesAllOrNothing(t *testing.T) {
+	s, client := newTodoTest(t)
+	section := must(s.CreateSectionForList(1, "Dairy"))
+	item := must(s.CreateItem(section.ID, "Milk", ""))
+	path := fmt.Sprintf("/todo/lists/1/items/%d", item.ID)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"status with a summary that is too long", `{"summary":"` + strings.Repeat("x", service.MaxItemNameLength+1) + `","status":"completed"}`},
+		{"summary with an unknown status", `{"summary":"Oat milk","status":"bought"}`},
+		{"empty summary", `{"summary":"","description":"2 l"}`},
+	}
+	for _, tt := range tests {
+		if status, _ := client.send("PATCH", path, tt.body); status != 400 {
+			t.Errorf("%s = %d, want 400", tt.name, status)
+		}
+		if got := must(s.GetItemByID(item.ID)); got.Name != "Milk" || got.Description != "" || got.Completed {
+			t.Errorf("item after a rejected %s = %+v", tt.name, got)
+		}
+	}
+
+	status, body := client.send("PUT", path, `{"summary":"Oat milk","description":"2 l","status":"completed"}`)
+	if status != 200 {
+		t.Fatalf("update = %d %s", status, body)
+	}
+	if got := must(s.GetItemByID(item.ID)); got.Name != "Oat milk" || got.Description != "2 l" || !got.Completed {
+		t.Errorf("item after the update = %+v", got)
+	}
+}
+
+func TestTodoDeleteItems(t *testing.T) {
+	s, client := newTodoTest(t)
+	other := must(s.CreateList("Hardware", "", 0))
+	dairy := must(s.CreateSectionForList(1, "Dairy"))
+	tools := must(s.CreateSectionForList(other.ID, "Tools"))
+	milk := must(s.CreateItem(dairy.ID, "Milk", ""))
+	cheese := must(s.CreateItem(dairy.ID, "Cheese", ""))
+	tape := must(s.CreateItem(tools.ID, "Tape", ""))
+
+	// An item of another list fails the whole request
+	body := fmt.Sprintf(`{"uids":["%d","%d"]}`, milk.ID, tape.ID)
+	if status, _ := client.send("POST", "/todo/lists/1/items/delete", body); status != 404 {
+		t.Errorf("delete with an item of another list = %d, want 404", status)
+	}
+	for _, id := range []int64{milk.ID, tape.ID} {
+		if _, err := s.GetItemByID(id); err != nil {
+			t.Errorf("item %d was deleted by a rejected request", id)
+		}
+	}
+
+	body = fmt.Sprintf(`{"uids":["%d","%d"]}`, milk.ID, cheese.ID)
+	if status, resp := client.send("POST", "/todo/lists/1/items/delete", body); status != 204 {
+		t.Fatalf("delete = %d %s", status, resp)
+	}
+	for _, id := range []int64{milk.ID, cheese.ID} {
+		if _, err := s.GetItemByID(id); err == nil {
+			t.Errorf("item %d was kept", id)
+		}
+	}
+}
+
+func TestTodoPermissions(t *testing.T) {
+	s, client := newTodoTest(t)
+	alice := must(s.GetOrCreateUser("alice"))
+	bob := must(s.GetOrCreateUser("bob"))
+	private := must(s.CreateList("Alice's", "", alice.ID))
+	section := must(s.CreateSectionForList(private.ID, "Dairy"))
+	item := must(s.CreateItem(section.ID, "Milk", ""))
+	if err := s.SetListPrivate(private.ID, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetListMember(private.ID, bob.ID, db.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateAPIToken("bob's phone", HashToken("bob-token"), bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	bobClient := client.as("bob-token")
+
+	var items TodoItemsResponse
+	path := fmt.Sprintf("/todo/lists/%d/items", private.ID)
+	if !bobClient.poll(path, &items) || len(items.Items) != 1 {
+		t.Fatalf("items for a viewer = %+v", items)
+	}
+	if status, _ := bobClient.send("PATCH", fmt.Sprintf("%s/%d", path, item.ID), `{"status":"completed"}`); status != 403 {
+		t.Errorf("complete as a viewer = %d, want 403", status)
+	}
+	if status, _ := bobClient.send("DELETE", fmt.Sprintf("%s/%d", path, item.ID), ""); status != 403 {
+		t.Errorf("delete as a viewer = %d, want 403", status)
+	}
+	if got := must(s.GetItemByID(item.ID)); got.Completed {
+		t.Error("a viewer completed an item")
+	}
+}
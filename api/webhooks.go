@@ -0,0 +1,150 @@
+package api
+
+import (
+	"shopping-list/handlers"
+	"shopping-list/service"
+	"shopping-list/webhooks"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxDeliveryLog is the most deliveries GetWebhookDeliveries returns
+const maxDeliveryLog = 200
+
+// GetWebhooks returns all webhooks
+func GetWebhooks(c *fiber.Ctx) error {
+	list, err := svc.Webhooks(handlers.CurrentUserID(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(list)
+}
+
+// GetWebhook returns one webhook
+func GetWebhook(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidWebhookID(c)
+	}
+
+	w, err := svc.Webhook(handlers.CurrentUserID(c), int64(id))
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(w)
+}
+
+// CreateWebhook adds a webhook and returns it with its signing secret
+func CreateWebhook(c *fiber.Ctx) error {
+	var req CreateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_json",
+			Message: "Failed to parse request body",
+		})
+	}
+
+	w, err := svc.CreateWebhook(handlers.CurrentUserID(c), service.NewWebhook{
+		Name:   req.Name,
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: req.Events,
+		ListID: req.ListID,
+	})
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(WebhookResponse{Webhook: w, Secret: w.Secret})
+}
+
+// UpdateWebhook changes a webhook. The response includes the secret if it
+// was changed; an empty "secret" generates a new one.
+func UpdateWebhook(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidWebhookID(c)
+	}
+
+	var req UpdateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "invalid_json",
+			Message: "Failed to parse request body",
+		})
+	}
+
+	w, err := svc.UpdateWebhook(handlers.CurrentUserID(c), int64(id), service.WebhookUpdate{
+		Name:    req.Name,
+		URL:     req.URL,
+		Secret:  req.Secret,
+		Events:  req.Events,
+		ListID:  req.ListID,
+		Enabled: req.Enabled,
+	})
+	if err != nil {
+		return serviceError(c, err)
+	}
+	if req.Secret != nil {
+		return c.JSON(WebhookResponse{Webhook: w, Secret: w.Secret})
+	}
+	return c.JSON(w)
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func DeleteWebhook(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidWebhookID(c)
+	}
+
+	if err := svc.DeleteWebhook(handlers.CurrentUserID(c), int64(id)); err != nil {
+		return serviceError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first
+func GetWebhookDeliveries(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidWebhookID(c)
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > maxDeliveryLog {
+		limit = maxDeliveryLog
+	}
+	deliveries, err := svc.WebhookDeliveries(handlers.CurrentUserID(c), int64(id), limit)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(deliveries)
+}
+
+// TestWebhook sends a "ping" event to a webhook and returns the delivery
+func TestWebhook(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return invalidWebhookID(c)
+	}
+
+	w, err := svc.Webhook(handlers.CurrentUserID(c), int64(id))
+	if err != nil {
+		return serviceError(c, err)
+	}
+	delivery, err := webhooks.Test(w)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "test_failed",
+			Message: "Failed to send the test event",
+		})
+	}
+	return c.JSON(delivery)
+}
+
+func invalidWebhookID(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+		Error:   "invalid_id",
+		Message: "Invalid webhook ID",
+	})
+}
@@ -0,0 +1,419 @@
+// Package caldav serves the lists over CalDAV, so the reminders apps of phones
+// and desktops can show and edit them. Each list is a calendar collection of
+// VTODOs, one per item. Clients sign in with HTTP Basic auth, using an API
+// token as the password.
+package caldav
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"shopping-list/api"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Methods are the WebDAV request methods to allow in addition to Fiber's defaults
+var Methods = []string{"PROPFIND", "PROPPATCH", "REPORT", "MKCOL", "MKCALENDAR"}
+
+// Namespaces of the properties served
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+const (
+	root      = "/caldav/"
+	principal = "/caldav/principal/"
+	home      = "/caldav/lists/"
+)
+
+var (
+	store db.Store
+	svc   *service.Service
+)
+
+// Register adds the CalDAV routes. Like the REST API, CalDAV needs API_TOKEN
+// or a token created with create-token; without one it answers 503.
+func Register(app *fiber.App, s db.Store, sv *service.Service) {
+	store = s
+	svc = sv
+
+	app.All("/.well-known/caldav", func(c *fiber.Ctx) error {
+		return c.Redirect(root, fiber.StatusMovedPermanently)
+	})
+	app.All("/caldav", api.EnabledMiddleware, api.IPRateLimitMiddleware, authenticate, serve)
+	app.All("/caldav/*", api.EnabledMiddleware, api.IPRateLimitMiddleware, authenticate, serve)
+}
+
+// authenticate accepts HTTP Basic auth with an API token as the password.
+// A full-access token acts as the user named, who must exist, and requests
+// count against the token's rate limit as on the REST API.
+func authenticate(c *fiber.Ctx) error {
+	if c.Method() == fiber.MethodOptions {
+		return c.Next()
+	}
+	username, password, ok := basicAuth(c.Get(fiber.HeaderAuthorization))
+	if !ok {
+		return unauthorized(c)
+	}
+	userID, ok := api.TokenUserID(password)
+	if !ok {
+		return unauthorized(c)
+	}
+	if userID == 0 && username != "" {
+		user, err := store.GetUserByUsername(username)
+		if err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(api.ErrorResponse{
+				Error:   "unknown_user",
+				Message: "Unknown user: " + username,
+			})
+		}
+		userID = user.ID
+	}
+	c.Locals(handlers.UserIDLocal, userID)
+	return api.LimitToken(c, password)
+}
+
+func basicAuth(header string) (username, password string, ok bool) {
+	scheme, encoded, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+func unauthorized(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="Koffan", charset="UTF-8"`)
+	return c.Status(fiber.StatusUnauthorized).SendString("Sign in with your username and an API token as the password")
+}
+
+// serve dispatches a request by path: the root, the principal, the home with
+// one collection per list, and the items of a list
+func serve(c *fiber.Ctx) error {
+	c.Set("DAV", "1, 3, calendar-access")
+	if c.Method() == fiber.MethodOptions {
+		c.Set(fiber.HeaderAllow, "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	path := strings.TrimPrefix(c.Path(), "/caldav")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case parts[0] == "":
+		return serveCollection(c, rootResource, nil)
+	case parts[0] == "principal" && len(parts) == 1:
+		return serveCollection(c, principalResource, nil)
+	case parts[0] == "lists" && len(parts) == 1:
+		return serveCollection(c, homeResource, listResources)
+	case parts[0] == "lists" && len(parts) <= 3:
+		listID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if len(parts) == 2 {
+			return serveList(c, listID)
+		}
+		name, err := url.PathUnescape(parts[2])
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		return serveItem(c, listID, name)
+	}
+	return c.SendStatus(fiber.StatusNotFound)
+}
+
+// resource is a WebDAV resource with the properties it has
+type resource struct {
+	href  string
+	props map[xml.Name]string
+}
+
+func rootResource(c *fiber.Ctx) (*resource, error) {
+	return &resource{href: root, props: map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:             "<d:collection/>",
+		{Space: nsDAV, Local: "displayname"}:              "Koffan",
+		{Space: nsDAV, Local: "current-user-principal"}:   href(principal),
+		{Space: nsCalDAV, Local: "calendar-home-set"}:     href(home),
+		{Space: nsDAV, Local: "principal-collection-set"}: href(principal),
+	}}, nil
+}
+
+func principalResource(c *fiber.Ctx) (*resource, error) {
+	r, _ := rootResource(c)
+	r.href = principal
+	r.props[xml.Name{Space: nsDAV, Local: "resourcetype"}] = "<d:collection/><d:principal/>"
+	r.props[xml.Name{Space: nsDAV, Local: "principal-URL"}] = href(principal)
+	r.props[xml.Name{Space: nsDAV, Local: "displayname"}] = escape(username(c))
+	return r, nil
+}
+
+func homeResource(c *fiber.Ctx) (*resource, error) {
+	r, _ := rootResource(c)
+	r.href = home
+	return r, nil
+}
+
+// listResources returns a collection resource for every list the user can see
+func listResources(c *fiber.Ctx) ([]*resource, error) {
+	lists, err := svc.TodoLists(handlers.CurrentUserID(c))
+	if err != nil {
+		return nil, err
+	}
+	var resources []*resource
+	for _, list := range lists {
+		id, _ := strconv.ParseInt(list.UID, 10, 64)
+		r, _, err := listResource(c, id)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
+
+// listResource returns the collection of a list with its items
+func listResource(c *fiber.Ctx, listID int64) (*resource, []service.CalDAVItem, error) {
+	userID := handlers.CurrentUserID(c)
+	items, err := svc.CalDAVItems(userID, listID)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, err := store.GetListByID(listID)
+	if err != nil {
+		return nil, nil, &service.Error{Kind: service.KindNotFound, Code: "not_found", Message: "List not found"}
+	}
+	role, err := svc.ListRole(userID, listID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The collection changes when any item, or the name of the list, does
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n", list.Name)
+	for _, item := range items {
+		fmt.Fprintf(sum, "%s %s\n", item.Resource, item.ETag())
+	}
+	ctag := `"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`
+
+	privileges := "<d:privilege><d:read/></d:privilege><d:privilege><d:read-current-user-privilege-set/></d:privilege>"
+	if db.RoleAtLeast(role, db.RoleEditor) {
+		privileges += "<d:privilege><d:write-content/></d:privilege><d:privilege><d:bind/></d:privilege><d:privilege><d:unbind/></d:privilege>"
+	}
+
+	return &resource{href: listHref(listID), props: map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                        "<d:collection/><c:calendar/>",
+		{Space: nsDAV, Local: "displayname"}:                         escape(list.Name),
+		{Space: nsDAV, Local: "getetag"}:                             escape(ctag),
+		{Space: nsCS, Local: "getctag"}:                              escape(ctag),
+		{Space: nsDAV, Local: "current-user-principal"}:              href(principal),
+		{Space: nsDAV, Local: "owner"}:                               href(principal),
+		{Space: nsDAV, Local: "current-user-privilege-set"}:          privileges,
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<c:comp name="VTODO"/>`,
+		{Space: nsDAV, Local: "supported-report-set"}: "<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>",
+	}}, items, nil
+}
+
+// itemResource returns the resource of an item; with data it includes the VTODO
+func itemResource(listID int64, item service.CalDAVItem) *resource {
+	return &resource{href: listHref(listID) + url.PathEscape(item.Resource), props: map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:     "",
+		{Space: nsDAV, Local: "getetag"}:          escape(item.ETag()),
+		{Space: nsDAV, Local: "getcontenttype"}:   "text/calendar; charset=utf-8; component=VTODO",
+		{Space: nsDAV, Local: "getlastmodified"}:  time.Unix(item.UpdatedAt, 0).UTC().Format(http.TimeFormat),
+		{Space: nsCalDAV, Local: "calendar-data"}: escape(formatTodo(item)),
+	}}
+}
+
+// serveCollection answers PROPFIND on a resource without items, listing the
+// children with Depth: 1
+func serveCollection(c *fiber.Ctx, self func(*fiber.Ctx) (*resource, error), children func(*fiber.Ctx) ([]*resource, error)) error {
+	if c.Method() != "PROPFIND" {
+		return methodNotAllowed(c)
+	}
+	props, err := requestedProps(c.Body())
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	r, err := self(c)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	resources := []*resource{r}
+	if children != nil && c.Get("Depth") == "1" {
+		more, err := children(c)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		resources = append(resources, more...)
+	}
+	return multistatus(c, resources, props)
+}
+
+// serveList answers PROPFIND and REPORT on the collection of a list
+func serveList(c *fiber.Ctx, listID int64) error {
+	switch c.Method() {
+	case "PROPFIND":
+		props, err := requestedProps(c.Body())
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		r, items, err := listResource(c, listID)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		resources := []*resource{r}
+		if c.Get("Depth") == "1" {
+			for _, item := range items {
+				resources = append(resources, itemResource(listID, item))
+			}
+		}
+		return multistatus(c, resources, withoutCalendarData(props))
+	case "REPORT":
+		return report(c, listID)
+	case "PROPPATCH", "MKCOL", "MKCALENDAR", fiber.MethodDelete, fiber.MethodPut:
+		return c.Status(fiber.StatusForbidden).SendString("Lists can't be changed over CalDAV")
+	}
+	return methodNotAllowed(c)
+}
+
+// serveItem answers requests on the VTODO of an item
+func serveItem(c *fiber.Ctx, listID int64, name string) error {
+	userID := handlers.CurrentUserID(c)
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead:
+		item, err := svc.CalDAVItem(userID, listID, name)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		c.Set(fiber.HeaderETag, item.ETag())
+		c.Set(fiber.HeaderLastModified, time.Unix(item.UpdatedAt, 0).UTC().Format(http.TimeFormat))
+		c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+		return c.SendString(formatTodo(*item))
+
+	case "PROPFIND":
+		props, err := requestedProps(c.Body())
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		item, err := svc.CalDAVItem(userID, listID, name)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		return multistatus(c, []*resource{itemResource(listID, *item)}, withoutCalendarData(props))
+
+	case fiber.MethodPut:
+		existing, err := svc.CalDAVItem(userID, listID, name)
+		if err != nil && service.AsError(err).Kind != service.KindNotFound {
+			return serviceError(c, err)
+		}
+		if !preconditionsMet(c, existing) {
+			return c.SendStatus(fiber.StatusPreconditionFailed)
+		}
+		todo, err := parseTodo(string(c.Body()))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		if existing != nil && todo.UID != "" && todo.UID != existing.UID {
+			return c.Status(fiber.StatusConflict).SendString("The UID of a VTODO can't change")
+		}
+		_, created, err := svc.PutCalDAVItem(userID, listID, name, todo)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		// No ETag: what is stored differs from what was sent, so clients fetch it again
+		if created {
+			return c.SendStatus(fiber.StatusCreated)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+
+	case fiber.MethodDelete:
+		existing, err := svc.CalDAVItem(userID, listID, name)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		if !preconditionsMet(c, existing) {
+			return c.SendStatus(fiber.StatusPreconditionFailed)
+		}
+		if err := svc.DeleteCalDAVItem(userID, listID, name); err != nil {
+			return serviceError(c, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	return methodNotAllowed(c)
+}
+
+// preconditionsMet checks If-Match and If-None-Match against an item, nil if
+// there is none
+func preconditionsMet(c *fiber.Ctx, existing *service.CalDAVItem) bool {
+	if match := c.Get(fiber.HeaderIfMatch); match != "" {
+		if existing == nil || (match != "*" && !etagListed(match, existing.ETag())) {
+			return false
+		}
+	}
+	if noneMatch := c.Get(fiber.HeaderIfNoneMatch); noneMatch != "" && existing != nil {
+		if noneMatch == "*" || etagListed(noneMatch, existing.ETag()) {
+			return false
+		}
+	}
+	return true
+}
+
+func etagListed(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func methodNotAllowed(c *fiber.Ctx) error {
+	return c.SendStatus(fiber.StatusMethodNotAllowed)
+}
+
+// serviceError answers with the status of a service error
+func serviceError(c *fiber.Ctx, err error) error {
+	e := service.AsError(err)
+	return c.Status(e.Status()).SendString(e.Message)
+}
+
+func listHref(listID int64) string {
+	return home + strconv.FormatInt(listID, 10) + "/"
+}
+
+func href(path string) string {
+	return "<d:href>" + escape(path) + "</d:href>"
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// username names the principal: the signed-in user, or "Koffan" for full access
+func username(c *fiber.Ctx) string {
+	if userID := handlers.CurrentUserID(c); userID != 0 {
+		if user, err := store.GetUserByID(userID); err == nil {
+			return user.Username
+		}
+	}
+	return "Koffan"
+}
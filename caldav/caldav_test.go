@@ -0,0 +1,292 @@
+package caldav
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"shopping-list/api"
+	"shopping-list/db"
+	"shopping-list/service"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// calDAVTest serves CalDAV from a memory store with a list Alice owns and
+// Bob may only view
+type calDAVTest struct {
+	t      *testing.T
+	app    *fiber.App
+	store  *db.MemoryStore
+	list   *db.List
+	bobKey string
+}
+
+func newCalDAVTest(t *testing.T) *calDAVTest {
+	t.Setenv("API_TOKEN", "full-access")
+	s := db.NewMemoryStore()
+	sv := service.New(s)
+	app := fiber.New(fiber.Config{
+		RequestMethods: append(append([]string{}, fiber.DefaultMethods...), Methods...),
+	})
+	api.Register(app, s, sv)
+	Register(app, s, sv)
+
+	alice := must(s.GetOrCreateUser("alice"))
+	bob := must(s.GetOrCreateUser("bob"))
+	list := must(s.CreateList("Groceries", "", alice.ID))
+	must(s.CreateSectionForList(list.ID, "Dairy"))
+	if err := s.SetListPrivate(list.ID, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetListMember(list.ID, bob.ID, db.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	token, hash, err := api.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	must(s.CreateAPIToken("bob's phone", hash, bob.ID))
+
+	return &calDAVTest{t: t, app: app, store: s, list: list, bobKey: token}
+}
+
+// do sends a request signed in as username with password, and returns the
+// status, headers and body of the response
+func (ct *calDAVTest) do(username, password, method, path, body string, header map[string]string) (int, map[string]string, string) {
+	ct.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := ct.app.Test(req, -1)
+	if err != nil {
+		ct.t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	headers := map[string]string{
+		"ETag":         resp.Header.Get("ETag"),
+		"Content-Type": resp.Header.Get("Content-Type"),
+	}
+	return resp.StatusCode, headers, string(data)
+}
+
+// asAlice sends a request with the full-access token acting as Alice
+func (ct *calDAVTest) asAlice(method, path, body string, header map[string]string) (int, map[string]string, string) {
+	ct.t.Helper()
+	return ct.do("alice", "full-access", method, path, body, header)
+}
+
+func (ct *calDAVTest) itemPath(name string) string {
+	return fmt.Sprintf("/caldav/lists/%d/%s", ct.list.ID, name)
+}
+
+func todo(uid, summary, extra string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VTODO\r\nUID:" + uid + "\r\nSUMMARY:" + summary + "\r\n" +
+		extra + "END:VTODO\r\nEND:VCALENDAR\r\n"
+}
+
+func TestAuthenticate(t *testing.T) {
+	ct := newCalDAVTest(t)
+	tests := []struct {
+		name, username, password string
+		want                     int
+	}{
+		{"a wrong token", "alice", "wrong", 401},
+		{"full access as an unknown user", "carol", "full-access", 403},
+		{"full access as a user", "alice", "full-access", 207},
+		{"a user's token", "", ct.bobKey, 207},
+	}
+	for _, tt := range tests {
+		status, _, _ := ct.do(tt.username, tt.password, "PROPFIND", "/caldav/lists/", "", map[string]string{"Depth": "0"})
+		if status != tt.want {
+			t.Errorf("%s: PROPFIND = %d, want %d", tt.name, status, tt.want)
+		}
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/caldav/", nil)
+	resp := must(ct.app.Test(req, -1))
+	if resp.StatusCode != 401 || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("PROPFIND without auth = %d, WWW-Authenticate %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+}
+
+func TestPropfindLists(t *testing.T) {
+	ct := newCalDAVTest(t)
+	other := must(ct.store.CreateList("Hardware", "", 0))
+
+	status, _, body := ct.asAlice("PROPFIND", "/caldav/lists/", "", map[string]string{"Depth": "1"})
+	if status != 207 {
+		t.Fatalf("PROPFIND = %d: %s", status, body)
+	}
+	for _, want := range []string{
+		"<d:href>/caldav/lists/</d:href>",
+		fmt.Sprintf("<d:href>/caldav/lists/%d/</d:href>", ct.list.ID),
+		fmt.Sprintf("<d:href>/caldav/lists/%d/</d:href>", other.ID),
+		"<d:displayname>Groceries</d:displayname>",
+		"<d:displayname>Hardware</d:displayname>",
+		`<c:comp name="VTODO"/>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the listing doesn't contain %s:\n%s", want, body)
+		}
+	}
+
+	// Depth 0 leaves the lists out, and Bob, who may only view Groceries, can't change it
+	if _, _, body := ct.asAlice("PROPFIND", "/caldav/lists/", "", map[string]string{"Depth": "0"}); strings.Contains(body, "Groceries") {
+		t.Errorf("PROPFIND with Depth 0 lists the lists:\n%s", body)
+	}
+	_, _, body = ct.do("", ct.bobKey, "PROPFIND", "/caldav/lists/", "", map[string]string{"Depth": "1"})
+	if !strings.Contains(body, "Groceries") || !strings.Contains(body, "Hardware") {
+		t.Errorf("Bob's listing:\n%s", body)
+	}
+	for _, response := range strings.Split(body, "</d:response>") {
+		if strings.Contains(response, "Groceries") && strings.Contains(response, "<d:write-content/>") {
+			t.Errorf("a viewer is offered write access:\n%s", response)
+		}
+	}
+}
+
+func TestTodoRoundTrip(t *testing.T) {
+	ct := newCalDAVTest(t)
+	path := ct.itemPath("milk.ics")
+
+	status, _, body := ct.asAlice("PUT", path, todo("milk-1", "Milk", "DESCRIPTION:2 l\\, organic\r\n"), map[string]string{"If-None-Match": "*"})
+	if status != 201 {
+		t.Fatalf("PUT a new VTODO = %d: %s", status, body)
+	}
+	items := must(ct.store.GetSectionsByList(ct.list.ID))[0].Items
+	if len(items) != 1 || items[0].Name != "Milk" || items[0].Description != "2 l, organic" || items[0].Completed {
+		t.Fatalf("items after PUT = %+v", items)
+	}
+
+	status, header, body := ct.asAlice("GET", path, "", nil)
+	if status != 200 || header["ETag"] == "" || !strings.HasPrefix(header["Content-Type"], "text/calendar") {
+		t.Fatalf("GET = %d %v", status, header)
+	}
+	for _, want := range []string{"UID:milk-1\r\n", "SUMMARY:Milk\r\n", "DESCRIPTION:2 l\\, organic\r\n", "STATUS:NEEDS-ACTION\r\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the VTODO doesn't contain %q:\n%s", want, body)
+		}
+	}
+	parsed, err := parseTodo(body)
+	if err != nil || parsed.UID != "milk-1" || parsed.Summary != "Milk" || parsed.Description != "2 l, organic" {
+		t.Errorf("parsed VTODO = %+v, %v", parsed, err)
+	}
+
+	// Completing it with the ETag from GET updates the same item
+	status, _, body = ct.asAlice("PUT", path, todo("milk-1", "Milk", "STATUS:COMPLETED\r\n"), map[string]string{"If-Match": header["ETag"]})
+	if status != 204 {
+		t.Fatalf("PUT with If-Match = %d: %s", status, body)
+	}
+	items = must(ct.store.GetSectionsByList(ct.list.ID))[0].Items
+	if len(items) != 1 || !items[0].Completed || items[0].Description != "" {
+		t.Errorf("items after the update = %+v", items)
+	}
+	if _, _, body := ct.asAlice("GET", path, "", nil); !strings.Contains(body, "STATUS:COMPLETED\r\n") {
+		t.Errorf("the completed VTODO:\n%s", body)
+	}
+
+	// The item shows up in the collection under its name
+	_, _, body = ct.asAlice("PROPFIND", fmt.Sprintf("/caldav/lists/%d/", ct.list.ID), "", map[string]string{"Depth": "1"})
+	if !strings.Contains(body, "<d:href>"+path+"</d:href>") {
+		t.Errorf("the collection doesn't list %s:\n%s", path, body)
+	}
+
+	if status, _, _ := ct.asAlice("PUT", path, todo("other", "Milk", ""), nil); status != 409 {
+		t.Errorf("PUT with another UID = %d, want 409", status)
+	}
+	if status, _, _ := ct.asAlice("DELETE", path, "", nil); status != 204 {
+		t.Errorf("DELETE = %d", status)
+	}
+	if status, _, _ := ct.asAlice("GET", path, "", nil); status != 404 {
+		t.Errorf("GET after DELETE = %d, want 404", status)
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	ct := newCalDAVTest(t)
+	path := ct.itemPath("bread.ics")
+	if status, _, _ := ct.asAlice("PUT", path, todo("bread-1", "Bread", ""), nil); status != 201 {
+		t.Fatalf("PUT = %d", status)
+	}
+	_, header, _ := ct.asAlice("GET", path, "", nil)
+	etag := header["ETag"]
+
+	tests := []struct {
+		name, method, path string
+		header             map[string]string
+		want               int
+	}{
+		{"PUT with a stale ETag", "PUT", path, map[string]string{"If-Match": `"0-0"`}, 412},
+		{"PUT of a new item with If-Match", "PUT", ct.itemPath("new.ics"), map[string]string{"If-Match": "*"}, 412},
+		{"PUT over an item with If-None-Match *", "PUT", path, map[string]string{"If-None-Match": "*"}, 412},
+		{"PUT with If-None-Match of the current ETag", "PUT", path, map[string]string{"If-None-Match": etag}, 412},
+		{"DELETE with a stale ETag", "DELETE", path, map[string]string{"If-Match": `"0-0", "1-1"`}, 412},
+		{"PUT with a weak current ETag", "PUT", path, map[string]string{"If-Match": `"0-0", W/` + etag}, 204},
+	}
+	for _, tt := range tests {
+		body := ""
+		if tt.method == "PUT" {
+			body = todo("bread-1", "Rye bread", "")
+		}
+		if status, _, _ := ct.asAlice(tt.method, tt.path, body, tt.header); status != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, status, tt.want)
+		}
+	}
+
+	items := must(ct.store.GetSectionsByList(ct.list.ID))[0].Items
+	if len(items) != 1 || items[0].Name != "Rye bread" {
+		t.Errorf("items = %+v", items)
+	}
+}
+
+func TestViewerAccess(t *testing.T) {
+	ct := newCalDAVTest(t)
+	path := ct.itemPath("eggs.ics")
+	if status, _, _ := ct.asAlice("PUT", path, todo("eggs-1", "Eggs", ""), nil); status != 201 {
+		t.Fatalf("PUT = %d", status)
+	}
+
+	bob := func(method, path, body string) int {
+		t.Helper()
+		status, _, _ := ct.do("", ct.bobKey, method, path, body, nil)
+		return status
+	}
+	if status := bob("GET", path, ""); status != 200 {
+		t.Errorf("GET as a viewer = %d", status)
+	}
+	if status := bob("PUT", path, todo("eggs-1", "Free range eggs", "")); status != 403 {
+		t.Errorf("PUT over an item as a viewer = %d, want 403", status)
+	}
+	if status := bob("PUT", ct.itemPath("tea.ics"), todo("tea-1", "Tea", "")); status != 403 {
+		t.Errorf("PUT of a new item as a viewer = %d, want 403", status)
+	}
+	if status := bob("DELETE", path, ""); status != 403 {
+		t.Errorf("DELETE as a viewer = %d, want 403", status)
+	}
+
+	items := must(ct.store.GetSectionsByList(ct.list.ID))[0].Items
+	if len(items) != 1 || items[0].Name != "Eggs" {
+		t.Errorf("a viewer changed the list: %+v", items)
+	}
+
+	// A list that is neither shared with Bob nor public is hidden from him
+	private := must(ct.store.CreateList("Alice's", "", must(ct.store.GetUserByUsername("alice")).ID))
+	if err := ct.store.SetListPrivate(private.ID, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if status := bob("PROPFIND", fmt.Sprintf("/caldav/lists/%d/", private.ID), ""); status != 403 && status != 404 {
+		t.Errorf("PROPFIND of a private list = %d", status)
+	}
+}
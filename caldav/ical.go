@@ -0,0 +1,161 @@
+package caldav
+
+import (
+	"errors"
+	"shopping-list/service"
+	"strings"
+	"time"
+)
+
+// icalTime is the UTC date-time format of iCalendar
+const icalTime = "20060102T150405Z"
+
+// errNoTodo rejects calendar data without a VTODO
+var errNoTodo = errors.New("the calendar data has no VTODO")
+
+// formatTodo renders an item as a VCALENDAR with one VTODO
+func formatTodo(item service.CalDAVItem) string {
+	updated := time.Unix(item.UpdatedAt, 0).UTC().Format(icalTime)
+
+	var b strings.Builder
+	line := func(name, value string) {
+		writeFolded(&b, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Koffan//Shopping List//EN")
+	line("BEGIN", "VTODO")
+	line("UID", escapeText(item.UID))
+	line("DTSTAMP", updated)
+	line("CREATED", item.CreatedAt.UTC().Format(icalTime))
+	line("LAST-MODIFIED", updated)
+	line("SUMMARY", escapeText(item.Name))
+	if item.Description != "" {
+		line("DESCRIPTION", escapeText(item.Description))
+	}
+	if item.Completed {
+		line("STATUS", "COMPLETED")
+		line("COMPLETED", updated)
+		line("PERCENT-COMPLETE", "100")
+	} else {
+		line("STATUS", "NEEDS-ACTION")
+	}
+	line("END", "VTODO")
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+// writeFolded writes a content line, folded after 75 octets as iCalendar
+// requires, without splitting UTF-8 sequences
+func writeFolded(b *strings.Builder, line string) {
+	for len(line) > 75 {
+		cut := 75
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+// parseTodo reads the first VTODO of calendar data. Properties Koffan has no
+// place for, like due dates or alarms, are ignored.
+func parseTodo(data string) (service.CalDAVTodo, error) {
+	var todo service.CalDAVTodo
+	inTodo, found := false, false
+	// nested counts components inside the VTODO, such as VALARM
+	nested := 0
+	status, completedAt := "", false
+
+	for _, line := range unfold(data) {
+		name, params, value := splitProperty(line)
+		switch {
+		case !inTodo:
+			if name == "BEGIN" && strings.EqualFold(value, "VTODO") && !found {
+				inTodo = true
+			}
+		case name == "BEGIN":
+			nested++
+		case name == "END" && nested > 0:
+			nested--
+		case name == "END":
+			inTodo, found = false, true
+		case nested > 0:
+		case name == "UID":
+			todo.UID = unescapeText(value)
+		case name == "SUMMARY":
+			todo.Summary = unescapeText(value)
+		case name == "DESCRIPTION" && !strings.Contains(strings.ToUpper(params), "ALTREP"):
+			todo.Description = unescapeText(value)
+		case name == "STATUS":
+			status = strings.ToUpper(value)
+		case name == "COMPLETED":
+			completedAt = value != ""
+		}
+	}
+	if !found {
+		return todo, errNoTodo
+	}
+	todo.Completed = status == "COMPLETED" || (status == "" && completedAt)
+	return todo, nil
+}
+
+// unfold splits calendar data into content lines, joining folded ones
+func unfold(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(data, "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, "\r"))
+		}
+	}
+	return lines
+}
+
+// splitProperty splits "NAME;PARAM=x:value" into its parts; the colon that
+// ends the name may not be inside a quoted parameter value
+func splitProperty(line string) (name, params, value string) {
+	quoted := false
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ':' && !quoted:
+			head := line[:i]
+			name, params, _ = strings.Cut(head, ";")
+			return strings.ToUpper(name), params, line[i+1:]
+		}
+	}
+	return strings.ToUpper(line), "", ""
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,223 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"shopping-list/handlers"
+	"shopping-list/service"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// prefixes are the namespace prefixes used in responses
+var prefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCS: "cs"}
+
+// propNames collects the names of the elements in a <prop>
+type propNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+func (p *propNames) list() []xml.Name {
+	names := make([]xml.Name, 0, len(p.Names))
+	for _, n := range p.Names {
+		names = append(names, n.XMLName)
+	}
+	return names
+}
+
+// requestedProps reads a PROPFIND body. Nil means all properties, as for an
+// empty body or <allprop/>.
+func requestedProps(body []byte) ([]xml.Name, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	var req struct {
+		XMLName xml.Name   `xml:"DAV: propfind"`
+		Prop    *propNames `xml:"DAV: prop"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	if req.Prop == nil {
+		return nil, nil
+	}
+	return req.Prop.list(), nil
+}
+
+// withoutCalendarData leaves calendar-data out of "all properties", since
+// PROPFIND doesn't return it
+func withoutCalendarData(props []xml.Name) []xml.Name {
+	if props != nil {
+		return props
+	}
+	return []xml.Name{
+		{Space: nsDAV, Local: "resourcetype"},
+		{Space: nsDAV, Local: "displayname"},
+		{Space: nsDAV, Local: "getetag"},
+		{Space: nsDAV, Local: "getcontenttype"},
+		{Space: nsDAV, Local: "getlastmodified"},
+		{Space: nsCS, Local: "getctag"},
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"},
+	}
+}
+
+// compFilter is a CalDAV comp-filter with the parts Koffan honors
+type compFilter struct {
+	Name        string       `xml:"name,attr"`
+	Comps       []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	PropFilters []struct {
+		Name         string    `xml:"name,attr"`
+		IsNotDefined *struct{} `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	} `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+}
+
+// report answers calendar-multiget and calendar-query on a list
+func report(c *fiber.Ctx, listID int64) error {
+	var req struct {
+		XMLName xml.Name
+		Prop    *propNames `xml:"DAV: prop"`
+		Hrefs   []string   `xml:"DAV: href"`
+		Filter  *struct {
+			Comp compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+		} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	}
+	if err := xml.Unmarshal(c.Body(), &req); err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	var props []xml.Name
+	if req.Prop != nil {
+		props = req.Prop.list()
+	}
+
+	items, err := svc.CalDAVItems(handlers.CurrentUserID(c), listID)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	var resources []*resource
+	switch {
+	case req.XMLName.Space == nsCalDAV && req.XMLName.Local == "calendar-multiget":
+		byHref := make(map[string]service.CalDAVItem, len(items))
+		for _, item := range items {
+			byHref[listHref(listID)+item.Resource] = item
+		}
+		var missing []string
+		for _, h := range req.Hrefs {
+			path := h
+			if u, err := url.Parse(h); err == nil {
+				path = u.Path
+			}
+			if unescaped, err := url.PathUnescape(path); err == nil {
+				path = unescaped
+			}
+			if item, ok := byHref[path]; ok {
+				resources = append(resources, itemResource(listID, item))
+			} else {
+				missing = append(missing, h)
+			}
+		}
+		return multistatusWithMissing(c, resources, props, missing)
+
+	case req.XMLName.Space == nsCalDAV && req.XMLName.Local == "calendar-query":
+		for _, item := range items {
+			if req.Filter == nil || matches(req.Filter.Comp, item) {
+				resources = append(resources, itemResource(listID, item))
+			}
+		}
+		return multistatus(c, resources, props)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	return c.Status(fiber.StatusForbidden).SendString(`<?xml version="1.0" encoding="utf-8"?>` +
+		`<d:error xmlns:d="DAV:"><d:supported-report/></d:error>`)
+}
+
+// matches applies a calendar-query filter to an item. Only the component
+// and an undefined COMPLETED are checked; time ranges match everything.
+func matches(filter compFilter, item service.CalDAVItem) bool {
+	if !strings.EqualFold(filter.Name, "VCALENDAR") {
+		return false
+	}
+	for _, comp := range filter.Comps {
+		if !strings.EqualFold(comp.Name, "VTODO") {
+			return false
+		}
+		for _, prop := range comp.PropFilters {
+			if strings.EqualFold(prop.Name, "COMPLETED") && prop.IsNotDefined != nil && item.Completed {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func multistatus(c *fiber.Ctx, resources []*resource, props []xml.Name) error {
+	return multistatusWithMissing(c, resources, props, nil)
+}
+
+// multistatusWithMissing writes a 207 response with the requested properties
+// of each resource, or all of them if props is nil, and a 404 for each href
+// in missing
+func multistatusWithMissing(c *fiber.Ctx, resources []*resource, props []xml.Name, missing []string) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	for _, r := range resources {
+		b.WriteString("<d:response>")
+		b.WriteString(href(r.href))
+
+		wanted := props
+		if wanted == nil {
+			for name := range r.props {
+				wanted = append(wanted, name)
+			}
+			sort.Slice(wanted, func(i, j int) bool { return wanted[i].Local < wanted[j].Local })
+		}
+		var found, notFound strings.Builder
+		for i, name := range wanted {
+			value, ok := r.props[name]
+			if !ok {
+				notFound.WriteString(emptyElement(name, i))
+				continue
+			}
+			tag := prefixes[name.Space] + ":" + name.Local
+			if value == "" {
+				found.WriteString("<" + tag + "/>")
+			} else {
+				found.WriteString("<" + tag + ">" + value + "</" + tag + ">")
+			}
+		}
+		if found.Len() > 0 {
+			b.WriteString("<d:propstat><d:prop>" + found.String() + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+		}
+		if notFound.Len() > 0 {
+			b.WriteString("<d:propstat><d:prop>" + notFound.String() + "</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	for _, h := range missing {
+		b.WriteString("<d:response>" + "<d:href>" + escape(h) + "</d:href>" + "<d:status>HTTP/1.1 404 Not Found</d:status></d:response>")
+	}
+	b.WriteString("</d:multistatus>")
+
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	return c.Status(fiber.StatusMultiStatus).SendString(b.String())
+}
+
+// emptyElement writes an empty element for a property, declaring its
+// namespace if it has no known prefix
+func emptyElement(name xml.Name, i int) string {
+	if prefix, ok := prefixes[name.Space]; ok {
+		return "<" + prefix + ":" + name.Local + "/>"
+	}
+	if name.Space == "" {
+		return "<" + name.Local + "/>"
+	}
+	prefix := "x" + string(rune('a'+i%26))
+	return "<" + prefix + ":" + name.Local + ` xmlns:` + prefix + `="` + escape(name.Space) + `"/>`
+}
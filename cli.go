@@ -0,0 +1,862 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"shopping-list/api"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/service"
+	"shopping-list/smtpd"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCommand runs a maintenance subcommand and returns the process exit code
+func runCommand(name string, args []string) int {
+	switch name {
+	case "reset-password":
+		return resetPasswordCommand(args)
+	case "link-oidc":
+		return linkOIDCCommand(args)
+	case "set-list-owner":
+		return setListOwnerCommand(args)
+	case "migrate":
+		return migrateCommand(args)
+	case "restore":
+		return restoreCommand(args)
+	case "export":
+		return exportCommand(args)
+	case "import":
+		return importCommand(args)
+	case "vacuum":
+		return vacuumCommand(args)
+	case "create-token":
+		return createTokenCommand(args)
+	case "list-tokens":
+		return listTokensCommand(args)
+	case "revoke-token":
+		return revokeTokenCommand(args)
+	case "create-hook":
+		return createHookCommand(args)
+	case "list-hooks":
+		return listHooksCommand(args)
+	case "revoke-hook":
+		return revokeHookCommand(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", name, usage)
+		return 2
+	}
+}
+
+const usage = `Usage:
+  shopping-list [serve]          start the server
+  shopping-list reset-password   set a new password for a user
+  shopping-list link-oidc        let a single sign-on subject log in as a user (-user <username>, -subject <sub>)
+  shopping-list set-list-owner   let a user delete a list and change who may see it (-list <list>, -user <username>)
+  shopping-list migrate status   list database migrations
+  shopping-list migrate up       apply pending database migrations
+  shopping-list restore          rebuild the database from REPLICA_DIR (-to <time>)
+  shopping-list export           write a backup of the database to stdout (-o <file>, -format json)
+  shopping-list import <file>    replace the database with a backup or import a JSON export ("-" reads stdin)
+  shopping-list vacuum           reclaim the space of deleted rows
+  shopping-list create-token     create an API token (-name <name>, -user <username>)
+  shopping-list list-tokens      list API tokens
+  shopping-list revoke-token     delete an API token (-name <name>)
+  shopping-list create-hook      create an add-item hook URL (-name <name>, -list <list>)
+  shopping-list list-hooks       list add-item hooks
+  shopping-list revoke-hook      delete an add-item hook (-name <name>)
+
+Run a command with -h to see its options.
+`
+
+// migrateCommand shows or applies schema migrations without starting the server
+func migrateCommand(args []string) int {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	db.Open()
+	defer db.Close()
+
+	if args[0] == "up" {
+		count, err := db.Migrate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			if count > 0 {
+				fmt.Fprintf(os.Stderr, "%d migration(s) were applied before the failure\n", count)
+			}
+			return 1
+		}
+		if count == 0 {
+			fmt.Println("Database is up to date")
+		} else {
+			fmt.Printf("Applied %d migration(s)\n", count)
+		}
+		return 0
+	}
+
+	states, err := db.GetMigrationStatus()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read migrations: %v\n", err)
+		return 1
+	}
+	pending := 0
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			pending++
+			fmt.Printf("%4d  pending                %s\n", s.Version, s.Name)
+		} else {
+			fmt.Printf("%4d  %s  %s\n", s.Version, s.AppliedAt.Format("2006-01-02 15:04:05"), s.Name)
+		}
+	}
+	fmt.Printf("\n%d applied, %d pending\n", len(states)-pending, pending)
+	if _, err := db.PendingMigrations(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// restoreCommand rebuilds the SQLite database from the replica as of a point in time.
+// The server must be stopped; the rebuilt file replaces the database only with -force.
+func restoreCommand(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	to := fs.String("to", "", "restore as of this time (RFC 3339 or \"2006-01-02 15:04:05\" local time; default latest)")
+	from := fs.String("from", db.ReplicaDir(), "replica directory")
+	out := fs.String("o", db.SQLitePath(), "database file to write")
+	force := fs.Bool("force", false, "replace the database file if it exists")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *from == "" {
+		fmt.Fprintln(os.Stderr, "No replica directory: set REPLICA_DIR or use -from")
+		return 2
+	}
+
+	target := time.Now()
+	if *to != "" {
+		var err error
+		target, err = parseRestoreTime(*to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -to time %q: use RFC 3339 or \"2006-01-02 15:04:05\"\n", *to)
+			return 2
+		}
+	}
+
+	if _, err := os.Stat(*out); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "%s exists; stop the server and add -force to replace it\n", *out)
+		return 1
+	}
+
+	// Rebuild next to the database, so it is only replaced once the restore succeeded
+	restored := *out + ".restored"
+	os.Remove(restored)
+	restoredTo, err := db.RestoreReplica(*from, target, restored)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Restore failed: %v\n", err)
+		return 1
+	}
+
+	// A leftover WAL would be applied on top of the restored database
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(*out + suffix); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", *out+suffix, err)
+			return 1
+		}
+	}
+	if err := os.Rename(restored, *out); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to replace %s: %v\n", *out, err)
+		return 1
+	}
+	fmt.Printf("Restored %s as of %s\n", *out, restoredTo.Local().Format("2006-01-02 15:04:05"))
+	return 0
+}
+
+func parseRestoreTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+}
+
+// resetPasswordCommand sets a new password when the old one is forgotten.
+// Without -password a random one is generated and printed.
+func resetPasswordCommand(args []string) int {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	username := fs.String("user", handlers.DefaultUsername, "user whose password to reset")
+	password := fs.String("password", "", "new password (generated if empty)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	handlers.SetStore(db.Init())
+	defer db.Close()
+
+	generated := *password == ""
+	if generated {
+		*password = randomPassword(16)
+	}
+
+	if err := handlers.ResetPassword(*username, *password); err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Fprintf(os.Stderr, "User %q not found\n", *username)
+		} else {
+			fmt.Fprintf(os.Stderr, "Failed to reset password: %v\n", err)
+		}
+		return 1
+	}
+
+	if generated {
+		fmt.Printf("New password for %s: %s\n", *username, *password)
+	} else {
+		fmt.Printf("Password for %s changed\n", *username)
+	}
+	fmt.Println("All devices of this user have been logged out.")
+	return 0
+}
+
+// linkOIDCCommand links a subject of the OIDC_ISSUER provider to an existing
+// user, which single sign-on only does by itself for verified email addresses
+func linkOIDCCommand(args []string) int {
+	fs := flag.NewFlagSet("link-oidc", flag.ContinueOnError)
+	username := fs.String("user", "", "user to log in as (required)")
+	subject := fs.String("subject", "", "the provider's sub claim for the account (required)")
+	issuer := fs.String("issuer", os.Getenv("OIDC_ISSUER"), "issuer URL of the provider")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	*issuer = strings.TrimSuffix(strings.TrimSpace(*issuer), "/")
+	if *username == "" || strings.TrimSpace(*subject) == "" || *issuer == "" {
+		fmt.Fprintln(os.Stderr, "link-oidc needs -user, -subject and OIDC_ISSUER or -issuer")
+		return 2
+	}
+
+	store := db.Init()
+	defer db.Close()
+
+	user, err := store.GetUserByUsername(*username)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "User %q not found\n", *username)
+		return 1
+	}
+	if err := store.LinkUserIdentity(*issuer, strings.TrimSpace(*subject), user.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to link subject: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Subject %s of %s now logs in as %s\n", strings.TrimSpace(*subject), *issuer, user.Username)
+	return 0
+}
+
+// setListOwnerCommand gives a list an owner, such as a list from before
+// user accounts, which nobody owns
+func setListOwnerCommand(args []string) int {
+	fs := flag.NewFlagSet("set-list-owner", flag.ContinueOnError)
+	listName := fs.String("list", "", "name or ID of the list (required)")
+	username := fs.String("user", "", "the new owner (required)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if strings.TrimSpace(*listName) == "" || *username == "" {
+		fmt.Fprintln(os.Stderr, "set-list-owner needs -list and -user")
+		return 2
+	}
+
+	store := db.Init()
+	defer db.Close()
+
+	lists, err := store.GetAllLists(0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read lists: %v\n", err)
+		return 1
+	}
+	var listID int64
+	for _, l := range lists {
+		if strings.EqualFold(l.Name, *listName) || strconv.FormatInt(l.ID, 10) == *listName {
+			listID = l.ID
+			break
+		}
+	}
+	if listID == 0 {
+		fmt.Fprintf(os.Stderr, "List %q not found\n", *listName)
+		return 1
+	}
+
+	list, err := service.New(store).SetListOwner(0, listID, *username)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set the owner: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s now owns %s\n", *username, list.Name)
+	return 0
+}
+
+func randomPassword(length int) string {
+	const alphabet = "abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			panic(err)
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b)
+}
+
+// exportCommand writes a consistent backup of the SQLite database, which is
+// safe while the server keeps running
+func exportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("o", "", "file to write (default stdout)")
+	format := fs.String("format", "db", "db (SQLite backup) or json (any database)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format == "json" {
+		return exportJSON(*out)
+	}
+	if *format != "db" {
+		fmt.Fprintf(os.Stderr, "Unknown -format %q: use db or json\n", *format)
+		return 2
+	}
+	if *out == "" && isTerminal(os.Stdout) {
+		fmt.Fprintln(os.Stderr, "Refusing to write a database to the terminal; redirect stdout or use -o")
+		return 2
+	}
+
+	db.Open()
+	defer db.Close()
+
+	dir, err := os.MkdirTemp("", "koffan-export-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	if err := db.BackupTo(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	if *out == "" {
+		_, err = io.Copy(os.Stdout, f)
+	} else {
+		// Never leave a half-written file under the requested name
+		err = writeFileAtomic(*out, f)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	if *out != "" {
+		fmt.Printf("Database exported to %s\n", *out)
+	}
+	return 0
+}
+
+// exportJSON writes all data in the JSON export format
+func exportJSON(out string) int {
+	store := db.Init()
+	defer db.Close()
+
+	export, err := service.New(store).Export(0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	data = append(data, '\n')
+
+	if out == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = writeFileAtomic(out, bytes.NewReader(data))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	if out != "" {
+		fmt.Printf("Data exported to %s\n", out)
+	}
+	return 0
+}
+
+// importCommand replaces the contents of the database with a backup made by
+// export or the backup endpoint. The current database is saved to BACKUP_DIR
+// first, if it is set. Connected clients keep their page until they reload.
+// JSON exports are imported with -mode merge or replace instead.
+func importCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	mode := fs.String("mode", service.ImportMerge, "for JSON exports: merge or replace")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: shopping-list import [-mode merge|replace] <file>  (\"-\" reads stdin)")
+		return 2
+	}
+
+	path := fs.Arg(0)
+	if path == "-" {
+		dir, err := os.MkdirTemp("", "koffan-import-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		path = filepath.Join(dir, "upload.db")
+		if err := writeFileAtomic(path, os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Reading stdin failed: %v\n", err)
+			return 1
+		}
+	}
+
+	if isJSONFile(path) {
+		return importJSON(path, *mode)
+	}
+
+	if err := db.ValidateBackup(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid backup: %v\n", err)
+		return 1
+	}
+
+	db.Open()
+	defer db.Close()
+
+	if !db.BackupSupported() {
+		fmt.Fprintln(os.Stderr, db.ErrBackupUnsupported)
+		return 1
+	}
+	if backupDir := db.BackupDir(); backupDir != "" {
+		saved, err := db.Snapshot(backupDir, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save the current database: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Saved the current database to %s\n", saved)
+	}
+
+	if err := db.Restore(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	fmt.Println("Database imported")
+	return 0
+}
+
+// vacuumCommand compacts the database after many deletions
+func vacuumCommand(args []string) int {
+	fs := flag.NewFlagSet("vacuum", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	db.Open()
+	defer db.Close()
+
+	sqlite := db.CurrentBackend() == db.SQLite
+	before := databaseSize()
+	if err := db.Vacuum(); err != nil {
+		fmt.Fprintf(os.Stderr, "Vacuum failed: %v\n", err)
+		return 1
+	}
+	if sqlite {
+		fmt.Printf("Database vacuumed: %s -> %s\n", formatSize(before), formatSize(databaseSize()))
+	} else {
+		fmt.Println("Database vacuumed")
+	}
+	return 0
+}
+
+// databaseSize returns the size of the SQLite database file and its WAL
+func databaseSize() int64 {
+	var size int64
+	for _, suffix := range []string{"", "-wal"} {
+		if info, err := os.Stat(db.SQLitePath() + suffix); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// createTokenCommand creates an API token and prints it once; only its hash is stored.
+// With -user the token acts as that user, otherwise it has full access like API_TOKEN.
+func createTokenCommand(args []string) int {
+	fs := flag.NewFlagSet("create-token", flag.ContinueOnError)
+	name := fs.String("name", "", "name to recognize the token by (required)")
+	username := fs.String("user", "", "user the token acts as (default: full access)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "A token needs a -name")
+		return 2
+	}
+
+	store := db.Init()
+	defer db.Close()
+
+	var userID int64
+	if *username != "" {
+		user, err := store.GetUserByUsername(*username)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "User %q not found\n", *username)
+			return 1
+		}
+		userID = user.ID
+	}
+
+	tokens, err := store.GetAPITokens()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read tokens: %v\n", err)
+		return 1
+	}
+	for _, t := range tokens {
+		if strings.EqualFold(t.Name, *name) {
+			fmt.Fprintf(os.Stderr, "A token named %q already exists\n", t.Name)
+			return 1
+		}
+	}
+
+	token, hash, err := api.NewToken()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate token: %v\n", err)
+		return 1
+	}
+	if _, err := store.CreateAPIToken(*name, hash, userID); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create token: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(token)
+	fmt.Fprintln(os.Stderr, "Store this token now; it cannot be shown again.")
+	if len(tokens) == 0 && api.GetAPIToken() == "" {
+		fmt.Fprintln(os.Stderr, "Restart the server to enable the REST API.")
+	}
+	return 0
+}
+
+// listTokensCommand prints the API tokens without their secrets
+func listTokensCommand(args []string) int {
+	fs := flag.NewFlagSet("list-tokens", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	store := db.Init()
+	defer db.Close()
+
+	tokens, err := store.GetAPITokens()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read tokens: %v\n", err)
+		return 1
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No API tokens")
+		return 0
+	}
+	for _, t := range tokens {
+		access := "full access"
+		if t.UserID != 0 {
+			access = "user " + t.Username
+		}
+		lastUsed := "never used"
+		if t.LastUsedAt != 0 {
+			lastUsed = "last used " + time.Unix(t.LastUsedAt, 0).Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%-20s  %-20s  created %s, %s\n", t.Name, access,
+			time.Unix(t.CreatedAt, 0).Format("2006-01-02 15:04"), lastUsed)
+	}
+	return 0
+}
+
+// revokeTokenCommand deletes an API token; requests with it fail immediately
+func revokeTokenCommand(args []string) int {
+	fs := flag.NewFlagSet("revoke-token", flag.ContinueOnError)
+	name := fs.String("name", "", "name of the token to revoke (required)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "Which token? Use -name; list-tokens shows the names")
+		return 2
+	}
+
+	store := db.Init()
+	defer db.Close()
+
+	if err := store.DeleteAPIToken(*name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Fprintf(os.Stderr, "Token %q not found\n", *name)
+		} else {
+			fmt.Fprintf(os.Stderr, "Failed to revoke token: %v\n", err)
+		}
+		return 1
+	}
+	fmt.Printf("Token %s revoked\n", *name)
+	return 0
+}
+
+// createHookCommand creates an inbound hook and prints its token once
+func createHookCommand(args []string) int {
+	fs := flag.NewFlagSet("create-hook", flag.ContinueOnError)
+	name := fs.String("name", "", "name to recognize the hook by (required)")
+	listName := fs.String("list", "", "name or ID of the list items are added to (required)")
+	sectionName := fs.String("section", "", "section items are always added to (default: where they were last added)")
+	allowGet := fs.Bool("get", false, "also accept GET requests, e.g. for NFC tags or bookmarks")
+	baseURL := fs.String("url", "", "address of the server, to print the full hook URL")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if strings.TrimSpace(*name) == "" || strings.TrimSpace(*listName) == "" {
+		fmt.Fprintln(os.Stderr, "A hook needs a -name and a -list")
+		return 2
+	}
+
+	store := db.Init()
+	defer db.Close()
+
+	lists, err := store.GetAllLists(0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read lists: %v\n", err)
+		return 1
+	}
+	var list *db.List
+	for i := range lists {
+		if strings.EqualFold(lists[i].Name, *listName) || strconv.FormatInt(lists[i].ID, 10) == *listName {
+			list = &lists[i]
+			break
+		}
+	}
+	if list == nil {
+		fmt.Fprintf(os.Stderr, "List %q not found\n", *listName)
+		return 1
+	}
+
+	var sectionID int64
+	if *sectionName != "" {
+		sections, err := store.GetSectionsByList(list.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read sections: %v\n", err)
+			return 1
+		}
+		for _, section := range sections {
+			if strings.EqualFold(section.Name, *sectionName) {
+				sectionID = section.ID
+				break
+			}
+		}
+		if sectionID == 0 {
+			fmt.Fprintf(os.Stderr, "Section %q not found in %s\n", *sectionName, list.Name)
+			return 1
+		}
+	}
+
+	hook, token, err := service.New(store).CreateInboundHook(0, service.NewInboundHook{
+		Name:      *name,
+		ListID:    list.ID,
+		SectionID: sectionID,
+		AllowGet:  *allowGet,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create hook: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%s/hook/%s/add\n", strings.TrimRight(*baseURL, "/"), token)
+	if email := smtpd.Address(hook); email != "" {
+		fmt.Println(email)
+	}
+	fmt.Fprintln(os.Stderr, "Store this URL now; it cannot be shown again.")
+	return 0
+}
+
+// listHooksCommand prints the inbound hooks without their tokens
+func listHooksCommand(args []string) int {
+	fs := flag.NewFlagSet("list-hooks", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	store := db.Init()
+	defer db.Close()
+
+	hooks, err := service.New(store).InboundHooks(0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read hooks: %v\n", err)
+		return 1
+	}
+	if len(hooks) == 0 {
+		fmt.Println("No add-item hooks")
+		return 0
+	}
+	for _, h := range hooks {
+		target := h.ListName
+		if h.SectionName != "" {
+			target += " / " + h.SectionName
+		}
+		if h.AllowGet {
+			target += " (GET allowed)"
+		}
+		lastUsed := "never used"
+		if h.LastUsedAt != 0 {
+			lastUsed = "last used " + time.Unix(h.LastUsedAt, 0).Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%-20s  %-30s  created %s, %s\n", h.Name, target,
+			time.Unix(h.CreatedAt, 0).Format("2006-01-02 15:04"), lastUsed)
+		if email := smtpd.Address(&h); email != "" {
+			fmt.Printf("%-20s  %s\n", "", email)
+		}
+	}
+	return 0
+}
+
+// revokeHookCommand deletes an inbound hook; its URL stops working immediately
+func revokeHookCommand(args []string) int {
+	fs := flag.NewFlagSet("revoke-hook", flag.ContinueOnError)
+	name := fs.String("name", "", "name of the hook to revoke (required)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "Which hook? Use -name; list-hooks shows the names")
+		return 2
+	}
+
+	store := db.Init()
+	defer db.Close()
+
+	svc := service.New(store)
+	hooks, err := svc.InboundHooks(0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read hooks: %v\n", err)
+		return 1
+	}
+	for _, h := range hooks {
+		if strings.EqualFold(h.Name, *name) {
+			if err := svc.DeleteInboundHook(0, h.ID); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to revoke hook: %v\n", err)
+				return 1
+			}
+			fmt.Printf("Hook %s revoked\n", h.Name)
+			return 0
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Hook %q not found\n", *name)
+	return 1
+}
+
+// importJSON imports a JSON export through the service, in one transaction
+func importJSON(path, mode string) int {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	var data service.Export
+	if err := json.Unmarshal(raw, &data); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid JSON export: %v\n", err)
+		return 1
+	}
+
+	store := db.Init()
+	defer db.Close()
+
+	result, err := service.New(store).Import(0, &data, mode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %s\n", service.AsError(err).Message)
+		return 1
+	}
+	fmt.Printf("Imported %d lists, %d sections, %d items, %d templates and %d history entries (%s)\n",
+		result.Lists, result.Sections, result.Items, result.Templates, result.History, result.Mode)
+	if len(result.RemovedWebhooks) > 0 {
+		fmt.Printf("Removed the webhooks of the replaced lists: %s\n", strings.Join(result.RemovedWebhooks, ", "))
+	}
+	if len(result.RemovedInboundHooks) > 0 {
+		fmt.Printf("Removed the inbound hooks of the replaced lists: %s\n", strings.Join(result.RemovedInboundHooks, ", "))
+	}
+	return 0
+}
+
+// isJSONFile reports whether the file starts like a JSON document rather than a database
+func isJSONFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	b := make([]byte, 64)
+	n, _ := f.Read(b)
+	return strings.HasPrefix(strings.TrimSpace(string(b[:n])), "{")
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// writeFileAtomic writes r to dst through a temporary file next to dst
+func writeFileAtomic(dst string, r io.Reader) error {
+	tmp := dst + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
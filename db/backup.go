@@ -0,0 +1,244 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBackupUnsupported is returned by backup and restore on other backends than SQLite
+var ErrBackupUnsupported = errors.New("backup and restore are only supported with SQLite")
+
+// snapshotPrefix and snapshotExt name the files written by Snapshot
+const (
+	snapshotPrefix = "koffan-"
+	snapshotExt    = ".db"
+)
+
+// BackupSupported reports whether the database can be backed up and restored
+func BackupSupported() bool {
+	return backend == SQLite && DB != nil
+}
+
+// BackupTo writes a consistent copy of the database to path, which must not exist yet.
+// It uses VACUUM INTO, so it is safe while the app keeps writing in WAL mode.
+func BackupTo(path string) error {
+	if !BackupSupported() {
+		return ErrBackupUnsupported
+	}
+	_, err := DB.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// ValidateBackup checks that path is an intact Koffan database this version can open
+func ValidateBackup(path string) error {
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var result string
+	if err := src.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("not a valid SQLite database: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	var sections, migrations int
+	err = src.QueryRow(`SELECT
+		COUNT(CASE WHEN name = 'sections' THEN 1 END),
+		COUNT(CASE WHEN name = 'schema_migrations' THEN 1 END)
+		FROM sqlite_master WHERE type = 'table'`).Scan(&sections, &migrations)
+	if err != nil {
+		return fmt.Errorf("reading the tables of the backup: %w", err)
+	}
+	if sections == 0 {
+		return errors.New("not a Koffan database")
+	}
+
+	// Databases older than schema_migrations are adopted by Migrate
+	var version int
+	if migrations > 0 {
+		if err := src.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+			return fmt.Errorf("reading the schema version of the backup: %w", err)
+		}
+	}
+	if latest := sqliteMigrations[len(sqliteMigrations)-1].Version; version > latest {
+		return fmt.Errorf("backup is from a newer version (schema %d, this version knows %d)", version, latest)
+	}
+	return nil
+}
+
+// Restore replaces the contents of the live database with the backup at path.
+// The backup is validated first, copied in with SQLite's backup API, so open
+// connections stay usable, and then migrated to the current schema.
+func Restore(path string) error {
+	if !BackupSupported() {
+		return ErrBackupUnsupported
+	}
+	if err := ValidateBackup(path); err != nil {
+		return err
+	}
+
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	ctx := context.Background()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	destConn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	err = copyDatabase(destConn, srcConn)
+	if err != nil {
+		return fmt.Errorf("copying backup: %w", err)
+	}
+
+	if _, err := DB.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		log.Println("Warning: Could not enable WAL mode after restore:", err)
+	}
+	if _, err := Migrate(); err != nil {
+		return fmt.Errorf("migrating restored database: %w", err)
+	}
+	return nil
+}
+
+// Vacuum rebuilds the database to reclaim the space of deleted rows.
+// On SQLite the WAL is checkpointed afterwards so the file shrinks, unless
+// REPLICA_DIR is set, in which case the replicator checkpoints once it shipped the frames.
+func Vacuum() error {
+	if _, err := DB.Exec("VACUUM"); err != nil {
+		return err
+	}
+	if backend == SQLite && ReplicaDir() == "" {
+		if _, err := DB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return fmt.Errorf("checkpointing after vacuum: %w", err)
+		}
+	}
+	return nil
+}
+
+// Snapshot writes a timestamped backup into dir and deletes the oldest
+// snapshots beyond keep (keep <= 0 keeps all). Returns the new file's path.
+func Snapshot(dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	// Nanoseconds keep snapshots taken within the same second apart, e.g. a
+	// scheduled one and the one saved before a restore
+	name := snapshotPrefix + time.Now().UTC().Format("20060102-150405.000000000") + snapshotExt
+	path := filepath.Join(dir, name)
+	// Write under a temporary name so a half-written file is never taken for a snapshot
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := BackupTo(tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	if keep > 0 {
+		pruneSnapshots(dir, keep)
+	}
+	return path, nil
+}
+
+// pruneSnapshots deletes all but the newest keep snapshots in dir
+func pruneSnapshots(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Failed to list backups in %s: %v", dir, err)
+		return
+	}
+
+	var snapshots []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), snapshotPrefix) && strings.HasSuffix(e.Name(), snapshotExt) {
+			snapshots = append(snapshots, e.Name())
+		}
+	}
+	// Timestamped names sort oldest first
+	sort.Strings(snapshots)
+
+	for i := 0; i < len(snapshots)-keep; i++ {
+		if err := os.Remove(filepath.Join(dir, snapshots[i])); err != nil {
+			log.Printf("Failed to remove old backup %s: %v", snapshots[i], err)
+		}
+	}
+}
+
+// BackupDir returns the directory for scheduled snapshots (BACKUP_DIR), empty if disabled
+func BackupDir() string {
+	return strings.TrimSpace(os.Getenv("BACKUP_DIR"))
+}
+
+// BackupKeep returns how many snapshots to keep (BACKUP_KEEP, default 7)
+func BackupKeep() int {
+	return envInt("BACKUP_KEEP", 7)
+}
+
+// StartScheduledBackups writes a snapshot to BACKUP_DIR every
+// BACKUP_INTERVAL_HOURS (default 24) and keeps the newest BACKUP_KEEP.
+// It does nothing if BACKUP_DIR is not set.
+func StartScheduledBackups() {
+	dir := BackupDir()
+	if dir == "" {
+		return
+	}
+	if !BackupSupported() {
+		log.Println("Warning: BACKUP_DIR is ignored; scheduled backups need SQLite")
+		return
+	}
+
+	interval := time.Duration(envInt("BACKUP_INTERVAL_HOURS", 24)) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	keep := BackupKeep()
+	log.Printf("Scheduled backups enabled: every %s to %s, keeping %d", interval, dir, keep)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if path, err := Snapshot(dir, keep); err != nil {
+				log.Printf("Scheduled backup failed: %v", err)
+			} else {
+				log.Printf("Scheduled backup written to %s", path)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func envInt(key string, defaultVal int) int {
+	val, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newSQLiteFile creates a SQLite database at path with the statements
+func newSQLiteFile(t *testing.T, path string, stmts ...string) {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, stmt := range stmts {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	s := openSQLiteTestStore(t)
+	must(s.CreateList("Before", "", 0))
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := BackupTo(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateBackup(path); err != nil {
+		t.Fatalf("validating a fresh backup: %v", err)
+	}
+	// The target must not exist yet
+	if err := BackupTo(path); err == nil {
+		t.Error("backup overwrote an existing file")
+	}
+
+	must(s.CreateList("After", "", 0))
+	if err := Restore(path); err != nil {
+		t.Fatal(err)
+	}
+	names := listNames(must(s.GetAllLists(0)))
+	if !equalStrings(names, []string{"Lista zakupów", "Before"}) {
+		t.Errorf("lists after the restore = %q", names)
+	}
+
+	// The restored database is usable as before
+	must(s.CreateList("Later", "", 0))
+	if n := len(must(s.GetAllLists(0))); n != 3 {
+		t.Errorf("%d lists after adding one to the restored database", n)
+	}
+}
+
+func TestValidateBackupRejects(t *testing.T) {
+	openSQLiteTestStore(t)
+	dir := t.TempDir()
+	latest := sqliteMigrations[len(sqliteMigrations)-1].Version
+
+	valid := filepath.Join(dir, "valid.db")
+	if err := BackupTo(valid); err != nil {
+		t.Fatal(err)
+	}
+	newer := filepath.Join(dir, "newer.db")
+	if err := BackupTo(newer); err != nil {
+		t.Fatal(err)
+	}
+	newSQLiteFile(t, newer, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'from the future', 0)")
+
+	other := filepath.Join(dir, "other.db")
+	newSQLiteFile(t, other, "CREATE TABLE notes (id INTEGER PRIMARY KEY, text TEXT)")
+
+	broken := filepath.Join(dir, "broken.db")
+	newSQLiteFile(t, broken, "CREATE TABLE sections (id INTEGER PRIMARY KEY)", "CREATE TABLE schema_migrations (id INTEGER)")
+
+	text := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(text, []byte(strings.Repeat("milk, eggs\n", 500)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, path, want string
+	}{
+		{"a file that isn't a database", text, "not a valid SQLite database"},
+		{"another app's database", other, "not a Koffan database"},
+		{"a database with a broken schema_migrations table", broken, "schema version"},
+		{"a backup of a newer version", newer, "newer version"},
+		{"a missing file", filepath.Join(dir, "missing.db"), ""},
+	}
+	for _, tt := range tests {
+		err := ValidateBackup(tt.path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("validating %s = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Databases from before schema_migrations are migrated on restore
+	legacy := filepath.Join(dir, "legacy.db")
+	newSQLiteFile(t, legacy, "CREATE TABLE sections (id INTEGER PRIMARY KEY, name TEXT)")
+	if err := ValidateBackup(legacy); err != nil {
+		t.Errorf("validating a database without schema_migrations: %v", err)
+	}
+	if err := ValidateBackup(valid); err != nil {
+		t.Errorf("validating a backup of schema %d: %v", latest, err)
+	}
+
+	// A rejected file leaves the database alone
+	s := NewSQLStore(DB, SQLite)
+	must(s.CreateList("Kept", "", 0))
+	if err := Restore(newer); err == nil {
+		t.Fatal("restored a backup of a newer version")
+	}
+	if names := listNames(must(s.GetAllLists(0))); len(names) != 2 || names[1] != "Kept" {
+		t.Errorf("lists after a rejected restore = %q", names)
+	}
+}
+
+func TestSnapshotKeepsNewest(t *testing.T) {
+	openSQLiteTestStore(t)
+	dir := t.TempDir()
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path, err := Snapshot(dir, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	entries := must(os.ReadDir(dir))
+	if len(entries) != 2 || entries[0].Name() != filepath.Base(paths[1]) || entries[1].Name() != filepath.Base(paths[2]) {
+		t.Errorf("snapshots left = %v", entries)
+	}
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Backend names the database engine behind DB
+type Backend string
+
+const (
+	SQLite   Backend = "sqlite"
+	Postgres Backend = "postgres"
+)
+
+// backend is chosen in Open from DATABASE_URL
+var backend = SQLite
+
+// CurrentBackend returns the engine the app is connected to
+func CurrentBackend() Backend {
+	return backend
+}
+
+// nocase compares a column case-insensitively.
+// SQLite uses the NOCASE collation so its indexes apply; PostgreSQL has lower() indexes.
+func (st *SQLStore) nocase(column string) string {
+	if st.backend == Postgres {
+		return "lower(" + column + ")"
+	}
+	return column + " COLLATE NOCASE"
+}
+
+// nocaseEquals is a case-insensitive "column = ?"
+func (st *SQLStore) nocaseEquals(column string) string {
+	if st.backend == Postgres {
+		return "lower(" + column + ") = lower(?)"
+	}
+	return column + " = ? COLLATE NOCASE"
+}
+
+// ==================== POSTGRESQL ====================
+
+// openPostgres connects with a driver that accepts SQLite-style ? placeholders,
+// so the queries in this package run unchanged on both backends
+func openPostgres(url string) (*sql.DB, error) {
+	connector, err := pq.NewConnector(url)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(rebindConnector{connector}), nil
+}
+
+type rebindConnector struct {
+	driver.Connector
+}
+
+func (c rebindConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rebindConn{conn}, nil
+}
+
+// rebindConn rewrites the placeholders of every statement before handing it to lib/pq
+type rebindConn struct {
+	driver.Conn
+}
+
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return execer.ExecContext(ctx, rebind(query), args)
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return queryer.QueryContext(ctx, rebind(query), args)
+}
+
+func (c rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c rebindConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// IsValid lets database/sql drop connections lib/pq marked as broken
+// instead of handing them out again
+func (c rebindConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// ResetSession runs before a pooled connection is reused, so a connection
+// that failed meanwhile is discarded
+func (c rebindConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// rebind turns ? placeholders into $1, $2, ... outside of quoted strings
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := map[string]string{
+		"SELECT 1":                                   "SELECT 1",
+		"SELECT * FROM items WHERE id = ?":           "SELECT * FROM items WHERE id = $1",
+		"UPDATE items SET name = ? WHERE id = ?":     "UPDATE items SET name = $1 WHERE id = $2",
+		"SELECT '?' || name FROM lists WHERE id = ?": "SELECT '?' || name FROM lists WHERE id = $1",
+		`SELECT "a?b" FROM t WHERE x = ? AND y = ?`:  `SELECT "a?b" FROM t WHERE x = $1 AND y = $2`,
+	}
+	for query, want := range tests {
+		if got := rebind(query); got != want {
+			t.Errorf("rebind(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+// fakeConn reports the state lib/pq keeps about a connection
+type fakeConn struct {
+	driver.Conn
+	bad bool
+}
+
+func (c *fakeConn) IsValid() bool { return !c.bad }
+
+func (c *fakeConn) ResetSession(ctx context.Context) error {
+	if c.bad {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func TestRebindConnPassesOnConnectionState(t *testing.T) {
+	conn := &fakeConn{}
+	var wrapped driver.Conn = rebindConn{conn}
+	validator, ok := wrapped.(driver.Validator)
+	if !ok {
+		t.Fatal("rebindConn is not a driver.Validator")
+	}
+	resetter, ok := wrapped.(driver.SessionResetter)
+	if !ok {
+		t.Fatal("rebindConn is not a driver.SessionResetter")
+	}
+
+	if !validator.IsValid() || resetter.ResetSession(context.Background()) != nil {
+		t.Error("healthy connection reported as broken")
+	}
+	conn.bad = true
+	if validator.IsValid() {
+		t.Error("broken connection reported as valid")
+	}
+	if err := resetter.ResetSession(context.Background()); !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("ResetSession of a broken connection = %v", err)
+	}
+
+	// Connections without the interfaces count as healthy
+	plain := rebindConn{nil}
+	if !plain.IsValid() || plain.ResetSession(context.Background()) != nil {
+		t.Error("connection without state reported as broken")
+	}
+}
@@ -0,0 +1,2198 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errMissingParent mirrors a foreign key violation in SQLStore
+var errMissingParent = errors.New("referenced row does not exist")
+
+// MemoryStore implements Store in memory. It behaves like SQLStore, including
+// sort orders, permissions and sql.ErrNoRows for missing rows, and is used in
+// tests.
+//
+// Strings are cloned before they are kept: Fiber reuses the request buffer
+// that form values point into once the handler returns.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+// memoryData holds one map per table. Rows are stored by value so a copy of
+// the maps is a snapshot that Batch can roll back to.
+type memoryData struct {
+	ids           map[string]int64
+	lists         map[int64]List
+	members       map[int64]map[int64]string // list ID -> user ID -> role
+	sections      map[int64]Section
+	items         map[int64]Item
+	history       map[int64]memoryHistory
+	templates     map[int64]Template
+	templateItems map[int64]TemplateItem
+	users         map[int64]memoryUser
+	identities    map[[2]string]int64 // (issuer, subject) -> user ID
+	totp          map[int64]UserTOTP
+	recoveryCodes map[int64][]memoryRecoveryCode
+	sessions      map[string]Session
+	rateLimits    map[string]RateLimitEntry
+	apiTokens     map[int64]memoryAPIToken
+	webhooks      map[int64]Webhook
+	deliveries    map[int64]WebhookDelivery
+	inboundHooks  map[int64]memoryInboundHook
+	caldav        map[int64]CalDAVObject
+}
+
+type memoryHistory struct {
+	ID            int64
+	Name          string
+	LastSectionID int64
+	UsageCount    int
+	LastUsedAt    int64
+}
+
+type memoryInboundHook struct {
+	InboundHook
+	TokenHash string
+}
+
+type memoryUser struct {
+	User
+	PasswordHash string
+	ActiveListID int64
+}
+
+type memoryAPIToken struct {
+	APIToken
+	Hash string
+}
+
+type memoryRecoveryCode struct {
+	Hash string
+	Used bool
+}
+
+// NewMemoryStore returns an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: &memoryData{
+		ids:           make(map[string]int64),
+		lists:         make(map[int64]List),
+		members:       make(map[int64]map[int64]string),
+		sections:      make(map[int64]Section),
+		items:         make(map[int64]Item),
+		history:       make(map[int64]memoryHistory),
+		templates:     make(map[int64]Template),
+		templateItems: make(map[int64]TemplateItem),
+		users:         make(map[int64]memoryUser),
+		identities:    make(map[[2]string]int64),
+		totp:          make(map[int64]UserTOTP),
+		recoveryCodes: make(map[int64][]memoryRecoveryCode),
+		sessions:      make(map[string]Session),
+		rateLimits:    make(map[string]RateLimitEntry),
+		apiTokens:     make(map[int64]memoryAPIToken),
+		webhooks:      make(map[int64]Webhook),
+		deliveries:    make(map[int64]WebhookDelivery),
+		inboundHooks:  make(map[int64]memoryInboundHook),
+		caldav:        make(map[int64]CalDAVObject),
+	}}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := &memoryData{
+		ids:           maps.Clone(d.ids),
+		lists:         maps.Clone(d.lists),
+		members:       make(map[int64]map[int64]string, len(d.members)),
+		sections:      maps.Clone(d.sections),
+		items:         maps.Clone(d.items),
+		history:       maps.Clone(d.history),
+		templates:     maps.Clone(d.templates),
+		templateItems: maps.Clone(d.templateItems),
+		users:         maps.Clone(d.users),
+		identities:    maps.Clone(d.identities),
+		totp:          maps.Clone(d.totp),
+		recoveryCodes: make(map[int64][]memoryRecoveryCode, len(d.recoveryCodes)),
+		sessions:      maps.Clone(d.sessions),
+		rateLimits:    maps.Clone(d.rateLimits),
+		apiTokens:     maps.Clone(d.apiTokens),
+		webhooks:      maps.Clone(d.webhooks),
+		deliveries:    maps.Clone(d.deliveries),
+		inboundHooks:  maps.Clone(d.inboundHooks),
+		caldav:        maps.Clone(d.caldav),
+	}
+	for listID, members := range d.members {
+		c.members[listID] = maps.Clone(members)
+	}
+	for userID, codes := range d.recoveryCodes {
+		c.recoveryCodes[userID] = append([]memoryRecoveryCode(nil), codes...)
+	}
+	return c
+}
+
+// nextID returns the next auto-increment ID of a table
+func (d *memoryData) nextID(table string) int64 {
+	d.ids[table]++
+	return d.ids[table]
+}
+
+// timestamp matches the second precision of CURRENT_TIMESTAMP
+func timestamp() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// sortedIDs returns the keys of m in ascending order, the order rows were inserted
+func sortedIDs[V any](m map[int64]V) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// ==================== LISTS ====================
+
+func (m *MemoryStore) GetAllLists(userID int64) ([]List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lists := m.visibleLists(userID)
+	for i := range lists {
+		lists[i].Stats = m.listStats(lists[i].ID)
+	}
+	return lists, nil
+}
+
+func (m *MemoryStore) visibleLists(userID int64) []List {
+	var lists []List
+	for _, l := range m.orderedLists() {
+		l.Role = resolveRole(userID, l.OwnerID, l.IsPrivate, m.data.members[l.ID][userID])
+		if l.Role == RoleNone {
+			continue
+		}
+		lists = append(lists, l)
+	}
+	markActiveList(lists, m.data.users[userID].ActiveListID)
+	return lists
+}
+
+func (m *MemoryStore) orderedLists() []List {
+	var lists []List
+	for _, id := range sortedIDs(m.data.lists) {
+		lists = append(lists, m.data.lists[id])
+	}
+	sort.SliceStable(lists, func(i, j int) bool { return lists[i].SortOrder < lists[j].SortOrder })
+	return lists
+}
+
+func (m *MemoryStore) GetListByID(id int64) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listByID(id)
+}
+
+func (m *MemoryStore) listByID(id int64) (*List, error) {
+	l, ok := m.data.lists[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	l.Stats = m.listStats(l.ID)
+	return &l, nil
+}
+
+func (m *MemoryStore) GetActiveList(userID int64) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, l := range m.visibleLists(userID) {
+		if l.IsActive {
+			l.Stats = m.listStats(l.ID)
+			return &l, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) CreateList(name, icon string, ownerID int64) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := m.insertList(name, icon, ownerID)
+	return m.listByID(l.ID)
+}
+
+func (m *MemoryStore) insertList(name, icon string, ownerID int64) List {
+	maxOrder := -1
+	for _, l := range m.data.lists {
+		maxOrder = max(maxOrder, l.SortOrder)
+	}
+	if icon == "" {
+		icon = "🛒"
+	}
+
+	l := List{
+		ID:        m.data.nextID("lists"),
+		Name:      strings.Clone(name),
+		Icon:      strings.Clone(icon),
+		SortOrder: maxOrder + 1,
+		CreatedAt: timestamp(),
+		UpdatedAt: time.Now().Unix(),
+		OwnerID:   ownerID,
+	}
+	m.data.lists[l.ID] = l
+	return l
+}
+
+func (m *MemoryStore) UpdateList(id int64, name, icon string) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, ok := m.data.lists[id]; ok {
+		l.Name = strings.Clone(name)
+		if icon != "" {
+			l.Icon = strings.Clone(icon)
+		}
+		l.UpdatedAt = time.Now().Unix()
+		m.data.lists[id] = l
+	}
+	return m.listByID(id)
+}
+
+func (m *MemoryStore) DeleteList(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.lists, id)
+	delete(m.data.members, id)
+	for userID, u := range m.data.users {
+		if u.ActiveListID == id {
+			u.ActiveListID = 0
+			m.data.users[userID] = u
+		}
+	}
+	for sectionID, s := range m.data.sections {
+		if s.ListID == id {
+			m.deleteSection(sectionID)
+		}
+	}
+	m.deleteListWebhooks(id)
+	for hookID, h := range m.data.inboundHooks {
+		if h.ListID == id {
+			delete(m.data.inboundHooks, hookID)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetActiveList(userID, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if userID != 0 {
+		if u, ok := m.data.users[userID]; ok {
+			if _, ok := m.data.lists[id]; !ok {
+				return errMissingParent
+			}
+			u.ActiveListID = id
+			m.data.users[userID] = u
+		}
+		return nil
+	}
+	for listID, l := range m.data.lists {
+		l.IsActive = listID == id
+		if l.IsActive {
+			l.UpdatedAt = time.Now().Unix()
+		}
+		m.data.lists[listID] = l
+	}
+	return nil
+}
+
+func (m *MemoryStore) MoveListUp(id int64) error {
+	return m.moveList(id, -1)
+}
+
+func (m *MemoryStore) MoveListDown(id int64) error {
+	return m.moveList(id, 1)
+}
+
+// moveList swaps a list with its neighbour in the direction of step (-1 or 1)
+func (m *MemoryStore) moveList(id int64, step int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.data.lists[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	orders := make(map[int64]int, len(m.data.lists))
+	for listID, l := range m.data.lists {
+		orders[listID] = l.SortOrder
+	}
+	if !swapOrder(orders, id, current.SortOrder, step) {
+		return nil
+	}
+	for listID, order := range orders {
+		l := m.data.lists[listID]
+		l.SortOrder = order
+		m.data.lists[listID] = l
+	}
+	return nil
+}
+
+// swapOrder moves id one place in the direction of step among orders, the way
+// the SQL queries do: the row(s) at the target position take the old one.
+// Returns false if id is already first or last.
+func swapOrder(orders map[int64]int, id int64, current, step int) bool {
+	maxOrder := current
+	for _, order := range orders {
+		maxOrder = max(maxOrder, order)
+	}
+	if (step < 0 && current == 0) || (step > 0 && current >= maxOrder) {
+		return false
+	}
+
+	target := current + step
+	for otherID, order := range orders {
+		if order == target {
+			orders[otherID] = order - step
+		}
+	}
+	orders[id] = target
+	return true
+}
+
+func (m *MemoryStore) GetListStats(listID int64) Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listStats(listID)
+}
+
+func (m *MemoryStore) listStats(listID int64) Stats {
+	var stats Stats
+	for _, i := range m.data.items {
+		if m.data.sections[i.SectionID].ListID != listID {
+			continue
+		}
+		stats.TotalItems++
+		if i.Completed {
+			stats.CompletedItems++
+		}
+	}
+	if stats.TotalItems > 0 {
+		stats.Percentage = (stats.CompletedItems * 100) / stats.TotalItems
+	}
+	return stats
+}
+
+// ==================== LIST PERMISSIONS ====================
+
+func (m *MemoryStore) GetListACL(listID int64) (*ListACL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listACL(listID)
+}
+
+func (m *MemoryStore) listACL(listID int64) (*ListACL, error) {
+	l, ok := m.data.lists[listID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &ListACL{
+		ListID:    listID,
+		OwnerID:   l.OwnerID,
+		IsPrivate: l.IsPrivate,
+		Members:   maps.Clone(m.data.members[listID]),
+	}, nil
+}
+
+func (m *MemoryStore) GetListRole(listID, userID int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acl, err := m.listACL(listID)
+	if err != nil {
+		return RoleNone, err
+	}
+	return acl.Role(userID), nil
+}
+
+func (m *MemoryStore) GetListMembers(listID int64) ([]ListMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var members []ListMember
+	for userID, role := range m.data.members[listID] {
+		members = append(members, ListMember{UserID: userID, Username: m.data.users[userID].Username, Role: role})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return strings.ToLower(members[i].Username) < strings.ToLower(members[j].Username)
+	})
+	return members, nil
+}
+
+func (m *MemoryStore) SetListMember(listID, userID int64, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.lists[listID]; !ok {
+		return errMissingParent
+	}
+	if _, ok := m.data.users[userID]; !ok {
+		return errMissingParent
+	}
+	if m.data.members[listID] == nil {
+		m.data.members[listID] = make(map[int64]string)
+	}
+	m.data.members[listID][userID] = strings.Clone(role)
+	return nil
+}
+
+func (m *MemoryStore) RemoveListMember(listID, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.members[listID], userID)
+	return nil
+}
+
+func (m *MemoryStore) SetListPrivate(listID int64, private bool, claimantID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, ok := m.data.lists[listID]; ok {
+		l.IsPrivate = private
+		if l.OwnerID == 0 {
+			l.OwnerID = claimantID
+		}
+		l.UpdatedAt = time.Now().Unix()
+		m.data.lists[listID] = l
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetListOwner(listID, ownerID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.data.lists[listID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := m.data.users[ownerID]; !ok {
+		return errMissingParent
+	}
+	l.OwnerID = ownerID
+	l.UpdatedAt = time.Now().Unix()
+	m.data.lists[listID] = l
+	return nil
+}
+
+func (m *MemoryStore) ReplaceListPermissions(listID int64, private *bool, claimantID int64, members map[int64]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.replaceListPermissions(listID, private, claimantID, members)
+}
+
+func (m *MemoryStore) replaceListPermissions(listID int64, private *bool, claimantID int64, members map[int64]string) error {
+	l, ok := m.data.lists[listID]
+	if !ok {
+		return nil
+	}
+	for userID := range members {
+		if _, ok := m.data.users[userID]; !ok {
+			return errMissingParent
+		}
+	}
+
+	if private != nil {
+		l.IsPrivate = *private
+		if l.OwnerID == 0 {
+			l.OwnerID = claimantID
+		}
+		l.UpdatedAt = time.Now().Unix()
+		m.data.lists[listID] = l
+	}
+	m.data.members[listID] = make(map[int64]string, len(members))
+	for userID, role := range members {
+		m.data.members[listID][userID] = strings.Clone(role)
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetItemListID(itemID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.data.items[itemID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return m.data.sections[i.SectionID].ListID, nil
+}
+
+func (m *MemoryStore) GetSectionListID(sectionID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.data.sections[sectionID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return s.ListID, nil
+}
+
+// ==================== SECTIONS ====================
+
+func (m *MemoryStore) GetSectionsByList(listID int64) ([]Section, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sectionsWhere(func(s Section) bool { return s.ListID == listID }), nil
+}
+
+// sectionsWhere returns the matching sections with their items, by sort order
+func (m *MemoryStore) sectionsWhere(match func(Section) bool) []Section {
+	var sections []Section
+	for _, id := range sortedIDs(m.data.sections) {
+		if s := m.data.sections[id]; match(s) {
+			s.Items = m.itemsBySection(id)
+			sections = append(sections, s)
+		}
+	}
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].SortOrder < sections[j].SortOrder })
+	return sections
+}
+
+func (m *MemoryStore) GetSectionByID(id int64) (*Section, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sectionByID(id)
+}
+
+func (m *MemoryStore) sectionByID(id int64) (*Section, error) {
+	s, ok := m.data.sections[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	s.Items = m.itemsBySection(id)
+	return &s, nil
+}
+
+func (m *MemoryStore) CreateSectionForList(listID int64, name string) (*Section, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createSectionForList(listID, name)
+}
+
+func (m *MemoryStore) createSectionForList(listID int64, name string) (*Section, error) {
+	s, err := m.insertSection(listID, name, m.maxSectionOrder(listID)+1)
+	if err != nil {
+		return nil, err
+	}
+	return m.sectionByID(s.ID)
+}
+
+func (m *MemoryStore) insertSection(listID int64, name string, sortOrder int) (Section, error) {
+	if _, ok := m.data.lists[listID]; !ok {
+		return Section{}, errMissingParent
+	}
+	s := Section{
+		ID:        m.data.nextID("sections"),
+		ListID:    listID,
+		Name:      strings.Clone(name),
+		SortOrder: sortOrder,
+		CreatedAt: timestamp(),
+		UpdatedAt: time.Now().Unix(),
+	}
+	m.data.sections[s.ID] = s
+	return s, nil
+}
+
+func (m *MemoryStore) maxSectionOrder(listID int64) int {
+	maxOrder := -1
+	for _, s := range m.data.sections {
+		if s.ListID == listID {
+			maxOrder = max(maxOrder, s.SortOrder)
+		}
+	}
+	return maxOrder
+}
+
+func (m *MemoryStore) UpdateSection(id int64, name string) (*Section, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.data.sections[id]; ok {
+		s.Name = strings.Clone(name)
+		s.UpdatedAt = time.Now().Unix()
+		m.data.sections[id] = s
+	}
+	return m.sectionByID(id)
+}
+
+func (m *MemoryStore) DeleteSection(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteSection(id)
+	return nil
+}
+
+func (m *MemoryStore) DeleteSections(ids []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		m.deleteSection(id)
+	}
+	return nil
+}
+
+// deleteSection removes a section and, like ON DELETE CASCADE, its items
+func (m *MemoryStore) deleteSection(id int64) {
+	delete(m.data.sections, id)
+	for itemID, i := range m.data.items {
+		if i.SectionID == id {
+			delete(m.data.items, itemID)
+		}
+	}
+}
+
+func (m *MemoryStore) MoveSectionUp(id int64) error {
+	return m.moveSection(id, -1)
+}
+
+func (m *MemoryStore) MoveSectionDown(id int64) error {
+	return m.moveSection(id, 1)
+}
+
+// moveSection swaps a section with its neighbour in the same list
+func (m *MemoryStore) moveSection(id int64, step int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.data.sections[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	orders := make(map[int64]int)
+	for sectionID, s := range m.data.sections {
+		if s.ListID == current.ListID {
+			orders[sectionID] = s.SortOrder
+		}
+	}
+	if !swapOrder(orders, id, current.SortOrder, step) {
+		return nil
+	}
+	for sectionID, order := range orders {
+		s := m.data.sections[sectionID]
+		s.SortOrder = order
+		m.data.sections[sectionID] = s
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetSectionStats(sectionID int64) SectionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stats SectionStats
+	for _, i := range m.data.items {
+		if i.SectionID != sectionID {
+			continue
+		}
+		stats.TotalItems++
+		if i.Completed {
+			stats.CompletedItems++
+		}
+	}
+	if stats.TotalItems > 0 {
+		stats.Percentage = (stats.CompletedItems * 100) / stats.TotalItems
+	}
+	return stats
+}
+
+// ==================== ITEMS ====================
+
+func (m *MemoryStore) GetItemsBySection(sectionID int64) ([]Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.itemsBySection(sectionID), nil
+}
+
+// itemsBySection returns the items of a section, open ones first, by sort order
+func (m *MemoryStore) itemsBySection(sectionID int64) []Item {
+	var items []Item
+	for _, id := range sortedIDs(m.data.items) {
+		if i := m.data.items[id]; i.SectionID == sectionID {
+			items = append(items, i)
+		}
+	}
+	sort.SliceStable(items, func(a, b int) bool {
+		if items[a].Completed != items[b].Completed {
+			return !items[a].Completed
+		}
+		return items[a].SortOrder < items[b].SortOrder
+	})
+	return items
+}
+
+func (m *MemoryStore) GetItemByID(id int64) (*Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.itemByID(id)
+}
+
+func (m *MemoryStore) itemByID(id int64) (*Item, error) {
+	i, ok := m.data.items[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &i, nil
+}
+
+func (m *MemoryStore) CreateItem(sectionID int64, name, description string) (*Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.insertItem(sectionID, name, description, m.maxItemOrder(sectionID)+1)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func (m *MemoryStore) insertItem(sectionID int64, name, description string, sortOrder int) (Item, error) {
+	if _, ok := m.data.sections[sectionID]; !ok {
+		return Item{}, errMissingParent
+	}
+	i := Item{
+		ID:          m.data.nextID("items"),
+		SectionID:   sectionID,
+		Name:        strings.Clone(name),
+		Description: strings.Clone(description),
+		SortOrder:   sortOrder,
+		CreatedAt:   timestamp(),
+		UpdatedAt:   time.Now().Unix(),
+	}
+	m.data.items[i.ID] = i
+	return i, nil
+}
+
+func (m *MemoryStore) maxItemOrder(sectionID int64) int {
+	maxOrder := -1
+	for _, i := range m.data.items {
+		if i.SectionID == sectionID {
+			maxOrder = max(maxOrder, i.SortOrder)
+		}
+	}
+	return maxOrder
+}
+
+// updateItem applies change to an item and returns the result
+func (m *MemoryStore) updateItem(id int64, change func(i *Item)) (*Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.data.items[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	change(&i)
+	i.UpdatedAt = time.Now().Unix()
+	m.data.items[id] = i
+	return &i, nil
+}
+
+func (m *MemoryStore) UpdateItem(id int64, name, description string) (*Item, error) {
+	return m.updateItem(id, func(i *Item) {
+		i.Name = strings.Clone(name)
+		i.Description = strings.Clone(description)
+	})
+}
+
+func (m *MemoryStore) DeleteItem(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.items, id)
+	return nil
+}
+
+func (m *MemoryStore) DeleteCompletedItems(listID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for id, i := range m.data.items {
+		if i.Completed && m.data.sections[i.SectionID].ListID == listID {
+			delete(m.data.items, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *MemoryStore) ToggleItemCompleted(id int64) (*Item, error) {
+	return m.updateItem(id, func(i *Item) { i.Completed = !i.Completed })
+}
+
+func (m *MemoryStore) ToggleItemUncertain(id int64) (*Item, error) {
+	return m.updateItem(id, func(i *Item) { i.Uncertain = !i.Uncertain })
+}
+
+func (m *MemoryStore) MoveItemToSection(id, newSectionID int64) (*Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.data.items[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if _, ok := m.data.sections[newSectionID]; !ok {
+		return nil, errMissingParent
+	}
+	i.SortOrder = m.maxItemOrder(newSectionID) + 1
+	i.SectionID = newSectionID
+	i.UpdatedAt = time.Now().Unix()
+	m.data.items[id] = i
+	return &i, nil
+}
+
+func (m *MemoryStore) MoveItemUp(id int64) error {
+	return m.moveItem(id, -1)
+}
+
+func (m *MemoryStore) MoveItemDown(id int64) error {
+	return m.moveItem(id, 1)
+}
+
+// moveItem swaps an item with its neighbour in the same section
+func (m *MemoryStore) moveItem(id int64, step int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.data.items[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	orders := make(map[int64]int)
+	for itemID, i := range m.data.items {
+		if i.SectionID == current.SectionID {
+			orders[itemID] = i.SortOrder
+		}
+	}
+	if !swapOrder(orders, id, current.SortOrder, step) {
+		return nil
+	}
+	for itemID, order := range orders {
+		i := m.data.items[itemID]
+		i.SortOrder = order
+		m.data.items[itemID] = i
+	}
+	return nil
+}
+
+// ==================== ITEM HISTORY ====================
+
+func (m *MemoryStore) SaveItemHistory(name string, sectionID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.saveItemHistory(name, sectionID)
+	return nil
+}
+
+// saveItemHistory upserts by case-insensitive name, keeping the first spelling
+func (m *MemoryStore) saveItemHistory(name string, sectionID int64) {
+	now := time.Now().Unix()
+	for id, h := range m.data.history {
+		if strings.EqualFold(h.Name, name) {
+			h.LastSectionID = sectionID
+			h.UsageCount++
+			h.LastUsedAt = now
+			m.data.history[id] = h
+			return
+		}
+	}
+	id := m.data.nextID("item_history")
+	m.data.history[id] = memoryHistory{ID: id, Name: strings.Clone(name), LastSectionID: sectionID, UsageCount: 1, LastUsedAt: now}
+}
+
+// historyByUsage returns up to limit history entries, most used first
+func (m *MemoryStore) historyByUsage(limit int) []HistoryItem {
+	var entries []memoryHistory
+	for _, id := range sortedIDs(m.data.history) {
+		entries = append(entries, m.data.history[id])
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].UsageCount != entries[j].UsageCount {
+			return entries[i].UsageCount > entries[j].UsageCount
+		}
+		return entries[i].LastUsedAt > entries[j].LastUsedAt
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	var items []HistoryItem
+	for _, h := range entries {
+		items = append(items, HistoryItem{
+			ID:              h.ID,
+			Name:            h.Name,
+			LastSectionID:   h.LastSectionID,
+			LastSectionName: m.data.sections[h.LastSectionID].Name,
+			UsageCount:      h.UsageCount,
+			LastUsedAt:      h.LastUsedAt,
+		})
+	}
+	return items
+}
+
+func (m *MemoryStore) historySuggestions(limit int) []ItemSuggestion {
+	var suggestions []ItemSuggestion
+	for _, h := range m.historyByUsage(limit) {
+		suggestions = append(suggestions, ItemSuggestion{
+			Name:            h.Name,
+			LastSectionID:   h.LastSectionID,
+			LastSectionName: h.LastSectionName,
+			UsageCount:      h.UsageCount,
+		})
+	}
+	return suggestions
+}
+
+func (m *MemoryStore) GetItemSuggestions(query string, limit int) ([]ItemSuggestion, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return rankSuggestions(m.historySuggestions(200), query, limit), nil
+}
+
+func (m *MemoryStore) GetAllItemSuggestions(limit int) ([]ItemSuggestion, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.historySuggestions(limit), nil
+}
+
+func (m *MemoryStore) GetItemHistoryList() ([]HistoryItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.historyByUsage(100), nil
+}
+
+func (m *MemoryStore) GetAllItemHistory() ([]HistoryItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := m.historyByUsage(len(m.data.history))
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+func (m *MemoryStore) DeleteItemHistory(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.history[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.data.history, id)
+	return nil
+}
+
+func (m *MemoryStore) DeleteItemHistoryBatch(ids []int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for _, id := range ids {
+		if _, ok := m.data.history[id]; ok {
+			delete(m.data.history, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// ==================== TEMPLATES ====================
+
+func (m *MemoryStore) GetAllTemplates() ([]Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var templates []Template
+	for _, id := range sortedIDs(m.data.templates) {
+		t := m.data.templates[id]
+		t.Items = m.templateItems(id)
+		templates = append(templates, t)
+	}
+	sort.SliceStable(templates, func(i, j int) bool { return templates[i].SortOrder < templates[j].SortOrder })
+	return templates, nil
+}
+
+func (m *MemoryStore) GetTemplateByID(id int64) (*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.templateByID(id)
+}
+
+func (m *MemoryStore) templateByID(id int64) (*Template, error) {
+	t, ok := m.data.templates[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	t.Items = m.templateItems(id)
+	return &t, nil
+}
+
+func (m *MemoryStore) GetTemplateItems(templateID int64) ([]TemplateItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.templateItems(templateID), nil
+}
+
+// templateItems returns the items of a template grouped by section name
+func (m *MemoryStore) templateItems(templateID int64) []TemplateItem {
+	var items []TemplateItem
+	for _, id := range sortedIDs(m.data.templateItems) {
+		if ti := m.data.templateItems[id]; ti.TemplateID == templateID {
+			items = append(items, ti)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].SectionName != items[j].SectionName {
+			return items[i].SectionName < items[j].SectionName
+		}
+		return items[i].SortOrder < items[j].SortOrder
+	})
+	return items
+}
+
+func (m *MemoryStore) CreateTemplate(name, description string) (*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.insertTemplate(name, description)
+	return m.templateByID(t.ID)
+}
+
+func (m *MemoryStore) insertTemplate(name, description string) Template {
+	maxOrder := -1
+	for _, t := range m.data.templates {
+		maxOrder = max(maxOrder, t.SortOrder)
+	}
+	t := Template{
+		ID:          m.data.nextID("templates"),
+		Name:        strings.Clone(name),
+		Description: strings.Clone(description),
+		SortOrder:   maxOrder + 1,
+		CreatedAt:   timestamp(),
+		UpdatedAt:   time.Now().Unix(),
+	}
+	m.data.templates[t.ID] = t
+	return t
+}
+
+func (m *MemoryStore) UpdateTemplate(id int64, name, description string) (*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.data.templates[id]; ok {
+		t.Name = strings.Clone(name)
+		t.Description = strings.Clone(description)
+		t.UpdatedAt = time.Now().Unix()
+		m.data.templates[id] = t
+	}
+	return m.templateByID(id)
+}
+
+func (m *MemoryStore) DeleteTemplate(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.templates, id)
+	for itemID, ti := range m.data.templateItems {
+		if ti.TemplateID == id {
+			delete(m.data.templateItems, itemID)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) AddTemplateItem(templateID int64, sectionName, name, description string) (*TemplateItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	maxOrder := -1
+	for _, ti := range m.data.templateItems {
+		if ti.TemplateID == templateID {
+			maxOrder = max(maxOrder, ti.SortOrder)
+		}
+	}
+	ti, err := m.insertTemplateItem(templateID, sectionName, name, description, maxOrder+1)
+	if err != nil {
+		return nil, err
+	}
+	return &ti, nil
+}
+
+func (m *MemoryStore) insertTemplateItem(templateID int64, sectionName, name, description string, sortOrder int) (TemplateItem, error) {
+	if _, ok := m.data.templates[templateID]; !ok {
+		return TemplateItem{}, errMissingParent
+	}
+	ti := TemplateItem{
+		ID:          m.data.nextID("template_items"),
+		TemplateID:  templateID,
+		SectionName: strings.Clone(sectionName),
+		Name:        strings.Clone(name),
+		Description: strings.Clone(description),
+		SortOrder:   sortOrder,
+		CreatedAt:   timestamp(),
+	}
+	m.data.templateItems[ti.ID] = ti
+	return ti, nil
+}
+
+func (m *MemoryStore) GetTemplateItemByID(id int64) (*TemplateItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ti, ok := m.data.templateItems[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &ti, nil
+}
+
+func (m *MemoryStore) UpdateTemplateItem(id int64, sectionName, name, description string) (*TemplateItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ti, ok := m.data.templateItems[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	ti.SectionName = strings.Clone(sectionName)
+	ti.Name = strings.Clone(name)
+	ti.Description = strings.Clone(description)
+	m.data.templateItems[id] = ti
+	return &ti, nil
+}
+
+func (m *MemoryStore) DeleteTemplateItem(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.templateItems, id)
+	return nil
+}
+
+func (m *MemoryStore) ApplyTemplateToList(templateID, listID int64) error {
+	return m.Batch(func(BatchStore) error {
+		template, err := m.templateByID(templateID)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range template.Items {
+			// Find or create the section in the target list
+			var sectionID int64
+			for _, id := range sortedIDs(m.data.sections) {
+				if s := m.data.sections[id]; s.ListID == listID && strings.EqualFold(s.Name, item.SectionName) {
+					sectionID = id
+					break
+				}
+			}
+			if sectionID == 0 {
+				s, err := m.insertSection(listID, item.SectionName, m.maxSectionOrder(listID)+1)
+				if err != nil {
+					return err
+				}
+				sectionID = s.ID
+			}
+
+			if _, err := m.insertItem(sectionID, item.Name, item.Description, m.maxItemOrder(sectionID)+1); err != nil {
+				return err
+			}
+			m.saveItemHistory(item.Name, sectionID)
+		}
+		return nil
+	})
+}
+
+func (m *MemoryStore) CreateTemplateFromList(listID int64, templateName, templateDescription string) (*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.insertTemplate(templateName, templateDescription)
+	itemOrder := 0
+	for _, section := range m.sectionsWhere(func(s Section) bool { return s.ListID == listID }) {
+		for _, item := range section.Items {
+			if !item.Completed { // Only add non-completed items
+				m.insertTemplateItem(t.ID, section.Name, item.Name, item.Description, itemOrder)
+				itemOrder++
+			}
+		}
+	}
+	return m.templateByID(t.ID)
+}
+
+// ==================== USERS ====================
+
+func (m *MemoryStore) GetOrCreateUser(username string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, err := m.userByUsername(username); err == nil {
+		return u, nil
+	}
+	u := memoryUser{User: User{ID: m.data.nextID("users"), Username: strings.Clone(username), CreatedAt: timestamp()}}
+	m.data.users[u.ID] = u
+	return &u.User, nil
+}
+
+func (m *MemoryStore) GetUserByUsername(username string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.userByUsername(username)
+}
+
+func (m *MemoryStore) userByUsername(username string) (*User, error) {
+	for _, u := range m.data.users {
+		if strings.EqualFold(u.Username, username) {
+			return &u.User, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) GetUserByID(id int64) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &u.User, nil
+}
+
+func (m *MemoryStore) GetAllUsers() ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []User
+	for _, id := range sortedIDs(m.data.users) {
+		users = append(users, m.data.users[id].User)
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		return strings.ToLower(users[i].Username) < strings.ToLower(users[j].Username)
+	})
+	return users, nil
+}
+
+func (m *MemoryStore) GetUserPasswordHash(userID int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[userID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return u.PasswordHash, nil
+}
+
+func (m *MemoryStore) SetUserPasswordHash(userID int64, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	u.PasswordHash = strings.Clone(hash)
+	m.data.users[userID] = u
+	return nil
+}
+
+func (m *MemoryStore) GetUserByIdentity(issuer, subject string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[m.data.identities[[2]string{issuer, subject}]]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &u.User, nil
+}
+
+func (m *MemoryStore) LinkUserIdentity(issuer, subject string, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[userID]; !ok {
+		return errMissingParent
+	}
+	m.data.identities[[2]string{strings.Clone(issuer), strings.Clone(subject)}] = userID
+	return nil
+}
+
+// ==================== TWO-FACTOR ====================
+
+func (m *MemoryStore) GetUserTOTP(userID int64) (*UserTOTP, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.data.totp[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &t, nil
+}
+
+func (m *MemoryStore) IsTOTPEnabled(userID int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data.totp[userID].Enabled, nil
+}
+
+func (m *MemoryStore) SaveTOTPSecret(userID int64, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.data.totp[userID]; ok && t.Enabled {
+		return nil
+	}
+	m.data.totp[userID] = UserTOTP{UserID: userID, Secret: strings.Clone(secret)}
+	return nil
+}
+
+func (m *MemoryStore) EnableTOTP(userID, step int64, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.data.totp[userID]; ok {
+		t.Enabled = true
+		t.LastUsedStep = step
+		m.data.totp[userID] = t
+	}
+	m.replaceRecoveryCodes(userID, recoveryCodeHashes)
+	return nil
+}
+
+func (m *MemoryStore) DisableTOTP(userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.totp, userID)
+	delete(m.data.recoveryCodes, userID)
+	return nil
+}
+
+func (m *MemoryStore) UseTOTPStep(userID, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.data.totp[userID]
+	if !ok || t.LastUsedStep >= step {
+		return false, nil
+	}
+	t.LastUsedStep = step
+	m.data.totp[userID] = t
+	return true, nil
+}
+
+func (m *MemoryStore) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (m *MemoryStore) replaceRecoveryCodes(userID int64, codeHashes []string) {
+	codes := make([]memoryRecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = memoryRecoveryCode{Hash: strings.Clone(hash)}
+	}
+	m.data.recoveryCodes[userID] = codes
+}
+
+func (m *MemoryStore) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used := false
+	for i, code := range m.data.recoveryCodes[userID] {
+		if code.Hash == codeHash && !code.Used {
+			m.data.recoveryCodes[userID][i].Used = true
+			used = true
+		}
+	}
+	return used, nil
+}
+
+func (m *MemoryStore) CountRecoveryCodes(userID int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, code := range m.data.recoveryCodes[userID] {
+		if !code.Used {
+			count++
+		}
+	}
+	return count
+}
+
+// ==================== SESSIONS ====================
+
+func (m *MemoryStore) CreateSession(s *Session) error {
+	now := time.Now().Unix()
+	if s.CreatedAt == 0 {
+		s.CreatedAt = now
+	}
+	if s.LastSeenAt == 0 {
+		s.LastSeenAt = now
+	}
+	if s.PublicID == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		s.PublicID = hex.EncodeToString(b)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.sessions[s.ID]; ok {
+		return fmt.Errorf("session already exists")
+	}
+	stored := Session{
+		ID:          strings.Clone(s.ID),
+		PublicID:    strings.Clone(s.PublicID),
+		UserID:      s.UserID,
+		DeviceLabel: strings.Clone(s.DeviceLabel),
+		UserAgent:   strings.Clone(s.UserAgent),
+		IP:          strings.Clone(s.IP),
+		CSRFToken:   strings.Clone(s.CSRFToken),
+		CreatedAt:   s.CreatedAt,
+		LastSeenAt:  s.LastSeenAt,
+		ExpiresAt:   s.ExpiresAt,
+	}
+	m.data.sessions[stored.ID] = stored
+	return nil
+}
+
+// session returns a stored session with the username filled in
+func (m *MemoryStore) session(s Session) Session {
+	s.Username = m.data.users[s.UserID].Username
+	return s
+}
+
+func (m *MemoryStore) GetSession(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.data.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	s = m.session(s)
+	return &s, nil
+}
+
+func (m *MemoryStore) GetSessions(userID int64) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+	sessions := []Session{}
+	for _, s := range m.data.sessions {
+		if s.ExpiresAt >= now && (userID == 0 || s.UserID == userID) {
+			sessions = append(sessions, m.session(s))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt > sessions[j].LastSeenAt })
+	return sessions, nil
+}
+
+func (m *MemoryStore) TouchSession(id, ip string, lastSeenAt, expiresAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.data.sessions[id]; ok {
+		s.IP = strings.Clone(ip)
+		s.LastSeenAt = lastSeenAt
+		s.ExpiresAt = expiresAt
+		m.data.sessions[id] = s
+	}
+	return nil
+}
+
+// sessionByPublicID finds a session by public ID; userID 0 matches any owner
+func (m *MemoryStore) sessionByPublicID(publicID string, userID int64) (Session, bool) {
+	for _, s := range m.data.sessions {
+		if s.PublicID == publicID && (userID == 0 || s.UserID == userID) {
+			return s, true
+		}
+	}
+	return Session{}, false
+}
+
+func (m *MemoryStore) RenameSession(publicID string, userID int64, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessionByPublicID(publicID, userID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	s.DeviceLabel = strings.Clone(label)
+	m.data.sessions[s.ID] = s
+	return nil
+}
+
+func (m *MemoryStore) DeleteSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.sessions, id)
+	return nil
+}
+
+func (m *MemoryStore) RevokeSession(publicID string, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessionByPublicID(publicID, userID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.data.sessions, s.ID)
+	return nil
+}
+
+func (m *MemoryStore) RevokeOtherSessions(userID int64, keepID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var revoked int64
+	for id, s := range m.data.sessions {
+		if s.UserID == userID && id != keepID {
+			delete(m.data.sessions, id)
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (m *MemoryStore) CleanExpiredSessions() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+	for id, s := range m.data.sessions {
+		if s.ExpiresAt < now {
+			delete(m.data.sessions, id)
+		}
+	}
+	return nil
+}
+
+// ==================== RATE LIMITS ====================
+
+func (m *MemoryStore) GetRateLimit(key string) (*RateLimitEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.data.rateLimits[key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &e, nil
+}
+
+func (m *MemoryStore) SaveRateLimit(key string, e *RateLimitEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data.rateLimits[strings.Clone(key)] = *e
+	return nil
+}
+
+func (m *MemoryStore) DeleteRateLimit(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.rateLimits, key)
+	return nil
+}
+
+func (m *MemoryStore) CleanRateLimits(prefix string, windowStartBefore, now int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, e := range m.data.rateLimits {
+		if strings.HasPrefix(key, prefix) && e.WindowStart < windowStartBefore && e.BlockedUntil < now {
+			delete(m.data.rateLimits, key)
+		}
+	}
+	return nil
+}
+
+// ==================== API TOKENS ====================
+
+func (m *MemoryStore) CreateAPIToken(name, tokenHash string, userID int64) (*APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.data.apiTokens {
+		if t.Name == name || t.Hash == tokenHash {
+			return nil, fmt.Errorf("api token already exists")
+		}
+	}
+	if _, ok := m.data.users[userID]; userID != 0 && !ok {
+		return nil, errMissingParent
+	}
+
+	t := memoryAPIToken{
+		APIToken: APIToken{
+			ID:        m.data.nextID("api_tokens"),
+			Name:      strings.Clone(name),
+			UserID:    userID,
+			CreatedAt: time.Now().Unix(),
+		},
+		Hash: strings.Clone(tokenHash),
+	}
+	m.data.apiTokens[t.ID] = t
+	return m.apiToken(t), nil
+}
+
+func (m *MemoryStore) apiToken(t memoryAPIToken) *APIToken {
+	token := t.APIToken
+	token.Username = m.data.users[t.UserID].Username
+	return &token
+}
+
+func (m *MemoryStore) GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.data.apiTokens {
+		if t.Hash == tokenHash {
+			return m.apiToken(t), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) GetAPITokens() ([]APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens := []APIToken{}
+	for _, t := range m.data.apiTokens {
+		tokens = append(tokens, *m.apiToken(t))
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+	return tokens, nil
+}
+
+func (m *MemoryStore) TouchAPIToken(id, lastUsedAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.data.apiTokens[id]; ok {
+		t.LastUsedAt = lastUsedAt
+		m.data.apiTokens[id] = t
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteAPIToken(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, t := range m.data.apiTokens {
+		if t.Name == name {
+			delete(m.data.apiTokens, id)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// ==================== WEBHOOKS ====================
+
+// cloneWebhook copies a webhook so callers can't change the stored one
+func cloneWebhook(w Webhook) *Webhook {
+	w.Events = append([]string(nil), w.Events...)
+	return &w
+}
+
+func (m *MemoryStore) CreateWebhook(w *Webhook) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.lists[w.ListID]; w.ListID != 0 && !ok {
+		return nil, errMissingParent
+	}
+	created := *cloneWebhook(*w)
+	created.ID = m.data.nextID("webhooks")
+	created.CreatedAt = time.Now().Unix()
+	m.data.webhooks[created.ID] = created
+	return cloneWebhook(created), nil
+}
+
+func (m *MemoryStore) GetWebhooks() ([]Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := []Webhook{}
+	for _, w := range m.data.webhooks {
+		webhooks = append(webhooks, *cloneWebhook(w))
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (m *MemoryStore) GetWebhook(id int64) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.data.webhooks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return cloneWebhook(w), nil
+}
+
+func (m *MemoryStore) UpdateWebhook(w *Webhook) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.data.webhooks[w.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if _, ok := m.data.lists[w.ListID]; w.ListID != 0 && !ok {
+		return nil, errMissingParent
+	}
+	updated := *cloneWebhook(*w)
+	updated.CreatedAt = existing.CreatedAt
+	m.data.webhooks[w.ID] = updated
+	return cloneWebhook(updated), nil
+}
+
+func (m *MemoryStore) DeleteWebhook(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.webhooks[id]; !ok {
+		return sql.ErrNoRows
+	}
+	m.deleteWebhook(id)
+	return nil
+}
+
+// deleteWebhook removes a webhook and its deliveries; the lock must be held
+func (m *MemoryStore) deleteWebhook(id int64) {
+	delete(m.data.webhooks, id)
+	for deliveryID, d := range m.data.deliveries {
+		if d.WebhookID == id {
+			delete(m.data.deliveries, deliveryID)
+		}
+	}
+}
+
+// deleteListWebhooks removes the webhooks limited to a list; the lock must be held
+func (m *MemoryStore) deleteListWebhooks(listID int64) {
+	for id, w := range m.data.webhooks {
+		if w.ListID == listID {
+			m.deleteWebhook(id)
+		}
+	}
+}
+
+func (m *MemoryStore) CreateWebhookDelivery(d *WebhookDelivery) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.webhooks[d.WebhookID]; !ok {
+		return nil, errMissingParent
+	}
+	created := *d
+	created.ID = m.data.nextID("webhook_deliveries")
+	created.CreatedAt = time.Now().Unix()
+	m.data.deliveries[created.ID] = created
+	return &created, nil
+}
+
+func (m *MemoryStore) GetDueWebhookDeliveries(now int64, limit int) ([]WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []WebhookDelivery{}
+	for _, d := range m.data.deliveries {
+		if d.Status == WebhookPending && d.NextAttemptAt <= now {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (m *MemoryStore) UpdateWebhookDelivery(d *WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.data.deliveries[d.ID]
+	if !ok {
+		return nil
+	}
+	existing.Status = d.Status
+	existing.Attempts = d.Attempts
+	existing.NextAttemptAt = d.NextAttemptAt
+	existing.ResponseCode = d.ResponseCode
+	existing.Error = strings.Clone(d.Error)
+	existing.FinishedAt = d.FinishedAt
+	m.data.deliveries[d.ID] = existing
+	return nil
+}
+
+func (m *MemoryStore) GetWebhookDeliveries(webhookID int64, limit int) ([]WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []WebhookDelivery{}
+	for _, d := range m.data.deliveries {
+		if d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (m *MemoryStore) DeleteWebhookDeliveries(finishedBefore int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, d := range m.data.deliveries {
+		if d.Status != WebhookPending && d.FinishedAt < finishedBefore {
+			delete(m.data.deliveries, id)
+		}
+	}
+	return nil
+}
+
+// ==================== BATCH ====================
+
+// memoryBatch creates rows while MemoryStore.Batch holds the lock
+type memoryBatch struct {
+	m *MemoryStore
+}
+
+// Batch runs fn with the store locked and restores the previous state if fn fails
+func (m *MemoryStore) Batch(fn func(b BatchStore) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.data.clone()
+	if err := fn(memoryBatch{m}); err != nil {
+		m.data = snapshot
+		return err
+	}
+	return nil
+}
+
+func (b memoryBatch) CreateList(name, icon string, ownerID int64) (*List, error) {
+	l := b.m.insertList(name, icon, ownerID)
+	return &l, nil
+}
+
+func (b memoryBatch) ReplaceListPermissions(listID int64, private *bool, claimantID int64, members map[int64]string) error {
+	return b.m.replaceListPermissions(listID, private, claimantID, members)
+}
+
+func (b memoryBatch) CreateSection(listID int64, name string, sortOrder int) (*Section, error) {
+	s, err := b.m.insertSection(listID, name, sortOrder)
+	if err != nil {
+		return nil, err
+	}
+	s.Items = []Item{}
+	return &s, nil
+}
+
+func (b memoryBatch) CreateItem(sectionID int64, name, description string, sortOrder int) (*Item, error) {
+	i, err := b.m.insertItem(sectionID, name, description, sortOrder)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func (b memoryBatch) SaveItemHistory(name string, sectionID int64) {
+	b.m.saveItemHistory(name, sectionID)
+}
+
+func (b memoryBatch) MaxSectionOrder(listID int64) int {
+	return b.m.maxSectionOrder(listID)
+}
+
+func (b memoryBatch) MaxItemOrder(sectionID int64) int {
+	return b.m.maxItemOrder(sectionID)
+}
+
+func (b memoryBatch) SetActiveList(id int64) error {
+	for listID, l := range b.m.data.lists {
+		l.IsActive = listID == id
+		b.m.data.lists[listID] = l
+	}
+	return nil
+}
+
+func (b memoryBatch) SetItemStatus(id int64, completed, uncertain bool) error {
+	if i, ok := b.m.data.items[id]; ok {
+		i.Completed = completed
+		i.Uncertain = uncertain
+		b.m.data.items[id] = i
+	}
+	return nil
+}
+
+func (b memoryBatch) UpdateItem(id int64, name, description string, completed bool) error {
+	if i, ok := b.m.data.items[id]; ok {
+		i.Name = strings.Clone(name)
+		i.Description = strings.Clone(description)
+		i.Completed = completed
+		i.UpdatedAt = time.Now().Unix()
+		b.m.data.items[id] = i
+	}
+	return nil
+}
+
+func (b memoryBatch) DeleteItem(id int64) error {
+	delete(b.m.data.items, id)
+	return nil
+}
+
+func (b memoryBatch) CreateTemplate(name, description string) (*Template, error) {
+	t := b.m.insertTemplate(name, description)
+	return &t, nil
+}
+
+func (b memoryBatch) CreateTemplateItem(templateID int64, sectionName, name, description string, sortOrder int) (*TemplateItem, error) {
+	ti, err := b.m.insertTemplateItem(templateID, sectionName, name, description, sortOrder)
+	if err != nil {
+		return nil, err
+	}
+	return &ti, nil
+}
+
+func (b memoryBatch) ImportItemHistory(name string, sectionID int64, usageCount int, lastUsedAt int64) error {
+	for id, h := range b.m.data.history {
+		if strings.EqualFold(h.Name, name) {
+			h.UsageCount += usageCount
+			if lastUsedAt > h.LastUsedAt {
+				h.LastSectionID = sectionID
+				h.LastUsedAt = lastUsedAt
+			}
+			b.m.data.history[id] = h
+			return nil
+		}
+	}
+	id := b.m.data.nextID("item_history")
+	b.m.data.history[id] = memoryHistory{ID: id, Name: strings.Clone(name), LastSectionID: sectionID, UsageCount: usageCount, LastUsedAt: lastUsedAt}
+	return nil
+}
+
+func (b memoryBatch) DeleteAllData() error {
+	d := b.m.data
+	d.lists = make(map[int64]List)
+	d.members = make(map[int64]map[int64]string)
+	d.sections = make(map[int64]Section)
+	d.items = make(map[int64]Item)
+	d.templates = make(map[int64]Template)
+	d.templateItems = make(map[int64]TemplateItem)
+	d.history = make(map[int64]memoryHistory)
+	for id, w := range d.webhooks {
+		if w.ListID != 0 {
+			b.m.deleteWebhook(id)
+		}
+	}
+	d.inboundHooks = make(map[int64]memoryInboundHook)
+	d.caldav = make(map[int64]CalDAVObject)
+	return nil
+}
+
+// ==================== INBOUND HOOKS ====================
+
+// inboundHook returns a copy of a stored hook with the names of its list and
+// section; a deleted section reads as none. The lock must be held.
+func (m *MemoryStore) inboundHook(h memoryInboundHook) *InboundHook {
+	hook := h.InboundHook
+	hook.ListName = m.data.lists[hook.ListID].Name
+	if section, ok := m.data.sections[hook.SectionID]; ok {
+		hook.SectionName = section.Name
+	} else {
+		hook.SectionID = 0
+		hook.SectionName = ""
+	}
+	return &hook
+}
+
+func (m *MemoryStore) CreateInboundHook(h *InboundHook, tokenHash string) (*InboundHook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.lists[h.ListID]; !ok {
+		return nil, errMissingParent
+	}
+	if _, ok := m.data.sections[h.SectionID]; h.SectionID != 0 && !ok {
+		return nil, errMissingParent
+	}
+	for _, existing := range m.data.inboundHooks {
+		if existing.Name == h.Name || existing.TokenHash == tokenHash || existing.MailAlias == h.MailAlias {
+			return nil, fmt.Errorf("UNIQUE constraint failed: inbound_hooks")
+		}
+	}
+	created := memoryInboundHook{InboundHook: *h, TokenHash: tokenHash}
+	created.ID = m.data.nextID("inbound_hooks")
+	created.CreatedAt = time.Now().Unix()
+	created.LastUsedAt = 0
+	m.data.inboundHooks[created.ID] = created
+	return m.inboundHook(created), nil
+}
+
+func (m *MemoryStore) GetInboundHookByHash(tokenHash string) (*InboundHook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, h := range m.data.inboundHooks {
+		if h.TokenHash == tokenHash {
+			return m.inboundHook(h), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) GetInboundHookByMailAlias(alias string) (*InboundHook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, h := range m.data.inboundHooks {
+		if h.MailAlias == alias {
+			return m.inboundHook(h), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) GetInboundHooks() ([]InboundHook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hooks := []InboundHook{}
+	for _, h := range m.data.inboundHooks {
+		hooks = append(hooks, *m.inboundHook(h))
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].Name < hooks[j].Name })
+	return hooks, nil
+}
+
+func (m *MemoryStore) TouchInboundHook(id, lastUsedAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if h, ok := m.data.inboundHooks[id]; ok {
+		h.LastUsedAt = lastUsedAt
+		m.data.inboundHooks[id] = h
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteInboundHook(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.inboundHooks[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.data.inboundHooks, id)
+	return nil
+}
+
+// ==================== CALDAV ====================
+
+// Objects of deleted items are left behind and skipped on read; item IDs are
+// never reused.
+
+func (m *MemoryStore) SaveCalDAVObject(o CalDAVObject) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.items[o.ItemID]; !ok {
+		return errMissingParent
+	}
+	for id, existing := range m.data.caldav {
+		if existing.Name == o.Name && id != o.ItemID {
+			if _, ok := m.data.items[id]; ok {
+				return fmt.Errorf("UNIQUE constraint failed: caldav_objects.name")
+			}
+			delete(m.data.caldav, id)
+		}
+	}
+	m.data.caldav[o.ItemID] = o
+	return nil
+}
+
+func (m *MemoryStore) GetCalDAVObjects(listID int64) ([]CalDAVObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var objects []CalDAVObject
+	for id, o := range m.data.caldav {
+		item, ok := m.data.items[id]
+		if !ok {
+			continue
+		}
+		if m.data.sections[item.SectionID].ListID == listID {
+			objects = append(objects, o)
+		}
+	}
+	return objects, nil
+}
+
+func (m *MemoryStore) GetCalDAVObjectByName(name string) (*CalDAVObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, o := range m.data.caldav {
+		if _, ok := m.data.items[id]; ok && o.Name == name {
+			return &o, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
@@ -0,0 +1,590 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Migration is one numbered schema change. Up runs inside a transaction,
+// so a failing migration leaves the database as it was.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// MigrationState describes a migration and whether it has been applied
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// sqliteMigrations must only ever be appended to; never renumber or edit applied ones.
+// Migrations up to 12 predate schema_migrations and check whether their change
+// is already present, so older databases are adopted without being converted twice.
+var sqliteMigrations = []Migration{
+	{1, "initial schema", migrateInitialSchema},
+	{2, "add updated_at to sections and items", migrateUpdatedAt},
+	{3, "multiple lists", migrateToMultipleLists},
+	{4, "templates", migrateTemplates},
+	{5, "list icons", migrateListIcons},
+	{6, "users and list permissions", migrateListPermissions},
+	{7, "external login identities", migrateUserIdentities},
+	{8, "two-factor authentication", migrateTwoFactor},
+	{9, "session device details", migrateSessionDetails},
+	{10, "user password hashes", migrateUserPasswords},
+	{11, "session CSRF tokens", migrateSessionCSRF},
+	{12, "rate limit counters", migrateRateLimits},
+	{13, "api tokens", migrateAPITokens},
+	{14, "webhooks", migrateWebhooks},
+	{15, "inbound hooks", migrateInboundHooks},
+	{16, "caldav objects", migrateCalDAVObjects},
+	{17, "per-user active list", migrateUserActiveList},
+	{18, "inbound hook mail aliases", migrateInboundHookMailAliases},
+}
+
+// migrations returns the migrations of the current backend.
+// New migrations get the same version number in both lists.
+func migrations() []Migration {
+	if backend == Postgres {
+		return postgresMigrations
+	}
+	return sqliteMigrations
+}
+
+// ensureMigrationsTable creates the table recording applied migrations
+func ensureMigrationsTable() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at BIGINT NOT NULL
+		)
+	`)
+	return err
+}
+
+// appliedMigrations returns the applied versions and when they were applied
+func appliedMigrations() (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = time.Unix(appliedAt, 0)
+	}
+	return applied, rows.Err()
+}
+
+// GetMigrationStatus lists all known migrations with their applied time
+func GetMigrationStatus() ([]MigrationState, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations()))
+	for _, m := range migrations() {
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if t, ok := applied[m.Version]; ok {
+			t := t
+			state.AppliedAt = &t
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// PendingMigrations returns the number of migrations not applied yet.
+// Fails if the database was migrated by a newer version of the app.
+func PendingMigrations() (int, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := checkNotNewer(applied); err != nil {
+		return 0, err
+	}
+	return len(migrations()) - len(applied), nil
+}
+
+func checkNotNewer(applied map[int]time.Time) error {
+	all := migrations()
+	latest := all[len(all)-1].Version
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("database schema version %d is newer than this build supports (%d); upgrade the app", version, latest)
+		}
+	}
+	return nil
+}
+
+// Migrate applies all pending migrations in order and returns how many ran.
+// It stops at the first failure; that migration is rolled back completely.
+func Migrate() (int, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+	if err := checkNotNewer(applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations() {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(m); err != nil {
+			return count, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+func applyMigration(m Migration) error {
+	log.Printf("Running migration %d: %s...", m.Version, m.Name)
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Migration completed: %d %s", m.Version, m.Name)
+	return nil
+}
+
+func tableExists(tx *sql.Tx, table string) (bool, error) {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&count)
+	return count > 0, err
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?", table, column).Scan(&count)
+	return count > 0, err
+}
+
+// execAll runs statements in order, stopping at the first error
+func execAll(tx *sql.Tx, statements ...string) error {
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ==================== SQLITE MIGRATIONS ====================
+
+func migrateInitialSchema(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS sections (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			sort_order INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at INTEGER DEFAULT (strftime('%s', 'now'))
+		);
+
+		CREATE TABLE IF NOT EXISTS items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			section_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			completed BOOLEAN DEFAULT FALSE,
+			uncertain BOOLEAN DEFAULT FALSE,
+			sort_order INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at INTEGER DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (section_id) REFERENCES sections(id) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			expires_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS item_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL COLLATE NOCASE,
+			last_section_id INTEGER,
+			usage_count INTEGER DEFAULT 1,
+			last_used_at INTEGER DEFAULT (strftime('%s', 'now')),
+			UNIQUE(name COLLATE NOCASE)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_items_section ON items(section_id, sort_order);
+		CREATE INDEX IF NOT EXISTS idx_sections_order ON sections(sort_order);
+		CREATE INDEX IF NOT EXISTS idx_item_history_name ON item_history(name COLLATE NOCASE);
+	`)
+	return err
+}
+
+func migrateUpdatedAt(tx *sql.Tx) error {
+	for _, table := range []string{"sections", "items"} {
+		exists, err := columnExists(tx, table, "updated_at")
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		// SQLite doesn't support dynamic DEFAULT in ALTER TABLE, so add with NULL first
+		err = execAll(tx,
+			"ALTER TABLE "+table+" ADD COLUMN updated_at INTEGER",
+			"UPDATE "+table+" SET updated_at = strftime('%s', 'now')",
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateToMultipleLists(tx *sql.Tx) error {
+	if exists, err := tableExists(tx, "lists"); err != nil || exists {
+		return err // Already migrated
+	}
+
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS lists (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			sort_order INTEGER NOT NULL,
+			is_active BOOLEAN DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at INTEGER DEFAULT (strftime('%s', 'now'))
+		);
+		CREATE INDEX IF NOT EXISTS idx_lists_order ON lists(sort_order);
+		CREATE INDEX IF NOT EXISTS idx_lists_active ON lists(is_active);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create default list
+	result, err := tx.Exec(`INSERT INTO lists (name, sort_order, is_active) VALUES ('Lista zakupów', 0, TRUE)`)
+	if err != nil {
+		return err
+	}
+	defaultListID, _ := result.LastInsertId()
+
+	// Existing sections move to the default list
+	if _, err := tx.Exec("ALTER TABLE sections ADD COLUMN list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE sections SET list_id = ?", defaultListID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS idx_sections_list ON sections(list_id, sort_order)")
+	return err
+}
+
+func migrateTemplates(tx *sql.Tx) error {
+	if exists, err := tableExists(tx, "templates"); err != nil || exists {
+		return err // Already migrated
+	}
+
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			sort_order INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at INTEGER DEFAULT (strftime('%s', 'now'))
+		);
+		CREATE INDEX IF NOT EXISTS idx_templates_order ON templates(sort_order);
+
+		CREATE TABLE IF NOT EXISTS template_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			template_id INTEGER NOT NULL,
+			section_name TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			sort_order INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (template_id) REFERENCES templates(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_template_items_template ON template_items(template_id, sort_order);
+	`)
+	return err
+}
+
+func migrateListIcons(tx *sql.Tx) error {
+	if exists, err := columnExists(tx, "lists", "icon"); err != nil || exists {
+		return err // Already migrated
+	}
+
+	_, err := tx.Exec("ALTER TABLE lists ADD COLUMN icon TEXT DEFAULT '🛒'")
+	return err
+}
+
+func migrateListPermissions(tx *sql.Tx) error {
+	if exists, err := tableExists(tx, "users"); err != nil || exists {
+		return err // Already migrated
+	}
+
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL COLLATE NOCASE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(username COLLATE NOCASE)
+		);
+
+		CREATE TABLE IF NOT EXISTS list_members (
+			list_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			role TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (list_id, user_id),
+			FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_list_members_user ON list_members(user_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Existing lists have no owner and stay shared with everyone.
+	// Sessions created before this migration have no user and will be rejected.
+	return execAll(tx,
+		"ALTER TABLE lists ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL",
+		"ALTER TABLE lists ADD COLUMN is_private BOOLEAN DEFAULT FALSE",
+		"ALTER TABLE sessions ADD COLUMN user_id INTEGER REFERENCES users(id) ON DELETE CASCADE",
+	)
+}
+
+func migrateUserIdentities(tx *sql.Tx) error {
+	if exists, err := tableExists(tx, "user_identities"); err != nil || exists {
+		return err // Already migrated
+	}
+
+	// Links an identity provider's subject to a local user
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+			issuer TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (issuer, subject),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	return err
+}
+
+func migrateTwoFactor(tx *sql.Tx) error {
+	if exists, err := tableExists(tx, "user_totp"); err != nil || exists {
+		return err // Already migrated
+	}
+
+	// last_used_step blocks replaying a code within its validity window
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS user_totp (
+			user_id INTEGER PRIMARY KEY,
+			secret TEXT NOT NULL,
+			enabled BOOLEAN DEFAULT FALSE,
+			last_used_step INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			code_hash TEXT NOT NULL,
+			used_at INTEGER,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON user_recovery_codes(user_id);
+	`)
+	return err
+}
+
+func migrateSessionDetails(tx *sql.Tx) error {
+	if exists, err := columnExists(tx, "sessions", "public_id"); err != nil || exists {
+		return err // Already migrated
+	}
+
+	// public_id identifies a session in listings without revealing the cookie value
+	return execAll(tx,
+		"ALTER TABLE sessions ADD COLUMN public_id TEXT",
+		"ALTER TABLE sessions ADD COLUMN device_label TEXT DEFAULT ''",
+		"ALTER TABLE sessions ADD COLUMN user_agent TEXT DEFAULT ''",
+		"ALTER TABLE sessions ADD COLUMN ip TEXT DEFAULT ''",
+		"ALTER TABLE sessions ADD COLUMN created_at INTEGER DEFAULT 0",
+		"ALTER TABLE sessions ADD COLUMN last_seen_at INTEGER DEFAULT 0",
+		"UPDATE sessions SET public_id = lower(hex(randomblob(8))), device_label = 'Unknown device'",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_public_id ON sessions(public_id)",
+		"CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)",
+	)
+}
+
+func migrateUserPasswords(tx *sql.Tx) error {
+	if exists, err := columnExists(tx, "users", "password_hash"); err != nil || exists {
+		return err // Already migrated
+	}
+
+	// Hashes are seeded from APP_PASSWORD / APP_USERS on the next start
+	_, err := tx.Exec("ALTER TABLE users ADD COLUMN password_hash TEXT DEFAULT ''")
+	return err
+}
+
+func migrateSessionCSRF(tx *sql.Tx) error {
+	if exists, err := columnExists(tx, "sessions", "csrf_token"); err != nil || exists {
+		return err // Already migrated
+	}
+
+	// Give existing sessions a token so open pages keep working after a reload
+	return execAll(tx,
+		"ALTER TABLE sessions ADD COLUMN csrf_token TEXT DEFAULT ''",
+		"UPDATE sessions SET csrf_token = lower(hex(randomblob(32)))",
+	)
+}
+
+func migrateRateLimits(tx *sql.Tx) error {
+	// Only used when RATE_LIMIT_PERSIST=true; counters survive restarts
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS rate_limits (
+			key TEXT PRIMARY KEY,
+			count INTEGER NOT NULL DEFAULT 0,
+			window_start INTEGER NOT NULL,
+			blocked_until INTEGER NOT NULL DEFAULT 0
+		);
+	`)
+	return err
+}
+
+func migrateAPITokens(tx *sql.Tx) error {
+	// A token without user_id has full access, like API_TOKEN
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			token_hash TEXT NOT NULL UNIQUE,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			created_at INTEGER NOT NULL,
+			last_used_at INTEGER NOT NULL DEFAULT 0
+		);
+	`)
+	return err
+}
+
+func migrateWebhooks(tx *sql.Tx) error {
+	// Events is a comma-separated list of event types, or "*" for all.
+	// Deliveries are both the retry queue and the delivery log.
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL DEFAULT '*',
+			list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at INTEGER NOT NULL,
+			response_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			finished_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+	`)
+	return err
+}
+
+func migrateInboundHooks(tx *sql.Tx) error {
+	// A hook token can only add items to its list, or to one section of it
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS inbound_hooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			token_hash TEXT NOT NULL UNIQUE,
+			list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+			section_id INTEGER REFERENCES sections(id) ON DELETE SET NULL,
+			allow_get BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at INTEGER NOT NULL,
+			last_used_at INTEGER NOT NULL DEFAULT 0
+		);
+	`)
+	return err
+}
+
+func migrateCalDAVObjects(tx *sql.Tx) error {
+	// Items created over CalDAV keep the resource name and UID the client chose
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS caldav_objects (
+			item_id INTEGER PRIMARY KEY REFERENCES items(id) ON DELETE CASCADE,
+			name TEXT NOT NULL UNIQUE,
+			uid TEXT NOT NULL
+		);
+	`)
+	return err
+}
+
+func migrateUserActiveList(tx *sql.Tx) error {
+	// Each user has their own list open; lists.is_active stays the default
+	// for users who haven't picked one and for access without a user
+	_, err := tx.Exec("ALTER TABLE users ADD COLUMN active_list_id INTEGER REFERENCES lists(id) ON DELETE SET NULL")
+	return err
+}
+
+func migrateInboundHookMailAliases(tx *sql.Tx) error {
+	// Mail goes to an alias of its own rather than the hook token, so the
+	// address of a list can be shared without giving away its hook URL.
+	// Existing hooks get a random alias; their token addresses stop working.
+	return execAll(tx,
+		"ALTER TABLE inbound_hooks ADD COLUMN mail_alias TEXT",
+		"UPDATE inbound_hooks SET mail_alias = lower(hex(randomblob(8)))",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_inbound_hooks_mail_alias ON inbound_hooks(mail_alias)",
+	)
+}
@@ -0,0 +1,243 @@
+package db
+
+import "database/sql"
+
+// postgresMigrations start at 12, the SQLite version whose schema the initial
+// one matches, so later migrations share their version number on both backends
+var postgresMigrations = []Migration{
+	{12, "initial schema", migratePostgresInitialSchema},
+	{13, "api tokens", migratePostgresAPITokens},
+	{14, "webhooks", migratePostgresWebhooks},
+	{15, "inbound hooks", migratePostgresInboundHooks},
+	{16, "caldav objects", migratePostgresCalDAVObjects},
+	{17, "per-user active list", migratePostgresUserActiveList},
+	{18, "inbound hook mail aliases", migratePostgresInboundHookMailAliases},
+}
+
+func migratePostgresInitialSchema(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id BIGSERIAL PRIMARY KEY,
+			username TEXT NOT NULL,
+			password_hash TEXT DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users(lower(username));
+
+		CREATE TABLE IF NOT EXISTS lists (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			icon TEXT DEFAULT '🛒',
+			sort_order INTEGER NOT NULL,
+			is_active BOOLEAN DEFAULT FALSE,
+			owner_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+			is_private BOOLEAN DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at BIGINT DEFAULT EXTRACT(EPOCH FROM now())::BIGINT
+		);
+		CREATE INDEX IF NOT EXISTS idx_lists_order ON lists(sort_order);
+		CREATE INDEX IF NOT EXISTS idx_lists_active ON lists(is_active);
+
+		CREATE TABLE IF NOT EXISTS sections (
+			id BIGSERIAL PRIMARY KEY,
+			list_id BIGINT REFERENCES lists(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			sort_order INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at BIGINT DEFAULT EXTRACT(EPOCH FROM now())::BIGINT
+		);
+		CREATE INDEX IF NOT EXISTS idx_sections_order ON sections(sort_order);
+		CREATE INDEX IF NOT EXISTS idx_sections_list ON sections(list_id, sort_order);
+
+		CREATE TABLE IF NOT EXISTS items (
+			id BIGSERIAL PRIMARY KEY,
+			section_id BIGINT NOT NULL REFERENCES sections(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			completed BOOLEAN DEFAULT FALSE,
+			uncertain BOOLEAN DEFAULT FALSE,
+			sort_order INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at BIGINT DEFAULT EXTRACT(EPOCH FROM now())::BIGINT
+		);
+		CREATE INDEX IF NOT EXISTS idx_items_section ON items(section_id, sort_order);
+
+		CREATE TABLE IF NOT EXISTS item_history (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			last_section_id BIGINT,
+			usage_count INTEGER DEFAULT 1,
+			last_used_at BIGINT DEFAULT EXTRACT(EPOCH FROM now())::BIGINT
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_item_history_name ON item_history(lower(name));
+
+		CREATE TABLE IF NOT EXISTS templates (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			sort_order INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at BIGINT DEFAULT EXTRACT(EPOCH FROM now())::BIGINT
+		);
+		CREATE INDEX IF NOT EXISTS idx_templates_order ON templates(sort_order);
+
+		CREATE TABLE IF NOT EXISTS template_items (
+			id BIGSERIAL PRIMARY KEY,
+			template_id BIGINT NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+			section_name TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			sort_order INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_template_items_template ON template_items(template_id, sort_order);
+
+		CREATE TABLE IF NOT EXISTS list_members (
+			list_id BIGINT NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+			user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (list_id, user_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_list_members_user ON list_members(user_id);
+
+		CREATE TABLE IF NOT EXISTS user_identities (
+			issuer TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (issuer, subject)
+		);
+
+		CREATE TABLE IF NOT EXISTS user_totp (
+			user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			secret TEXT NOT NULL,
+			enabled BOOLEAN DEFAULT FALSE,
+			last_used_step BIGINT DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			id BIGSERIAL PRIMARY KEY,
+			user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash TEXT NOT NULL,
+			used_at BIGINT
+		);
+		CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON user_recovery_codes(user_id);
+
+		CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			public_id TEXT,
+			user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+			device_label TEXT DEFAULT '',
+			user_agent TEXT DEFAULT '',
+			ip TEXT DEFAULT '',
+			csrf_token TEXT DEFAULT '',
+			created_at BIGINT DEFAULT 0,
+			last_seen_at BIGINT DEFAULT 0,
+			expires_at BIGINT NOT NULL
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_public_id ON sessions(public_id);
+		CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+
+		CREATE TABLE IF NOT EXISTS rate_limits (
+			key TEXT PRIMARY KEY,
+			count INTEGER NOT NULL DEFAULT 0,
+			window_start BIGINT NOT NULL,
+			blocked_until BIGINT NOT NULL DEFAULT 0
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create default list, as the SQLite "multiple lists" migration does
+	_, err = tx.Exec(`INSERT INTO lists (name, sort_order, is_active) VALUES ('Lista zakupów', 0, TRUE)`)
+	return err
+}
+
+func migratePostgresAPITokens(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			token_hash TEXT NOT NULL UNIQUE,
+			user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+			created_at BIGINT NOT NULL,
+			last_used_at BIGINT NOT NULL DEFAULT 0
+		);
+	`)
+	return err
+}
+
+func migratePostgresWebhooks(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL DEFAULT '*',
+			list_id BIGINT REFERENCES lists(id) ON DELETE CASCADE,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at BIGINT NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at BIGINT NOT NULL,
+			response_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL,
+			finished_at BIGINT NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+	`)
+	return err
+}
+
+func migratePostgresInboundHooks(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS inbound_hooks (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			token_hash TEXT NOT NULL UNIQUE,
+			list_id BIGINT NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+			section_id BIGINT REFERENCES sections(id) ON DELETE SET NULL,
+			allow_get BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at BIGINT NOT NULL,
+			last_used_at BIGINT NOT NULL DEFAULT 0
+		);
+	`)
+	return err
+}
+
+func migratePostgresCalDAVObjects(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS caldav_objects (
+			item_id BIGINT PRIMARY KEY REFERENCES items(id) ON DELETE CASCADE,
+			name TEXT NOT NULL UNIQUE,
+			uid TEXT NOT NULL
+		);
+	`)
+	return err
+}
+
+func migratePostgresUserActiveList(tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE users ADD COLUMN IF NOT EXISTS active_list_id BIGINT REFERENCES lists(id) ON DELETE SET NULL")
+	return err
+}
+
+func migratePostgresInboundHookMailAliases(tx *sql.Tx) error {
+	return execAll(tx,
+		"ALTER TABLE inbound_hooks ADD COLUMN IF NOT EXISTS mail_alias TEXT",
+		"UPDATE inbound_hooks SET mail_alias = substr(md5(random()::text || id::text), 1, 16) WHERE mail_alias IS NULL",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_inbound_hooks_mail_alias ON inbound_hooks(mail_alias)",
+	)
+}
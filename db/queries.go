@@ -1,7 +1,9 @@
 package db
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"sort"
 	"strings"
@@ -32,10 +34,28 @@ type Item struct {
 	UpdatedAt   int64     `json:"updated_at"`
 }
 
-// Session represents a user session
+// Session represents a logged-in device.
+// ID is the cookie value and never leaves the server; PublicID names the session in listings.
 type Session struct {
-	ID        string
-	ExpiresAt int64
+	ID          string `json:"-"`
+	PublicID    string `json:"id"`
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username,omitempty"`
+	DeviceLabel string `json:"device_label"`
+	UserAgent   string `json:"user_agent"`
+	IP          string `json:"ip"`
+	CSRFToken   string `json:"-"`
+	CreatedAt   int64  `json:"created_at"`
+	LastSeenAt  int64  `json:"last_seen_at"`
+	ExpiresAt   int64  `json:"expires_at"`
+	Current     bool   `json:"current"`
+}
+
+// User represents a household member who can log in
+type User struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // List represents a shopping list
@@ -47,6 +67,9 @@ type List struct {
 	IsActive  bool      `json:"is_active"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt int64     `json:"updated_at"`
+	OwnerID   int64     `json:"owner_id,omitempty"`
+	IsPrivate bool      `json:"is_private"`
+	Role      string    `json:"role,omitempty"`
 	Stats     Stats     `json:"stats,omitempty"`
 }
 
@@ -74,13 +97,37 @@ type TemplateItem struct {
 
 // ==================== LISTS ====================
 
-// GetAllLists returns all shopping lists with their stats
-func GetAllLists() ([]List, error) {
-	rows, err := DB.Query(`
-		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0)
-		FROM lists
-		ORDER BY sort_order ASC
-	`)
+// GetAllLists returns all shopping lists visible to the user with their stats.
+// A userID of 0 means system access (auth disabled or API token) and returns every list.
+// IsActive marks the list the user has open.
+func (st *SQLStore) GetAllLists(userID int64) ([]List, error) {
+	lists, err := st.visibleLists(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range lists {
+		lists[i].Stats = st.GetListStats(lists[i].ID)
+	}
+	return lists, nil
+}
+
+// visibleLists returns the lists visible to the user without their stats
+func (st *SQLStore) visibleLists(userID int64) ([]List, error) {
+	var picked int64
+	if userID != 0 {
+		err := st.db.QueryRow("SELECT COALESCE(active_list_id, 0) FROM users WHERE id = ?", userID).Scan(&picked)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	rows, err := st.db.Query(`
+		SELECT l.id, l.name, COALESCE(l.icon, '🛒'), l.sort_order, l.is_active, l.created_at, COALESCE(l.updated_at, 0),
+			COALESCE(l.owner_id, 0), COALESCE(l.is_private, FALSE), COALESCE(m.role, '')
+		FROM lists l
+		LEFT JOIN list_members m ON m.list_id = l.id AND m.user_id = ?
+		ORDER BY l.sort_order ASC
+	`, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -89,90 +136,105 @@ func GetAllLists() ([]List, error) {
 	var lists []List
 	for rows.Next() {
 		var l List
-		err := rows.Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt)
+		var memberRole string
+		err := rows.Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt, &l.OwnerID, &l.IsPrivate, &memberRole)
 		if err != nil {
 			return nil, err
 		}
-		l.Stats = GetListStats(l.ID)
+		l.Role = resolveRole(userID, l.OwnerID, l.IsPrivate, memberRole)
+		if l.Role == RoleNone {
+			continue
+		}
 		lists = append(lists, l)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	markActiveList(lists, picked)
 	return lists, nil
 }
 
 // GetListByID returns a single list by ID
-func GetListByID(id int64) (*List, error) {
+func (st *SQLStore) GetListByID(id int64) (*List, error) {
 	var l List
-	err := DB.QueryRow(`
-		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0)
+	err := st.db.QueryRow(`
+		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0),
+			COALESCE(owner_id, 0), COALESCE(is_private, FALSE)
 		FROM lists WHERE id = ?
-	`, id).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt)
+	`, id).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt, &l.OwnerID, &l.IsPrivate)
 	if err != nil {
 		return nil, err
 	}
-	l.Stats = GetListStats(l.ID)
+	l.Stats = st.GetListStats(l.ID)
 	return &l, nil
 }
 
-// GetActiveList returns the currently active list
-func GetActiveList() (*List, error) {
-	var l List
-	err := DB.QueryRow(`
-		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0)
-		FROM lists WHERE is_active = TRUE
-		LIMIT 1
-	`).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt)
+// GetActiveList returns the list the user has open: the one they picked
+// last, else the default list, else the first list they can see
+func (st *SQLStore) GetActiveList(userID int64) (*List, error) {
+	lists, err := st.visibleLists(userID)
 	if err != nil {
 		return nil, err
 	}
-	l.Stats = GetListStats(l.ID)
-	return &l, nil
+	for _, l := range lists {
+		if l.IsActive {
+			l.Stats = st.GetListStats(l.ID)
+			return &l, nil
+		}
+	}
+	return nil, sql.ErrNoRows
 }
 
-// CreateList creates a new shopping list
-func CreateList(name, icon string) (*List, error) {
+// CreateList creates a new shopping list owned by ownerID (0 for no owner)
+func (st *SQLStore) CreateList(name, icon string, ownerID int64) (*List, error) {
 	var maxOrder int
-	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM lists").Scan(&maxOrder)
+	st.db.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM lists").Scan(&maxOrder)
 
 	if icon == "" {
 		icon = "🛒"
 	}
 
-	result, err := DB.Exec(`
-		INSERT INTO lists (name, icon, sort_order, is_active) VALUES (?, ?, ?, FALSE)
-	`, name, icon, maxOrder+1)
+	var id int64
+	err := st.db.QueryRow(`
+		INSERT INTO lists (name, icon, sort_order, is_active, owner_id) VALUES (?, ?, ?, FALSE, NULLIF(?, 0)) RETURNING id
+	`, name, icon, maxOrder+1, ownerID).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
-
-	id, _ := result.LastInsertId()
-	return GetListByID(id)
+	return st.GetListByID(id)
 }
 
 // UpdateList updates a list's name and icon
-func UpdateList(id int64, name, icon string) (*List, error) {
+func (st *SQLStore) UpdateList(id int64, name, icon string) (*List, error) {
 	if icon == "" {
-		_, err := DB.Exec(`UPDATE lists SET name = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, name, id)
+		_, err := st.db.Exec(`UPDATE lists SET name = ?, updated_at = ? WHERE id = ?`, name, time.Now().Unix(), id)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		_, err := DB.Exec(`UPDATE lists SET name = ?, icon = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, name, icon, id)
+		_, err := st.db.Exec(`UPDATE lists SET name = ?, icon = ?, updated_at = ? WHERE id = ?`, name, icon, time.Now().Unix(), id)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return GetListByID(id)
+	return st.GetListByID(id)
 }
 
 // DeleteList deletes a list and all its sections/items
-func DeleteList(id int64) error {
-	_, err := DB.Exec(`DELETE FROM lists WHERE id = ?`, id)
+func (st *SQLStore) DeleteList(id int64) error {
+	_, err := st.db.Exec(`DELETE FROM lists WHERE id = ?`, id)
 	return err
 }
 
-// SetActiveList sets a list as the active one
-func SetActiveList(id int64) error {
-	tx, err := DB.Begin()
+// SetActiveList opens a list for a user. With a userID of 0 it sets the
+// default list instead, which users who haven't picked one see.
+func (st *SQLStore) SetActiveList(userID, id int64) error {
+	if userID != 0 {
+		_, err := st.db.Exec("UPDATE users SET active_list_id = ? WHERE id = ?", id, userID)
+		return err
+	}
+
+	tx, err := st.db.Begin()
 	if err != nil {
 		return err
 	}
@@ -185,7 +247,7 @@ func SetActiveList(id int64) error {
 	}
 
 	// Activate the selected list
-	_, err = tx.Exec("UPDATE lists SET is_active = TRUE, updated_at = strftime('%s', 'now') WHERE id = ?", id)
+	_, err = tx.Exec("UPDATE lists SET is_active = TRUE, updated_at = ? WHERE id = ?", time.Now().Unix(), id)
 	if err != nil {
 		return err
 	}
@@ -194,8 +256,8 @@ func SetActiveList(id int64) error {
 }
 
 // MoveListUp moves a list up in sort order
-func MoveListUp(id int64) error {
-	tx, err := DB.Begin()
+func (st *SQLStore) MoveListUp(id int64) error {
+	tx, err := st.db.Begin()
 	if err != nil {
 		return err
 	}
@@ -225,8 +287,8 @@ func MoveListUp(id int64) error {
 }
 
 // MoveListDown moves a list down in sort order
-func MoveListDown(id int64) error {
-	tx, err := DB.Begin()
+func (st *SQLStore) MoveListDown(id int64) error {
+	tx, err := st.db.Begin()
 	if err != nil {
 		return err
 	}
@@ -260,14 +322,14 @@ func MoveListDown(id int64) error {
 }
 
 // GetListStats returns stats for a specific list
-func GetListStats(listID int64) Stats {
+func (st *SQLStore) GetListStats(listID int64) Stats {
 	var stats Stats
-	DB.QueryRow(`
+	st.db.QueryRow(`
 		SELECT COUNT(*) FROM items i
 		JOIN sections s ON i.section_id = s.id
 		WHERE s.list_id = ?
 	`, listID).Scan(&stats.TotalItems)
-	DB.QueryRow(`
+	st.db.QueryRow(`
 		SELECT COUNT(*) FROM items i
 		JOIN sections s ON i.section_id = s.id
 		WHERE s.list_id = ? AND i.completed = TRUE
@@ -278,53 +340,256 @@ func GetListStats(listID int64) Stats {
 	return stats
 }
 
-// ==================== SECTIONS ====================
+// ==================== LIST PERMISSIONS ====================
+
+// List roles, from most to least privileged
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+	RoleNone   = ""
+)
+
+var roleRank = map[string]int{
+	RoleNone:   0,
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// IsValidMemberRole reports whether role can be granted to a list member
+func IsValidMemberRole(role string) bool {
+	return role == RoleEditor || role == RoleViewer
+}
+
+// RoleAtLeast reports whether role grants at least the privileges of min
+func RoleAtLeast(role, min string) bool {
+	return roleRank[role] >= roleRank[min]
+}
+
+// ListMember represents a user granted access to a list
+type ListMember struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// ListACL holds everything needed to resolve a user's role on a list
+type ListACL struct {
+	ListID    int64
+	OwnerID   int64
+	IsPrivate bool
+	Members   map[int64]string
+}
+
+// Role returns the effective role of a user on the list
+func (a *ListACL) Role(userID int64) string {
+	return resolveRole(userID, a.OwnerID, a.IsPrivate, a.Members[userID])
+}
+
+// resolveRole applies the permission rules:
+// system access (userID 0) and the owner get full access, explicit members get their role,
+// shared lists are editable by everyone, and private lists are hidden from everyone else.
+// Lists without an owner, like those from before user accounts, can only be deleted or
+// have their permissions changed with system access until an owner is set.
+func resolveRole(userID, ownerID int64, isPrivate bool, memberRole string) string {
+	if userID == 0 || (ownerID != 0 && ownerID == userID) {
+		return RoleOwner
+	}
+	if memberRole != "" {
+		return memberRole
+	}
+	if !isPrivate {
+		return RoleEditor
+	}
+	return RoleNone
+}
+
+// markActiveList leaves IsActive set on the one list a user has open: the
+// list they picked if they can still see it, else the default list, else the
+// first one. Lists come in with IsActive marking the default list.
+func markActiveList(lists []List, picked int64) {
+	active := int64(0)
+	for _, l := range lists {
+		if picked != 0 && l.ID == picked {
+			active = picked
+			break
+		}
+		if active == 0 && l.IsActive {
+			active = l.ID
+		}
+	}
+	if active == 0 && len(lists) > 0 {
+		active = lists[0].ID
+	}
+	for i := range lists {
+		lists[i].IsActive = lists[i].ID == active
+	}
+}
+
+// GetListACL returns the owner, visibility and members of a list
+func (st *SQLStore) GetListACL(listID int64) (*ListACL, error) {
+	acl := &ListACL{ListID: listID, Members: make(map[int64]string)}
+	err := st.db.QueryRow(`
+		SELECT COALESCE(owner_id, 0), COALESCE(is_private, FALSE) FROM lists WHERE id = ?
+	`, listID).Scan(&acl.OwnerID, &acl.IsPrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := st.db.Query(`SELECT user_id, role FROM list_members WHERE list_id = ?`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-func GetAllSections() ([]Section, error) {
-	activeList, err := GetActiveList()
+	for rows.Next() {
+		var userID int64
+		var role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			return nil, err
+		}
+		acl.Members[userID] = role
+	}
+	return acl, nil
+}
+
+// GetListRole returns the effective role of a user on a list
+func (st *SQLStore) GetListRole(listID, userID int64) (string, error) {
+	acl, err := st.GetListACL(listID)
 	if err != nil {
-		// Fallback: return all sections if no active list (shouldn't happen)
-		return getAllSectionsGlobal()
+		return RoleNone, err
 	}
-	return GetSectionsByList(activeList.ID)
+	return acl.Role(userID), nil
 }
 
-// GetSectionsByList returns all sections for a specific list
-func GetSectionsByList(listID int64) ([]Section, error) {
-	rows, err := DB.Query(`
-		SELECT id, list_id, name, sort_order, created_at, COALESCE(updated_at, 0)
-		FROM sections
-		WHERE list_id = ?
-		ORDER BY sort_order ASC
+// GetListMembers returns users explicitly granted access to a list
+func (st *SQLStore) GetListMembers(listID int64) ([]ListMember, error) {
+	rows, err := st.db.Query(`
+		SELECT m.user_id, u.username, m.role
+		FROM list_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.list_id = ?
+		ORDER BY `+st.nocase("u.username")+` ASC
 	`, listID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var sections []Section
+	var members []ListMember
 	for rows.Next() {
-		var s Section
-		err := rows.Scan(&s.ID, &s.ListID, &s.Name, &s.SortOrder, &s.CreatedAt, &s.UpdatedAt)
-		if err != nil {
+		var m ListMember
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Role); err != nil {
 			return nil, err
 		}
-		s.Items, err = GetItemsBySection(s.ID)
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// SetListMember grants a user a role on a list, replacing any previous grant
+func (st *SQLStore) SetListMember(listID, userID int64, role string) error {
+	_, err := st.db.Exec(`
+		INSERT INTO list_members (list_id, user_id, role) VALUES (?, ?, ?)
+		ON CONFLICT(list_id, user_id) DO UPDATE SET role = excluded.role
+	`, listID, userID, role)
+	return err
+}
+
+// RemoveListMember revokes a user's explicit grant on a list
+func (st *SQLStore) RemoveListMember(listID, userID int64) error {
+	_, err := st.db.Exec(`DELETE FROM list_members WHERE list_id = ? AND user_id = ?`, listID, userID)
+	return err
+}
+
+// SetListPrivate changes whether a list is hidden from users without a grant.
+// An unowned list is claimed by claimantID so it cannot become invisible to everyone.
+func (st *SQLStore) SetListPrivate(listID int64, private bool, claimantID int64) error {
+	_, err := st.db.Exec(`
+		UPDATE lists SET is_private = ?, owner_id = COALESCE(owner_id, NULLIF(?, 0)), updated_at = ?
+		WHERE id = ?
+	`, private, claimantID, time.Now().Unix(), listID)
+	return err
+}
+
+// SetListOwner gives a list a new owner, sql.ErrNoRows if there is no such list
+func (st *SQLStore) SetListOwner(listID, ownerID int64) error {
+	result, err := st.db.Exec(`UPDATE lists SET owner_id = ?, updated_at = ? WHERE id = ?`, ownerID, time.Now().Unix(), listID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ReplaceListPermissions sets the visibility of a list, unless private is nil,
+// and replaces its members with the given user ID to role map in one transaction
+func (st *SQLStore) ReplaceListPermissions(listID int64, private *bool, claimantID int64, members map[int64]string) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceListPermissions(tx, listID, private, claimantID, members); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceListPermissions(tx *sql.Tx, listID int64, private *bool, claimantID int64, members map[int64]string) error {
+	if private != nil {
+		_, err := tx.Exec(`
+			UPDATE lists SET is_private = ?, owner_id = COALESCE(owner_id, NULLIF(?, 0)), updated_at = ?
+			WHERE id = ?
+		`, *private, claimantID, time.Now().Unix(), listID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		sections = append(sections, s)
 	}
-	return sections, nil
+
+	if _, err := tx.Exec(`DELETE FROM list_members WHERE list_id = ?`, listID); err != nil {
+		return err
+	}
+	for userID, role := range members {
+		if _, err := tx.Exec(`INSERT INTO list_members (list_id, user_id, role) VALUES (?, ?, ?)`, listID, userID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetItemListID returns the ID of the list an item belongs to
+func (st *SQLStore) GetItemListID(itemID int64) (int64, error) {
+	var listID int64
+	err := st.db.QueryRow(`
+		SELECT s.list_id FROM items i
+		JOIN sections s ON i.section_id = s.id
+		WHERE i.id = ?
+	`, itemID).Scan(&listID)
+	return listID, err
+}
+
+// GetSectionListID returns the ID of the list a section belongs to
+func (st *SQLStore) GetSectionListID(sectionID int64) (int64, error) {
+	var listID int64
+	err := st.db.QueryRow(`SELECT list_id FROM sections WHERE id = ?`, sectionID).Scan(&listID)
+	return listID, err
 }
 
-// getAllSectionsGlobal returns all sections (fallback, used during migration)
-func getAllSectionsGlobal() ([]Section, error) {
-	rows, err := DB.Query(`
+// ==================== SECTIONS ====================
+
+// GetSectionsByList returns all sections for a specific list
+func (st *SQLStore) GetSectionsByList(listID int64) ([]Section, error) {
+	rows, err := st.db.Query(`
 		SELECT id, list_id, name, sort_order, created_at, COALESCE(updated_at, 0)
 		FROM sections
+		WHERE list_id = ?
 		ORDER BY sort_order ASC
-	`)
+	`, listID)
 	if err != nil {
 		return nil, err
 	}
@@ -337,7 +602,7 @@ func getAllSectionsGlobal() ([]Section, error) {
 		if err != nil {
 			return nil, err
 		}
-		s.Items, err = GetItemsBySection(s.ID)
+		s.Items, err = st.GetItemsBySection(s.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -346,62 +611,53 @@ func getAllSectionsGlobal() ([]Section, error) {
 	return sections, nil
 }
 
-func GetSectionByID(id int64) (*Section, error) {
+func (st *SQLStore) GetSectionByID(id int64) (*Section, error) {
 	var s Section
-	err := DB.QueryRow(`
+	err := st.db.QueryRow(`
 		SELECT id, list_id, name, sort_order, created_at, COALESCE(updated_at, 0)
 		FROM sections WHERE id = ?
 	`, id).Scan(&s.ID, &s.ListID, &s.Name, &s.SortOrder, &s.CreatedAt, &s.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
-	s.Items, err = GetItemsBySection(s.ID)
+	s.Items, err = st.GetItemsBySection(s.ID)
 	if err != nil {
 		return nil, err
 	}
 	return &s, nil
 }
 
-func CreateSection(name string) (*Section, error) {
-	activeList, err := GetActiveList()
-	if err != nil {
-		return nil, fmt.Errorf("no active list found")
-	}
-	return CreateSectionForList(activeList.ID, name)
-}
-
 // CreateSectionForList creates a section for a specific list
-func CreateSectionForList(listID int64, name string) (*Section, error) {
+func (st *SQLStore) CreateSectionForList(listID int64, name string) (*Section, error) {
 	// Get max sort_order for this list
 	var maxOrder int
-	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM sections WHERE list_id = ?", listID).Scan(&maxOrder)
+	st.db.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM sections WHERE list_id = ?", listID).Scan(&maxOrder)
 
-	result, err := DB.Exec(`
-		INSERT INTO sections (name, sort_order, list_id) VALUES (?, ?, ?)
-	`, name, maxOrder+1, listID)
+	var id int64
+	err := st.db.QueryRow(`
+		INSERT INTO sections (name, sort_order, list_id) VALUES (?, ?, ?) RETURNING id
+	`, name, maxOrder+1, listID).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
-
-	id, _ := result.LastInsertId()
-	return GetSectionByID(id)
+	return st.GetSectionByID(id)
 }
 
-func UpdateSection(id int64, name string) (*Section, error) {
-	_, err := DB.Exec(`UPDATE sections SET name = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, name, id)
+func (st *SQLStore) UpdateSection(id int64, name string) (*Section, error) {
+	_, err := st.db.Exec(`UPDATE sections SET name = ?, updated_at = ? WHERE id = ?`, name, time.Now().Unix(), id)
 	if err != nil {
 		return nil, err
 	}
-	return GetSectionByID(id)
+	return st.GetSectionByID(id)
 }
 
-func DeleteSection(id int64) error {
-	_, err := DB.Exec(`DELETE FROM sections WHERE id = ?`, id)
+func (st *SQLStore) DeleteSection(id int64) error {
+	_, err := st.db.Exec(`DELETE FROM sections WHERE id = ?`, id)
 	return err
 }
 
-func MoveSectionUp(id int64) error {
-	tx, err := DB.Begin()
+func (st *SQLStore) MoveSectionUp(id int64) error {
+	tx, err := st.db.Begin()
 	if err != nil {
 		return err
 	}
@@ -437,8 +693,8 @@ func MoveSectionUp(id int64) error {
 	return tx.Commit()
 }
 
-func MoveSectionDown(id int64) error {
-	tx, err := DB.Begin()
+func (st *SQLStore) MoveSectionDown(id int64) error {
+	tx, err := st.db.Begin()
 	if err != nil {
 		return err
 	}
@@ -476,231 +732,1041 @@ func MoveSectionDown(id int64) error {
 	if err != nil {
 		return err
 	}
-
-	return tx.Commit()
+
+	return tx.Commit()
+}
+
+// ==================== ITEMS ====================
+
+func (st *SQLStore) GetItemsBySection(sectionID int64) ([]Item, error) {
+	rows, err := st.db.Query(`
+		SELECT id, section_id, name, description, completed, uncertain, sort_order, created_at, COALESCE(updated_at, 0)
+		FROM items
+		WHERE section_id = ?
+		ORDER BY completed ASC, sort_order ASC
+	`, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Item
+	for rows.Next() {
+		var i Item
+		err := rows.Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, nil
+}
+
+func (st *SQLStore) GetItemByID(id int64) (*Item, error) {
+	var i Item
+	err := st.db.QueryRow(`
+		SELECT id, section_id, name, description, completed, uncertain, sort_order, created_at, COALESCE(updated_at, 0)
+		FROM items WHERE id = ?
+	`, id).Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func (st *SQLStore) CreateItem(sectionID int64, name, description string) (*Item, error) {
+	// Get max sort_order for this section
+	var maxOrder int
+	st.db.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", sectionID).Scan(&maxOrder)
+
+	var id int64
+	err := st.db.QueryRow(`
+		INSERT INTO items (section_id, name, description, sort_order) VALUES (?, ?, ?, ?) RETURNING id
+	`, sectionID, name, description, maxOrder+1).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetItemByID(id)
+}
+
+func (st *SQLStore) UpdateItem(id int64, name, description string) (*Item, error) {
+	_, err := st.db.Exec(`
+		UPDATE items SET name = ?, description = ?, updated_at = ? WHERE id = ?
+	`, name, description, time.Now().Unix(), id)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetItemByID(id)
+}
+
+func (st *SQLStore) DeleteItem(id int64) error {
+	_, err := st.db.Exec(`DELETE FROM items WHERE id = ?`, id)
+	return err
+}
+
+// DeleteCompletedItems deletes all completed items from a list
+func (st *SQLStore) DeleteCompletedItems(listID int64) (int64, error) {
+	result, err := st.db.Exec(`
+		DELETE FROM items WHERE completed = TRUE AND section_id IN (
+			SELECT id FROM sections WHERE list_id = ?
+		)
+	`, listID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (st *SQLStore) ToggleItemCompleted(id int64) (*Item, error) {
+	_, err := st.db.Exec(`UPDATE items SET completed = NOT completed, updated_at = ? WHERE id = ?`, time.Now().Unix(), id)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetItemByID(id)
+}
+
+func (st *SQLStore) ToggleItemUncertain(id int64) (*Item, error) {
+	_, err := st.db.Exec(`UPDATE items SET uncertain = NOT uncertain, updated_at = ? WHERE id = ?`, time.Now().Unix(), id)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetItemByID(id)
+}
+
+func (st *SQLStore) MoveItemToSection(id, newSectionID int64) (*Item, error) {
+	// Get max sort_order in new section
+	var maxOrder int
+	st.db.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", newSectionID).Scan(&maxOrder)
+
+	_, err := st.db.Exec(`
+		UPDATE items SET section_id = ?, sort_order = ?, updated_at = ? WHERE id = ?
+	`, newSectionID, maxOrder+1, time.Now().Unix(), id)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetItemByID(id)
+}
+
+func (st *SQLStore) MoveItemUp(id int64) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sectionID int64
+	var sortOrder int
+	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ?", id).Scan(&sectionID, &sortOrder)
+	if err != nil {
+		return err
+	}
+
+	if sortOrder == 0 {
+		return nil // Already at top
+	}
+
+	// Swap with previous item in same section
+	_, err = tx.Exec(`
+		UPDATE items SET sort_order = sort_order + 1
+		WHERE section_id = ? AND sort_order = ?
+	`, sectionID, sortOrder-1)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE items SET sort_order = ? WHERE id = ?
+	`, sortOrder-1, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (st *SQLStore) MoveItemDown(id int64) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sectionID int64
+	var sortOrder int
+	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ?", id).Scan(&sectionID, &sortOrder)
+	if err != nil {
+		return err
+	}
+
+	var maxOrder int
+	err = tx.QueryRow("SELECT MAX(sort_order) FROM items WHERE section_id = ?", sectionID).Scan(&maxOrder)
+	if err != nil {
+		return err
+	}
+
+	if sortOrder >= maxOrder {
+		return nil // Already at bottom
+	}
+
+	// Swap with next item in same section
+	_, err = tx.Exec(`
+		UPDATE items SET sort_order = sort_order - 1
+		WHERE section_id = ? AND sort_order = ?
+	`, sectionID, sortOrder+1)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE items SET sort_order = ? WHERE id = ?
+	`, sortOrder+1, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ==================== USERS ====================
+
+// GetOrCreateUser returns the user with the given name, creating it on first login
+func (st *SQLStore) GetOrCreateUser(username string) (*User, error) {
+	_, err := st.db.Exec(`INSERT INTO users (username) VALUES (?) ON CONFLICT(`+st.nocase("username")+`) DO NOTHING`, username)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetUserByUsername(username)
+}
+
+// GetUserByUsername returns a user by name (case-insensitive)
+func (st *SQLStore) GetUserByUsername(username string) (*User, error) {
+	var u User
+	err := st.db.QueryRow(`
+		SELECT id, username, created_at FROM users WHERE `+st.nocaseEquals("username"), username).Scan(&u.ID, &u.Username, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUserPasswordHash returns the stored password hash, empty if the user has none
+func (st *SQLStore) GetUserPasswordHash(userID int64) (string, error) {
+	var hash string
+	err := st.db.QueryRow(`SELECT COALESCE(password_hash, '') FROM users WHERE id = ?`, userID).Scan(&hash)
+	return hash, err
+}
+
+// SetUserPasswordHash replaces the stored password hash of a user
+func (st *SQLStore) SetUserPasswordHash(userID int64, hash string) error {
+	result, err := st.db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, hash, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserByID returns a user by ID
+func (st *SQLStore) GetUserByID(id int64) (*User, error) {
+	var u User
+	err := st.db.QueryRow(`SELECT id, username, created_at FROM users WHERE id = ?`, id).Scan(&u.ID, &u.Username, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetAllUsers returns all users ordered by name
+func (st *SQLStore) GetAllUsers() ([]User, error) {
+	rows, err := st.db.Query(`SELECT id, username, created_at FROM users ORDER BY ` + st.nocase("username") + ` ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// GetUserByIdentity returns the user linked to an identity provider subject
+func (st *SQLStore) GetUserByIdentity(issuer, subject string) (*User, error) {
+	var u User
+	err := st.db.QueryRow(`
+		SELECT u.id, u.username, u.created_at
+		FROM user_identities ui
+		JOIN users u ON u.id = ui.user_id
+		WHERE ui.issuer = ? AND ui.subject = ?
+	`, issuer, subject).Scan(&u.ID, &u.Username, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// LinkUserIdentity links an identity provider subject to a user
+func (st *SQLStore) LinkUserIdentity(issuer, subject string, userID int64) error {
+	_, err := st.db.Exec(`
+		INSERT INTO user_identities (issuer, subject, user_id) VALUES (?, ?, ?)
+		ON CONFLICT(issuer, subject) DO UPDATE SET user_id = excluded.user_id
+	`, issuer, subject, userID)
+	return err
+}
+
+// ==================== TWO-FACTOR ====================
+
+// UserTOTP is a user's authenticator app enrolment
+type UserTOTP struct {
+	UserID       int64
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+// GetUserTOTP returns the TOTP enrolment of a user
+func (st *SQLStore) GetUserTOTP(userID int64) (*UserTOTP, error) {
+	var t UserTOTP
+	err := st.db.QueryRow(`
+		SELECT user_id, secret, COALESCE(enabled, FALSE), COALESCE(last_used_step, 0)
+		FROM user_totp WHERE user_id = ?
+	`, userID).Scan(&t.UserID, &t.Secret, &t.Enabled, &t.LastUsedStep)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// IsTOTPEnabled returns true if the user must enter a code at login
+func (st *SQLStore) IsTOTPEnabled(userID int64) (bool, error) {
+	var enabled bool
+	err := st.db.QueryRow(`SELECT COALESCE(enabled, FALSE) FROM user_totp WHERE user_id = ?`, userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return enabled, err
+}
+
+// SaveTOTPSecret stores a new, not yet confirmed secret.
+// An already enabled enrolment is left untouched.
+func (st *SQLStore) SaveTOTPSecret(userID int64, secret string) error {
+	_, err := st.db.Exec(`
+		INSERT INTO user_totp (user_id, secret, enabled) VALUES (?, ?, FALSE)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_used_step = 0
+		WHERE user_totp.enabled = FALSE
+	`, userID, secret)
+	return err
+}
+
+// EnableTOTP turns on two-factor login and replaces the recovery codes
+func (st *SQLStore) EnableTOTP(userID, step int64, recoveryCodeHashes []string) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE user_totp SET enabled = TRUE, last_used_step = ? WHERE user_id = ?`, step, userID); err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodesTx(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableTOTP removes the enrolment and all recovery codes
+func (st *SQLStore) DisableTOTP(userID int64) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records a successfully verified time step.
+// Returns false if this or a later step was already used (replayed code).
+func (st *SQLStore) UseTOTPStep(userID, step int64) (bool, error) {
+	result, err := st.db.Exec(`
+		UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?
+	`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// ReplaceRecoveryCodes swaps all recovery codes of a user for new ones
+func (st *SQLStore) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodesTx(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodesTx(tx *sql.Tx, userID int64, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used. Returns false if no such code.
+func (st *SQLStore) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	result, err := st.db.Exec(`
+		UPDATE user_recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, time.Now().Unix(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left
+func (st *SQLStore) CountRecoveryCodes(userID int64) int {
+	var count int
+	st.db.QueryRow(`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&count)
+	return count
+}
+
+// ==================== SESSIONS ====================
+
+// CreateSession stores a new session; PublicID is generated if empty
+func (st *SQLStore) CreateSession(s *Session) error {
+	now := time.Now().Unix()
+	if s.CreatedAt == 0 {
+		s.CreatedAt = now
+	}
+	if s.LastSeenAt == 0 {
+		s.LastSeenAt = now
+	}
+	if s.PublicID == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		s.PublicID = hex.EncodeToString(b)
+	}
+	_, err := st.db.Exec(`
+		INSERT INTO sessions (id, public_id, user_id, device_label, user_agent, ip, csrf_token, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?)
+	`, s.ID, s.PublicID, s.UserID, s.DeviceLabel, s.UserAgent, s.IP, s.CSRFToken, s.CreatedAt, s.LastSeenAt, s.ExpiresAt)
+	return err
+}
+
+const sessionColumns = `
+	s.id, COALESCE(s.public_id, ''), COALESCE(s.user_id, 0), COALESCE(u.username, ''),
+	COALESCE(s.device_label, ''), COALESCE(s.user_agent, ''), COALESCE(s.ip, ''), COALESCE(s.csrf_token, ''),
+	COALESCE(s.created_at, 0), COALESCE(s.last_seen_at, 0), s.expires_at
+`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	var s Session
+	err := row.Scan(&s.ID, &s.PublicID, &s.UserID, &s.Username,
+		&s.DeviceLabel, &s.UserAgent, &s.IP, &s.CSRFToken,
+		&s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (st *SQLStore) GetSession(id string) (*Session, error) {
+	return scanSession(st.db.QueryRow(`
+		SELECT `+sessionColumns+`
+		FROM sessions s LEFT JOIN users u ON u.id = s.user_id
+		WHERE s.id = ?
+	`, id))
+}
+
+// GetSessions returns the unexpired sessions of a user, most recently used first.
+// userID 0 returns the sessions of all users.
+func (st *SQLStore) GetSessions(userID int64) ([]Session, error) {
+	rows, err := st.db.Query(`
+		SELECT `+sessionColumns+`
+		FROM sessions s LEFT JOIN users u ON u.id = s.user_id
+		WHERE s.expires_at >= ? AND (? = 0 OR s.user_id = ?)
+		ORDER BY s.last_seen_at DESC
+	`, time.Now().Unix(), userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records activity and slides the expiry forward
+func (st *SQLStore) TouchSession(id, ip string, lastSeenAt, expiresAt int64) error {
+	_, err := st.db.Exec(`
+		UPDATE sessions SET ip = ?, last_seen_at = ?, expires_at = ? WHERE id = ?
+	`, ip, lastSeenAt, expiresAt, id)
+	return err
+}
+
+// RenameSession changes the device label of a session.
+// userID 0 may rename any session. Returns sql.ErrNoRows if no session matched.
+func (st *SQLStore) RenameSession(publicID string, userID int64, label string) error {
+	result, err := st.db.Exec(`
+		UPDATE sessions SET device_label = ? WHERE public_id = ? AND (? = 0 OR user_id = ?)
+	`, label, publicID, userID, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (st *SQLStore) DeleteSession(id string) error {
+	_, err := st.db.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+// RevokeSession deletes a session by its public ID.
+// userID 0 may revoke any session. Returns sql.ErrNoRows if no session matched.
+func (st *SQLStore) RevokeSession(publicID string, userID int64) error {
+	result, err := st.db.Exec(`
+		DELETE FROM sessions WHERE public_id = ? AND (? = 0 OR user_id = ?)
+	`, publicID, userID, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeOtherSessions deletes all sessions of a user except keepID.
+// Returns the number of sessions removed.
+func (st *SQLStore) RevokeOtherSessions(userID int64, keepID string) (int64, error) {
+	result, err := st.db.Exec(`DELETE FROM sessions WHERE user_id = ? AND id != ?`, userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (st *SQLStore) CleanExpiredSessions() error {
+	_, err := st.db.Exec(`DELETE FROM sessions WHERE expires_at < ?`, time.Now().Unix())
+	return err
+}
+
+// ==================== RATE LIMITS ====================
+
+// RateLimitEntry is the counter of one rate-limited key (unix seconds)
+type RateLimitEntry struct {
+	Count        int
+	WindowStart  int64
+	BlockedUntil int64
+}
+
+// GetRateLimit returns the counter for a key, sql.ErrNoRows if there is none
+func (st *SQLStore) GetRateLimit(key string) (*RateLimitEntry, error) {
+	var e RateLimitEntry
+	err := st.db.QueryRow(`
+		SELECT count, window_start, blocked_until FROM rate_limits WHERE key = ?
+	`, key).Scan(&e.Count, &e.WindowStart, &e.BlockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// SaveRateLimit stores the counter for a key
+func (st *SQLStore) SaveRateLimit(key string, e *RateLimitEntry) error {
+	_, err := st.db.Exec(`
+		INSERT INTO rate_limits (key, count, window_start, blocked_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			count = excluded.count,
+			window_start = excluded.window_start,
+			blocked_until = excluded.blocked_until
+	`, key, e.Count, e.WindowStart, e.BlockedUntil)
+	return err
+}
+
+// DeleteRateLimit removes the counter for a key
+func (st *SQLStore) DeleteRateLimit(key string) error {
+	_, err := st.db.Exec(`DELETE FROM rate_limits WHERE key = ?`, key)
+	return err
+}
+
+// CleanRateLimits removes counters of keys with the prefix whose window started
+// before the given time and that aren't blocked
+func (st *SQLStore) CleanRateLimits(prefix string, windowStartBefore, now int64) error {
+	_, err := st.db.Exec(`
+		DELETE FROM rate_limits
+		WHERE substr(key, 1, ?) = ? AND window_start < ? AND blocked_until < ?
+	`, len(prefix), prefix, windowStartBefore, now)
+	return err
+}
+
+// ==================== API TOKENS ====================
+
+// APIToken is a named API token; UserID 0 means full access
+type APIToken struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username,omitempty"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at"`
+}
+
+const apiTokenColumns = `
+	t.id, t.name, COALESCE(t.user_id, 0), COALESCE(u.username, ''), t.created_at, t.last_used_at
+`
+
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var t APIToken
+	err := row.Scan(&t.ID, &t.Name, &t.UserID, &t.Username, &t.CreatedAt, &t.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateAPIToken stores the hash of a new token; userID 0 gives it full access
+func (st *SQLStore) CreateAPIToken(name, tokenHash string, userID int64) (*APIToken, error) {
+	var id int64
+	err := st.db.QueryRow(`
+		INSERT INTO api_tokens (name, token_hash, user_id, created_at) VALUES (?, ?, NULLIF(?, 0), ?) RETURNING id
+	`, name, tokenHash, userID, time.Now().Unix()).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIToken(st.db.QueryRow(`
+		SELECT `+apiTokenColumns+` FROM api_tokens t LEFT JOIN users u ON u.id = t.user_id WHERE t.id = ?
+	`, id))
 }
 
-// ==================== ITEMS ====================
+// GetAPITokenByHash returns the token with the hash, sql.ErrNoRows if there is none
+func (st *SQLStore) GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	return scanAPIToken(st.db.QueryRow(`
+		SELECT `+apiTokenColumns+` FROM api_tokens t LEFT JOIN users u ON u.id = t.user_id WHERE t.token_hash = ?
+	`, tokenHash))
+}
 
-func GetItemsBySection(sectionID int64) ([]Item, error) {
-	rows, err := DB.Query(`
-		SELECT id, section_id, name, description, completed, uncertain, sort_order, created_at, COALESCE(updated_at, 0)
-		FROM items
-		WHERE section_id = ?
-		ORDER BY completed ASC, sort_order ASC
-	`, sectionID)
+// GetAPITokens returns all tokens ordered by name
+func (st *SQLStore) GetAPITokens() ([]APIToken, error) {
+	rows, err := st.db.Query(`
+		SELECT ` + apiTokenColumns + ` FROM api_tokens t LEFT JOIN users u ON u.id = t.user_id ORDER BY t.name
+	`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var items []Item
+	tokens := []APIToken{}
 	for rows.Next() {
-		var i Item
-		err := rows.Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt)
+		t, err := scanAPIToken(rows)
 		if err != nil {
 			return nil, err
 		}
-		items = append(items, i)
+		tokens = append(tokens, *t)
 	}
-	return items, nil
+	return tokens, rows.Err()
 }
 
-func GetItemByID(id int64) (*Item, error) {
-	var i Item
-	err := DB.QueryRow(`
-		SELECT id, section_id, name, description, completed, uncertain, sort_order, created_at, COALESCE(updated_at, 0)
-		FROM items WHERE id = ?
-	`, id).Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return &i, nil
+// TouchAPIToken records when a token was last used
+func (st *SQLStore) TouchAPIToken(id, lastUsedAt int64) error {
+	_, err := st.db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, lastUsedAt, id)
+	return err
 }
 
-func CreateItem(sectionID int64, name, description string) (*Item, error) {
-	// Get max sort_order for this section
-	var maxOrder int
-	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", sectionID).Scan(&maxOrder)
-
-	result, err := DB.Exec(`
-		INSERT INTO items (section_id, name, description, sort_order) VALUES (?, ?, ?, ?)
-	`, sectionID, name, description, maxOrder+1)
+// DeleteAPIToken revokes the token with the name, sql.ErrNoRows if there is none
+func (st *SQLStore) DeleteAPIToken(name string) error {
+	result, err := st.db.Exec(`DELETE FROM api_tokens WHERE name = ?`, name)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	id, _ := result.LastInsertId()
-	return GetItemByID(id)
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func UpdateItem(id int64, name, description string) (*Item, error) {
-	_, err := DB.Exec(`
-		UPDATE items SET name = ?, description = ?, updated_at = strftime('%s', 'now') WHERE id = ?
-	`, name, description, id)
+// ==================== WEBHOOKS ====================
+
+// Webhook delivery states
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// Webhook is an endpoint that receives change events. Events holds event
+// types or "*" for all; a ListID limits it to the events of one list.
+type Webhook struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"-"`
+	Events    []string `json:"events"`
+	ListID    int64    `json:"list_id,omitempty"`
+	Enabled   bool     `json:"enabled"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent, or still to be sent, to a webhook
+type WebhookDelivery struct {
+	ID            int64  `json:"id"`
+	WebhookID     int64  `json:"webhook_id"`
+	Event         string `json:"event"`
+	Payload       string `json:"payload"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt int64  `json:"next_attempt_at"`
+	ResponseCode  int    `json:"response_code"`
+	Error         string `json:"error,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+	FinishedAt    int64  `json:"finished_at,omitempty"`
+}
+
+const webhookColumns = `id, name, url, secret, events, COALESCE(list_id, 0), enabled, created_at`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*Webhook, error) {
+	var w Webhook
+	var events string
+	err := row.Scan(&w.ID, &w.Name, &w.URL, &w.Secret, &events, &w.ListID, &w.Enabled, &w.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
-	return GetItemByID(id)
+	w.Events = strings.Split(events, ",")
+	return &w, nil
 }
 
-func DeleteItem(id int64) error {
-	_, err := DB.Exec(`DELETE FROM items WHERE id = ?`, id)
-	return err
-}
+const webhookDeliveryColumns = `
+	id, webhook_id, event, payload, status, attempts, next_attempt_at, response_code, error, created_at, finished_at
+`
 
-// DeleteCompletedItems deletes all completed items from the active list
-func DeleteCompletedItems() (int64, error) {
-	activeList, err := GetActiveList()
-	if err != nil {
-		return 0, err
-	}
+func scanWebhookDeliveries(rows *sql.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
 
-	result, err := DB.Exec(`
-		DELETE FROM items WHERE completed = TRUE AND section_id IN (
-			SELECT id FROM sections WHERE list_id = ?
-		)
-	`, activeList.ID)
-	if err != nil {
-		return 0, err
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.ResponseCode, &d.Error, &d.CreatedAt, &d.FinishedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
 	}
-	return result.RowsAffected()
+	return deliveries, rows.Err()
 }
 
-func ToggleItemCompleted(id int64) (*Item, error) {
-	_, err := DB.Exec(`UPDATE items SET completed = NOT completed, updated_at = strftime('%s', 'now') WHERE id = ?`, id)
+// CreateWebhook stores a new webhook
+func (st *SQLStore) CreateWebhook(w *Webhook) (*Webhook, error) {
+	var id int64
+	err := st.db.QueryRow(`
+		INSERT INTO webhooks (name, url, secret, events, list_id, enabled, created_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, 0), ?, ?) RETURNING id
+	`, w.Name, w.URL, w.Secret, strings.Join(w.Events, ","), w.ListID, w.Enabled, time.Now().Unix()).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
-	return GetItemByID(id)
+	return st.GetWebhook(id)
 }
 
-func ToggleItemUncertain(id int64) (*Item, error) {
-	_, err := DB.Exec(`UPDATE items SET uncertain = NOT uncertain, updated_at = strftime('%s', 'now') WHERE id = ?`, id)
+// GetWebhooks returns all webhooks in the order they were added
+func (st *SQLStore) GetWebhooks() ([]Webhook, error) {
+	rows, err := st.db.Query(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`)
 	if err != nil {
 		return nil, err
 	}
-	return GetItemByID(id)
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
 }
 
-func MoveItemToSection(id, newSectionID int64) (*Item, error) {
-	// Get max sort_order in new section
-	var maxOrder int
-	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", newSectionID).Scan(&maxOrder)
+// GetWebhook returns a webhook, sql.ErrNoRows if there is none
+func (st *SQLStore) GetWebhook(id int64) (*Webhook, error) {
+	return scanWebhook(st.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id))
+}
 
-	_, err := DB.Exec(`
-		UPDATE items SET section_id = ?, sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?
-	`, newSectionID, maxOrder+1, id)
+// UpdateWebhook saves all fields of a webhook, sql.ErrNoRows if there is none
+func (st *SQLStore) UpdateWebhook(w *Webhook) (*Webhook, error) {
+	result, err := st.db.Exec(`
+		UPDATE webhooks SET name = ?, url = ?, secret = ?, events = ?, list_id = NULLIF(?, 0), enabled = ?
+		WHERE id = ?
+	`, w.Name, w.URL, w.Secret, strings.Join(w.Events, ","), w.ListID, w.Enabled, w.ID)
 	if err != nil {
 		return nil, err
 	}
-	return GetItemByID(id)
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return st.GetWebhook(w.ID)
 }
 
-func MoveItemUp(id int64) error {
-	tx, err := DB.Begin()
+// DeleteWebhook deletes a webhook and its deliveries, sql.ErrNoRows if there is none
+func (st *SQLStore) DeleteWebhook(id int64) error {
+	result, err := st.db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-
-	var sectionID int64
-	var sortOrder int
-	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ?", id).Scan(&sectionID, &sortOrder)
-	if err != nil {
-		return err
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
 	}
+	return nil
+}
 
-	if sortOrder == 0 {
-		return nil // Already at top
+// CreateWebhookDelivery queues a delivery
+func (st *SQLStore) CreateWebhookDelivery(d *WebhookDelivery) (*WebhookDelivery, error) {
+	created := *d
+	created.CreatedAt = time.Now().Unix()
+	err := st.db.QueryRow(`
+		INSERT INTO webhook_deliveries
+			(webhook_id, event, payload, status, attempts, next_attempt_at, response_code, error, created_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id
+	`, d.WebhookID, d.Event, d.Payload, d.Status, d.Attempts, d.NextAttemptAt, d.ResponseCode, d.Error,
+		created.CreatedAt, d.FinishedAt).Scan(&created.ID)
+	if err != nil {
+		return nil, err
 	}
+	return &created, nil
+}
 
-	// Swap with previous item in same section
-	_, err = tx.Exec(`
-		UPDATE items SET sort_order = sort_order + 1
-		WHERE section_id = ? AND sort_order = ?
-	`, sectionID, sortOrder-1)
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is due, oldest first
+func (st *SQLStore) GetDueWebhookDeliveries(now int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := st.db.Query(`
+		SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT ?
+	`, WebhookPending, now, limit)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return scanWebhookDeliveries(rows)
+}
 
-	_, err = tx.Exec(`
-		UPDATE items SET sort_order = ? WHERE id = ?
-	`, sortOrder-1, id)
+// UpdateWebhookDelivery records the outcome of an attempt
+func (st *SQLStore) UpdateWebhookDelivery(d *WebhookDelivery) error {
+	_, err := st.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, response_code = ?, error = ?, finished_at = ?
+		WHERE id = ?
+	`, d.Status, d.Attempts, d.NextAttemptAt, d.ResponseCode, d.Error, d.FinishedAt, d.ID)
+	return err
+}
+
+// GetWebhookDeliveries returns the latest deliveries of a webhook, newest first
+func (st *SQLStore) GetWebhookDeliveries(webhookID int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := st.db.Query(`
+		SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = ? ORDER BY id DESC LIMIT ?
+	`, webhookID, limit)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return scanWebhookDeliveries(rows)
+}
 
-	return tx.Commit()
+// DeleteWebhookDeliveries removes delivered and failed deliveries finished before a time
+func (st *SQLStore) DeleteWebhookDeliveries(finishedBefore int64) error {
+	_, err := st.db.Exec(`
+		DELETE FROM webhook_deliveries WHERE status <> ? AND finished_at < ?
+	`, WebhookPending, finishedBefore)
+	return err
 }
 
-func MoveItemDown(id int64) error {
-	tx, err := DB.Begin()
+// ==================== INBOUND HOOKS ====================
+
+// InboundHook is a token that may only add items to one list. Items go to
+// SectionID if it is set, otherwise to the section they were last added to.
+// Mail to MailAlias adds items as well; the alias is not derived from the
+// token, so an address that gets around doesn't give the URL away.
+type InboundHook struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	MailAlias   string `json:"mail_alias"`
+	ListID      int64  `json:"list_id"`
+	ListName    string `json:"list_name,omitempty"`
+	SectionID   int64  `json:"section_id,omitempty"`
+	SectionName string `json:"section_name,omitempty"`
+	AllowGet    bool   `json:"allow_get"`
+	CreatedAt   int64  `json:"created_at"`
+	LastUsedAt  int64  `json:"last_used_at"`
+}
+
+const inboundHookColumns = `
+	h.id, h.name, COALESCE(h.mail_alias, ''), h.list_id, COALESCE(l.name, ''), COALESCE(h.section_id, 0), COALESCE(s.name, ''),
+	h.allow_get, h.created_at, h.last_used_at
+	FROM inbound_hooks h
+	LEFT JOIN lists l ON l.id = h.list_id
+	LEFT JOIN sections s ON s.id = h.section_id
+`
+
+func scanInboundHook(row interface{ Scan(...interface{}) error }) (*InboundHook, error) {
+	var h InboundHook
+	err := row.Scan(&h.ID, &h.Name, &h.MailAlias, &h.ListID, &h.ListName, &h.SectionID, &h.SectionName,
+		&h.AllowGet, &h.CreatedAt, &h.LastUsedAt)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
+	return &h, nil
+}
 
-	var sectionID int64
-	var sortOrder int
-	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ?", id).Scan(&sectionID, &sortOrder)
+// CreateInboundHook stores a hook with the hash of its token
+func (st *SQLStore) CreateInboundHook(h *InboundHook, tokenHash string) (*InboundHook, error) {
+	var id int64
+	err := st.db.QueryRow(`
+		INSERT INTO inbound_hooks (name, token_hash, mail_alias, list_id, section_id, allow_get, created_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, 0), ?, ?) RETURNING id
+	`, h.Name, tokenHash, h.MailAlias, h.ListID, h.SectionID, h.AllowGet, time.Now().Unix()).Scan(&id)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return scanInboundHook(st.db.QueryRow(`SELECT `+inboundHookColumns+` WHERE h.id = ?`, id))
+}
 
-	var maxOrder int
-	err = tx.QueryRow("SELECT MAX(sort_order) FROM items WHERE section_id = ?", sectionID).Scan(&maxOrder)
+// GetInboundHookByHash returns the hook with the token hash, sql.ErrNoRows if there is none
+func (st *SQLStore) GetInboundHookByHash(tokenHash string) (*InboundHook, error) {
+	return scanInboundHook(st.db.QueryRow(`SELECT `+inboundHookColumns+` WHERE h.token_hash = ?`, tokenHash))
+}
+
+// GetInboundHookByMailAlias returns the hook with the mail alias, sql.ErrNoRows if there is none
+func (st *SQLStore) GetInboundHookByMailAlias(alias string) (*InboundHook, error) {
+	return scanInboundHook(st.db.QueryRow(`SELECT `+inboundHookColumns+` WHERE h.mail_alias = ?`, alias))
+}
+
+// GetInboundHooks returns all hooks ordered by name
+func (st *SQLStore) GetInboundHooks() ([]InboundHook, error) {
+	rows, err := st.db.Query(`SELECT ` + inboundHookColumns + ` ORDER BY h.name`)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	if sortOrder >= maxOrder {
-		return nil // Already at bottom
+	hooks := []InboundHook{}
+	for rows.Next() {
+		h, err := scanInboundHook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *h)
 	}
+	return hooks, rows.Err()
+}
 
-	// Swap with next item in same section
-	_, err = tx.Exec(`
-		UPDATE items SET sort_order = sort_order - 1
-		WHERE section_id = ? AND sort_order = ?
-	`, sectionID, sortOrder+1)
-	if err != nil {
-		return err
-	}
+// TouchInboundHook records when a hook was last used
+func (st *SQLStore) TouchInboundHook(id, lastUsedAt int64) error {
+	_, err := st.db.Exec(`UPDATE inbound_hooks SET last_used_at = ? WHERE id = ?`, lastUsedAt, id)
+	return err
+}
 
-	_, err = tx.Exec(`
-		UPDATE items SET sort_order = ? WHERE id = ?
-	`, sortOrder+1, id)
+// DeleteInboundHook revokes a hook, sql.ErrNoRows if there is none
+func (st *SQLStore) DeleteInboundHook(id int64) error {
+	result, err := st.db.Exec(`DELETE FROM inbound_hooks WHERE id = ?`, id)
 	if err != nil {
 		return err
 	}
-
-	return tx.Commit()
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-// ==================== SESSIONS ====================
+// ==================== CALDAV ====================
+
+// CalDAVObject links an item to the resource name and UID a CalDAV client
+// created it with. Items without one are served under a name of their ID.
+type CalDAVObject struct {
+	ItemID int64
+	Name   string
+	UID    string
+}
 
-func CreateSession(id string, expiresAt int64) error {
-	_, err := DB.Exec(`INSERT INTO sessions (id, expires_at) VALUES (?, ?)`, id, expiresAt)
+// SaveCalDAVObject stores the resource name and UID of an item
+func (st *SQLStore) SaveCalDAVObject(o CalDAVObject) error {
+	_, err := st.db.Exec(`
+		INSERT INTO caldav_objects (item_id, name, uid) VALUES (?, ?, ?)
+		ON CONFLICT(item_id) DO UPDATE SET name = excluded.name, uid = excluded.uid
+	`, o.ItemID, o.Name, o.UID)
 	return err
 }
 
-func GetSession(id string) (*Session, error) {
-	var s Session
-	err := DB.QueryRow(`SELECT id, expires_at FROM sessions WHERE id = ?`, id).Scan(&s.ID, &s.ExpiresAt)
+// GetCalDAVObjects returns the resource names of the items of a list
+func (st *SQLStore) GetCalDAVObjects(listID int64) ([]CalDAVObject, error) {
+	rows, err := st.db.Query(`
+		SELECT o.item_id, o.name, o.uid
+		FROM caldav_objects o
+		JOIN items i ON i.id = o.item_id
+		JOIN sections s ON s.id = i.section_id
+		WHERE s.list_id = ?
+	`, listID)
 	if err != nil {
 		return nil, err
 	}
-	return &s, nil
-}
+	defer rows.Close()
 
-func DeleteSession(id string) error {
-	_, err := DB.Exec(`DELETE FROM sessions WHERE id = ?`, id)
-	return err
+	var objects []CalDAVObject
+	for rows.Next() {
+		var o CalDAVObject
+		if err := rows.Scan(&o.ItemID, &o.Name, &o.UID); err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
 }
 
-func CleanExpiredSessions() error {
-	_, err := DB.Exec(`DELETE FROM sessions WHERE expires_at < ?`, time.Now().Unix())
-	return err
+// GetCalDAVObjectByName returns the item stored under a resource name, sql.ErrNoRows if none
+func (st *SQLStore) GetCalDAVObjectByName(name string) (*CalDAVObject, error) {
+	var o CalDAVObject
+	err := st.db.QueryRow(`SELECT item_id, name, uid FROM caldav_objects WHERE name = ?`, name).
+		Scan(&o.ItemID, &o.Name, &o.UID)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
 }
 
 // ==================== STATS ====================
@@ -711,26 +1777,6 @@ type Stats struct {
 	Percentage     int `json:"percentage"`
 }
 
-func GetStats() Stats {
-	activeList, err := GetActiveList()
-	if err != nil {
-		// Fallback to global stats
-		return getGlobalStats()
-	}
-	return GetListStats(activeList.ID)
-}
-
-// getGlobalStats returns stats for all items (fallback)
-func getGlobalStats() Stats {
-	var stats Stats
-	DB.QueryRow("SELECT COUNT(*) FROM items").Scan(&stats.TotalItems)
-	DB.QueryRow("SELECT COUNT(*) FROM items WHERE completed = TRUE").Scan(&stats.CompletedItems)
-	if stats.TotalItems > 0 {
-		stats.Percentage = (stats.CompletedItems * 100) / stats.TotalItems
-	}
-	return stats
-}
-
 // ==================== SECTION STATS ====================
 
 type SectionStats struct {
@@ -739,10 +1785,10 @@ type SectionStats struct {
 	Percentage     int `json:"percentage"`
 }
 
-func GetSectionStats(sectionID int64) SectionStats {
+func (st *SQLStore) GetSectionStats(sectionID int64) SectionStats {
 	var stats SectionStats
-	DB.QueryRow("SELECT COUNT(*) FROM items WHERE section_id = ?", sectionID).Scan(&stats.TotalItems)
-	DB.QueryRow("SELECT COUNT(*) FROM items WHERE section_id = ? AND completed = TRUE", sectionID).Scan(&stats.CompletedItems)
+	st.db.QueryRow("SELECT COUNT(*) FROM items WHERE section_id = ?", sectionID).Scan(&stats.TotalItems)
+	st.db.QueryRow("SELECT COUNT(*) FROM items WHERE section_id = ? AND completed = TRUE", sectionID).Scan(&stats.CompletedItems)
 	if stats.TotalItems > 0 {
 		stats.Percentage = (stats.CompletedItems * 100) / stats.TotalItems
 	}
@@ -751,8 +1797,8 @@ func GetSectionStats(sectionID int64) SectionStats {
 
 // ==================== BATCH DELETE SECTIONS ====================
 
-func DeleteSections(ids []int64) error {
-	tx, err := DB.Begin()
+func (st *SQLStore) DeleteSections(ids []int64) error {
+	tx, err := st.db.Begin()
 	if err != nil {
 		return err
 	}
@@ -778,15 +1824,15 @@ type ItemSuggestion struct {
 }
 
 // SaveItemHistory saves or updates item name in history for auto-completion
-func SaveItemHistory(name string, sectionID int64) error {
-	_, err := DB.Exec(`
+func (st *SQLStore) SaveItemHistory(name string, sectionID int64) error {
+	_, err := st.db.Exec(`
 		INSERT INTO item_history (name, last_section_id, usage_count, last_used_at)
-		VALUES (?, ?, 1, strftime('%s', 'now'))
-		ON CONFLICT(name COLLATE NOCASE) DO UPDATE SET
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT(`+st.nocase("name")+`) DO UPDATE SET
 			last_section_id = excluded.last_section_id,
-			usage_count = usage_count + 1,
-			last_used_at = strftime('%s', 'now')
-	`, name, sectionID)
+			usage_count = item_history.usage_count + 1,
+			last_used_at = excluded.last_used_at
+	`, name, sectionID, time.Now().Unix())
 	return err
 }
 
@@ -874,13 +1920,13 @@ func scoreSuggestion(name, query string) int {
 }
 
 // GetItemSuggestions returns item name suggestions matching the query with fuzzy matching
-func GetItemSuggestions(query string, limit int) ([]ItemSuggestion, error) {
+func (st *SQLStore) GetItemSuggestions(query string, limit int) ([]ItemSuggestion, error) {
 	if limit <= 0 {
 		limit = 10
 	}
 
 	// Fetch more items to allow for fuzzy matching and scoring
-	rows, err := DB.Query(`
+	rows, err := st.db.Query(`
 		SELECT h.name, COALESCE(h.last_section_id, 0), COALESCE(s.name, ''), h.usage_count
 		FROM item_history h
 		LEFT JOIN sections s ON h.last_section_id = s.id
@@ -892,18 +1938,26 @@ func GetItemSuggestions(query string, limit int) ([]ItemSuggestion, error) {
 	}
 	defer rows.Close()
 
-	type scoredSuggestion struct {
-		suggestion ItemSuggestion
-		score      int
-	}
-
-	var scored []scoredSuggestion
+	var candidates []ItemSuggestion
 	for rows.Next() {
 		var s ItemSuggestion
 		if err := rows.Scan(&s.Name, &s.LastSectionID, &s.LastSectionName, &s.UsageCount); err != nil {
 			return nil, err
 		}
+		candidates = append(candidates, s)
+	}
+	return rankSuggestions(candidates, query, limit), nil
+}
+
+// rankSuggestions returns the best matches for query among the candidates
+func rankSuggestions(candidates []ItemSuggestion, query string, limit int) []ItemSuggestion {
+	type scoredSuggestion struct {
+		suggestion ItemSuggestion
+		score      int
+	}
 
+	var scored []scoredSuggestion
+	for _, s := range candidates {
 		score := scoreSuggestion(s.Name, query)
 		if score > 0 {
 			// Boost score slightly by usage count
@@ -926,16 +1980,16 @@ func GetItemSuggestions(query string, limit int) ([]ItemSuggestion, error) {
 		suggestions = append(suggestions, scored[i].suggestion)
 	}
 
-	return suggestions, nil
+	return suggestions
 }
 
 // GetAllItemSuggestions returns all item suggestions for offline cache
-func GetAllItemSuggestions(limit int) ([]ItemSuggestion, error) {
+func (st *SQLStore) GetAllItemSuggestions(limit int) ([]ItemSuggestion, error) {
 	if limit <= 0 {
 		limit = 100
 	}
 
-	rows, err := DB.Query(`
+	rows, err := st.db.Query(`
 		SELECT h.name, COALESCE(h.last_section_id, 0), COALESCE(s.name, ''), h.usage_count
 		FROM item_history h
 		LEFT JOIN sections s ON h.last_section_id = s.id
@@ -965,12 +2019,13 @@ type HistoryItem struct {
 	LastSectionID   int64  `json:"last_section_id"`
 	LastSectionName string `json:"last_section_name"`
 	UsageCount      int    `json:"usage_count"`
+	LastUsedAt      int64  `json:"last_used_at"`
 }
 
 // GetItemHistoryList returns all history items for management UI
-func GetItemHistoryList() ([]HistoryItem, error) {
-	rows, err := DB.Query(`
-		SELECT h.id, h.name, COALESCE(h.last_section_id, 0), COALESCE(s.name, ''), h.usage_count
+func (st *SQLStore) GetItemHistoryList() ([]HistoryItem, error) {
+	rows, err := st.db.Query(`
+		SELECT ` + historyColumns + `
 		FROM item_history h
 		LEFT JOIN sections s ON h.last_section_id = s.id
 		ORDER BY h.usage_count DESC, h.last_used_at DESC
@@ -980,33 +2035,55 @@ func GetItemHistoryList() ([]HistoryItem, error) {
 		return nil, err
 	}
 	defer rows.Close()
+	return scanHistoryItems(rows)
+}
+
+// GetAllItemHistory returns the whole history for exports
+func (st *SQLStore) GetAllItemHistory() ([]HistoryItem, error) {
+	rows, err := st.db.Query(`
+		SELECT ` + historyColumns + `
+		FROM item_history h
+		LEFT JOIN sections s ON h.last_section_id = s.id
+		ORDER BY h.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanHistoryItems(rows)
+}
 
+const historyColumns = `
+	h.id, h.name, COALESCE(h.last_section_id, 0), COALESCE(s.name, ''), h.usage_count, COALESCE(h.last_used_at, 0)
+`
+
+func scanHistoryItems(rows *sql.Rows) ([]HistoryItem, error) {
 	var items []HistoryItem
 	for rows.Next() {
 		var h HistoryItem
-		if err := rows.Scan(&h.ID, &h.Name, &h.LastSectionID, &h.LastSectionName, &h.UsageCount); err != nil {
+		if err := rows.Scan(&h.ID, &h.Name, &h.LastSectionID, &h.LastSectionName, &h.UsageCount, &h.LastUsedAt); err != nil {
 			return nil, err
 		}
 		items = append(items, h)
 	}
-	return items, nil
+	return items, rows.Err()
 }
 
-// DeleteItemHistory deletes a single item from history
-func DeleteItemHistory(id int64) error {
-	result, err := DB.Exec("DELETE FROM item_history WHERE id = ?", id)
+// DeleteItemHistory deletes a single item from history, sql.ErrNoRows if there is none
+func (st *SQLStore) DeleteItemHistory(id int64) error {
+	result, err := st.db.Exec("DELETE FROM item_history WHERE id = ?", id)
 	if err != nil {
 		return err
 	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("history item not found")
+		return sql.ErrNoRows
 	}
 	return nil
 }
 
 // DeleteItemHistoryBatch deletes multiple items from history
-func DeleteItemHistoryBatch(ids []int64) (int64, error) {
+func (st *SQLStore) DeleteItemHistoryBatch(ids []int64) (int64, error) {
 	if len(ids) == 0 {
 		return 0, nil
 	}
@@ -1020,7 +2097,7 @@ func DeleteItemHistoryBatch(ids []int64) (int64, error) {
 	}
 
 	query := fmt.Sprintf("DELETE FROM item_history WHERE id IN (%s)", strings.Join(placeholders, ","))
-	result, err := DB.Exec(query, args...)
+	result, err := st.db.Exec(query, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -1030,8 +2107,8 @@ func DeleteItemHistoryBatch(ids []int64) (int64, error) {
 // ==================== TEMPLATES ====================
 
 // GetAllTemplates returns all templates with their items
-func GetAllTemplates() ([]Template, error) {
-	rows, err := DB.Query(`
+func (st *SQLStore) GetAllTemplates() ([]Template, error) {
+	rows, err := st.db.Query(`
 		SELECT id, name, description, sort_order, created_at, COALESCE(updated_at, 0)
 		FROM templates
 		ORDER BY sort_order ASC
@@ -1048,7 +2125,7 @@ func GetAllTemplates() ([]Template, error) {
 		if err != nil {
 			return nil, err
 		}
-		t.Items, err = GetTemplateItems(t.ID)
+		t.Items, err = st.GetTemplateItems(t.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -1058,16 +2135,16 @@ func GetAllTemplates() ([]Template, error) {
 }
 
 // GetTemplateByID returns a single template by ID with items
-func GetTemplateByID(id int64) (*Template, error) {
+func (st *SQLStore) GetTemplateByID(id int64) (*Template, error) {
 	var t Template
-	err := DB.QueryRow(`
+	err := st.db.QueryRow(`
 		SELECT id, name, description, sort_order, created_at, COALESCE(updated_at, 0)
 		FROM templates WHERE id = ?
 	`, id).Scan(&t.ID, &t.Name, &t.Description, &t.SortOrder, &t.CreatedAt, &t.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
-	t.Items, err = GetTemplateItems(t.ID)
+	t.Items, err = st.GetTemplateItems(t.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -1075,8 +2152,8 @@ func GetTemplateByID(id int64) (*Template, error) {
 }
 
 // GetTemplateItems returns all items for a template
-func GetTemplateItems(templateID int64) ([]TemplateItem, error) {
-	rows, err := DB.Query(`
+func (st *SQLStore) GetTemplateItems(templateID int64) ([]TemplateItem, error) {
+	rows, err := st.db.Query(`
 		SELECT id, template_id, section_name, name, description, sort_order, created_at
 		FROM template_items
 		WHERE template_id = ?
@@ -1100,59 +2177,57 @@ func GetTemplateItems(templateID int64) ([]TemplateItem, error) {
 }
 
 // CreateTemplate creates a new template
-func CreateTemplate(name, description string) (*Template, error) {
+func (st *SQLStore) CreateTemplate(name, description string) (*Template, error) {
 	var maxOrder int
-	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM templates").Scan(&maxOrder)
+	st.db.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM templates").Scan(&maxOrder)
 
-	result, err := DB.Exec(`
-		INSERT INTO templates (name, description, sort_order) VALUES (?, ?, ?)
-	`, name, description, maxOrder+1)
+	var id int64
+	err := st.db.QueryRow(`
+		INSERT INTO templates (name, description, sort_order) VALUES (?, ?, ?) RETURNING id
+	`, name, description, maxOrder+1).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
-
-	id, _ := result.LastInsertId()
-	return GetTemplateByID(id)
+	return st.GetTemplateByID(id)
 }
 
 // UpdateTemplate updates a template's name and description
-func UpdateTemplate(id int64, name, description string) (*Template, error) {
-	_, err := DB.Exec(`
-		UPDATE templates SET name = ?, description = ?, updated_at = strftime('%s', 'now') WHERE id = ?
-	`, name, description, id)
+func (st *SQLStore) UpdateTemplate(id int64, name, description string) (*Template, error) {
+	_, err := st.db.Exec(`
+		UPDATE templates SET name = ?, description = ?, updated_at = ? WHERE id = ?
+	`, name, description, time.Now().Unix(), id)
 	if err != nil {
 		return nil, err
 	}
-	return GetTemplateByID(id)
+	return st.GetTemplateByID(id)
 }
 
 // DeleteTemplate deletes a template and all its items
-func DeleteTemplate(id int64) error {
-	_, err := DB.Exec(`DELETE FROM templates WHERE id = ?`, id)
+func (st *SQLStore) DeleteTemplate(id int64) error {
+	_, err := st.db.Exec(`DELETE FROM templates WHERE id = ?`, id)
 	return err
 }
 
 // AddTemplateItem adds an item to a template
-func AddTemplateItem(templateID int64, sectionName, name, description string) (*TemplateItem, error) {
+func (st *SQLStore) AddTemplateItem(templateID int64, sectionName, name, description string) (*TemplateItem, error) {
 	var maxOrder int
-	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM template_items WHERE template_id = ?", templateID).Scan(&maxOrder)
+	st.db.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM template_items WHERE template_id = ?", templateID).Scan(&maxOrder)
 
-	result, err := DB.Exec(`
+	var id int64
+	err := st.db.QueryRow(`
 		INSERT INTO template_items (template_id, section_name, name, description, sort_order)
-		VALUES (?, ?, ?, ?, ?)
-	`, templateID, sectionName, name, description, maxOrder+1)
+		VALUES (?, ?, ?, ?, ?) RETURNING id
+	`, templateID, sectionName, name, description, maxOrder+1).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
-
-	id, _ := result.LastInsertId()
-	return GetTemplateItemByID(id)
+	return st.GetTemplateItemByID(id)
 }
 
 // GetTemplateItemByID returns a single template item by ID
-func GetTemplateItemByID(id int64) (*TemplateItem, error) {
+func (st *SQLStore) GetTemplateItemByID(id int64) (*TemplateItem, error) {
 	var ti TemplateItem
-	err := DB.QueryRow(`
+	err := st.db.QueryRow(`
 		SELECT id, template_id, section_name, name, description, sort_order, created_at
 		FROM template_items WHERE id = ?
 	`, id).Scan(&ti.ID, &ti.TemplateID, &ti.SectionName, &ti.Name, &ti.Description, &ti.SortOrder, &ti.CreatedAt)
@@ -1163,30 +2238,30 @@ func GetTemplateItemByID(id int64) (*TemplateItem, error) {
 }
 
 // UpdateTemplateItem updates a template item
-func UpdateTemplateItem(id int64, sectionName, name, description string) (*TemplateItem, error) {
-	_, err := DB.Exec(`
+func (st *SQLStore) UpdateTemplateItem(id int64, sectionName, name, description string) (*TemplateItem, error) {
+	_, err := st.db.Exec(`
 		UPDATE template_items SET section_name = ?, name = ?, description = ? WHERE id = ?
 	`, sectionName, name, description, id)
 	if err != nil {
 		return nil, err
 	}
-	return GetTemplateItemByID(id)
+	return st.GetTemplateItemByID(id)
 }
 
 // DeleteTemplateItem deletes a template item
-func DeleteTemplateItem(id int64) error {
-	_, err := DB.Exec(`DELETE FROM template_items WHERE id = ?`, id)
+func (st *SQLStore) DeleteTemplateItem(id int64) error {
+	_, err := st.db.Exec(`DELETE FROM template_items WHERE id = ?`, id)
 	return err
 }
 
 // ApplyTemplateToList applies a template to a list (adds items from template)
-func ApplyTemplateToList(templateID, listID int64) error {
-	template, err := GetTemplateByID(templateID)
+func (st *SQLStore) ApplyTemplateToList(templateID, listID int64) error {
+	template, err := st.GetTemplateByID(templateID)
 	if err != nil {
 		return err
 	}
 
-	tx, err := DB.Begin()
+	tx, err := st.db.Begin()
 	if err != nil {
 		return err
 	}
@@ -1203,21 +2278,19 @@ func ApplyTemplateToList(templateID, listID int64) error {
 		// Find or create section in target list
 		var sectionID int64
 		err := tx.QueryRow(`
-			SELECT id FROM sections WHERE list_id = ? AND name = ? COLLATE NOCASE
-		`, listID, sectionName).Scan(&sectionID)
+			SELECT id FROM sections WHERE list_id = ? AND `+st.nocaseEquals("name"), listID, sectionName).Scan(&sectionID)
 
 		if err != nil {
 			// Section doesn't exist, create it
 			var maxOrder int
 			tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM sections WHERE list_id = ?", listID).Scan(&maxOrder)
 
-			result, err := tx.Exec(`
-				INSERT INTO sections (name, sort_order, list_id) VALUES (?, ?, ?)
-			`, sectionName, maxOrder+1, listID)
+			err := tx.QueryRow(`
+				INSERT INTO sections (name, sort_order, list_id) VALUES (?, ?, ?) RETURNING id
+			`, sectionName, maxOrder+1, listID).Scan(&sectionID)
 			if err != nil {
 				return err
 			}
-			sectionID, _ = result.LastInsertId()
 		}
 
 		// Add items to section
@@ -1234,14 +2307,7 @@ func ApplyTemplateToList(templateID, listID int64) error {
 			}
 
 			// Save to item history
-			tx.Exec(`
-				INSERT INTO item_history (name, last_section_id, usage_count, last_used_at)
-				VALUES (?, ?, 1, strftime('%s', 'now'))
-				ON CONFLICT(name COLLATE NOCASE) DO UPDATE SET
-					last_section_id = excluded.last_section_id,
-					usage_count = usage_count + 1,
-					last_used_at = strftime('%s', 'now')
-			`, item.Name, sectionID)
+			sqlBatch{st, tx}.SaveItemHistory(item.Name, sectionID)
 		}
 	}
 
@@ -1249,13 +2315,13 @@ func ApplyTemplateToList(templateID, listID int64) error {
 }
 
 // CreateTemplateFromList creates a template from an existing list
-func CreateTemplateFromList(listID int64, templateName, templateDescription string) (*Template, error) {
-	sections, err := GetSectionsByList(listID)
+func (st *SQLStore) CreateTemplateFromList(listID int64, templateName, templateDescription string) (*Template, error) {
+	sections, err := st.GetSectionsByList(listID)
 	if err != nil {
 		return nil, err
 	}
 
-	tx, err := DB.Begin()
+	tx, err := st.db.Begin()
 	if err != nil {
 		return nil, err
 	}
@@ -1265,13 +2331,13 @@ func CreateTemplateFromList(listID int64, templateName, templateDescription stri
 	var maxOrder int
 	tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM templates").Scan(&maxOrder)
 
-	result, err := tx.Exec(`
-		INSERT INTO templates (name, description, sort_order) VALUES (?, ?, ?)
-	`, templateName, templateDescription, maxOrder+1)
+	var templateID int64
+	err = tx.QueryRow(`
+		INSERT INTO templates (name, description, sort_order) VALUES (?, ?, ?) RETURNING id
+	`, templateName, templateDescription, maxOrder+1).Scan(&templateID)
 	if err != nil {
 		return nil, err
 	}
-	templateID, _ := result.LastInsertId()
 
 	// Add items from list sections
 	itemOrder := 0
@@ -1295,53 +2361,77 @@ func CreateTemplateFromList(listID int64, templateName, templateDescription stri
 		return nil, err
 	}
 
-	return GetTemplateByID(templateID)
+	return st.GetTemplateByID(templateID)
+}
+
+// ==================== BATCH (for batch API) ====================
+
+// sqlBatch creates rows inside the transaction of SQLStore.Batch
+type sqlBatch struct {
+	st *SQLStore
+	tx *sql.Tx
 }
 
-// ==================== TRANSACTION HELPERS (for batch API) ====================
+// Batch runs fn in a transaction that is committed only if fn succeeds
+func (st *SQLStore) Batch(fn func(b BatchStore) error) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(sqlBatch{st, tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-// CreateListTx creates a list within a transaction
-func CreateListTx(tx *sql.Tx, name, icon string) (*List, error) {
+// CreateList creates a list owned by ownerID (0 for no owner) within the transaction
+func (b sqlBatch) CreateList(name, icon string, ownerID int64) (*List, error) {
 	var maxOrder int
-	tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM lists").Scan(&maxOrder)
+	b.tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM lists").Scan(&maxOrder)
 
 	if icon == "" {
 		icon = "🛒"
 	}
 
-	result, err := tx.Exec(`
-		INSERT INTO lists (name, icon, sort_order, is_active) VALUES (?, ?, ?, FALSE)
-	`, name, icon, maxOrder+1)
+	var id int64
+	err := b.tx.QueryRow(`
+		INSERT INTO lists (name, icon, sort_order, is_active, owner_id) VALUES (?, ?, ?, FALSE, NULLIF(?, 0)) RETURNING id
+	`, name, icon, maxOrder+1, ownerID).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
 
-	id, _ := result.LastInsertId()
-
 	var l List
-	err = tx.QueryRow(`
-		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0)
+	err = b.tx.QueryRow(`
+		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0),
+			COALESCE(owner_id, 0), COALESCE(is_private, FALSE)
 		FROM lists WHERE id = ?
-	`, id).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt)
+	`, id).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt, &l.OwnerID, &l.IsPrivate)
 	if err != nil {
 		return nil, err
 	}
 	return &l, nil
 }
 
-// CreateSectionForListTx creates a section within a transaction
-func CreateSectionForListTx(tx *sql.Tx, listID int64, name string, sortOrder int) (*Section, error) {
-	result, err := tx.Exec(`
-		INSERT INTO sections (name, sort_order, list_id) VALUES (?, ?, ?)
-	`, name, sortOrder, listID)
+// ReplaceListPermissions sets the privacy and members of a list within the transaction
+func (b sqlBatch) ReplaceListPermissions(listID int64, private *bool, claimantID int64, members map[int64]string) error {
+	return replaceListPermissions(b.tx, listID, private, claimantID, members)
+}
+
+// CreateSection creates a section within the transaction
+func (b sqlBatch) CreateSection(listID int64, name string, sortOrder int) (*Section, error) {
+	var id int64
+	err := b.tx.QueryRow(`
+		INSERT INTO sections (name, sort_order, list_id) VALUES (?, ?, ?) RETURNING id
+	`, name, sortOrder, listID).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
 
-	id, _ := result.LastInsertId()
-
 	var s Section
-	err = tx.QueryRow(`
+	err = b.tx.QueryRow(`
 		SELECT id, list_id, name, sort_order, created_at, COALESCE(updated_at, 0)
 		FROM sections WHERE id = ?
 	`, id).Scan(&s.ID, &s.ListID, &s.Name, &s.SortOrder, &s.CreatedAt, &s.UpdatedAt)
@@ -1352,19 +2442,18 @@ func CreateSectionForListTx(tx *sql.Tx, listID int64, name string, sortOrder int
 	return &s, nil
 }
 
-// CreateItemTx creates an item within a transaction
-func CreateItemTx(tx *sql.Tx, sectionID int64, name, description string, sortOrder int) (*Item, error) {
-	result, err := tx.Exec(`
-		INSERT INTO items (section_id, name, description, sort_order) VALUES (?, ?, ?, ?)
-	`, sectionID, name, description, sortOrder)
+// CreateItem creates an item within the transaction
+func (b sqlBatch) CreateItem(sectionID int64, name, description string, sortOrder int) (*Item, error) {
+	var id int64
+	err := b.tx.QueryRow(`
+		INSERT INTO items (section_id, name, description, sort_order) VALUES (?, ?, ?, ?) RETURNING id
+	`, sectionID, name, description, sortOrder).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
 
-	id, _ := result.LastInsertId()
-
 	var i Item
-	err = tx.QueryRow(`
+	err = b.tx.QueryRow(`
 		SELECT id, section_id, name, description, completed, uncertain, sort_order, created_at, COALESCE(updated_at, 0)
 		FROM items WHERE id = ?
 	`, id).Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt)
@@ -1374,27 +2463,109 @@ func CreateItemTx(tx *sql.Tx, sectionID int64, name, description string, sortOrd
 	return &i, nil
 }
 
-// SaveItemHistoryTx saves item name to history within a transaction
-func SaveItemHistoryTx(tx *sql.Tx, name string, sectionID int64) {
-	tx.Exec(`
-		INSERT INTO item_history (name, last_section_id, usage_count)
-		VALUES (?, ?, 1)
-		ON CONFLICT(name) DO UPDATE SET
-			usage_count = usage_count + 1,
-			last_section_id = excluded.last_section_id
-	`, name, sectionID)
+// SaveItemHistory saves item name to history within the transaction
+func (b sqlBatch) SaveItemHistory(name string, sectionID int64) {
+	b.tx.Exec(`
+		INSERT INTO item_history (name, last_section_id, usage_count, last_used_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT(`+b.st.nocase("name")+`) DO UPDATE SET
+			last_section_id = excluded.last_section_id,
+			usage_count = item_history.usage_count + 1,
+			last_used_at = excluded.last_used_at
+	`, name, sectionID, time.Now().Unix())
 }
 
-// GetMaxSectionOrderTx gets max sort_order for sections in a list within a transaction
-func GetMaxSectionOrderTx(tx *sql.Tx, listID int64) int {
+// MaxSectionOrder gets max sort_order for sections in a list within the transaction
+func (b sqlBatch) MaxSectionOrder(listID int64) int {
 	var maxOrder int
-	tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM sections WHERE list_id = ?", listID).Scan(&maxOrder)
+	b.tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM sections WHERE list_id = ?", listID).Scan(&maxOrder)
 	return maxOrder
 }
 
-// GetMaxItemOrderTx gets max sort_order for items in a section within a transaction
-func GetMaxItemOrderTx(tx *sql.Tx, sectionID int64) int {
+// MaxItemOrder gets max sort_order for items in a section within the transaction
+func (b sqlBatch) MaxItemOrder(sectionID int64) int {
 	var maxOrder int
-	tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", sectionID).Scan(&maxOrder)
+	b.tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", sectionID).Scan(&maxOrder)
 	return maxOrder
 }
+
+// SetActiveList makes a list the active one within the transaction
+func (b sqlBatch) SetActiveList(id int64) error {
+	_, err := b.tx.Exec("UPDATE lists SET is_active = (id = ?)", id)
+	return err
+}
+
+// SetItemStatus sets the completed and uncertain flags of an item within the transaction
+func (b sqlBatch) SetItemStatus(id int64, completed, uncertain bool) error {
+	_, err := b.tx.Exec("UPDATE items SET completed = ?, uncertain = ? WHERE id = ?", completed, uncertain, id)
+	return err
+}
+
+// UpdateItem changes the text and state of an item within the transaction
+func (b sqlBatch) UpdateItem(id int64, name, description string, completed bool) error {
+	_, err := b.tx.Exec(`
+		UPDATE items SET name = ?, description = ?, completed = ?, updated_at = ? WHERE id = ?
+	`, name, description, completed, time.Now().Unix(), id)
+	return err
+}
+
+// DeleteItem deletes an item within the transaction
+func (b sqlBatch) DeleteItem(id int64) error {
+	_, err := b.tx.Exec(`DELETE FROM items WHERE id = ?`, id)
+	return err
+}
+
+// CreateTemplate creates a template after the existing ones within the transaction
+func (b sqlBatch) CreateTemplate(name, description string) (*Template, error) {
+	var maxOrder int
+	b.tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM templates").Scan(&maxOrder)
+
+	t := Template{Name: name, Description: description, SortOrder: maxOrder + 1, UpdatedAt: time.Now().Unix()}
+	err := b.tx.QueryRow(`
+		INSERT INTO templates (name, description, sort_order, updated_at) VALUES (?, ?, ?, ?) RETURNING id
+	`, name, description, t.SortOrder, t.UpdatedAt).Scan(&t.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateTemplateItem adds an item to a template within the transaction
+func (b sqlBatch) CreateTemplateItem(templateID int64, sectionName, name, description string, sortOrder int) (*TemplateItem, error) {
+	ti := TemplateItem{TemplateID: templateID, SectionName: sectionName, Name: name, Description: description, SortOrder: sortOrder}
+	err := b.tx.QueryRow(`
+		INSERT INTO template_items (template_id, section_name, name, description, sort_order)
+		VALUES (?, ?, ?, ?, ?) RETURNING id
+	`, templateID, sectionName, name, description, sortOrder).Scan(&ti.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &ti, nil
+}
+
+// ImportItemHistory adds an imported history entry within the transaction.
+// Usage counts of an existing entry are added up; the more recent use wins.
+func (b sqlBatch) ImportItemHistory(name string, sectionID int64, usageCount int, lastUsedAt int64) error {
+	_, err := b.tx.Exec(`
+		INSERT INTO item_history (name, last_section_id, usage_count, last_used_at)
+		VALUES (?, NULLIF(?, 0), ?, ?)
+		ON CONFLICT(`+b.st.nocase("name")+`) DO UPDATE SET
+			usage_count = item_history.usage_count + excluded.usage_count,
+			last_section_id = CASE WHEN excluded.last_used_at > item_history.last_used_at
+				THEN excluded.last_section_id ELSE item_history.last_section_id END,
+			last_used_at = CASE WHEN excluded.last_used_at > item_history.last_used_at
+				THEN excluded.last_used_at ELSE item_history.last_used_at END
+	`, name, sectionID, usageCount, lastUsedAt)
+	return err
+}
+
+// DeleteAllData deletes all lists, templates and history within the transaction.
+// Users, sessions and API tokens are kept.
+func (b sqlBatch) DeleteAllData() error {
+	for _, table := range []string{"items", "sections", "list_members", "lists", "template_items", "templates", "item_history"} {
+		if _, err := b.tx.Exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
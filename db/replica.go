@@ -0,0 +1,769 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Replication keeps a copy of the SQLite database that can be rebuilt as of any
+// point in time. The replica is a series of generations, each a page-for-page
+// snapshot followed by the WAL frames committed after it:
+//
+//	generations/<start time>/snapshot.db
+//	generations/<start time>/wal/<sequence>-<unix ms>.frames
+//
+// A segment starts with the WAL magic number and the checksum its first frame
+// continues from, so a restore can verify the frames before applying them.
+// Automatic checkpoints are turned off while replicating, so the WAL is only
+// restarted by the replicator after it has copied every frame.
+
+const (
+	// replicatedDriver opens SQLite connections without automatic checkpoints
+	replicatedDriver = "sqlite3_replicated"
+
+	generationsDir  = "generations"
+	generationFmt   = "20060102T150405.000Z"
+	snapshotFile    = "snapshot.db"
+	segmentExt      = ".frames"
+	walHeaderSize   = 32
+	walFrameHdrSize = 24
+	segmentHdrSize  = 12
+
+	// checkpointSize is the WAL size after which the replicator checkpoints,
+	// about what SQLite's own automatic checkpoint allows
+	checkpointSize = 4 << 20
+)
+
+// errWALReset means frames may have been lost and a new generation is needed
+var errWALReset = errors.New("WAL was reset outside of the replicator")
+
+func init() {
+	sql.Register(replicatedDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			_, err := conn.Exec("PRAGMA wal_autocheckpoint=0", nil)
+			return err
+		},
+	})
+}
+
+// ReplicaDir returns the replica directory (REPLICA_DIR), empty if replication is off
+func ReplicaDir() string {
+	return strings.TrimSpace(os.Getenv("REPLICA_DIR"))
+}
+
+// ReplicaSink stores the files written by the replicator.
+// Names are slash-separated; a file must only become visible once closed.
+type ReplicaSink interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// ReplicaPruner is implemented by sinks that can delete old generations
+type ReplicaPruner interface {
+	// Prune deletes generations no longer needed to restore to any time after cutoff
+	Prune(cutoff time.Time) error
+}
+
+// DirSink stores replica files below a local directory
+type DirSink string
+
+// Create writes to a temporary file that is renamed into place on Close
+func (d DirSink) Create(name string) (io.WriteCloser, error) {
+	final := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(final), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(final+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &sinkFile{File: f, final: final}, nil
+}
+
+// Prune deletes every generation whose successor started before cutoff
+func (d DirSink) Prune(cutoff time.Time) error {
+	generations, err := listGenerations(string(d))
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(generations); i++ {
+		if !generations[i+1].start.Before(cutoff) {
+			break
+		}
+		if err := os.RemoveAll(generations[i].dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sinkFile struct {
+	*os.File
+	final string
+}
+
+func (f *sinkFile) Close() error {
+	if err := f.File.Sync(); err != nil {
+		f.File.Close()
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.File.Name(), f.final)
+}
+
+// Replicator ships WAL frames of the open SQLite database to a sink
+type Replicator struct {
+	sink          ReplicaSink
+	walPath       string
+	snapshotEvery time.Duration
+	retain        time.Duration
+
+	// holder keeps the WAL alive and runs checkpoints; locker takes the write lock
+	holder *sql.Conn
+	locker *sql.Conn
+
+	generation string
+	started    time.Time
+	seq        int
+
+	// Position in the WAL up to which frames have been shipped
+	offset        int64
+	salt          [8]byte
+	sum           [2]uint32
+	bigEndian     bool
+	expectRestart bool
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+var replicator *Replicator
+
+// StartReplication ships the database to REPLICA_DIR if it is set: WAL frames
+// every REPLICA_SYNC_SECONDS (default 1) and a new snapshot every
+// REPLICA_SNAPSHOT_HOURS (default 24). Generations older than
+// REPLICA_RETAIN_HOURS (default 72) are deleted.
+func StartReplication() {
+	dir := ReplicaDir()
+	if dir == "" {
+		return
+	}
+	if !BackupSupported() {
+		log.Println("Warning: REPLICA_DIR is ignored; replication needs SQLite")
+		return
+	}
+
+	r, err := NewReplicator(DirSink(dir), sqlitePath+"-wal")
+	if err != nil {
+		log.Fatal("Failed to start replication: ", err)
+	}
+	r.snapshotEvery = time.Duration(envInt("REPLICA_SNAPSHOT_HOURS", 24)) * time.Hour
+	r.retain = time.Duration(envInt("REPLICA_RETAIN_HOURS", 72)) * time.Hour
+
+	interval := time.Duration(envInt("REPLICA_SYNC_SECONDS", 1)) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+	r.Start(interval)
+	replicator = r
+	log.Printf("Replicating database to %s every %s", dir, interval)
+}
+
+// NewReplicator starts a new generation in sink for the open database.
+// The database must have been opened with automatic checkpoints off.
+func NewReplicator(sink ReplicaSink, walPath string) (*Replicator, error) {
+	if !BackupSupported() {
+		return nil, ErrBackupUnsupported
+	}
+
+	ctx := context.Background()
+	holder, err := DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	locker, err := DB.Conn(ctx)
+	if err != nil {
+		holder.Close()
+		return nil, err
+	}
+
+	r := &Replicator{
+		sink:          sink,
+		walPath:       walPath,
+		snapshotEvery: 24 * time.Hour,
+		holder:        holder,
+		locker:        locker,
+	}
+	if err := r.newGeneration(); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Start syncs every interval until Stop is called
+func (r *Replicator) Start(interval time.Duration) {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if err := r.Sync(); err != nil {
+					log.Printf("Replication failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop ships the remaining frames and releases the replicator's connections
+func (r *Replicator) Stop() {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+	}
+	if err := r.Sync(); err != nil {
+		log.Printf("Final replication failed: %v", err)
+	}
+	r.close()
+}
+
+func (r *Replicator) close() {
+	r.locker.Close()
+	r.holder.Close()
+}
+
+// Sync ships new frames, checkpoints a large WAL and starts a new generation when due
+func (r *Replicator) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.started) >= r.snapshotEvery {
+		return r.newGeneration()
+	}
+
+	size, err := r.ship(true)
+	if err == errWALReset {
+		log.Printf("Replication: %v; starting a new generation", err)
+		return r.newGeneration()
+	}
+	if err != nil {
+		return err
+	}
+	if size >= checkpointSize {
+		return r.checkpoint()
+	}
+	return nil
+}
+
+// checkpoint copies the WAL into the database, so SQLite restarts it with the next write
+func (r *Replicator) checkpoint() error {
+	return r.withWriteLock(func() error {
+		if _, err := r.ship(true); err != nil {
+			return err
+		}
+		return r.checkpointLocked()
+	})
+}
+
+// newGeneration snapshots the database and ships later frames into a new generation.
+// Frames not yet shipped still go to the previous generation.
+func (r *Replicator) newGeneration() error {
+	return r.withWriteLock(func() error {
+		// Without a generation there is nothing to ship to; just find the end of the WAL
+		_, err := r.ship(r.generation != "")
+		if err == errWALReset {
+			// Frames after the reset can't follow the old generation; skip them
+			r.salt = [8]byte{}
+			_, err = r.ship(false)
+		}
+		if err != nil {
+			return err
+		}
+
+		start := time.Now().UTC()
+		generation := start.Format(generationFmt)
+		if err := r.writeSnapshot(path.Join(generationsDir, generation, snapshotFile)); err != nil {
+			return fmt.Errorf("writing snapshot: %w", err)
+		}
+
+		r.generation = generation
+		r.started = start
+		r.seq = 0
+		log.Printf("Replication: started generation %s", generation)
+
+		if err := r.checkpointLocked(); err != nil {
+			return err
+		}
+		if pruner, ok := r.sink.(ReplicaPruner); ok && r.retain > 0 {
+			if err := pruner.Prune(time.Now().Add(-r.retain)); err != nil {
+				log.Printf("Replication: failed to delete old generations: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// withWriteLock runs fn while no other connection can write
+func (r *Replicator) withWriteLock(fn func() error) error {
+	ctx := context.Background()
+	if _, err := r.locker.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	err := fn()
+	if _, rbErr := r.locker.ExecContext(ctx, "ROLLBACK"); rbErr != nil && err == nil {
+		err = rbErr
+	}
+	return err
+}
+
+// checkpointLocked must run under the write lock after all frames have been shipped
+func (r *Replicator) checkpointLocked() error {
+	if _, err := r.holder.ExecContext(context.Background(), "PRAGMA wal_checkpoint(PASSIVE)"); err != nil {
+		return err
+	}
+	r.expectRestart = true
+	return nil
+}
+
+// writeSnapshot copies the database page for page into the sink
+func (r *Replicator) writeSnapshot(name string) error {
+	tmp, err := os.CreateTemp("", "koffan-snapshot-*.db")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	dest, err := sql.Open("sqlite3", tmpPath)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	destConn, err := dest.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	if err := copyDatabase(destConn, r.holder); err != nil {
+		destConn.Close()
+		return err
+	}
+	destConn.Close()
+
+	return r.writeFile(name, func(w io.Writer) error {
+		f, err := os.Open(tmpPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+}
+
+func (r *Replicator) writeFile(name string, write func(w io.Writer) error) error {
+	w, err := r.sink.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// ship copies committed frames after r.offset into a new segment (or only
+// advances past them if write is false). Returns the size of the WAL file.
+func (r *Replicator) ship(write bool) (int64, error) {
+	f, err := os.Open(r.walPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if size < walHeaderSize {
+		return size, nil
+	}
+
+	header := make([]byte, walHeaderSize)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return size, err
+	}
+	magic := binary.BigEndian.Uint32(header[0:4])
+	if !isWALMagic(magic) {
+		return size, errors.New("invalid WAL header")
+	}
+	pageSize := int64(binary.BigEndian.Uint32(header[8:12]))
+
+	var salt [8]byte
+	copy(salt[:], header[16:24])
+	if salt != r.salt {
+		fresh := r.salt == [8]byte{}
+		restarted := r.expectRestart && binary.BigEndian.Uint32(salt[0:4]) == binary.BigEndian.Uint32(r.salt[0:4])+1
+		if !fresh && !restarted {
+			return size, errWALReset
+		}
+		r.salt = salt
+		r.bigEndian = magic&1 == 1
+		r.sum = walChecksum(r.bigEndian, [2]uint32{}, header[:24])
+		r.offset = walHeaderSize
+		r.expectRestart = false
+	}
+	if size < r.offset {
+		return size, errWALReset
+	}
+
+	// Only whole transactions with valid frames are shipped
+	data := make([]byte, size-r.offset)
+	if _, err := f.ReadAt(data, r.offset); err != nil && err != io.EOF {
+		return size, err
+	}
+	frameSize := walFrameHdrSize + pageSize
+	sum := r.sum
+	var committed int64
+	committedSum := sum
+	for pos := int64(0); pos+frameSize <= int64(len(data)); pos += frameSize {
+		frame := data[pos : pos+frameSize]
+		if string(frame[8:16]) != string(salt[:]) {
+			break
+		}
+		sum = walChecksum(r.bigEndian, sum, frame[:8])
+		sum = walChecksum(r.bigEndian, sum, frame[walFrameHdrSize:])
+		if sum[0] != binary.BigEndian.Uint32(frame[16:20]) || sum[1] != binary.BigEndian.Uint32(frame[20:24]) {
+			break
+		}
+		if binary.BigEndian.Uint32(frame[4:8]) != 0 {
+			committed = pos + frameSize
+			committedSum = sum
+		}
+	}
+	if committed == 0 {
+		return size, nil
+	}
+
+	if write {
+		segmentHdr := make([]byte, segmentHdrSize)
+		binary.BigEndian.PutUint32(segmentHdr[0:4], magic)
+		binary.BigEndian.PutUint32(segmentHdr[4:8], r.sum[0])
+		binary.BigEndian.PutUint32(segmentHdr[8:12], r.sum[1])
+
+		name := fmt.Sprintf("%08d-%d%s", r.seq, time.Now().UnixMilli(), segmentExt)
+		err := r.writeFile(path.Join(generationsDir, r.generation, "wal", name), func(w io.Writer) error {
+			if _, err := w.Write(segmentHdr); err != nil {
+				return err
+			}
+			_, err := w.Write(data[:committed])
+			return err
+		})
+		if err != nil {
+			return size, err
+		}
+		r.seq++
+	}
+	r.offset += committed
+	r.sum = committedSum
+	return size, nil
+}
+
+// isWALMagic reports whether magic starts a WAL; the last bit is the checksum byte order
+func isWALMagic(magic uint32) bool {
+	return magic == 0x377f0682 || magic == 0x377f0683
+}
+
+// walChecksum continues SQLite's WAL checksum over b
+func walChecksum(bigEndian bool, sum [2]uint32, b []byte) [2]uint32 {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	s0, s1 := sum[0], sum[1]
+	for i := 0; i+8 <= len(b); i += 8 {
+		s0 += order.Uint32(b[i:]) + s1
+		s1 += order.Uint32(b[i+4:]) + s0
+	}
+	return [2]uint32{s0, s1}
+}
+
+// copyDatabase copies the main database of src over dest with SQLite's backup API
+func copyDatabase(dest, src *sql.Conn) error {
+	return dest.Raw(func(destRaw interface{}) error {
+		return src.Raw(func(srcRaw interface{}) error {
+			destConn, ok1 := destRaw.(*sqlite3.SQLiteConn)
+			srcConn, ok2 := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok1 || !ok2 {
+				return errors.New("unexpected SQLite driver connection")
+			}
+
+			backup, err := destConn.Backup("main", srcConn, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// ==================== RESTORE ====================
+
+type generationDir struct {
+	dir   string
+	start time.Time
+}
+
+// listGenerations returns the complete generations in dir, oldest first
+func listGenerations(dir string) ([]generationDir, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, generationsDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var generations []generationDir
+	for _, e := range entries {
+		start, err := time.Parse(generationFmt, e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		genDir := filepath.Join(dir, generationsDir, e.Name())
+		if _, err := os.Stat(filepath.Join(genDir, snapshotFile)); err != nil {
+			continue
+		}
+		generations = append(generations, generationDir{dir: genDir, start: start})
+	}
+	sort.Slice(generations, func(i, j int) bool {
+		return generations[i].start.Before(generations[j].start)
+	})
+	return generations, nil
+}
+
+// RestoreReplica rebuilds the database as of the given time from the replica
+// in dir and writes it to out. Returns the time of the
+// latest change included; changes are shipped about every REPLICA_SYNC_SECONDS,
+// so that is how precisely a time can be hit.
+func RestoreReplica(dir string, to time.Time, out string) (time.Time, error) {
+	generations, err := listGenerations(dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var gen *generationDir
+	for i := range generations {
+		if !generations[i].start.After(to) {
+			gen = &generations[i]
+		}
+	}
+	if gen == nil {
+		return time.Time{}, fmt.Errorf("no snapshot in %s from before %s", dir, to.Format(time.RFC3339))
+	}
+
+	tmp := out + ".restoring"
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+	if err := copyFile(filepath.Join(gen.dir, snapshotFile), tmp); err != nil {
+		return time.Time{}, err
+	}
+
+	restoredTo, err := applySegments(tmp, filepath.Join(gen.dir, "wal"), to)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if restoredTo.IsZero() {
+		restoredTo = gen.start
+	}
+
+	// The rebuilt file is a plain database; the app switches it to WAL when opening it
+	conn, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, err = conn.Exec("PRAGMA journal_mode=DELETE")
+	conn.Close()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := ValidateBackup(tmp); err != nil {
+		return time.Time{}, err
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return time.Time{}, err
+	}
+	return restoredTo, nil
+}
+
+// applySegments writes the pages of all segments shipped up to the given time
+// into the database file. Returns when the last applied segment was shipped.
+func applySegments(dbPath, walDir string, to time.Time) (time.Time, error) {
+	entries, err := os.ReadDir(walDir)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	f, err := os.OpenFile(dbPath, os.O_RDWR, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 100)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return time.Time{}, err
+	}
+	pageSize := int64(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+
+	// Names sort by sequence number
+	var restoredTo time.Time
+	next := 0
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seqStr, msStr, ok := strings.Cut(strings.TrimSuffix(name, segmentExt), "-")
+		seq, err1 := strconv.Atoi(seqStr)
+		ms, err2 := strconv.ParseInt(msStr, 10, 64)
+		if !ok || err1 != nil || err2 != nil {
+			continue
+		}
+		shipped := time.UnixMilli(ms)
+		if shipped.After(to) {
+			break
+		}
+		if seq != next {
+			log.Printf("Replica segment %d is missing; restoring up to %s", next, restoredTo.Format(time.RFC3339))
+			break
+		}
+
+		data, err := os.ReadFile(filepath.Join(walDir, name))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if err := applyFrames(f, data, pageSize); err != nil {
+			return time.Time{}, fmt.Errorf("applying %s: %w", name, err)
+		}
+		restoredTo = shipped
+		next++
+	}
+	return restoredTo, f.Sync()
+}
+
+// checkSegment verifies the frame checksums of a segment and returns its frames
+func checkSegment(data []byte, pageSize int64) ([]byte, error) {
+	if len(data) < segmentHdrSize || !isWALMagic(binary.BigEndian.Uint32(data[0:4])) {
+		return nil, errors.New("segment has no valid header")
+	}
+	bigEndian := binary.BigEndian.Uint32(data[0:4])&1 == 1
+	sum := [2]uint32{binary.BigEndian.Uint32(data[4:8]), binary.BigEndian.Uint32(data[8:12])}
+
+	frames := data[segmentHdrSize:]
+	frameSize := walFrameHdrSize + pageSize
+	if len(frames) == 0 || int64(len(frames))%frameSize != 0 {
+		return nil, errors.New("segment is not a whole number of frames")
+	}
+	salt := frames[8:16]
+	for pos := int64(0); pos < int64(len(frames)); pos += frameSize {
+		frame := frames[pos : pos+frameSize]
+		sum = walChecksum(bigEndian, sum, frame[:8])
+		sum = walChecksum(bigEndian, sum, frame[walFrameHdrSize:])
+		if string(frame[8:16]) != string(salt) ||
+			sum[0] != binary.BigEndian.Uint32(frame[16:20]) || sum[1] != binary.BigEndian.Uint32(frame[20:24]) {
+			return nil, fmt.Errorf("frame %d is corrupted", pos/frameSize)
+		}
+	}
+	if binary.BigEndian.Uint32(frames[len(frames)-int(frameSize)+4:]) == 0 {
+		return nil, errors.New("segment ends inside a transaction")
+	}
+	return frames, nil
+}
+
+// applyFrames verifies a segment and writes each committed transaction's
+// pages at their place in the file. Nothing is written if the segment is corrupted.
+func applyFrames(f *os.File, segment []byte, pageSize int64) error {
+	data, err := checkSegment(segment, pageSize)
+	if err != nil {
+		return err
+	}
+
+	frameSize := walFrameHdrSize + pageSize
+	var pending [][]byte
+	for pos := int64(0); pos < int64(len(data)); pos += frameSize {
+		frame := data[pos : pos+frameSize]
+		pending = append(pending, frame)
+
+		commitSize := int64(binary.BigEndian.Uint32(frame[4:8]))
+		if commitSize == 0 {
+			continue
+		}
+		for _, p := range pending {
+			pgno := int64(binary.BigEndian.Uint32(p[0:4]))
+			if _, err := f.WriteAt(p[walFrameHdrSize:], (pgno-1)*pageSize); err != nil {
+				return err
+			}
+		}
+		if err := f.Truncate(commitSize * pageSize); err != nil {
+			return err
+		}
+		pending = pending[:0]
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
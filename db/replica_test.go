@@ -0,0 +1,150 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openReplicatedTestStore opens a SQLite database the way Open does with
+// REPLICA_DIR set and starts replicating it to a new directory
+func openReplicatedTestStore(t *testing.T) (Store, *Replicator, string) {
+	path := filepath.Join(t.TempDir(), "koffan.db")
+	conn, err := sql.Open(replicatedDriver, path+"?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := migrateTestStore(t, conn, SQLite)
+
+	dir := t.TempDir()
+	r, err := NewReplicator(DirSink(dir), path+"-wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, r, dir
+}
+
+// restoredLists rebuilds the replica as of a time and returns its list names
+func restoredLists(t *testing.T, dir string, to time.Time) []string {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "restored.db")
+	if _, err := RestoreReplica(dir, to, out); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := sql.Open("sqlite3", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return listNames(must(NewSQLStore(conn, SQLite).GetAllLists(0)))
+}
+
+// segments returns the paths of the shipped segments, oldest first
+func segments(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, generationsDir, "*", "wal", "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestReplicaRoundTrip(t *testing.T) {
+	s, r, dir := openReplicatedTestStore(t)
+
+	must(s.CreateList("Monday", "", 0))
+	if err := r.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	// Segments are named by the millisecond they were shipped in
+	time.Sleep(5 * time.Millisecond)
+	between := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	must(s.CreateList("Tuesday", "", 0))
+	list := must(s.GetAllLists(0))[0]
+	if _, err := s.UpdateList(list.ID, "Renamed", ""); err != nil {
+		t.Fatal(err)
+	}
+	r.Stop()
+
+	if n := len(segments(t, dir)); n != 2 {
+		t.Fatalf("%d segments shipped, want 2", n)
+	}
+	if names := restoredLists(t, dir, between); !equalStrings(names, []string{"Lista zakupów", "Monday"}) {
+		t.Errorf("lists restored as of between the syncs = %q", names)
+	}
+	if names := restoredLists(t, dir, time.Now()); !equalStrings(names, []string{"Renamed", "Monday", "Tuesday"}) {
+		t.Errorf("lists restored as of now = %q", names)
+	}
+
+	// Nothing can be restored from before the first snapshot
+	if _, err := RestoreReplica(dir, time.Now().Add(-time.Hour), filepath.Join(t.TempDir(), "early.db")); err == nil {
+		t.Error("restored from before the first snapshot")
+	}
+}
+
+func TestReplicaRejectsCorruptedSegment(t *testing.T) {
+	s, r, dir := openReplicatedTestStore(t)
+
+	must(s.CreateList("Monday", "", 0))
+	if err := r.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	between := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	must(s.CreateList("Tuesday", "", 0))
+	r.Stop()
+
+	paths := segments(t, dir)
+	if len(paths) != 2 {
+		t.Fatalf("%d segments shipped, want 2", len(paths))
+	}
+	original := must(os.ReadFile(paths[1]))
+
+	tests := []struct {
+		name    string
+		corrupt func([]byte) []byte
+	}{
+		{"a flipped bit in a page", func(b []byte) []byte {
+			b[len(b)-100] ^= 0x01
+			return b
+		}},
+		{"a changed checksum seed", func(b []byte) []byte {
+			b[5] ^= 0x01
+			return b
+		}},
+		{"a truncated frame", func(b []byte) []byte {
+			return b[:len(b)-10]
+		}},
+		{"a missing last frame", func(b []byte) []byte {
+			return b[:len(b)-int(walFrameHdrSize+4096)]
+		}},
+		{"no header", func(b []byte) []byte {
+			return b[segmentHdrSize:]
+		}},
+	}
+	for _, tt := range tests {
+		data := tt.corrupt(append([]byte(nil), original...))
+		if err := os.WriteFile(paths[1], data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(t.TempDir(), "restored.db")
+		_, err := RestoreReplica(dir, time.Now(), out)
+		if err == nil || !strings.Contains(err.Error(), filepath.Base(paths[1])) {
+			t.Errorf("restoring with %s = %v", tt.name, err)
+		}
+		if _, statErr := os.Stat(out); !os.IsNotExist(statErr) {
+			t.Errorf("restoring with %s left a database behind", tt.name)
+		}
+	}
+
+	// The changes before the damaged segment can still be restored
+	if names := restoredLists(t, dir, between); !equalStrings(names, []string{"Lista zakupów", "Monday"}) {
+		t.Errorf("lists restored as of before the damaged segment = %q", names)
+	}
+}
@@ -0,0 +1,231 @@
+package db
+
+import "database/sql"
+
+// Store is everything the app persists. SQLStore keeps it in SQLite or
+// PostgreSQL; MemoryStore keeps it in memory for tests.
+type Store interface {
+	ListStore
+	PermissionStore
+	SectionStore
+	ItemStore
+	HistoryStore
+	TemplateStore
+	UserStore
+	TwoFactorStore
+	SessionStore
+	RateLimitStore
+	TokenStore
+	WebhookStore
+	InboundHookStore
+	CalDAVStore
+
+	// Batch runs fn in a transaction; nothing is saved if fn returns an error
+	Batch(fn func(b BatchStore) error) error
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// ListStore manages shopping lists
+type ListStore interface {
+	GetAllLists(userID int64) ([]List, error)
+	GetListByID(id int64) (*List, error)
+	GetActiveList(userID int64) (*List, error)
+	CreateList(name, icon string, ownerID int64) (*List, error)
+	UpdateList(id int64, name, icon string) (*List, error)
+	DeleteList(id int64) error
+	SetActiveList(userID, id int64) error
+	MoveListUp(id int64) error
+	MoveListDown(id int64) error
+	GetListStats(listID int64) Stats
+}
+
+// PermissionStore manages who may see and edit a list
+type PermissionStore interface {
+	GetListACL(listID int64) (*ListACL, error)
+	GetListRole(listID, userID int64) (string, error)
+	GetListMembers(listID int64) ([]ListMember, error)
+	SetListMember(listID, userID int64, role string) error
+	RemoveListMember(listID, userID int64) error
+	SetListPrivate(listID int64, private bool, claimantID int64) error
+	SetListOwner(listID, ownerID int64) error
+	ReplaceListPermissions(listID int64, private *bool, claimantID int64, members map[int64]string) error
+	GetItemListID(itemID int64) (int64, error)
+	GetSectionListID(sectionID int64) (int64, error)
+}
+
+// SectionStore manages the sections of a list
+type SectionStore interface {
+	GetSectionsByList(listID int64) ([]Section, error)
+	GetSectionByID(id int64) (*Section, error)
+	CreateSectionForList(listID int64, name string) (*Section, error)
+	UpdateSection(id int64, name string) (*Section, error)
+	DeleteSection(id int64) error
+	DeleteSections(ids []int64) error
+	MoveSectionUp(id int64) error
+	MoveSectionDown(id int64) error
+	GetSectionStats(sectionID int64) SectionStats
+}
+
+// ItemStore manages the items of a section
+type ItemStore interface {
+	GetItemsBySection(sectionID int64) ([]Item, error)
+	GetItemByID(id int64) (*Item, error)
+	CreateItem(sectionID int64, name, description string) (*Item, error)
+	UpdateItem(id int64, name, description string) (*Item, error)
+	DeleteItem(id int64) error
+	DeleteCompletedItems(listID int64) (int64, error)
+	ToggleItemCompleted(id int64) (*Item, error)
+	ToggleItemUncertain(id int64) (*Item, error)
+	MoveItemToSection(id, newSectionID int64) (*Item, error)
+	MoveItemUp(id int64) error
+	MoveItemDown(id int64) error
+}
+
+// HistoryStore remembers item names for auto-completion
+type HistoryStore interface {
+	SaveItemHistory(name string, sectionID int64) error
+	GetItemSuggestions(query string, limit int) ([]ItemSuggestion, error)
+	GetAllItemSuggestions(limit int) ([]ItemSuggestion, error)
+	GetItemHistoryList() ([]HistoryItem, error)
+	GetAllItemHistory() ([]HistoryItem, error)
+	DeleteItemHistory(id int64) error
+	DeleteItemHistoryBatch(ids []int64) (int64, error)
+}
+
+// TemplateStore manages reusable list templates
+type TemplateStore interface {
+	GetAllTemplates() ([]Template, error)
+	GetTemplateByID(id int64) (*Template, error)
+	GetTemplateItems(templateID int64) ([]TemplateItem, error)
+	CreateTemplate(name, description string) (*Template, error)
+	UpdateTemplate(id int64, name, description string) (*Template, error)
+	DeleteTemplate(id int64) error
+	AddTemplateItem(templateID int64, sectionName, name, description string) (*TemplateItem, error)
+	GetTemplateItemByID(id int64) (*TemplateItem, error)
+	UpdateTemplateItem(id int64, sectionName, name, description string) (*TemplateItem, error)
+	DeleteTemplateItem(id int64) error
+	ApplyTemplateToList(templateID, listID int64) error
+	CreateTemplateFromList(listID int64, templateName, templateDescription string) (*Template, error)
+}
+
+// UserStore manages household members and their login identities
+type UserStore interface {
+	GetOrCreateUser(username string) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	GetUserByID(id int64) (*User, error)
+	GetAllUsers() ([]User, error)
+	GetUserPasswordHash(userID int64) (string, error)
+	SetUserPasswordHash(userID int64, hash string) error
+	GetUserByIdentity(issuer, subject string) (*User, error)
+	LinkUserIdentity(issuer, subject string, userID int64) error
+}
+
+// TwoFactorStore manages TOTP secrets and recovery codes
+type TwoFactorStore interface {
+	GetUserTOTP(userID int64) (*UserTOTP, error)
+	IsTOTPEnabled(userID int64) (bool, error)
+	SaveTOTPSecret(userID int64, secret string) error
+	EnableTOTP(userID, step int64, recoveryCodeHashes []string) error
+	DisableTOTP(userID int64) error
+	UseTOTPStep(userID, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int64, codeHashes []string) error
+	UseRecoveryCode(userID int64, codeHash string) (bool, error)
+	CountRecoveryCodes(userID int64) int
+}
+
+// SessionStore manages logged-in devices
+type SessionStore interface {
+	CreateSession(s *Session) error
+	GetSession(id string) (*Session, error)
+	GetSessions(userID int64) ([]Session, error)
+	TouchSession(id, ip string, lastSeenAt, expiresAt int64) error
+	RenameSession(publicID string, userID int64, label string) error
+	DeleteSession(id string) error
+	RevokeSession(publicID string, userID int64) error
+	RevokeOtherSessions(userID int64, keepID string) (int64, error)
+	CleanExpiredSessions() error
+}
+
+// RateLimitStore keeps rate limit counters across restarts
+type RateLimitStore interface {
+	GetRateLimit(key string) (*RateLimitEntry, error)
+	SaveRateLimit(key string, e *RateLimitEntry) error
+	DeleteRateLimit(key string) error
+	CleanRateLimits(prefix string, windowStartBefore, now int64) error
+}
+
+// TokenStore manages API tokens created with the create-token command.
+// Only a hash of each token is stored.
+type TokenStore interface {
+	CreateAPIToken(name, tokenHash string, userID int64) (*APIToken, error)
+	GetAPITokenByHash(tokenHash string) (*APIToken, error)
+	GetAPITokens() ([]APIToken, error)
+	TouchAPIToken(id, lastUsedAt int64) error
+	DeleteAPIToken(name string) error
+}
+
+// WebhookStore manages outgoing webhooks and their delivery queue
+type WebhookStore interface {
+	CreateWebhook(w *Webhook) (*Webhook, error)
+	GetWebhooks() ([]Webhook, error)
+	GetWebhook(id int64) (*Webhook, error)
+	UpdateWebhook(w *Webhook) (*Webhook, error)
+	DeleteWebhook(id int64) error
+	CreateWebhookDelivery(d *WebhookDelivery) (*WebhookDelivery, error)
+	GetDueWebhookDeliveries(now int64, limit int) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(d *WebhookDelivery) error
+	GetWebhookDeliveries(webhookID int64, limit int) ([]WebhookDelivery, error)
+	DeleteWebhookDeliveries(finishedBefore int64) error
+}
+
+// InboundHookStore manages the tokens that may add items to one list
+type InboundHookStore interface {
+	CreateInboundHook(h *InboundHook, tokenHash string) (*InboundHook, error)
+	GetInboundHookByHash(tokenHash string) (*InboundHook, error)
+	GetInboundHookByMailAlias(alias string) (*InboundHook, error)
+	GetInboundHooks() ([]InboundHook, error)
+	TouchInboundHook(id, lastUsedAt int64) error
+	DeleteInboundHook(id int64) error
+}
+
+// CalDAVStore keeps the resource names and UIDs CalDAV clients gave items
+type CalDAVStore interface {
+	SaveCalDAVObject(o CalDAVObject) error
+	GetCalDAVObjects(listID int64) ([]CalDAVObject, error)
+	GetCalDAVObjectByName(name string) (*CalDAVObject, error)
+}
+
+// BatchStore creates lists, sections and items inside a Batch transaction.
+// Imports also use it to restore templates and history and to replace all data.
+type BatchStore interface {
+	CreateList(name, icon string, ownerID int64) (*List, error)
+	ReplaceListPermissions(listID int64, private *bool, claimantID int64, members map[int64]string) error
+	CreateSection(listID int64, name string, sortOrder int) (*Section, error)
+	CreateItem(sectionID int64, name, description string, sortOrder int) (*Item, error)
+	SaveItemHistory(name string, sectionID int64)
+	MaxSectionOrder(listID int64) int
+	MaxItemOrder(sectionID int64) int
+	SetActiveList(id int64) error
+	SetItemStatus(id int64, completed, uncertain bool) error
+	UpdateItem(id int64, name, description string, completed bool) error
+	DeleteItem(id int64) error
+	CreateTemplate(name, description string) (*Template, error)
+	CreateTemplateItem(templateID int64, sectionName, name, description string, sortOrder int) (*TemplateItem, error)
+	ImportItemHistory(name string, sectionID int64, usageCount int, lastUsedAt int64) error
+	DeleteAllData() error
+}
+
+// SQLStore implements Store on a SQLite or PostgreSQL connection
+type SQLStore struct {
+	db      *sql.DB
+	backend Backend
+}
+
+// NewSQLStore wraps an open connection; backend selects the SQL dialect
+func NewSQLStore(conn *sql.DB, backend Backend) *SQLStore {
+	return &SQLStore{db: conn, backend: backend}
+}
@@ -0,0 +1,544 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The tests in this file only use the Store interface and run against every
+// backend: SQLite, MemoryStore and, when TEST_DATABASE_URL points to a
+// PostgreSQL database, PostgreSQL. Each test gets a freshly migrated schema.
+
+type storeFactory struct {
+	name string
+	open func(t *testing.T) Store
+}
+
+func storeFactories() []storeFactory {
+	return []storeFactory{
+		{"sqlite", openSQLiteTestStore},
+		{"postgres", openPostgresTestStore},
+		{"memory", openMemoryTestStore},
+	}
+}
+
+// forEachStore runs a test against a new store of every backend
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	for _, f := range storeFactories() {
+		t.Run(f.name, func(t *testing.T) {
+			test(t, f.open(t))
+		})
+	}
+}
+
+func openSQLiteTestStore(t *testing.T) Store {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrateTestStore(t, conn, SQLite)
+}
+
+// openPostgresTestStore migrates a new schema in the TEST_DATABASE_URL
+// database and drops it when the test ends
+func openPostgresTestStore(t *testing.T) Store {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := openPostgres(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("koffan_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	conn, err := openPostgres(url + sep + "search_path=" + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrateTestStore(t, conn, Postgres)
+}
+
+// migrateTestStore runs the migrations on conn, which Migrate finds in DB
+func migrateTestStore(t *testing.T, conn *sql.DB, b Backend) Store {
+	oldDB, oldBackend := DB, backend
+	DB, backend = conn, b
+	t.Cleanup(func() {
+		conn.Close()
+		DB, backend = oldDB, oldBackend
+	})
+
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLStore(conn, b)
+}
+
+// openMemoryTestStore starts with the default list the migrations create
+func openMemoryTestStore(t *testing.T) Store {
+	s := NewMemoryStore()
+	list, err := s.CreateList("Lista zakupów", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetActiveList(0, list.ID); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// must returns v, failing the test by panicking if err is set
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func listNames(lists []List) []string {
+	var names []string
+	for _, l := range lists {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+func itemNames(items []Item) []string {
+	var names []string
+	for _, i := range items {
+		names = append(names, i.Name)
+	}
+	return names
+}
+
+func equalStrings(a, b []string) bool {
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00")
+}
+
+func TestStoreLists(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		first := must(s.GetActiveList(0))
+
+		a := must(s.CreateList("Groceries", "", 0))
+		if a.Icon != "🛒" || a.IsActive {
+			t.Errorf("new list = %+v, want default icon and not active", a)
+		}
+		b := must(s.CreateList("Hardware", "🔨", 0))
+
+		if err := s.MoveListUp(b.ID); err != nil {
+			t.Fatal(err)
+		}
+		lists := must(s.GetAllLists(0))
+		if want := []string{first.Name, "Hardware", "Groceries"}; !equalStrings(listNames(lists), want) {
+			t.Errorf("lists = %v, want %v", listNames(lists), want)
+		}
+
+		updated := must(s.UpdateList(a.ID, "Food", ""))
+		if updated.Name != "Food" || updated.Icon != "🛒" {
+			t.Errorf("updated list = %+v, want the name changed and the icon kept", updated)
+		}
+
+		section := must(s.CreateSectionForList(a.ID, "Dairy"))
+		item := must(s.CreateItem(section.ID, "Milk", ""))
+		if err := s.DeleteList(a.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetListByID(a.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetListByID of a deleted list: err = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.GetItemByID(item.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetItemByID of an item of a deleted list: err = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestStoreActiveListPerUser(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		def := must(s.GetActiveList(0))
+		other := must(s.CreateList("Other", "", 0))
+		alice := must(s.GetOrCreateUser("alice"))
+		bob := must(s.GetOrCreateUser("bob"))
+
+		if err := s.SetActiveList(alice.ID, other.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := must(s.GetActiveList(alice.ID)); got.ID != other.ID || !got.IsActive {
+			t.Errorf("alice's active list = %d, want %d", got.ID, other.ID)
+		}
+		if got := must(s.GetActiveList(bob.ID)); got.ID != def.ID {
+			t.Errorf("bob's active list = %d, want the default %d", got.ID, def.ID)
+		}
+		if got := must(s.GetActiveList(0)); got.ID != def.ID {
+			t.Errorf("default list = %d, want %d", got.ID, def.ID)
+		}
+
+		for _, l := range must(s.GetAllLists(alice.ID)) {
+			if l.IsActive != (l.ID == other.ID) {
+				t.Errorf("list %d IsActive = %v for alice", l.ID, l.IsActive)
+			}
+		}
+
+		// A list the user can no longer see, or a deleted one, falls back to the default
+		if err := s.SetListPrivate(other.ID, true, bob.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := must(s.GetActiveList(alice.ID)); got.ID != def.ID {
+			t.Errorf("alice's active list after losing access = %d, want %d", got.ID, def.ID)
+		}
+		if err := s.SetActiveList(bob.ID, other.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DeleteList(other.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := must(s.GetActiveList(bob.ID)); got.ID != def.ID {
+			t.Errorf("bob's active list after deleting it = %d, want %d", got.ID, def.ID)
+		}
+	})
+}
+
+func TestStorePermissions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		owner := must(s.GetOrCreateUser("owner"))
+		member := must(s.GetOrCreateUser("member"))
+		stranger := must(s.GetOrCreateUser("stranger"))
+
+		list := must(s.CreateList("Private", "", owner.ID))
+		if err := s.SetListPrivate(list.ID, true, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetListMember(list.ID, member.ID, RoleViewer); err != nil {
+			t.Fatal(err)
+		}
+
+		roles := map[int64]string{0: RoleOwner, owner.ID: RoleOwner, member.ID: RoleViewer, stranger.ID: RoleNone}
+		for userID, want := range roles {
+			if got := must(s.GetListRole(list.ID, userID)); got != want {
+				t.Errorf("role of user %d = %q, want %q", userID, got, want)
+			}
+		}
+		for _, l := range must(s.GetAllLists(stranger.ID)) {
+			if l.ID == list.ID {
+				t.Error("a private list is visible to a stranger")
+			}
+		}
+
+		acl := must(s.GetListACL(list.ID))
+		if acl.OwnerID != owner.ID || !acl.IsPrivate || acl.Members[member.ID] != RoleViewer {
+			t.Errorf("ACL = %+v", acl)
+		}
+
+		if err := s.SetListMember(list.ID, member.ID, RoleEditor); err != nil {
+			t.Fatal(err)
+		}
+		members := must(s.GetListMembers(list.ID))
+		if len(members) != 1 || members[0].Username != "member" || members[0].Role != RoleEditor {
+			t.Errorf("members = %+v, want member as editor", members)
+		}
+		if err := s.RemoveListMember(list.ID, member.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := must(s.GetListRole(list.ID, member.ID)); got != RoleNone {
+			t.Errorf("role after removal = %q, want none", got)
+		}
+
+		// Nobody but system access may manage an unowned list
+		shared := must(s.CreateList("Shared", "", 0))
+		if got := must(s.GetListRole(shared.ID, member.ID)); got != RoleEditor {
+			t.Errorf("role on an unowned list = %q, want editor", got)
+		}
+		if err := s.SetListOwner(shared.ID, stranger.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := must(s.GetListRole(shared.ID, stranger.ID)); got != RoleOwner {
+			t.Errorf("role of the new owner = %q, want owner", got)
+		}
+		if err := s.SetListOwner(shared.ID+100, stranger.ID); err != sql.ErrNoRows {
+			t.Errorf("SetListOwner of a missing list = %v, want sql.ErrNoRows", err)
+		}
+
+		// Making an unowned list private hands it to the claimant
+		shared = must(s.CreateList("Shared too", "", 0))
+		if err := s.SetListPrivate(shared.ID, true, member.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := must(s.GetListRole(shared.ID, member.ID)); got != RoleOwner {
+			t.Errorf("claimant role = %q, want owner", got)
+		}
+
+		// Replacing the permissions drops members that aren't given
+		if err := s.SetListMember(list.ID, stranger.ID, RoleViewer); err != nil {
+			t.Fatal(err)
+		}
+		public := false
+		if err := s.ReplaceListPermissions(list.ID, &public, 0, map[int64]string{member.ID: RoleEditor}); err != nil {
+			t.Fatal(err)
+		}
+		acl = must(s.GetListACL(list.ID))
+		if acl.IsPrivate || acl.OwnerID != owner.ID || len(acl.Members) != 1 || acl.Members[member.ID] != RoleEditor {
+			t.Errorf("ACL after ReplaceListPermissions = %+v", acl)
+		}
+	})
+}
+
+func TestStoreSectionsAndItems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		list := must(s.CreateList("Groceries", "", 0))
+		other := must(s.CreateList("Other", "", 0))
+		dairy := must(s.CreateSectionForList(list.ID, "Dairy"))
+		bakery := must(s.CreateSectionForList(list.ID, "Bakery"))
+
+		if err := s.MoveSectionUp(bakery.ID); err != nil {
+			t.Fatal(err)
+		}
+		sections := must(s.GetSectionsByList(list.ID))
+		if len(sections) != 2 || sections[0].ID != bakery.ID {
+			t.Fatalf("sections = %+v, want Bakery first", sections)
+		}
+		if id := must(s.GetSectionListID(dairy.ID)); id != list.ID {
+			t.Errorf("GetSectionListID = %d, want %d", id, list.ID)
+		}
+
+		milk := must(s.CreateItem(dairy.ID, "Milk", "2 l"))
+		butter := must(s.CreateItem(dairy.ID, "Butter", ""))
+		must(s.CreateItem(dairy.ID, "Cheese", ""))
+		if err := s.MoveItemDown(milk.ID); err != nil {
+			t.Fatal(err)
+		}
+		items := must(s.GetItemsBySection(dairy.ID))
+		if want := []string{"Butter", "Milk", "Cheese"}; !equalStrings(itemNames(items), want) {
+			t.Errorf("items = %v, want %v", itemNames(items), want)
+		}
+
+		updated := must(s.UpdateItem(milk.ID, "Oat milk", "1 l"))
+		if updated.Name != "Oat milk" || updated.Description != "1 l" {
+			t.Errorf("updated item = %+v", updated)
+		}
+		if toggled := must(s.ToggleItemUncertain(milk.ID)); !toggled.Uncertain {
+			t.Error("ToggleItemUncertain did not mark the item uncertain")
+		}
+		moved := must(s.MoveItemToSection(butter.ID, bakery.ID))
+		if moved.SectionID != bakery.ID {
+			t.Errorf("moved item is in section %d, want %d", moved.SectionID, bakery.ID)
+		}
+		if id := must(s.GetItemListID(butter.ID)); id != list.ID {
+			t.Errorf("GetItemListID = %d, want %d", id, list.ID)
+		}
+
+		// Completed items are only deleted from the given list
+		otherSection := must(s.CreateSectionForList(other.ID, "Misc"))
+		otherItem := must(s.CreateItem(otherSection.ID, "Tape", ""))
+		for _, id := range []int64{milk.ID, butter.ID, otherItem.ID} {
+			if toggled := must(s.ToggleItemCompleted(id)); !toggled.Completed {
+				t.Fatalf("item %d not completed", id)
+			}
+		}
+		if stats := s.GetListStats(list.ID); stats != (Stats{TotalItems: 3, CompletedItems: 2, Percentage: 66}) {
+			t.Errorf("list stats = %+v", stats)
+		}
+		if stats := s.GetSectionStats(dairy.ID); stats != (SectionStats{TotalItems: 2, CompletedItems: 1, Percentage: 50}) {
+			t.Errorf("section stats = %+v", stats)
+		}
+		if n := must(s.DeleteCompletedItems(list.ID)); n != 2 {
+			t.Errorf("DeleteCompletedItems = %d, want 2", n)
+		}
+		if _, err := s.GetItemByID(otherItem.ID); err != nil {
+			t.Errorf("completed item of another list was deleted: %v", err)
+		}
+
+		if err := s.DeleteSections([]int64{dairy.ID, bakery.ID}); err != nil {
+			t.Fatal(err)
+		}
+		if sections := must(s.GetSectionsByList(list.ID)); len(sections) != 0 {
+			t.Errorf("%d sections left after DeleteSections", len(sections))
+		}
+	})
+}
+
+func TestStoreItemHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		list := must(s.CreateList("Groceries", "", 0))
+		dairy := must(s.CreateSectionForList(list.ID, "Dairy"))
+
+		for _, name := range []string{"Milk", "milk", "Mustard"} {
+			if err := s.SaveItemHistory(name, dairy.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		history := must(s.GetAllItemHistory())
+		if len(history) != 2 {
+			t.Fatalf("history = %+v, want names merged case-insensitively", history)
+		}
+
+		suggestions := must(s.GetItemSuggestions("mil", 5))
+		if len(suggestions) == 0 || suggestions[0].Name != "Milk" || suggestions[0].UsageCount != 2 || suggestions[0].LastSectionName != "Dairy" {
+			t.Errorf("suggestions for mil = %+v", suggestions)
+		}
+
+		ids := []int64{history[0].ID, history[1].ID}
+		if n := must(s.DeleteItemHistoryBatch(ids)); n != 2 {
+			t.Errorf("DeleteItemHistoryBatch = %d, want 2", n)
+		}
+		if history := must(s.GetAllItemHistory()); len(history) != 0 {
+			t.Errorf("%d history entries left", len(history))
+		}
+	})
+}
+
+func TestStoreTemplates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		tmpl := must(s.CreateTemplate("Weekly", "Every week"))
+		must(s.AddTemplateItem(tmpl.ID, "Dairy", "Milk", ""))
+		must(s.AddTemplateItem(tmpl.ID, "Bakery", "Bread", "whole grain"))
+
+		list := must(s.CreateList("Groceries", "", 0))
+		if err := s.ApplyTemplateToList(tmpl.ID, list.ID); err != nil {
+			t.Fatal(err)
+		}
+		sections := must(s.GetSectionsByList(list.ID))
+		if len(sections) != 2 || len(sections[0].Items)+len(sections[1].Items) != 2 {
+			t.Fatalf("sections after applying the template = %+v", sections)
+		}
+
+		copied := must(s.CreateTemplateFromList(list.ID, "Copy", ""))
+		if items := must(s.GetTemplateItems(copied.ID)); len(items) != 2 {
+			t.Errorf("template from list has %d items, want 2", len(items))
+		}
+
+		if err := s.DeleteTemplate(tmpl.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetTemplateByID(tmpl.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetTemplateByID of a deleted template: err = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestStoreUsersAndSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		user := must(s.GetOrCreateUser("Alice"))
+		if again := must(s.GetOrCreateUser("alice")); again.ID != user.ID {
+			t.Errorf("GetOrCreateUser is not case-insensitive: %d != %d", again.ID, user.ID)
+		}
+		if err := s.SetUserPasswordHash(user.ID, "hash"); err != nil {
+			t.Fatal(err)
+		}
+		if hash := must(s.GetUserPasswordHash(user.ID)); hash != "hash" {
+			t.Errorf("password hash = %q", hash)
+		}
+
+		if err := s.LinkUserIdentity("https://issuer", "sub-1", user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if linked := must(s.GetUserByIdentity("https://issuer", "sub-1")); linked.ID != user.ID {
+			t.Errorf("identity is linked to %d, want %d", linked.ID, user.ID)
+		}
+		if _, err := s.GetUserByIdentity("https://issuer", "sub-2"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("unknown identity: err = %v, want sql.ErrNoRows", err)
+		}
+
+		expires := time.Now().Add(time.Hour).Unix()
+		for _, id := range []string{"one", "two", "three"} {
+			if err := s.CreateSession(&Session{ID: id, UserID: user.ID, ExpiresAt: expires}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		session := must(s.GetSession("one"))
+		if session.UserID != user.ID || session.Username != "Alice" || session.PublicID == "" {
+			t.Errorf("session = %+v", session)
+		}
+		if n := must(s.RevokeOtherSessions(user.ID, "one")); n != 2 {
+			t.Errorf("RevokeOtherSessions = %d, want 2", n)
+		}
+		if sessions := must(s.GetSessions(user.ID)); len(sessions) != 1 || sessions[0].PublicID != session.PublicID {
+			t.Errorf("sessions left = %+v", sessions)
+		}
+	})
+}
+
+func TestStoreRateLimits(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		if _, err := s.GetRateLimit("login:1.2.3.4"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("missing counter: err = %v, want sql.ErrNoRows", err)
+		}
+		entry := &RateLimitEntry{Count: 3, WindowStart: 100, BlockedUntil: 200}
+		if err := s.SaveRateLimit("login:1.2.3.4", entry); err != nil {
+			t.Fatal(err)
+		}
+		entry.Count = 4
+		if err := s.SaveRateLimit("login:1.2.3.4", entry); err != nil {
+			t.Fatal(err)
+		}
+		if got := must(s.GetRateLimit("login:1.2.3.4")); *got != *entry {
+			t.Errorf("counter = %+v, want %+v", got, entry)
+		}
+		if err := s.DeleteRateLimit("login:1.2.3.4"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetRateLimit("login:1.2.3.4"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("deleted counter: err = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestStoreBatchRollsBack(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		before := len(must(s.GetAllLists(0)))
+
+		failed := errors.New("stop")
+		err := s.Batch(func(b BatchStore) error {
+			list, err := b.CreateList("Imported", "", 0)
+			if err != nil {
+				return err
+			}
+			section, err := b.CreateSection(list.ID, "Section", 0)
+			if err != nil {
+				return err
+			}
+			if _, err := b.CreateItem(section.ID, "Item", "", 0); err != nil {
+				return err
+			}
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Fatalf("Batch err = %v, want %v", err, failed)
+		}
+		if after := len(must(s.GetAllLists(0))); after != before {
+			t.Errorf("%d lists after a failed batch, want %d", after, before)
+		}
+
+		err = s.Batch(func(b BatchStore) error {
+			list, err := b.CreateList("Imported", "", 0)
+			if err != nil {
+				return err
+			}
+			return b.SetActiveList(list.ID)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active := must(s.GetActiveList(0)); active.Name != "Imported" {
+			t.Errorf("default list after the batch = %q, want Imported", active.Name)
+		}
+	})
+}
@@ -9,12 +9,17 @@ import (
 
 // GetAllData returns all sections with items and stats for offline caching
 func GetAllData(c *fiber.Ctx) error {
-	sections, err := db.GetAllSections()
+	activeList, status, msg := checkActiveListRole(c, db.RoleViewer)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	sections, err := store.GetSectionsByList(activeList.ID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
 	}
 
-	stats := db.GetStats()
+	stats := store.GetListStats(activeList.ID)
 
 	return c.JSON(fiber.Map{
 		"sections":  sections,
@@ -7,6 +7,7 @@ import (
 	"os"
 	"shopping-list/db"
 	"shopping-list/i18n"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,7 +15,18 @@ import (
 
 const (
 	SessionCookieName = "session"
-	SessionDuration   = 7 * 24 * time.Hour // 7 days
+
+	// DefaultSessionIdleDays is how long a session survives without activity
+	DefaultSessionIdleDays = 7
+
+	// sessionTouchInterval limits how often activity is written to the database
+	sessionTouchInterval = 5 * time.Minute
+
+	// UserIDLocal is the fiber.Ctx locals key holding the authenticated user ID
+	UserIDLocal = "user_id"
+
+	// DefaultUsername is the account used when APP_USERS is not configured
+	DefaultUsername = "admin"
 )
 
 func getAppPassword() string {
@@ -25,10 +37,47 @@ func getAppPassword() string {
 	return pass
 }
 
+// getAppUsers parses APP_USERS ("alice:secret,bob:hunter2") into username -> password
+func getAppUsers() map[string]string {
+	users := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("APP_USERS"), ",") {
+		name, pass, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || pass == "" {
+			continue
+		}
+		users[strings.ToLower(name)] = pass
+	}
+	return users
+}
+
+// isMultiUser returns true if separate household accounts are configured
+func isMultiUser() bool {
+	return len(getAppUsers()) > 0
+}
+
+// sessionIdleTimeout returns the sliding session lifetime (SESSION_IDLE_DAYS)
+func sessionIdleTimeout() time.Duration {
+	days := getEnvInt("SESSION_IDLE_DAYS", DefaultSessionIdleDays)
+	if days < 1 {
+		days = DefaultSessionIdleDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
 func isAuthDisabled() bool {
 	return os.Getenv("DISABLE_AUTH") == "true"
 }
 
+// CurrentUserID returns the authenticated user's ID.
+// 0 means system access (authentication disabled) with no list restrictions.
+func CurrentUserID(c *fiber.Ctx) int64 {
+	if id, ok := c.Locals(UserIDLocal).(int64); ok {
+		return id
+	}
+	return 0
+}
+
 // isSecureConnection checks if the request came over HTTPS
 // Works both directly and behind reverse proxies
 func isSecureConnection(c *fiber.Ctx) bool {
@@ -50,28 +99,42 @@ func generateSessionID() string {
 
 // LoginPage renders the login page
 func LoginPage(c *fiber.Ctx) error {
+	// The reverse proxy already authenticated this user
+	if proxyAuthUser(c) != nil {
+		return c.Redirect("/")
+	}
+
 	// Check if already logged in
 	sessionID := c.Cookies(SessionCookieName)
 	if sessionID != "" {
-		session, err := db.GetSession(sessionID)
+		session, err := store.GetSession(sessionID)
 		if err == nil && session.ExpiresAt > time.Now().Unix() {
 			return c.Redirect("/")
 		}
 	}
 	return c.Render("login", fiber.Map{
-		"Error":        c.Query("error"),
-		"Translations": i18n.GetAllLocales(),
-		"Locales":      i18n.AvailableLocales(),
-		"DefaultLang":  i18n.GetDefaultLang(),
+		"Error":         c.Query("error"),
+		"MultiUser":     isMultiUser(),
+		"OIDCEnabled":   isOIDCEnabled(),
+		"OIDCProvider":  oidcProviderName(),
+		"PasswordLogin": !isPasswordLoginDisabled(),
+		"Translations":  i18n.GetAllLocales(),
+		"Locales":       i18n.AvailableLocales(),
+		"DefaultLang":   i18n.GetDefaultLang(),
 	}, "")
 }
 
 // Login handles login form submission
 func Login(c *fiber.Ctx) error {
-	ip := c.IP()
+	if isPasswordLoginDisabled() {
+		return c.Redirect("/login")
+	}
+
+	ip := ClientIP(c)
 	password := c.FormValue("password")
 
-	if password != getAppPassword() {
+	user, ok := checkCredentials(c.FormValue("username"), password)
+	if !ok {
 		// Record failed attempt
 		if loginLimiter != nil {
 			if loginLimiter.RecordAttempt(ip) {
@@ -82,40 +145,89 @@ func Login(c *fiber.Ctx) error {
 		return c.Redirect("/login?error=1")
 	}
 
+	// Users with an authenticator app get a second step before the session
+	// exists. Failed attempts are kept until the code is right, so knowing the
+	// password doesn't buy unlimited code guesses.
+	twoFactor, err := store.IsTOTPEnabled(user.ID)
+	if err != nil {
+		return c.Status(500).SendString("Session creation failed")
+	}
+	if twoFactor {
+		return beginTwoFactor(c, user)
+	}
+
 	// Successful login - reset attempts
 	if loginLimiter != nil {
 		loginLimiter.ResetAttempts(ip)
 	}
 
-	// Create session
-	sessionID := generateSessionID()
-	expiresAt := time.Now().Add(SessionDuration).Unix()
-
-	err := db.CreateSession(sessionID, expiresAt)
-	if err != nil {
+	if err := startSession(c, user); err != nil {
 		return c.Status(500).SendString("Session creation failed")
 	}
-	log.Printf("[AUTH] New session created: %s... (expires: %d)", sessionID[:8], expiresAt)
 
-	// Set cookie
+	return c.Redirect("/")
+}
+
+// startSession creates a session for the user and sets the session cookie
+func startSession(c *fiber.Ctx, user *db.User) error {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > MaxUserAgentLength {
+		userAgent = userAgent[:MaxUserAgentLength]
+	}
+
+	session := &db.Session{
+		ID:          generateSessionID(),
+		UserID:      user.ID,
+		DeviceLabel: deviceLabel(userAgent),
+		UserAgent:   userAgent,
+		IP:          ClientIP(c),
+		CSRFToken:   generateSessionID(),
+		ExpiresAt:   time.Now().Add(sessionIdleTimeout()).Unix(),
+	}
+	if err := store.CreateSession(session); err != nil {
+		return err
+	}
+	log.Printf("[AUTH] New session created for %s on %s: %s... (expires: %d)", user.Username, session.DeviceLabel, session.ID[:8], session.ExpiresAt)
+
+	setSessionCookie(c, session.ID)
+	return nil
+}
+
+// setSessionCookie (re)issues the session cookie with a fresh expiry
+func setSessionCookie(c *fiber.Ctx, sessionID string) {
 	c.Cookie(&fiber.Cookie{
 		Name:     SessionCookieName,
 		Value:    sessionID,
-		Expires:  time.Now().Add(SessionDuration),
+		Expires:  time.Now().Add(sessionIdleTimeout()),
 		HTTPOnly: true,
 		Secure:   isSecureConnection(c),
 		SameSite: "Lax",
 		Path:     "/",
 	})
+}
 
-	return c.Redirect("/")
+// touchSession slides the expiry of an active session forward.
+// Writes at most once per sessionTouchInterval to keep requests cheap.
+func touchSession(c *fiber.Ctx, session *db.Session) {
+	now := time.Now()
+	if now.Unix()-session.LastSeenAt < int64(sessionTouchInterval.Seconds()) {
+		return
+	}
+
+	expiresAt := now.Add(sessionIdleTimeout()).Unix()
+	if err := store.TouchSession(session.ID, ClientIP(c), now.Unix(), expiresAt); err != nil {
+		// Not fatal - the session is still valid until its old expiry
+		log.Printf("[AUTH] Failed to update session activity: %v", err)
+		return
+	}
+	setSessionCookie(c, session.ID)
 }
 
 // Logout handles logout
 func Logout(c *fiber.Ctx) error {
 	sessionID := c.Cookies(SessionCookieName)
 	if sessionID != "" {
-		db.DeleteSession(sessionID)
+		store.DeleteSession(sessionID)
 	}
 
 	// Clear cookie
@@ -129,6 +241,11 @@ func Logout(c *fiber.Ctx) error {
 		Path:     "/",
 	})
 
+	// The proxy would log the user straight back in, so end its session instead
+	if proxyAuth != nil && proxyAuth.LogoutURL != "" {
+		return c.Redirect(proxyAuth.LogoutURL)
+	}
+
 	return c.Redirect("/login")
 }
 
@@ -140,7 +257,13 @@ func AuthMiddleware(c *fiber.Ctx) error {
 
 	// Skip auth for login page and static files
 	path := c.Path()
-	if path == "/login" || path == "/static" || len(path) > 7 && path[:8] == "/static/" {
+	if path == "/login" || path == "/login/2fa" || path == "/static" || len(path) > 7 && path[:8] == "/static/" {
+		return c.Next()
+	}
+
+	// Trusted reverse proxy already authenticated the user
+	if user := proxyAuthUser(c); user != nil {
+		c.Locals(UserIDLocal, user.ID)
 		return c.Next()
 	}
 
@@ -154,13 +277,13 @@ func AuthMiddleware(c *fiber.Ctx) error {
 		return c.Redirect("/login")
 	}
 
-	session, err := db.GetSession(sessionID)
+	session, err := store.GetSession(sessionID)
 	if err != nil {
 		// Check if it's a "not found" error vs database error
 		if err.Error() == "sql: no rows in result set" {
 			log.Printf("[AUTH] Session not found in DB for %s %s (sessionID: %s...)", c.Method(), path, sessionID[:8])
 			// Only delete if session truly doesn't exist
-			db.DeleteSession(sessionID)
+			store.DeleteSession(sessionID)
 		} else {
 			// Database error (e.g., locked) - don't delete session, just log and retry
 			log.Printf("[AUTH] Database error for %s %s: %v", c.Method(), path, err)
@@ -183,9 +306,10 @@ func AuthMiddleware(c *fiber.Ctx) error {
 		return c.Redirect("/login")
 	}
 
-	if session.ExpiresAt < time.Now().Unix() {
-		log.Printf("[AUTH] Session expired for %s %s (expired: %d, now: %d)", c.Method(), path, session.ExpiresAt, time.Now().Unix())
-		db.DeleteSession(sessionID)
+	if session.ExpiresAt < time.Now().Unix() || session.UserID == 0 {
+		// Sessions without a user were created before user accounts existed
+		log.Printf("[AUTH] Session expired for %s %s (expired: %d, now: %d, user: %d)", c.Method(), path, session.ExpiresAt, time.Now().Unix(), session.UserID)
+		store.DeleteSession(sessionID)
 		c.Cookie(&fiber.Cookie{
 			Name:     SessionCookieName,
 			Value:    "",
@@ -202,5 +326,9 @@ func AuthMiddleware(c *fiber.Ctx) error {
 		return c.Redirect("/login")
 	}
 
+	touchSession(c, session)
+
+	c.Locals(UserIDLocal, session.UserID)
+	c.Locals(sessionLocal, session)
 	return c.Next()
 }
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultClientIPHeader carries the client address when TRUSTED_PROXIES is set
+const DefaultClientIPHeader = fiber.HeaderXForwardedFor
+
+var (
+	// trustedProxies are the addresses allowed to forward client IPs and proxy-auth headers
+	trustedProxies []*net.IPNet
+
+	// clientIPHeader is read only on requests coming from a trusted proxy
+	clientIPHeader = DefaultClientIPHeader
+)
+
+// InitTrustedProxies reads TRUSTED_PROXIES and CLIENT_IP_HEADER
+func InitTrustedProxies() {
+	trustedProxies = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if header := strings.TrimSpace(os.Getenv("CLIENT_IP_HEADER")); header != "" {
+		clientIPHeader = header
+	}
+	if len(trustedProxies) > 0 {
+		log.Printf("[PROXY] Client IPs read from %s of %d trusted proxy range(s)", clientIPHeader, len(trustedProxies))
+	}
+}
+
+// parseTrustedProxies parses comma-separated CIDRs; bare IPs match only themselves
+func parseTrustedProxies(value string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Printf("[PROXY] Ignoring invalid trusted proxy %q", entry)
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("[PROXY] Ignoring invalid trusted proxy %q: %v", entry, err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func isTrustedProxyIP(ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFromTrustedProxy checks the address of the direct peer, never forwarded headers
+func isFromTrustedProxy(c *fiber.Ctx) bool {
+	return isTrustedProxyIP(c.Context().RemoteIP())
+}
+
+// ClientIP returns the address of the client, looking through trusted proxies.
+// X-Forwarded-For is walked from the right so clients can't prepend fake entries.
+func ClientIP(c *fiber.Ctx) string {
+	peer := c.Context().RemoteIP()
+	if !isTrustedProxyIP(peer) {
+		return peer.String()
+	}
+
+	value := c.Get(clientIPHeader)
+	if value == "" {
+		return peer.String()
+	}
+
+	hops := strings.Split(value, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if i == 0 || !isTrustedProxyIP(ip) {
+			return ip.String()
+		}
+	}
+	return peer.String()
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	CSRFHeaderName = "X-CSRF-Token"
+	CSRFFormField  = "_csrf"
+
+	// CSRFTokenLocal is the fiber.Ctx locals key (and template variable) holding the token
+	CSRFTokenLocal = "CSRFToken"
+)
+
+// csrfKey signs tokens for requests without a session (proxy authentication,
+// DISABLE_AUTH). It is regenerated on restart, which only forces a page reload.
+var csrfKey []byte
+
+// trustedOrigins are extra origins allowed besides the request's own host
+var trustedOrigins map[string]bool
+
+// InitCSRF prepares the signing key and CSRF_TRUSTED_ORIGINS
+func InitCSRF() {
+	csrfKey = make([]byte, 32)
+	if _, err := rand.Read(csrfKey); err != nil {
+		log.Fatal("Failed to generate secure random bytes:", err)
+	}
+
+	trustedOrigins = make(map[string]bool)
+	for _, origin := range strings.Split(os.Getenv("CSRF_TRUSTED_ORIGINS"), ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			trustedOrigins[strings.ToLower(origin)] = true
+		}
+	}
+	if len(trustedOrigins) > 0 {
+		log.Printf("[CSRF] Trusted origins: %s", os.Getenv("CSRF_TRUSTED_ORIGINS"))
+	}
+}
+
+// CSRFToken returns the token the current request's pages must send back
+func CSRFToken(c *fiber.Ctx) string {
+	if session := CurrentSession(c); session != nil && session.CSRFToken != "" {
+		return session.CSRFToken
+	}
+
+	mac := hmac.New(sha256.New, csrfKey)
+	mac.Write([]byte("user:" + strconv.FormatInt(CurrentUserID(c), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// CheckOrigin reports whether the Origin header (if any) belongs to this server.
+// Requests without Origin come from non-browser clients or same-origin navigation.
+func CheckOrigin(c *fiber.Ctx) bool {
+	origin := c.Get(fiber.HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	if trustedOrigins[strings.ToLower(strings.TrimRight(origin, "/"))] {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	return host == strings.ToLower(c.Hostname()) || host == strings.ToLower(string(c.Request().Host()))
+}
+
+// CSRFMiddleware rejects state-changing requests without the session's token.
+// Must run after AuthMiddleware so the session is known.
+func CSRFMiddleware(c *fiber.Ctx) error {
+	token := CSRFToken(c)
+	c.Locals(CSRFTokenLocal, token)
+
+	if isSafeMethod(c.Method()) {
+		return c.Next()
+	}
+
+	if !CheckOrigin(c) {
+		log.Printf("[CSRF] Rejected %s %s from origin %s", c.Method(), c.Path(), c.Get(fiber.HeaderOrigin))
+		return csrfFailure(c)
+	}
+
+	sent := c.Get(CSRFHeaderName)
+	if sent == "" {
+		sent = c.FormValue(CSRFFormField)
+	}
+	if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		log.Printf("[CSRF] Missing or invalid token for %s %s", c.Method(), c.Path())
+		return csrfFailure(c)
+	}
+
+	return c.Next()
+}
+
+// csrfFailure makes HTMX reload the page, which picks up a fresh token
+func csrfFailure(c *fiber.Ctx) error {
+	if c.Get("HX-Request") == "true" {
+		target := "/"
+		if current, err := url.Parse(c.Get("HX-Current-URL")); err == nil && current.Path != "" {
+			target = current.RequestURI()
+		}
+		c.Set("HX-Redirect", target)
+		return c.SendStatus(403)
+	}
+	return c.Status(403).JSON(fiber.Map{"error": "Invalid or missing CSRF token. Please reload the page."})
+}
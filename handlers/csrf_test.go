@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/url"
+	"testing"
+)
+
+func TestCSRFToken(t *testing.T) {
+	env := newTestEnv(t)
+	session := env.login(env.alice)
+	other := env.login(env.bob)
+
+	tests := []struct {
+		name   string
+		token  string
+		form   bool
+		status int
+	}{
+		{"with the token in the header", session.CSRFToken, false, 200},
+		{"with the token in the form", session.CSRFToken, true, 200},
+		{"without a token", "", false, 403},
+		{"with a wrong token", "0123456789abcdef", false, 403},
+		{"with the token of another session", other.CSRFToken, false, 403},
+	}
+	for _, tt := range tests {
+		form := url.Values{}
+		if tt.form {
+			form.Set(CSRFFormField, tt.token)
+		}
+		// alice has no other sessions, so nothing is revoked
+		req := webRequest("POST", "/settings/sessions/revoke-others", session, form)
+		req.Header.Del(CSRFHeaderName)
+		if !tt.form && tt.token != "" {
+			req.Header.Set(CSRFHeaderName, tt.token)
+		}
+		if status, body := env.serve(req); status != tt.status {
+			t.Errorf("request %s = %d %s, want %d", tt.name, status, body, tt.status)
+		}
+	}
+
+	// Safe methods need no token
+	req := webRequest("GET", "/whoami", session, nil)
+	req.Header.Del(CSRFHeaderName)
+	if status, _ := env.serve(req); status != 200 {
+		t.Errorf("GET without a token = %d", status)
+	}
+}
+
+func TestCSRFOrigin(t *testing.T) {
+	env := newTestEnv(t)
+	t.Setenv("CSRF_TRUSTED_ORIGINS", "https://shop.example.com/")
+	InitCSRF()
+	t.Cleanup(func() { trustedOrigins = nil })
+	session := env.login(env.alice)
+
+	tests := map[string]int{
+		"":                         200,
+		"http://example.com":       200,
+		"https://shop.example.com": 200,
+		"https://evil.example":     403,
+		"http://example.com.evil":  403,
+		"null":                     403,
+	}
+	for origin, want := range tests {
+		// A valid token doesn't help a request from a foreign page
+		req := webRequest("POST", "/settings/sessions/revoke-others", session, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if status, body := env.serve(req); status != want {
+			t.Errorf("request from origin %q = %d %s, want %d", origin, status, body, want)
+		}
+	}
+}
+
+func TestLogoutCSRF(t *testing.T) {
+	env := newTestEnv(t)
+	session := env.login(env.alice)
+
+	// Another site can't log the user out
+	req := webRequest("POST", "/logout", session, nil)
+	req.Header.Del(CSRFHeaderName)
+	if status, _ := env.serve(req); status != 403 {
+		t.Errorf("logout without a token = %d", status)
+	}
+	req = webRequest("POST", "/logout", session, url.Values{CSRFFormField: {session.CSRFToken}})
+	req.Header.Del(CSRFHeaderName)
+	req.Header.Set("Origin", "https://evil.example")
+	if status, _ := env.serve(req); status != 403 {
+		t.Errorf("logout from a foreign origin = %d", status)
+	}
+	if _, err := env.store.GetSession(session.ID); err != nil {
+		t.Fatalf("session after rejected logouts: %v", err)
+	}
+
+	// The logout form sends the token
+	req = webRequest("POST", "/logout", session, url.Values{CSRFFormField: {session.CSRFToken}})
+	req.Header.Del(CSRFHeaderName)
+	resp := must(env.web.Test(req, -1))
+	if resp.StatusCode != 302 || resp.Header.Get("Location") != "/login" {
+		t.Errorf("logout = %d to %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if _, err := env.store.GetSession(session.ID); err != sql.ErrNoRows {
+		t.Errorf("session after logout: %v", err)
+	}
+}
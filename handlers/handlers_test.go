@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"shopping-list/db"
+	"shopping-list/service"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testUserHeader names the user a test request acts as, in place of a session
+const testUserHeader = "X-Test-User"
+
+// testEnv is a MemoryStore with the default list, two users and the handlers
+// under test
+type testEnv struct {
+	t     *testing.T
+	store *db.MemoryStore
+	app   *fiber.App
+	// web serves the routes that need a real session, see newWebApp
+	web         *fiber.App
+	defaultList *db.List
+	alice, bob  *db.User
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	s := db.NewMemoryStore()
+	SetStore(s)
+	SetService(service.New(s))
+
+	env := &testEnv{t: t, store: s}
+	env.defaultList = must(s.CreateList("Lista zakupów", "", 0))
+	if err := s.SetActiveList(0, env.defaultList.ID); err != nil {
+		t.Fatal(err)
+	}
+	env.alice = must(s.GetOrCreateUser("alice"))
+	env.bob = must(s.GetOrCreateUser("bob"))
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.ParseInt(c.Get(testUserHeader), 10, 64); err == nil {
+			c.Locals(UserIDLocal, id)
+		}
+		return c.Next()
+	})
+	app.Get("/stats", GetStats)
+	app.Get("/api/data", GetAllData)
+	app.Get("/api/item/:id/version", GetItemVersion)
+	app.Post("/items/delete-completed", DeleteCompletedItems)
+	app.Post("/items/:id/toggle", ToggleItem)
+	app.Delete("/items/:id", DeleteItem)
+	app.Get("/lists/:id/permissions", GetListPermissions)
+	app.Put("/lists/:id/permissions", UpdateListPermissions)
+	app.Post("/lists/:id/move-up", MoveListUp)
+	app.Delete("/lists/:id", DeleteList)
+	env.app = app
+	env.web = newWebApp()
+	return env
+}
+
+// newWebApp serves the login and account routes behind the session and CSRF
+// middleware, as main.go does. GET /whoami returns the current user ID.
+func newWebApp() *fiber.App {
+	app := fiber.New()
+	app.Post("/login", LoginRateLimitMiddleware, Login)
+	app.Post("/login/2fa", LoginRateLimitMiddleware, LoginTwoFactor)
+	app.Use(AuthMiddleware)
+	app.Use(CSRFMiddleware)
+	app.Post("/logout", Logout)
+	app.Get("/whoami", func(c *fiber.Ctx) error {
+		return c.SendString(strconv.FormatInt(CurrentUserID(c), 10))
+	})
+	app.Post("/settings/2fa/setup", SetupTwoFactor)
+	app.Post("/settings/2fa/enable", EnableTwoFactor)
+	app.Post("/settings/password", ChangePassword)
+	app.Get("/settings/sessions", GetSessions)
+	app.Post("/settings/sessions/revoke-others", RevokeOtherSessions)
+	app.Delete("/settings/sessions/:id", RevokeSession)
+	return app
+}
+
+// login creates a session for a user as a password login would
+func (env *testEnv) login(user *db.User) *db.Session {
+	env.t.Helper()
+	session := &db.Session{
+		ID:          generateSessionID(),
+		UserID:      user.ID,
+		DeviceLabel: "Test",
+		CSRFToken:   generateSessionID(),
+		ExpiresAt:   time.Now().Add(time.Hour).Unix(),
+	}
+	if err := env.store.CreateSession(session); err != nil {
+		env.t.Fatal(err)
+	}
+	return session
+}
+
+// webRequest builds a form request to the web app, sent with the session's
+// cookie and CSRF token if there is a session
+func webRequest(method, path string, session *db.Session, form url.Values) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if session != nil {
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: session.ID})
+		req.Header.Set(CSRFHeaderName, session.CSRFToken)
+	}
+	return req
+}
+
+// serve sends a request to the web app and returns the status and body
+func (env *testEnv) serve(req *http.Request) (int, string) {
+	env.t.Helper()
+	resp, err := env.web.Test(req, -1)
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+// must returns v, failing the test by panicking if err is set
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// addItem adds an item to a new section of a list, completed if asked
+func (env *testEnv) addItem(listID int64, name string, completed bool) *db.Item {
+	env.t.Helper()
+	section := must(env.store.CreateSectionForList(listID, "Section"))
+	item := must(env.store.CreateItem(section.ID, name, ""))
+	if completed {
+		item = must(env.store.ToggleItemCompleted(item.ID))
+	}
+	return item
+}
+
+// request sends a request as a user (0 for full access) and returns the
+// status and body
+func (env *testEnv) request(method, path string, userID int64, body string) (int, string) {
+	env.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if userID != 0 {
+		req.Header.Set(testUserHeader, strconv.FormatInt(userID, 10))
+	}
+	resp, err := env.app.Test(req, -1)
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
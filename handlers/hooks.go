@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HookAdd adds items to the list of an inbound hook. It needs no session, only
+// the hook token in the URL, and accepts the text as ?item=, a form field
+// (item or text), JSON ({"item": ...}, {"text": ...} or {"items": [...]}) or
+// a plain text body. GET works only for hooks created with it allowed.
+func HookAdd(c *fiber.Ctx) error {
+	if hookLimiter != nil {
+		result := hookLimiter.Hit(ClientIP(c))
+		SetRateLimitHeaders(c, result)
+		if !result.Allowed {
+			return c.Status(fiber.StatusTooManyRequests).SendString("Too many requests")
+		}
+	}
+
+	hook, err := svc.InboundHookByToken(c.Params("token"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+	if c.Method() == fiber.MethodGet && !hook.AllowGet {
+		return c.Status(fiber.StatusMethodNotAllowed).SendString("This hook only accepts POST")
+	}
+
+	text := hookText(c)
+	if text == "" {
+		return c.Status(400).SendString("No item given")
+	}
+
+	// The hook acts with full access, but only on its own list
+	result, err := svc.QuickAdd(0, hook.ListID, hook.SectionID, text)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	var names []string
+	for _, item := range result.Added {
+		names = append(names, item.Name)
+	}
+	for _, item := range result.Reopened {
+		names = append(names, item.Name)
+	}
+	message := fmt.Sprintf("Added %s to %s", strings.Join(names, ", "), hook.ListName)
+	if len(names) == 0 {
+		message = fmt.Sprintf("%s already on %s", strings.Join(result.Skipped, ", "), hook.ListName)
+	}
+
+	if c.Method() == fiber.MethodGet {
+		return c.SendString(message)
+	}
+	return c.JSON(fiber.Map{
+		"message":  message,
+		"list_id":  hook.ListID,
+		"added":    result.Added,
+		"reopened": result.Reopened,
+		"skipped":  result.Skipped,
+	})
+}
+
+// hookText reads the item text from any of the forms HookAdd accepts
+func hookText(c *fiber.Ctx) string {
+	for _, key := range []string{"item", "text"} {
+		if v := strings.TrimSpace(c.Query(key)); v != "" {
+			return v
+		}
+	}
+	if c.Method() == fiber.MethodGet {
+		return ""
+	}
+
+	body := strings.TrimSpace(string(c.Body()))
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	switch {
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		var req struct {
+			Item  string   `json:"item"`
+			Text  string   `json:"text"`
+			Items []string `json:"items"`
+		}
+		if json.Unmarshal([]byte(body), &req) != nil {
+			return ""
+		}
+		return strings.TrimSpace(strings.Join(append([]string{req.Item, req.Text}, req.Items...), "\n"))
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationForm), strings.HasPrefix(contentType, fiber.MIMEMultipartForm):
+		for _, key := range []string{"item", "text"} {
+			if v := strings.TrimSpace(c.FormValue(key)); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	return body
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"shopping-list/db"
+	"shopping-list/service"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,29 +17,13 @@ func CreateItem(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid section ID")
 	}
 
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Name is required")
-	}
-
-	description := c.FormValue("description")
-
-	item, err := db.CreateItem(sectionID, name, description)
+	item, err := svc.CreateItem(CurrentUserID(c), sectionID, c.FormValue("name"), c.FormValue("description"))
 	if err != nil {
-		return c.Status(500).SendString("Failed to create item")
+		return serviceError(c, err)
 	}
 
-	// Save to item history for auto-completion
-	db.SaveItemHistory(name, sectionID)
-
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_created", item)
-
 	// Return the new item partial for HTMX
-	return c.Render("partials/item", fiber.Map{
-		"Item":     item,
-		"Sections": getSectionsForDropdown(),
-	}, "")
+	return renderItem(c, item)
 }
 
 // UpdateItem updates an item's name and description
@@ -48,26 +33,14 @@ func UpdateItem(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Name is required")
-	}
-
-	description := c.FormValue("description")
-
-	item, err := db.UpdateItem(id, name, description)
+	name, description := c.FormValue("name"), c.FormValue("description")
+	item, err := svc.UpdateItem(CurrentUserID(c), id, service.ItemUpdate{Name: &name, Description: &description})
 	if err != nil {
-		return c.Status(500).SendString("Failed to update item")
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_updated", item)
-
 	// Return updated item partial
-	return c.Render("partials/item", fiber.Map{
-		"Item":     item,
-		"Sections": getSectionsForDropdown(),
-	}, "")
+	return renderItem(c, item)
 }
 
 // DeleteItem deletes an item
@@ -77,27 +50,25 @@ func DeleteItem(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.DeleteItem(id)
-	if err != nil {
-		return c.Status(500).SendString("Failed to delete item")
+	if err := svc.DeleteItem(CurrentUserID(c), id); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_deleted", map[string]int64{"id": id})
-
 	// Return empty string (HTMX will remove the element)
 	return c.SendString("")
 }
 
 // DeleteCompletedItems deletes all completed items
 func DeleteCompletedItems(c *fiber.Ctx) error {
-	count, err := db.DeleteCompletedItems()
-	if err != nil {
-		return c.Status(500).SendString("Failed to delete completed items")
+	activeList, status, msg := checkActiveListRole(c, db.RoleEditor)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("completed_items_deleted", map[string]int64{"count": count})
+	count, err := svc.DeleteCompletedItems(CurrentUserID(c), activeList.ID)
+	if err != nil {
+		return serviceError(c, err)
+	}
 
 	return c.JSON(fiber.Map{"deleted": count})
 }
@@ -109,25 +80,12 @@ func ToggleItem(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	item, err := db.ToggleItemCompleted(id)
+	item, err := svc.ToggleItemCompleted(CurrentUserID(c), id)
 	if err != nil {
-		return c.Status(500).SendString("Failed to toggle item")
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_toggled", item)
-
-	// Return the appropriate item partial based on completed status
-	if item.Completed {
-		return c.Render("partials/item_completed", fiber.Map{
-			"Item":     item,
-			"Sections": getSectionsForDropdown(),
-		}, "")
-	}
-	return c.Render("partials/item", fiber.Map{
-		"Item":     item,
-		"Sections": getSectionsForDropdown(),
-	}, "")
+	return renderItem(c, item)
 }
 
 // ToggleUncertain toggles the uncertain status of an item
@@ -137,24 +95,28 @@ func ToggleUncertain(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	item, err := db.ToggleItemUncertain(id)
+	item, err := svc.ToggleItemUncertain(CurrentUserID(c), id)
 	if err != nil {
-		return c.Status(500).SendString("Failed to toggle uncertain")
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_updated", item)
+	return renderItem(c, item)
+}
+
+// renderItem returns the item partial matching its completed status
+func renderItem(c *fiber.Ctx, item *db.Item) error {
+	section, err := store.GetSectionByID(item.SectionID)
+	if err != nil {
+		return c.Status(500).SendString("Failed to fetch section")
+	}
 
-	// Return the appropriate item partial based on completed status
+	template := "partials/item"
 	if item.Completed {
-		return c.Render("partials/item_completed", fiber.Map{
-			"Item":     item,
-			"Sections": getSectionsForDropdown(),
-		}, "")
+		template = "partials/item_completed"
 	}
-	return c.Render("partials/item", fiber.Map{
+	return c.Render(template, fiber.Map{
 		"Item":     item,
-		"Sections": getSectionsForDropdown(),
+		"Sections": getSectionsForDropdown(section.ListID),
 	}, "")
 }
 
@@ -170,14 +132,10 @@ func MoveItemToSection(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid section ID")
 	}
 
-	item, err := db.MoveItemToSection(id, newSectionID)
-	if err != nil {
-		return c.Status(500).SendString("Failed to move item")
+	if _, err := svc.MoveItemToSection(CurrentUserID(c), id, newSectionID); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_moved", item)
-
 	// Trigger full refresh for simplicity (item moved between sections)
 	c.Set("HX-Trigger", "refreshList")
 	return c.SendString("")
@@ -190,19 +148,13 @@ func MoveItemUp(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.MoveItemUp(id)
+	item, err := svc.MoveItemUp(CurrentUserID(c), id)
 	if err != nil {
-		return c.Status(500).SendString("Failed to move item")
+		return serviceError(c, err)
 	}
 
-	// Get the item's section and return all items in that section
-	item, _ := db.GetItemByID(id)
-	if item != nil {
-		BroadcastUpdate("items_reordered", map[string]int64{"section_id": item.SectionID})
-		return returnSectionItems(c, item.SectionID)
-	}
-
-	return c.SendString("")
+	// Return all items in the item's section
+	return returnSectionItems(c, item.SectionID)
 }
 
 // MoveItemDown moves an item down in its section
@@ -212,37 +164,36 @@ func MoveItemDown(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.MoveItemDown(id)
+	item, err := svc.MoveItemDown(CurrentUserID(c), id)
 	if err != nil {
-		return c.Status(500).SendString("Failed to move item")
-	}
-
-	// Get the item's section and return all items in that section
-	item, _ := db.GetItemByID(id)
-	if item != nil {
-		BroadcastUpdate("items_reordered", map[string]int64{"section_id": item.SectionID})
-		return returnSectionItems(c, item.SectionID)
+		return serviceError(c, err)
 	}
 
-	return c.SendString("")
+	// Return all items in the item's section
+	return returnSectionItems(c, item.SectionID)
 }
 
 // Helper to return all items in a section
 func returnSectionItems(c *fiber.Ctx, sectionID int64) error {
-	section, err := db.GetSectionByID(sectionID)
+	section, err := store.GetSectionByID(sectionID)
 	if err != nil {
 		return c.Status(500).SendString("Failed to fetch section")
 	}
 
 	return c.Render("partials/section", fiber.Map{
 		"Section":  section,
-		"Sections": getSectionsForDropdown(),
+		"Sections": getSectionsForDropdown(section.ListID),
 	}, "")
 }
 
 // GetStats returns current stats as JSON (for Alpine.js updates)
 func GetStats(c *fiber.Ctx) error {
-	stats := db.GetStats()
+	activeList, status, msg := checkActiveListRole(c, db.RoleViewer)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	stats := store.GetListStats(activeList.ID)
 	return c.JSON(stats)
 }
 
@@ -253,7 +204,11 @@ func GetItemVersion(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
 	}
 
-	item, err := db.GetItemByID(id)
+	if _, status, msg := checkItemRole(c, id, db.RoleViewer); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	item, err := store.GetItemByID(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"shopping-list/db"
+	"testing"
+)
+
+func TestDeleteCompletedItemsUsesTheUsersList(t *testing.T) {
+	env := newTestEnv(t)
+	other := must(env.store.CreateList("Hardware", "", 0))
+	onDefault := env.addItem(env.defaultList.ID, "Milk", true)
+	onOther := env.addItem(other.ID, "Tape", true)
+
+	// Alice has the other list open; Bob still sees the default one
+	if err := env.store.SetActiveList(env.alice.ID, other.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := env.request("POST", "/items/delete-completed", env.bob.ID, "")
+	if status != 200 || body != `{"deleted":1}` {
+		t.Fatalf("delete-completed as bob = %d %s", status, body)
+	}
+	if _, err := env.store.GetItemByID(onDefault.ID); err == nil {
+		t.Error("bob's completed item was kept")
+	}
+	if _, err := env.store.GetItemByID(onOther.ID); err != nil {
+		t.Error("the completed item of alice's list was deleted")
+	}
+
+	status, body = env.request("POST", "/items/delete-completed", env.alice.ID, "")
+	if status != 200 || body != `{"deleted":1}` {
+		t.Fatalf("delete-completed as alice = %d %s", status, body)
+	}
+}
+
+func TestDeleteCompletedItemsNeedsEditor(t *testing.T) {
+	env := newTestEnv(t)
+	list := must(env.store.CreateList("Alice's", "", env.alice.ID))
+	item := env.addItem(list.ID, "Milk", true)
+	if err := env.store.SetListPrivate(list.ID, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.SetListMember(list.ID, env.bob.ID, db.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.SetActiveList(env.bob.ID, list.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := env.request("POST", "/items/delete-completed", env.bob.ID, ""); status != 403 {
+		t.Errorf("delete-completed as a viewer = %d, want 403", status)
+	}
+	if _, err := env.store.GetItemByID(item.ID); err != nil {
+		t.Error("a viewer deleted completed items")
+	}
+}
+
+func TestStatsFollowTheUsersList(t *testing.T) {
+	env := newTestEnv(t)
+	private := must(env.store.CreateList("Alice's", "", env.alice.ID))
+	env.addItem(private.ID, "Milk", true)
+	env.addItem(private.ID, "Bread", false)
+	env.addItem(env.defaultList.ID, "Tape", false)
+	if err := env.store.SetListPrivate(private.ID, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.SetActiveList(env.alice.ID, private.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user int64
+		want db.Stats
+	}{
+		{env.alice.ID, db.Stats{TotalItems: 2, CompletedItems: 1, Percentage: 50}},
+		{env.bob.ID, db.Stats{TotalItems: 1}},
+	}
+	for _, tt := range tests {
+		status, body := env.request("GET", "/stats", tt.user, "")
+		var got db.Stats
+		if status != 200 || json.Unmarshal([]byte(body), &got) != nil || got != tt.want {
+			t.Errorf("stats for user %d = %d %s, want %+v", tt.user, status, body, tt.want)
+		}
+	}
+
+	// Bob never gets the sections of Alice's private list
+	status, body := env.request("GET", "/api/data", env.bob.ID, "")
+	var data struct {
+		Sections []db.Section `json:"sections"`
+	}
+	if status != 200 || json.Unmarshal([]byte(body), &data) != nil {
+		t.Fatalf("data for bob = %d %s", status, body)
+	}
+	for _, s := range data.Sections {
+		if s.ListID != env.defaultList.ID {
+			t.Errorf("bob got section %d of list %d", s.ID, s.ListID)
+		}
+	}
+}
+
+func TestItemAccess(t *testing.T) {
+	env := newTestEnv(t)
+	list := must(env.store.CreateList("Alice's", "", env.alice.ID))
+	item := env.addItem(list.ID, "Milk", false)
+	if err := env.store.SetListPrivate(list.ID, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/items/%d", item.ID)
+
+	// Items of lists a user can't see don't exist for them
+	if status, _ := env.request("GET", "/api/item/"+fmt.Sprint(item.ID)+"/version", env.bob.ID, ""); status != 404 {
+		t.Errorf("version as a stranger = %d, want 404", status)
+	}
+	if status, _ := env.request("POST", path+"/toggle", env.bob.ID, ""); status != 404 {
+		t.Errorf("toggle as a stranger = %d, want 404", status)
+	}
+
+	if err := env.store.SetListMember(list.ID, env.bob.ID, db.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := env.request("DELETE", path, env.bob.ID, ""); status != 403 {
+		t.Errorf("delete as a viewer = %d, want 403", status)
+	}
+	status, body := env.request("GET", "/api/item/"+fmt.Sprint(item.ID)+"/version", env.bob.ID, "")
+	if status != 200 || body != fmt.Sprintf(`{"completed":false,"id":%d,"updated_at":%d}`, item.ID, item.UpdatedAt) {
+		t.Errorf("version as a viewer = %d %s", status, body)
+	}
+
+	if status, _ := env.request("DELETE", path, env.alice.ID, ""); status != 200 {
+		t.Errorf("delete as the owner = %d, want 200", status)
+	}
+	if _, err := env.store.GetItemByID(item.ID); err == nil {
+		t.Error("the item was not deleted")
+	}
+}
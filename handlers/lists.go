@@ -2,35 +2,29 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"shopping-list/db"
 	"shopping-list/i18n"
+	"shopping-list/service"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// Input length limits
-const (
-	MaxListNameLength    = 100
-	MaxIconLength        = 20 // emoji can be multi-byte
-	MaxSectionNameLength = 100
-	MaxItemNameLength    = 200
-	MaxDescriptionLength = 500
-)
-
 // GetListsPage returns the homepage with all lists
 func GetListsPage(c *fiber.Ctx) error {
-	lists, err := db.GetAllLists()
+	lists, err := store.GetAllLists(CurrentUserID(c))
 	if err != nil {
 		return c.Status(500).SendString("Failed to fetch lists")
 	}
 
-	templates, _ := db.GetAllTemplates()
+	templates, _ := store.GetAllTemplates()
 
 	return c.Render("home", fiber.Map{
 		"Lists":        lists,
 		"Templates":    templates,
+		"CanShare":     !isAuthDisabled(),
 		"Translations": i18n.GetAllLocales(),
 		"Locales":      i18n.AvailableLocales(),
 		"DefaultLang":  i18n.GetDefaultLang(),
@@ -44,7 +38,7 @@ func GetListView(c *fiber.Ctx) error {
 		return c.Redirect("/")
 	}
 
-	list, err := db.GetListByID(id)
+	list, err := store.GetListByID(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// List not found - redirect to home
@@ -55,16 +49,27 @@ func GetListView(c *fiber.Ctx) error {
 		return c.Status(500).SendString("Database error")
 	}
 
-	// Set this list as active
-	db.SetActiveList(id)
+	// Lists the user can't see behave like missing ones
+	role, err := ListRole(c, id)
+	if err != nil {
+		log.Printf("Error checking access to list %d: %v", id, err)
+		return c.Status(500).SendString("Database error")
+	}
+	if role == db.RoleNone {
+		return c.Redirect("/")
+	}
+	list.Role = role
 
-	sections, err := db.GetSectionsByList(id)
+	// Open this list for the user
+	store.SetActiveList(CurrentUserID(c), id)
+
+	sections, err := store.GetSectionsByList(id)
 	if err != nil {
 		return c.Status(500).SendString("Failed to fetch sections")
 	}
 
-	stats := db.GetListStats(id)
-	lists, _ := db.GetAllLists()
+	stats := store.GetListStats(id)
+	lists, _ := store.GetAllLists(CurrentUserID(c))
 
 	return c.Render("list", fiber.Map{
 		"List":         list,
@@ -79,7 +84,7 @@ func GetListView(c *fiber.Ctx) error {
 
 // GetLists returns all lists (JSON API)
 func GetLists(c *fiber.Ctx) error {
-	lists, err := db.GetAllLists()
+	lists, err := store.GetAllLists(CurrentUserID(c))
 	if err != nil {
 		return c.Status(500).SendString("Failed to fetch lists")
 	}
@@ -95,30 +100,11 @@ func GetLists(c *fiber.Ctx) error {
 
 // CreateList creates a new shopping list
 func CreateList(c *fiber.Ctx) error {
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Name is required")
-	}
-	if len(name) > MaxListNameLength {
-		return c.Status(400).SendString("Name too long (max 100 characters)")
-	}
-
-	icon := c.FormValue("icon")
-	if icon == "" {
-		icon = "🛒"
-	}
-	if len(icon) > MaxIconLength {
-		return c.Status(400).SendString("Icon too long")
-	}
-
-	list, err := db.CreateList(name, icon)
+	list, err := svc.CreateList(CurrentUserID(c), c.FormValue("name"), c.FormValue("icon"))
 	if err != nil {
-		return c.Status(500).SendString("Failed to create list")
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("list_created", list)
-
 	// Return the new list item partial for HTMX
 	return c.Render("partials/list_item", fiber.Map{
 		"List": list,
@@ -132,27 +118,12 @@ func UpdateList(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Name is required")
-	}
-	if len(name) > MaxListNameLength {
-		return c.Status(400).SendString("Name too long (max 100 characters)")
-	}
-
-	icon := c.FormValue("icon")
-	if len(icon) > MaxIconLength {
-		return c.Status(400).SendString("Icon too long")
-	}
-
-	list, err := db.UpdateList(id, name, icon)
+	name, icon := c.FormValue("name"), c.FormValue("icon")
+	list, err := svc.UpdateList(CurrentUserID(c), id, service.ListUpdate{Name: &name, Icon: &icon})
 	if err != nil {
-		return c.Status(500).SendString("Failed to update list")
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("list_updated", list)
-
 	// Return updated list item partial
 	return c.Render("partials/list_item", fiber.Map{
 		"List": list,
@@ -166,14 +137,10 @@ func DeleteList(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.DeleteList(id)
-	if err != nil {
-		return c.Status(400).SendString(err.Error())
+	if err := svc.DeleteList(CurrentUserID(c), id); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("list_deleted", map[string]int64{"id": id})
-
 	// Return empty string (HTMX will remove the element)
 	return c.SendString("")
 }
@@ -185,14 +152,10 @@ func SetActiveList(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.SetActiveList(id)
-	if err != nil {
-		return c.Status(500).SendString("Failed to activate list")
+	if err := svc.SetActiveList(CurrentUserID(c), id); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("list_activated", map[string]int64{"id": id})
-
 	// Check if this is from the main page (needs redirect) or lists page
 	if c.Get("HX-Current-URL") != "" && !contains(c.Get("HX-Current-URL"), "/lists") {
 		c.Set("HX-Redirect", "/")
@@ -210,13 +173,11 @@ func MoveListUp(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.MoveListUp(id)
-	if err != nil {
-		return c.Status(500).SendString("Failed to move list")
+	if _, err := svc.MoveListUp(CurrentUserID(c), id); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast and return full lists
-	BroadcastUpdate("lists_reordered", nil)
+	// Return full lists
 	return returnAllLists(c)
 }
 
@@ -227,24 +188,66 @@ func MoveListDown(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.MoveListDown(id)
-	if err != nil {
-		return c.Status(500).SendString("Failed to move list")
+	if _, err := svc.MoveListDown(CurrentUserID(c), id); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast and return full lists
-	BroadcastUpdate("lists_reordered", nil)
+	// Return full lists
 	return returnAllLists(c)
 }
 
+// ExportListText returns a list as Markdown, todo.txt or plain text
+func ExportListText(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).SendString("Invalid ID")
+	}
+
+	format := c.Query("format", service.TextMarkdown)
+	text, err := svc.ExportListText(CurrentUserID(c), id, format)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	ext := map[string]string{service.TextMarkdown: "md", service.TextTodoTxt: "txt", service.TextPlain: "txt"}[format]
+	if format == service.TextMarkdown {
+		c.Set("Content-Type", "text/markdown; charset=utf-8")
+	} else {
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	if c.QueryBool("download") {
+		c.Attachment(fmt.Sprintf("list-%d.%s", id, ext))
+	}
+	return c.SendString(text)
+}
+
+// ImportListText adds the sections and items of pasted text to a list
+func ImportListText(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).SendString("Invalid ID")
+	}
+
+	result, skipped, err := svc.ImportListText(CurrentUserID(c), id, c.FormValue("text"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"sections": len(result.Sections),
+		"items":    len(result.Items),
+		"skipped":  skipped,
+	})
+}
+
 // Helper to return all lists as HTML partials
 func returnAllLists(c *fiber.Ctx) error {
-	lists, err := db.GetAllLists()
+	lists, err := store.GetAllLists(CurrentUserID(c))
 	if err != nil {
 		return c.Status(500).SendString("Failed to fetch lists")
 	}
 
-	activeList, _ := db.GetActiveList()
+	activeList, _ := store.GetActiveList(CurrentUserID(c))
 
 	return c.Render("partials/lists_container", fiber.Map{
 		"Lists":      lists,
@@ -0,0 +1,726 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // registers SHA-384/512 for RS384, ES512 etc.
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"shopping-list/db"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	oidcStateCookieName = "oidc_state"
+	oidcPendingTimeout  = 10 * time.Minute
+	// oidcMaxPending bounds the logins waiting for the provider at once
+	oidcMaxPending    = 1000
+	oidcCacheDuration = time.Hour
+	oidcClockSkew     = time.Minute
+)
+
+// OIDCConfig holds single sign-on settings from environment variables
+type OIDCConfig struct {
+	Issuer          string
+	ClientID        string
+	ClientSecret    string
+	RedirectURL     string
+	Scopes          []string
+	UsernameClaim   string
+	ProviderName    string
+	DisablePassword bool
+}
+
+// oidcDiscovery is the subset of the provider's discovery document we use
+type oidcDiscovery struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// oidcPending tracks a login that was sent to the provider and hasn't returned yet
+type oidcPending struct {
+	Verifier    string
+	Nonce       string
+	RedirectURL string
+	ExpiresAt   time.Time
+}
+
+// OIDCClient performs the authorization code flow with PKCE against one provider
+type OIDCClient struct {
+	config     OIDCConfig
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	discoveredAt  time.Time
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+	pending       map[string]*oidcPending
+}
+
+// Singleton instance, nil when OIDC is not configured
+var oidcClient *OIDCClient
+
+// oidcLoginLimiter limits how often one IP address may start a login
+var oidcLoginLimiter *RateLimiter
+
+// InitOIDC enables single sign-on if OIDC_ISSUER and OIDC_CLIENT_ID are set
+func InitOIDC() {
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if issuer == "" || clientID == "" {
+		return
+	}
+
+	config := OIDCConfig{
+		Issuer:          issuer,
+		ClientID:        clientID,
+		ClientSecret:    os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:     os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:          strings.Fields(os.Getenv("OIDC_SCOPES")),
+		UsernameClaim:   os.Getenv("OIDC_USERNAME_CLAIM"),
+		ProviderName:    os.Getenv("OIDC_PROVIDER_NAME"),
+		DisablePassword: os.Getenv("OIDC_DISABLE_PASSWORD") == "true",
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "preferred_username"
+	}
+	if config.ProviderName == "" {
+		config.ProviderName = "SSO"
+	}
+
+	oidcClient = NewOIDCClient(config)
+	if limit := getEnvInt("OIDC_LOGIN_RATE_LIMIT", 10); limit > 0 {
+		oidcLoginLimiter = NewRateLimiter("oidc-login", RateLimitConfig{Limit: limit, Window: time.Minute})
+	}
+	log.Printf("[OIDC] Enabled: issuer=%s client=%s password_login=%v",
+		config.Issuer, config.ClientID, !config.DisablePassword)
+}
+
+// NewOIDCClient creates a client for the configured provider
+func NewOIDCClient(config OIDCConfig) *OIDCClient {
+	return &OIDCClient{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		pending:    make(map[string]*oidcPending),
+	}
+}
+
+func isOIDCEnabled() bool {
+	return oidcClient != nil
+}
+
+// isPasswordLoginDisabled returns true if only single sign-on may be used
+func isPasswordLoginDisabled() bool {
+	return oidcClient != nil && oidcClient.config.DisablePassword
+}
+
+// oidcProviderName is the label for the single sign-on button
+func oidcProviderName() string {
+	if oidcClient == nil {
+		return ""
+	}
+	return oidcClient.config.ProviderName
+}
+
+// OIDCLogin redirects the browser to the identity provider
+func OIDCLogin(c *fiber.Ctx) error {
+	if oidcClient == nil {
+		return c.Redirect("/login")
+	}
+
+	redirectURL := oidcClient.config.RedirectURL
+	if redirectURL == "" {
+		scheme := "http"
+		if isSecureConnection(c) {
+			scheme = "https"
+		}
+		redirectURL = scheme + "://" + c.Hostname() + "/auth/oidc/callback"
+	}
+
+	authURL, state, err := oidcClient.AuthCodeURL(redirectURL)
+	if err != nil {
+		log.Printf("[OIDC] Failed to start login: %v", err)
+		return c.Redirect("/login?error=oidc")
+	}
+
+	// Bind the login to this browser so a foreign callback can't be replayed
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Expires:  time.Now().Add(oidcPendingTimeout),
+		HTTPOnly: true,
+		Secure:   isSecureConnection(c),
+		SameSite: "Lax",
+		Path:     "/auth/oidc",
+	})
+
+	return c.Redirect(authURL)
+}
+
+// OIDCLoginRateLimitMiddleware limits the logins started per IP address, as
+// each one is remembered until the provider sends the browser back
+func OIDCLoginRateLimitMiddleware(c *fiber.Ctx) error {
+	if oidcLoginLimiter == nil {
+		return c.Next()
+	}
+	result := oidcLoginLimiter.Hit(ClientIP(c))
+	if !result.Allowed {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(result.RetryAfter)))
+		return c.Redirect("/login?error=rate_limited")
+	}
+	return c.Next()
+}
+
+// OIDCCallback completes the login after the identity provider redirects back
+func OIDCCallback(c *fiber.Ctx) error {
+	if oidcClient == nil {
+		return c.Redirect("/login")
+	}
+
+	state := c.Query("state")
+	cookieState := c.Cookies(oidcStateCookieName)
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+		Secure:   isSecureConnection(c),
+		SameSite: "Lax",
+		Path:     "/auth/oidc",
+	})
+
+	if errCode := c.Query("error"); errCode != "" {
+		log.Printf("[OIDC] Provider returned error: %s %s", errCode, c.Query("error_description"))
+		return c.Redirect("/login?error=oidc")
+	}
+	if state == "" || state != cookieState {
+		log.Printf("[OIDC] State mismatch from %s", ClientIP(c))
+		return c.Redirect("/login?error=oidc")
+	}
+
+	claims, err := oidcClient.Exchange(state, c.Query("code"))
+	if err != nil {
+		log.Printf("[OIDC] Login failed: %v", err)
+		return c.Redirect("/login?error=oidc")
+	}
+
+	user, err := oidcClient.ResolveUser(claims)
+	if err != nil {
+		log.Printf("[OIDC] Failed to map claims to a user: %v", err)
+		return c.Redirect("/login?error=oidc")
+	}
+
+	if err := startSession(c, user); err != nil {
+		return c.Status(500).SendString("Session creation failed")
+	}
+
+	return c.Redirect("/")
+}
+
+// AuthCodeURL prepares a pending login and returns the provider URL and its state
+func (o *OIDCClient) AuthCodeURL(redirectURL string) (string, string, error) {
+	discovery, err := o.getDiscovery()
+	if err != nil {
+		return "", "", err
+	}
+
+	state := randomURLString(24)
+	pending := &oidcPending{
+		Verifier:    randomURLString(32),
+		Nonce:       randomURLString(24),
+		RedirectURL: redirectURL,
+		ExpiresAt:   time.Now().Add(oidcPendingTimeout),
+	}
+
+	o.mu.Lock()
+	now := time.Now()
+	if len(o.pending) >= oidcMaxPending {
+		for key, p := range o.pending {
+			if now.After(p.ExpiresAt) {
+				delete(o.pending, key)
+			}
+		}
+	}
+	if len(o.pending) >= oidcMaxPending {
+		o.mu.Unlock()
+		return "", "", errors.New("too many pending logins")
+	}
+	o.pending[state] = pending
+	o.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(pending.Verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.config.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(o.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {pending.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + params.Encode(), state, nil
+}
+
+// Exchange redeems the authorization code and returns the verified ID token claims
+func (o *OIDCClient) Exchange(state, code string) (map[string]interface{}, error) {
+	o.mu.Lock()
+	pending := o.pending[state]
+	delete(o.pending, state)
+	o.mu.Unlock()
+
+	if pending == nil || time.Now().After(pending.ExpiresAt) {
+		return nil, errors.New("unknown or expired login state")
+	}
+	if code == "" {
+		return nil, errors.New("missing authorization code")
+	}
+
+	discovery, err := o.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {pending.RedirectURL},
+		"client_id":     {o.config.ClientID},
+		"code_verifier": {pending.Verifier},
+	}
+	useBasicAuth := o.config.ClientSecret != "" && o.supportsAuthMethod(discovery, "client_secret_basic")
+	if o.config.ClientSecret != "" && !useBasicAuth {
+		form.Set("client_secret", o.config.ClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasicAuth {
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret))
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return o.VerifyIDToken(token.IDToken, pending.Nonce)
+}
+
+// supportsAuthMethod checks the token endpoint auth methods; client_secret_basic is the default
+func (o *OIDCClient) supportsAuthMethod(discovery *oidcDiscovery, method string) bool {
+	if len(discovery.TokenEndpointAuthMethods) == 0 {
+		return method == "client_secret_basic"
+	}
+	for _, m := range discovery.TokenEndpointAuthMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyIDToken checks the signature and standard claims of an ID token
+func (o *OIDCClient) VerifyIDToken(rawToken, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id_token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid id_token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token signature: %w", err)
+	}
+
+	key, err := o.getKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid id_token claims: %w", err)
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != o.config.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if !audienceContains(claims["aud"], o.config.ClientID) {
+		return nil, errors.New("id_token was not issued for this client")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().Add(-oidcClockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("id_token has expired")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+
+	return claims, nil
+}
+
+// ResolveUser returns the local user for the ID token claims.
+// A known subject keeps its user even if the username claim changes. A new
+// subject gets a new user named by the username claim; it is only linked to
+// an existing user of that name if the name is the provider's verified email
+// address. Other existing users need an admin to link them (link-oidc).
+func (o *OIDCClient) ResolveUser(claims map[string]interface{}) (*db.User, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+
+	user, err := store.GetUserByIdentity(o.config.Issuer, subject)
+	if err == nil {
+		return user, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	username := ""
+	for _, claim := range []string{o.config.UsernameClaim, "preferred_username", "email", "sub"} {
+		if value, ok := claims[claim].(string); ok && strings.TrimSpace(value) != "" {
+			username = strings.TrimSpace(value)
+			break
+		}
+	}
+	if username == "" {
+		return nil, errors.New("id_token has no username")
+	}
+
+	user, err = store.GetUserByUsername(username)
+	switch {
+	case err == sql.ErrNoRows:
+		if user, err = store.GetOrCreateUser(username); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case !isVerifiedEmail(claims, username):
+		return nil, fmt.Errorf("user %s already exists; link subject %s to it with link-oidc", username, subject)
+	}
+
+	if err := store.LinkUserIdentity(o.config.Issuer, subject, user.ID); err != nil {
+		return nil, err
+	}
+	log.Printf("[OIDC] Linked subject %s to user %s", subject, user.Username)
+	return user, nil
+}
+
+// isVerifiedEmail reports whether the provider vouches that address is the
+// user's email. Some providers send email_verified as a string.
+func isVerifiedEmail(claims map[string]interface{}, address string) bool {
+	email, _ := claims["email"].(string)
+	if email == "" || !strings.EqualFold(strings.TrimSpace(email), address) {
+		return false
+	}
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		return verified
+	case string:
+		return verified == "true"
+	}
+	return false
+}
+
+// getDiscovery returns the provider metadata, fetching it at most once per hour
+func (o *OIDCClient) getDiscovery() (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.discovery != nil && time.Since(o.discoveredAt) < oidcCacheDuration {
+		return o.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := o.getJSON(o.config.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != o.config.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, o.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+
+	o.discovery = &discovery
+	o.discoveredAt = time.Now()
+	return o.discovery, nil
+}
+
+// getKey returns the signing key by ID, refetching the key set when the key is unknown
+func (o *OIDCClient) getKey(kid string) (crypto.PublicKey, error) {
+	discovery, err := o.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key := o.lookupKey(kid); key != nil && time.Since(o.keysFetchedAt) < oidcCacheDuration {
+		return key, nil
+	}
+
+	// Don't let unknown key IDs hammer the provider
+	if o.keys != nil && time.Since(o.keysFetchedAt) < 10*time.Second {
+		if key := o.lookupKey(kid); key != nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := o.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching signing keys failed: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("[OIDC] Skipping signing key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	o.keys = keys
+	o.keysFetchedAt = time.Now()
+
+	if key := o.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a cached key; without a key ID the only key is used
+func (o *OIDCClient) lookupKey(kid string) crypto.PublicKey {
+	if key, ok := o.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(o.keys) == 1 {
+		for _, key := range o.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func (o *OIDCClient) getJSON(url string, v interface{}) error {
+	resp, err := o.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// jsonWebKey is a public key from the provider's JWKS
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifyJWTSignature checks an RS*, PS* or ES* signature over the signing input
+func verifyJWTSignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match %s", alg)
+		}
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(rsaKey, hash, digest, signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match %s", alg)
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid ECDSA signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid ECDSA signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported signing algorithm %q", alg)
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains handles aud as either a string or an array of strings
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func randomURLString(n int) string {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		log.Fatal("Failed to generate secure random bytes:", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
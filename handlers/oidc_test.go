@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mockIssuer is an OpenID provider with discovery, a key set and a token
+// endpoint that checks PKCE
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu sync.Mutex
+	// codes maps issued authorization codes to their login
+	codes map[string]mockLogin
+}
+
+// mockLogin is an authorization the provider granted
+type mockLogin struct {
+	challenge   string
+	redirectURL string
+	claims      map[string]interface{}
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	m := &mockIssuer{t: t, key: newRSAKey(t), codes: make(map[string]mockLogin)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: "test",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// authorize grants the login in an authorization URL and returns its code
+func (m *mockIssuer) authorize(authURL string, claims map[string]interface{}) string {
+	m.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("response_type") != "code" || q.Get("client_id") != "koffan" || q.Get("code_challenge_method") != "S256" || q.Get("state") == "" {
+		m.t.Fatalf("authorization URL = %s", authURL)
+	}
+	if claims["nonce"] == nil {
+		claims["nonce"] = q.Get("nonce")
+	}
+
+	code := randomURLString(16)
+	m.mu.Lock()
+	m.codes[code] = mockLogin{challenge: q.Get("code_challenge"), redirectURL: q.Get("redirect_uri"), claims: claims}
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != "koffan" || secret != "s3cret" {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	m.mu.Lock()
+	login, found := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	m.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !found || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != login.redirectURL ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != login.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signToken(m.t, m.key, login.claims)})
+}
+
+// claims returns valid ID token claims for a subject
+func (m *mockIssuer) claims(subject string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": m.server.URL,
+		"aud": "koffan",
+		"sub": subject,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+func (m *mockIssuer) client() *OIDCClient {
+	return NewOIDCClient(OIDCConfig{
+		Issuer:        m.server.URL,
+		ClientID:      "koffan",
+		ClientSecret:  "s3cret",
+		Scopes:        []string{"openid", "email"},
+		UsernameClaim: "preferred_username",
+	})
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// signToken returns an RS256 ID token with the claims
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"test","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString(must(json.Marshal(claims)))
+	digest := sha256.Sum256([]byte(header + "." + payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCCodeExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	client := issuer.client()
+
+	authURL, state, err := client.AuthCodeURL("https://koffan.test/auth/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, issuer.server.URL+"/authorize?") {
+		t.Fatalf("authorization URL = %s", authURL)
+	}
+	code := issuer.authorize(authURL, issuer.claims("user-1"))
+
+	claims, err := client.Exchange(state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "user-1" {
+		t.Errorf("claims = %v", claims)
+	}
+
+	// The state is used up by the first exchange
+	if _, err := client.Exchange(state, code); err == nil {
+		t.Error("state was accepted twice")
+	}
+
+	// Without the verifier of the login the provider refuses the code
+	authURL, _, _ = client.AuthCodeURL("https://koffan.test/auth/oidc/callback")
+	code = issuer.authorize(authURL, issuer.claims("user-1"))
+	_, otherState, _ := client.AuthCodeURL("https://koffan.test/auth/oidc/callback")
+	if _, err := client.Exchange(otherState, code); err == nil {
+		t.Error("code was exchanged with the verifier of another login")
+	}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	issuer := newMockIssuer(t)
+	client := issuer.client()
+	otherKey := newRSAKey(t)
+
+	tests := []struct {
+		name  string
+		key   *rsa.PrivateKey
+		claim string
+		value interface{}
+		ok    bool
+	}{
+		{"valid token", issuer.key, "", nil, true},
+		{"expired within the clock skew", issuer.key, "exp", time.Now().Add(-30 * time.Second).Unix(), true},
+		{"bad signature", otherKey, "", nil, false},
+		{"wrong iss", issuer.key, "iss", "https://evil.example", false},
+		{"wrong aud", issuer.key, "aud", []string{"someone-else"}, false},
+		{"wrong nonce", issuer.key, "nonce", "replayed", false},
+		{"expired token", issuer.key, "exp", time.Now().Add(-time.Hour).Unix(), false},
+		{"no subject", issuer.key, "sub", "", false},
+	}
+	for _, tt := range tests {
+		claims := issuer.claims("user-1")
+		claims["nonce"] = "n0nce"
+		if tt.claim != "" {
+			claims[tt.claim] = tt.value
+		}
+		_, err := client.VerifyIDToken(signToken(t, tt.key, claims), "n0nce")
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestOIDCResolveUser(t *testing.T) {
+	env := newTestEnv(t)
+	issuer := newMockIssuer(t)
+	client := issuer.client()
+
+	claims := issuer.claims("sub-carol")
+	claims["preferred_username"] = "carol"
+	carol, err := client.ResolveUser(claims)
+	if err != nil || carol.Username != "carol" {
+		t.Fatalf("new user = %+v, %v", carol, err)
+	}
+	// A renamed account keeps its user
+	claims["preferred_username"] = "caroline"
+	if user, err := client.ResolveUser(claims); err != nil || user.ID != carol.ID {
+		t.Errorf("renamed user = %+v, %v", user, err)
+	}
+
+	// An existing user is only taken over by its verified email address
+	claims = issuer.claims("sub-alice")
+	claims["preferred_username"] = "alice"
+	if _, err := client.ResolveUser(claims); err == nil {
+		t.Error("existing user was linked by username")
+	}
+
+	alice := must(env.store.GetOrCreateUser("alice@example.com"))
+	claims = issuer.claims("sub-alice")
+	claims["email"] = "alice@example.com"
+	claims["email_verified"] = false
+	if _, err := client.ResolveUser(claims); err == nil {
+		t.Error("existing user was linked by an unverified email")
+	}
+	claims["email_verified"] = true
+	if user, err := client.ResolveUser(claims); err != nil || user.ID != alice.ID {
+		t.Errorf("user with verified email = %+v, %v", user, err)
+	}
+	if user, err := env.store.GetUserByIdentity(issuer.server.URL, "sub-alice"); err != nil || user.ID != alice.ID {
+		t.Errorf("linked identity = %+v, %v", user, err)
+	}
+}
+
+func TestOIDCPendingLimit(t *testing.T) {
+	issuer := newMockIssuer(t)
+	client := issuer.client()
+
+	for i := 0; i < oidcMaxPending; i++ {
+		if _, _, err := client.AuthCodeURL("https://koffan.test/auth/oidc/callback"); err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+	if _, _, err := client.AuthCodeURL("https://koffan.test/auth/oidc/callback"); err == nil {
+		t.Fatal("pending logins are not limited")
+	}
+
+	// Expired logins make room again
+	client.mu.Lock()
+	for _, p := range client.pending {
+		p.ExpiresAt = time.Now().Add(-time.Second)
+	}
+	client.mu.Unlock()
+	if _, _, err := client.AuthCodeURL("https://koffan.test/auth/oidc/callback"); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.pending) != 1 {
+		t.Errorf("%d pending logins after expiry", len(client.pending))
+	}
+}
+
+func TestOIDCLoginRateLimit(t *testing.T) {
+	oidcLoginLimiter = NewRateLimiter("oidc-login-test", RateLimitConfig{Limit: 2, Window: time.Minute})
+	t.Cleanup(func() { oidcLoginLimiter = nil })
+
+	app := fiber.New()
+	app.Get("/auth/oidc/login", OIDCLoginRateLimitMiddleware, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	for i, want := range []int{fiber.StatusNoContent, fiber.StatusNoContent, fiber.StatusFound} {
+		resp := must(app.Test(httptest.NewRequest("GET", "/auth/oidc/login", nil)))
+		if resp.StatusCode != want {
+			t.Errorf("login %d = %d, want %d", i+1, resp.StatusCode, want)
+		}
+		if want == fiber.StatusFound && resp.Header.Get("Location") != "/login?error=rate_limited" {
+			t.Errorf("redirected to %q", resp.Header.Get("Location"))
+		}
+	}
+}
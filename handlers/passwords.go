@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"shopping-list/db"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MinPasswordLength = 8
+	// bcrypt ignores everything after 72 bytes
+	MaxPasswordLength = 72
+)
+
+// dummyPasswordHash is compared against for unknown users, so the response
+// time doesn't reveal which usernames exist
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("koffan-dummy-password"), bcrypt.DefaultCost)
+
+// ChangePasswordRequest is the body for changing the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" form:"current_password"`
+	NewPassword     string `json:"new_password" form:"new_password"`
+}
+
+// HashPassword returns the bcrypt hash stored for a password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// validatePassword returns a message describing why a new password is rejected, or ""
+func validatePassword(password string) string {
+	if len(password) < MinPasswordLength {
+		return "Password must be at least 8 characters"
+	}
+	if len(password) > MaxPasswordLength {
+		return "Password must be at most 72 bytes"
+	}
+	return ""
+}
+
+// InitPasswords stores a hash for every configured account that doesn't have one yet.
+// APP_PASSWORD / APP_USERS only seed the database; afterwards the stored hash wins.
+func InitPasswords() {
+	accounts := getAppUsers()
+	if len(accounts) == 0 {
+		accounts = map[string]string{DefaultUsername: getAppPassword()}
+	}
+
+	for username, password := range accounts {
+		user, err := store.GetOrCreateUser(username)
+		if err != nil {
+			log.Printf("[AUTH] Failed to create user %s: %v", username, err)
+			continue
+		}
+
+		hash, err := store.GetUserPasswordHash(user.ID)
+		if err != nil {
+			log.Printf("[AUTH] Failed to load password of %s: %v", user.Username, err)
+			continue
+		}
+
+		if hash != "" {
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+				log.Printf("[AUTH] Password of %s was changed in the app; the value from the environment is ignored", user.Username)
+			}
+			continue
+		}
+
+		hash, err = HashPassword(password)
+		if err == nil {
+			err = store.SetUserPasswordHash(user.ID, hash)
+		}
+		if err != nil {
+			log.Printf("[AUTH] Failed to store password of %s: %v", user.Username, err)
+			continue
+		}
+		log.Printf("[AUTH] Stored hashed password for %s", user.Username)
+	}
+}
+
+// checkCredentials returns the user to log in as if the credentials are valid.
+// Only accounts configured in APP_USERS (or DefaultUsername without it) may log in with a password.
+func checkCredentials(username, password string) (*db.User, bool) {
+	users := getAppUsers()
+	if len(users) == 0 {
+		username = DefaultUsername
+	} else if _, ok := users[strings.ToLower(strings.TrimSpace(username))]; !ok {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, false
+	}
+
+	user, err := store.GetUserByUsername(strings.TrimSpace(username))
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, false
+	}
+
+	hash, err := store.GetUserPasswordHash(user.ID)
+	if err != nil || hash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, false
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, false
+	}
+	return user, true
+}
+
+// ChangePassword sets a new password for the current user and logs out all
+// other devices (JSON)
+func ChangePassword(c *fiber.Ctx) error {
+	userID := CurrentUserID(c)
+	if userID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Changing the password requires a user account"})
+	}
+
+	if loginLimiter != nil {
+		if blocked, _ := loginLimiter.IsBlocked(ClientIP(c)); blocked {
+			return c.Status(429).JSON(fiber.Map{"error": "Too many attempts. Please try again later."})
+		}
+	}
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	hash, err := store.GetUserPasswordHash(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if hash == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "This account logs in without a password"})
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.CurrentPassword)) != nil {
+		// Counts as a failed login so the form can't be used to guess passwords
+		if loginLimiter != nil {
+			loginLimiter.RecordAttempt(ClientIP(c))
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Current password is incorrect"})
+	}
+	if msg := validatePassword(req.NewPassword); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	newHash, err := HashPassword(req.NewPassword)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to change password"})
+	}
+	if err := store.SetUserPasswordHash(userID, newHash); err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to change password"})
+	}
+
+	// Anyone who knew the old password may still be logged in elsewhere
+	keepID := ""
+	if current := CurrentSession(c); current != nil {
+		keepID = current.ID
+	}
+	revoked, err := RevokeUserSessions(userID, keepID)
+	if err != nil {
+		log.Printf("[AUTH] Failed to revoke sessions after password change: %v", err)
+	}
+	log.Printf("[AUTH] Password changed for user %d", userID)
+
+	return c.JSON(fiber.Map{"revoked_sessions": revoked})
+}
+
+// ResetPassword replaces a user's password and logs out all of their devices.
+// Used by the reset-password command when the password is forgotten.
+func ResetPassword(username, password string) error {
+	if msg := validatePassword(password); msg != "" {
+		return errors.New(msg)
+	}
+
+	user, err := store.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := store.SetUserPasswordHash(user.ID, hash); err != nil {
+		return err
+	}
+
+	_, err = RevokeUserSessions(user.ID, "")
+	return err
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/url"
+	"testing"
+)
+
+func TestChangePassword(t *testing.T) {
+	env := newTestEnv(t)
+	t.Setenv("APP_USERS", "alice:old password,bob:bobs password")
+	InitPasswords()
+	phone, laptop := env.login(env.alice), env.login(env.alice)
+	bobs := env.login(env.bob)
+
+	change := func(current, next string) (int, string) {
+		return env.serve(webRequest("POST", "/settings/password", phone, url.Values{"current_password": {current}, "new_password": {next}}))
+	}
+	if status, _ := change("wrong password", "new password"); status != 400 {
+		t.Errorf("change with a wrong password = %d", status)
+	}
+	if status, _ := change("old password", "short"); status != 400 {
+		t.Errorf("change to a short password = %d", status)
+	}
+	if _, ok := checkCredentials("alice", "old password"); !ok {
+		t.Fatal("rejected changes replaced the password")
+	}
+
+	if status, body := change("old password", "new password"); status != 200 || body != `{"revoked_sessions":1}` {
+		t.Fatalf("change = %d %s", status, body)
+	}
+	if _, ok := checkCredentials("alice", "old password"); ok {
+		t.Error("old password still works")
+	}
+	if user, ok := checkCredentials("Alice", "new password"); !ok || user.ID != env.alice.ID {
+		t.Error("new password doesn't work")
+	}
+
+	// Other devices are logged out, this one and other users stay
+	if _, err := env.store.GetSession(laptop.ID); err != sql.ErrNoRows {
+		t.Errorf("other session after the change: %v", err)
+	}
+	if _, err := env.store.GetSession(phone.ID); err != nil {
+		t.Errorf("current session after the change: %v", err)
+	}
+	if _, err := env.store.GetSession(bobs.ID); err != nil {
+		t.Errorf("bob's session after the change: %v", err)
+	}
+
+	// The environment only seeds the password
+	InitPasswords()
+	if _, ok := checkCredentials("alice", "new password"); !ok {
+		t.Error("restart reset the changed password")
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	env := newTestEnv(t)
+	t.Setenv("APP_USERS", "alice:old password")
+	InitPasswords()
+	session := env.login(env.alice)
+
+	if err := ResetPassword("alice", "short"); err == nil {
+		t.Error("reset to a short password")
+	}
+	if err := ResetPassword("alice", "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := checkCredentials("alice", "new password"); !ok {
+		t.Error("new password doesn't work")
+	}
+	if _, err := env.store.GetSession(session.ID); err != sql.ErrNoRows {
+		t.Errorf("session after the reset: %v", err)
+	}
+}
+
+func TestCheckCredentials(t *testing.T) {
+	env := newTestEnv(t)
+	t.Setenv("APP_USERS", "alice:secret password")
+	InitPasswords()
+	// bob has a password but is not configured in APP_USERS
+	if err := env.store.SetUserPasswordHash(env.bob.ID, must(HashPassword("secret password"))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"alice", "secret password", true},
+		{" ALICE ", "secret password", true},
+		{"alice", "Secret password", false},
+		{"bob", "secret password", false},
+		{"nobody", "secret password", false},
+	}
+	for _, tt := range tests {
+		if _, ok := checkCredentials(tt.username, tt.password); ok != tt.ok {
+			t.Errorf("checkCredentials(%q, %q) = %v", tt.username, tt.password, ok)
+		}
+	}
+}
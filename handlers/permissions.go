@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"shopping-list/db"
+	"shopping-list/service"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListRole returns the current user's role on a list.
+// Missing lists and lists hidden from the user both yield db.RoleNone.
+func ListRole(c *fiber.Ctx, listID int64) (string, error) {
+	return svc.ListRole(CurrentUserID(c), listID)
+}
+
+// serviceError responds with the status and message of a failed service call
+func serviceError(c *fiber.Ctx, err error) error {
+	e := service.AsError(err)
+	return c.Status(e.Status()).SendString(e.Message)
+}
+
+// checkListRole returns the status and message to reject the request with,
+// or 0 if the current user has at least the min role on the list.
+// Lists the user can't see are reported as not found.
+func checkListRole(c *fiber.Ctx, listID int64, min string) (int, string) {
+	return roleError(svc.RequireListRole(CurrentUserID(c), listID, min))
+}
+
+// checkItemRole is checkListRole for the list an item belongs to
+func checkItemRole(c *fiber.Ctx, itemID int64, min string) (int64, int, string) {
+	listID, err := svc.RequireItemRole(CurrentUserID(c), itemID, min)
+	status, msg := roleError(err)
+	return listID, status, msg
+}
+
+// checkActiveListRole is checkListRole for the list the current user has open
+func checkActiveListRole(c *fiber.Ctx, min string) (*db.List, int, string) {
+	activeList, err := store.GetActiveList(CurrentUserID(c))
+	if err != nil {
+		return nil, 500, "No active list found"
+	}
+	status, msg := checkListRole(c, activeList.ID, min)
+	return activeList, status, msg
+}
+
+func roleError(err error) (int, string) {
+	if err == nil {
+		return 0, ""
+	}
+	e := service.AsError(err)
+	return e.Status(), e.Message
+}
+
+// ListPermissionsRequest is the body for updating who can access a list
+type ListPermissionsRequest struct {
+	Private *bool `json:"private" form:"private"`
+	Members []struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	} `json:"members"`
+}
+
+// MemberRoles maps the usernames of the request to their roles
+func (r *ListPermissionsRequest) MemberRoles() map[string]string {
+	members := make(map[string]string, len(r.Members))
+	for _, m := range r.Members {
+		members[m.Username] = m.Role
+	}
+	return members
+}
+
+// GetListPermissions returns the sharing settings of a list (JSON)
+func GetListPermissions(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	if status, msg := checkListRole(c, id, db.RoleOwner); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	permissions, err := LoadListPermissions(id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch permissions"})
+	}
+	return c.JSON(permissions)
+}
+
+// UpdateListPermissions replaces the sharing settings of a list (JSON)
+func UpdateListPermissions(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req ListPermissionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if _, err := svc.UpdateListPermissions(CurrentUserID(c), id, req.Private, req.MemberRoles()); err != nil {
+		e := service.AsError(err)
+		return c.Status(e.Status()).JSON(fiber.Map{"error": e.Message})
+	}
+
+	permissions, err := LoadListPermissions(id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch permissions"})
+	}
+	return c.JSON(permissions)
+}
+
+// ListPermissions describes who can access a list
+type ListPermissions struct {
+	ListID    int64           `json:"list_id"`
+	IsPrivate bool            `json:"is_private"`
+	Owner     string          `json:"owner,omitempty"`
+	Members   []db.ListMember `json:"members"`
+	Users     []db.User       `json:"users"`
+}
+
+// LoadListPermissions collects the sharing settings of a list and all known users
+func LoadListPermissions(listID int64) (*ListPermissions, error) {
+	acl, err := store.GetListACL(listID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := store.GetListMembers(listID)
+	if err != nil {
+		return nil, err
+	}
+	users, err := store.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := &ListPermissions{
+		ListID:    listID,
+		IsPrivate: acl.IsPrivate,
+		Members:   members,
+		Users:     users,
+	}
+	if permissions.Members == nil {
+		permissions.Members = []db.ListMember{}
+	}
+	if permissions.Users == nil {
+		permissions.Users = []db.User{}
+	}
+	if acl.OwnerID != 0 {
+		if owner, err := store.GetUserByID(acl.OwnerID); err == nil {
+			permissions.Owner = owner.Username
+		}
+	}
+	return permissions, nil
+}
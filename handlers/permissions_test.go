@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"shopping-list/db"
+	"testing"
+)
+
+func TestListPermissions(t *testing.T) {
+	env := newTestEnv(t)
+	list := must(env.store.CreateList("Alice's", "", env.alice.ID))
+	path := fmt.Sprintf("/lists/%d/permissions", list.ID)
+
+	// Bob may edit the shared list but not change who has access
+	if status, _ := env.request("GET", path, env.bob.ID, ""); status != 403 {
+		t.Errorf("permissions as an editor = %d, want 403", status)
+	}
+
+	body := `{"private":true,"members":[{"username":"bob","role":"viewer"}]}`
+	status, resp := env.request("PUT", path, env.alice.ID, body)
+	if status != 200 {
+		t.Fatalf("update as the owner = %d %s", status, resp)
+	}
+	var got ListPermissions
+	if err := json.Unmarshal([]byte(resp), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsPrivate || got.Owner != "alice" || len(got.Members) != 1 || got.Members[0].Role != db.RoleViewer {
+		t.Errorf("permissions = %+v", got)
+	}
+	if role := must(env.store.GetListRole(list.ID, env.bob.ID)); role != db.RoleViewer {
+		t.Errorf("bob's role = %q, want viewer", role)
+	}
+
+	// Removing Bob hides the list from him entirely
+	status, resp = env.request("PUT", path, env.alice.ID, `{"private":true,"members":[]}`)
+	if status != 200 {
+		t.Fatalf("update as the owner = %d %s", status, resp)
+	}
+	if status, _ := env.request("GET", path, env.bob.ID, ""); status != 404 {
+		t.Errorf("permissions as a stranger = %d, want 404", status)
+	}
+
+	// Nothing changes when any part of the request is invalid
+	body = `{"private":false,"members":[{"username":"bob","role":"editor"},{"username":"nobody","role":"viewer"}]}`
+	if status, _ := env.request("PUT", path, env.alice.ID, body); status != 400 {
+		t.Errorf("granting an unknown user = %d, want 400", status)
+	}
+	if acl := must(env.store.GetListACL(list.ID)); !acl.IsPrivate || len(acl.Members) != 0 {
+		t.Errorf("permissions after a rejected update = %+v", acl)
+	}
+}
+
+func TestUnownedListPermissions(t *testing.T) {
+	env := newTestEnv(t)
+	path := fmt.Sprintf("/lists/%d", env.defaultList.ID)
+
+	// Everyone may edit a list nobody owns, but not delete it or share it
+	if status, _ := env.request("DELETE", path, env.alice.ID, ""); status != 403 {
+		t.Errorf("delete an unowned list = %d, want 403", status)
+	}
+	if status, _ := env.request("PUT", path+"/permissions", env.alice.ID, `{"private":true,"members":[]}`); status != 403 {
+		t.Errorf("make an unowned list private = %d, want 403", status)
+	}
+	if acl := must(env.store.GetListACL(env.defaultList.ID)); acl.IsPrivate || acl.OwnerID != 0 {
+		t.Errorf("ACL after rejected changes = %+v", acl)
+	}
+}
+
+func TestViewerCannotReorderLists(t *testing.T) {
+	env := newTestEnv(t)
+	first := must(env.store.CreateList("Alice's", "", env.alice.ID))
+	list := must(env.store.CreateList("Alice's too", "", env.alice.ID))
+	if err := env.store.SetListMember(list.ID, env.bob.ID, db.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := env.request("POST", fmt.Sprintf("/lists/%d/move-up", list.ID), env.bob.ID, ""); status != 403 {
+		t.Errorf("move up as a viewer = %d, want 403", status)
+	}
+	if got := must(env.store.GetListByID(list.ID)); got.SortOrder < must(env.store.GetListByID(first.ID)).SortOrder {
+		t.Error("a viewer moved a list")
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"shopping-list/i18n"
+	"shopping-list/service"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PrintOptions reads ?columns=, ?hide_completed= and ?paper= of a print request
+func PrintOptions(c *fiber.Ctx) service.PrintOptions {
+	return service.PrintOptions{
+		HideCompleted: c.QueryBool("hide_completed"),
+		Columns:       c.QueryInt("columns", 1),
+		Paper:         c.Query("paper"),
+	}
+}
+
+// GetPrintView renders a list for printing on paper
+func GetPrintView(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).SendString("Invalid ID")
+	}
+
+	opts := PrintOptions(c)
+	if err := opts.Normalize(); err != nil {
+		return serviceError(c, err)
+	}
+	list, sections, err := svc.PrintableList(CurrentUserID(c), id, opts)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	items := 0
+	for _, section := range sections {
+		items += len(section.Items)
+	}
+
+	columns := make([]int, service.MaxPrintColumns)
+	for i := range columns {
+		columns[i] = i + 1
+	}
+
+	return c.Render("print", fiber.Map{
+		"List":          list,
+		"Sections":      sections,
+		"Items":         items,
+		"Date":          time.Now().Format("2006-01-02"),
+		"Columns":       opts.Columns,
+		"ColumnChoices": columns,
+		"HideCompleted": opts.HideCompleted,
+		"Lang":          c.Query("lang", i18n.GetDefaultLang()),
+	}, "")
+}
+
+// GetListPDF returns a list as a printable PDF
+func GetListPDF(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).SendString("Invalid ID")
+	}
+
+	data, err := svc.ListPDF(CurrentUserID(c), id, PrintOptions(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf(`inline; filename="list-%d.pdf"`, id))
+	return c.Send(data)
+}
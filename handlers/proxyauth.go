@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"shopping-list/db"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ProxyAuthConfig holds reverse-proxy header authentication settings.
+// The header is only honoured from TRUSTED_PROXIES (see InitTrustedProxies).
+type ProxyAuthConfig struct {
+	Header    string
+	LogoutURL string
+}
+
+// Singleton instance, nil when proxy authentication is not configured
+var proxyAuth *ProxyAuthConfig
+
+// InitProxyAuth enables header authentication if AUTH_PROXY_HEADER and TRUSTED_PROXIES are set.
+// Must run after InitTrustedProxies.
+func InitProxyAuth() {
+	header := strings.TrimSpace(os.Getenv("AUTH_PROXY_HEADER"))
+	if header == "" {
+		return
+	}
+
+	if len(trustedProxies) == 0 {
+		// Trusting the header from anywhere would let any client pick a user
+		log.Printf("[PROXY AUTH] AUTH_PROXY_HEADER is set but TRUSTED_PROXIES is empty - proxy authentication disabled")
+		return
+	}
+
+	proxyAuth = &ProxyAuthConfig{
+		Header:    header,
+		LogoutURL: os.Getenv("AUTH_PROXY_LOGOUT_URL"),
+	}
+
+	var cidrs []string
+	for _, p := range trustedProxies {
+		cidrs = append(cidrs, p.String())
+	}
+	log.Printf("[PROXY AUTH] Enabled: header=%s trusted=%s", header, strings.Join(cidrs, ","))
+}
+
+// proxyAuthUser returns the user named in the proxy header, provisioning it on first sight.
+// Returns nil if proxy authentication is off, the peer isn't trusted, or the header is empty.
+func proxyAuthUser(c *fiber.Ctx) *db.User {
+	if proxyAuth == nil {
+		return nil
+	}
+
+	username := strings.TrimSpace(c.Get(proxyAuth.Header))
+	if username == "" {
+		return nil
+	}
+	if !isFromTrustedProxy(c) {
+		log.Printf("[PROXY AUTH] Ignoring %s header from untrusted address %s", proxyAuth.Header, c.Context().RemoteIP())
+		return nil
+	}
+
+	// Look up first so regular requests don't write to the database
+	user, err := store.GetUserByUsername(username)
+	if err == sql.ErrNoRows {
+		user, err = store.GetOrCreateUser(username)
+		if err == nil {
+			log.Printf("[PROXY AUTH] Provisioned user %s", user.Username)
+		}
+	}
+	if err != nil {
+		log.Printf("[PROXY AUTH] Failed to load user %s: %v", username, err)
+		return nil
+	}
+	return user
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net"
+	"strconv"
+	"testing"
+)
+
+// enableProxyAuth trusts the header from the CIDRs for the rest of the test
+func enableProxyAuth(t *testing.T, cidrs string) {
+	trustedProxies = parseTrustedProxies(cidrs)
+	proxyAuth = &ProxyAuthConfig{Header: "Remote-User"}
+	t.Cleanup(func() {
+		trustedProxies = nil
+		proxyAuth = nil
+	})
+}
+
+func TestProxyAuthTrustedPeer(t *testing.T) {
+	env := newTestEnv(t)
+	// Requests of app.Test come from 0.0.0.0
+	enableProxyAuth(t, "10.0.0.0/8, 0.0.0.0/32")
+
+	req := webRequest("GET", "/whoami", nil, nil)
+	req.Header.Set("Remote-User", "alice")
+	if status, body := env.serve(req); status != 200 || body != strconv.FormatInt(env.alice.ID, 10) {
+		t.Errorf("whoami as alice = %d %q", status, body)
+	}
+
+	// Unknown users are provisioned on first sight
+	req = webRequest("GET", "/whoami", nil, nil)
+	req.Header.Set("Remote-User", "carol")
+	status, body := env.serve(req)
+	carol, err := env.store.GetUserByUsername("carol")
+	if err != nil || status != 200 || body != strconv.FormatInt(carol.ID, 10) {
+		t.Errorf("whoami as carol = %d %q (%v)", status, body, err)
+	}
+
+	// Without the header a session is still needed
+	if status, _ := env.serve(webRequest("GET", "/whoami", nil, nil)); status != 302 {
+		t.Errorf("whoami without header = %d", status)
+	}
+}
+
+func TestProxyAuthUntrustedPeer(t *testing.T) {
+	env := newTestEnv(t)
+	enableProxyAuth(t, "10.0.0.0/8,192.168.1.1")
+
+	req := webRequest("GET", "/whoami", nil, nil)
+	req.Header.Set("Remote-User", "mallory")
+	// A forwarded address doesn't make the peer trusted
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	if status, body := env.serve(req); status != 302 {
+		t.Errorf("header from an untrusted peer = %d %q", status, body)
+	}
+	if _, err := env.store.GetUserByUsername("mallory"); err == nil {
+		t.Error("user provisioned from an untrusted peer")
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	trustedProxies = parseTrustedProxies("10.0.0.0/8, 192.168.1.1, fd00::/8, not-an-ip, 300.1.1.1/8")
+	t.Cleanup(func() { trustedProxies = nil })
+	if len(trustedProxies) != 3 {
+		t.Fatalf("parsed %v", trustedProxies)
+	}
+
+	tests := map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.1": true,
+		"192.168.1.2": false,
+		"fd12::1":     true,
+		"11.0.0.1":    false,
+		"127.0.0.1":   false,
+	}
+	for ip, want := range tests {
+		if got := isTrustedProxyIP(net.ParseIP(ip)); got != want {
+			t.Errorf("isTrustedProxyIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
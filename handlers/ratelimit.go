@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"database/sql"
 	"log"
 	"os"
+	"shopping-list/db"
 	"strconv"
 	"sync"
 	"time"
@@ -10,48 +12,87 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-// RateLimitConfig holds configuration from environment variables
+// RateLimitConfig describes a fixed-window limit.
+// After more than Limit hits within Window the key is blocked for Lockout
+// (or until the window ends if Lockout is 0).
 type RateLimitConfig struct {
-	MaxAttempts     int
-	WindowDuration  time.Duration
-	LockoutDuration time.Duration
+	Limit   int
+	Window  time.Duration
+	Lockout time.Duration
 }
 
-// LoginAttempt tracks login attempts for a single IP
-type LoginAttempt struct {
-	Count        int
-	FirstAttempt time.Time
-	LockedUntil  time.Time
+// RateLimitResult is the state of a key after a hit
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAt    time.Time
+	RetryAfter time.Duration
 }
 
-// LoginRateLimiter manages rate limiting for login attempts
-type LoginRateLimiter struct {
+// rateLimitStore keeps counters in memory or in the database (RATE_LIMIT_PERSIST=true)
+type rateLimitStore interface {
+	get(key string) (*db.RateLimitEntry, error)
+	put(key string, e *db.RateLimitEntry) error
+	remove(key string) error
+	cleanup(prefix string, windowStartBefore, now int64) error
+}
+
+// RateLimiter counts hits per key (IP address, token, ...) under a name prefix
+type RateLimiter struct {
+	name     string
 	config   RateLimitConfig
-	attempts map[string]*LoginAttempt
-	mu       sync.RWMutex
+	counters rateLimitStore
+	mu       sync.Mutex
 }
 
-// Singleton instance
-var loginLimiter *LoginRateLimiter
+// Singleton instance for password and 2FA attempts
+var loginLimiter *RateLimiter
 
-// InitLoginRateLimiter initializes the rate limiter with env vars
+// InitLoginRateLimiter initializes the login rate limiter with env vars
 func InitLoginRateLimiter() {
 	config := RateLimitConfig{
-		MaxAttempts:     getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
-		WindowDuration:  time.Duration(getEnvInt("LOGIN_WINDOW_MINUTES", 15)) * time.Minute,
-		LockoutDuration: time.Duration(getEnvInt("LOGIN_LOCKOUT_MINUTES", 30)) * time.Minute,
+		Limit:   getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+		Window:  time.Duration(getEnvInt("LOGIN_WINDOW_MINUTES", 15)) * time.Minute,
+		Lockout: time.Duration(getEnvInt("LOGIN_LOCKOUT_MINUTES", 30)) * time.Minute,
 	}
 
-	loginLimiter = &LoginRateLimiter{
-		config:   config,
-		attempts: make(map[string]*LoginAttempt),
+	loginLimiter = NewRateLimiter("login", config)
+
+	log.Printf("[RATE LIMIT] Initialized login: max=%d attempts per %v, lockout=%v, persistent=%v",
+		config.Limit, config.Window, config.Lockout, isRateLimitPersistent())
+}
+
+// hookLimiter limits requests to inbound hooks per IP address
+var hookLimiter *RateLimiter
+
+// InitHookRateLimiter initializes the inbound hook rate limiter with env vars
+func InitHookRateLimiter() {
+	config := RateLimitConfig{
+		Limit:  getEnvInt("HOOK_RATE_LIMIT", 30),
+		Window: time.Minute,
+	}
+	if config.Limit <= 0 {
+		return
+	}
+	hookLimiter = NewRateLimiter("hook", config)
+}
+
+// NewRateLimiter creates a limiter and starts its cleanup routine.
+// Counters are kept in the database when RATE_LIMIT_PERSIST=true.
+func NewRateLimiter(name string, config RateLimitConfig) *RateLimiter {
+	var counters rateLimitStore = &memoryRateLimitStore{entries: make(map[string]*db.RateLimitEntry)}
+	if isRateLimitPersistent() {
+		counters = persistentRateLimitStore{}
 	}
 
-	// Start cleanup goroutine
-	go loginLimiter.cleanupRoutine()
+	rl := &RateLimiter{name: name, config: config, counters: counters}
+	go rl.cleanupRoutine()
+	return rl
+}
 
-	log.Printf("[RATE LIMIT] Initialized: max=%d attempts per %v, lockout=%v",
-		config.MaxAttempts, config.WindowDuration, config.LockoutDuration)
+func isRateLimitPersistent() bool {
+	return os.Getenv("RATE_LIMIT_PERSIST") == "true"
 }
 
 func getEnvInt(key string, defaultVal int) int {
@@ -66,70 +107,98 @@ func getEnvInt(key string, defaultVal int) int {
 	return intVal
 }
 
-// IsBlocked checks if an IP is currently blocked
-func (rl *LoginRateLimiter) IsBlocked(ip string) (bool, time.Duration) {
-	rl.mu.RLock()
-	defer rl.mu.RUnlock()
+func (rl *RateLimiter) key(key string) string {
+	return rl.name + ":" + key
+}
 
-	attempt, exists := rl.attempts[ip]
-	if !exists {
+// IsBlocked checks if a key is currently blocked, without counting a hit
+func (rl *RateLimiter) IsBlocked(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	entry, err := rl.counters.get(rl.key(key))
+	if err != nil || entry == nil {
 		return false, 0
 	}
 
-	if time.Now().Before(attempt.LockedUntil) {
-		remaining := time.Until(attempt.LockedUntil)
-		return true, remaining
+	blockedUntil := time.Unix(entry.BlockedUntil, 0)
+	if time.Now().Before(blockedUntil) {
+		return true, time.Until(blockedUntil)
 	}
-
 	return false, 0
 }
 
-// RecordAttempt records a failed login attempt, returns true if limit exceeded
-func (rl *LoginRateLimiter) RecordAttempt(ip string) bool {
+// Hit counts a hit for the key and reports whether it is within the limit
+func (rl *RateLimiter) Hit(key string) RateLimitResult {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
 	now := time.Now()
-	attempt, exists := rl.attempts[ip]
+	result := RateLimitResult{Allowed: true, Limit: rl.config.Limit}
 
-	if !exists {
-		rl.attempts[ip] = &LoginAttempt{
-			Count:        1,
-			FirstAttempt: now,
-		}
-		return false
+	entry, err := rl.counters.get(rl.key(key))
+	if err != nil {
+		// Fail open: a broken counter shouldn't lock everyone out
+		log.Printf("[RATE LIMIT] Failed to read %s counter: %v", rl.name, err)
+		result.Remaining = rl.config.Limit
+		result.ResetAt = now.Add(rl.config.Window)
+		return result
+	}
+
+	if entry != nil && now.Unix() < entry.BlockedUntil {
+		result.Allowed = false
+		result.ResetAt = time.Unix(entry.BlockedUntil, 0)
+		result.RetryAfter = result.ResetAt.Sub(now)
+		return result
+	}
+
+	if entry == nil || now.Unix()-entry.WindowStart >= int64(rl.config.Window.Seconds()) {
+		entry = &db.RateLimitEntry{WindowStart: now.Unix()}
 	}
+	entry.Count++
+	entry.BlockedUntil = 0
 
-	// Check if window has expired
-	if now.Sub(attempt.FirstAttempt) > rl.config.WindowDuration {
-		attempt.Count = 1
-		attempt.FirstAttempt = now
-		attempt.LockedUntil = time.Time{}
-		return false
+	result.ResetAt = time.Unix(entry.WindowStart, 0).Add(rl.config.Window)
+	result.Remaining = rl.config.Limit - entry.Count
+	if result.Remaining < 0 {
+		result.Remaining = 0
 	}
 
-	attempt.Count++
+	if entry.Count > rl.config.Limit {
+		blockedUntil := result.ResetAt
+		if rl.config.Lockout > 0 {
+			blockedUntil = now.Add(rl.config.Lockout)
+		}
+		entry.BlockedUntil = blockedUntil.Unix()
+		result.Allowed = false
+		result.ResetAt = blockedUntil
+		result.RetryAfter = blockedUntil.Sub(now)
+		log.Printf("[RATE LIMIT] %s %s blocked until %s (hits: %d)",
+			rl.name, key, blockedUntil.Format("15:04:05"), entry.Count)
+	}
 
-	// Check if limit exceeded
-	if attempt.Count > rl.config.MaxAttempts {
-		attempt.LockedUntil = now.Add(rl.config.LockoutDuration)
-		log.Printf("[RATE LIMIT] IP %s blocked until %s (attempts: %d)",
-			ip, attempt.LockedUntil.Format("15:04:05"), attempt.Count)
-		return true
+	if err := rl.counters.put(rl.key(key), entry); err != nil {
+		log.Printf("[RATE LIMIT] Failed to save %s counter: %v", rl.name, err)
 	}
+	return result
+}
 
-	return false
+// RecordAttempt records a failed attempt, returns true if the limit is exceeded
+func (rl *RateLimiter) RecordAttempt(key string) bool {
+	return !rl.Hit(key).Allowed
 }
 
-// ResetAttempts clears the attempt counter after successful login
-func (rl *LoginRateLimiter) ResetAttempts(ip string) {
+// ResetAttempts clears the counter, e.g. after a successful login
+func (rl *RateLimiter) ResetAttempts(key string) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
-	delete(rl.attempts, ip)
+	if err := rl.counters.remove(rl.key(key)); err != nil {
+		log.Printf("[RATE LIMIT] Failed to reset %s counter: %v", rl.name, err)
+	}
 }
 
 // cleanupRoutine periodically removes old entries
-func (rl *LoginRateLimiter) cleanupRoutine() {
+func (rl *RateLimiter) cleanupRoutine() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
@@ -138,18 +207,34 @@ func (rl *LoginRateLimiter) cleanupRoutine() {
 	}
 }
 
-func (rl *LoginRateLimiter) cleanup() {
+func (rl *RateLimiter) cleanup() {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
 	now := time.Now()
-	maxAge := rl.config.WindowDuration + rl.config.LockoutDuration
+	windowStartBefore := now.Add(-rl.config.Window).Unix()
+	if err := rl.counters.cleanup(rl.name+":", windowStartBefore, now.Unix()); err != nil {
+		log.Printf("[RATE LIMIT] Cleanup of %s counters failed: %v", rl.name, err)
+	}
+}
 
-	for ip, attempt := range rl.attempts {
-		if now.Sub(attempt.FirstAttempt) > maxAge && now.After(attempt.LockedUntil) {
-			delete(rl.attempts, ip)
-		}
+// SetRateLimitHeaders adds the X-RateLimit-* headers (and Retry-After when blocked)
+func SetRateLimitHeaders(c *fiber.Ctx, result RateLimitResult) {
+	c.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Set("X-RateLimit-Reset", strconv.FormatInt(result.ResetAt.Unix(), 10))
+	if !result.Allowed {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(result.RetryAfter)))
+	}
+}
+
+// retryAfterSeconds rounds up so clients never retry too early
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
 	}
+	return seconds
 }
 
 // LoginRateLimitMiddleware checks if IP is blocked before allowing login
@@ -158,7 +243,7 @@ func LoginRateLimitMiddleware(c *fiber.Ctx) error {
 		return c.Next()
 	}
 
-	ip := c.IP()
+	ip := ClientIP(c)
 
 	if blocked, remaining := loginLimiter.IsBlocked(ip); blocked {
 		minutes := int(remaining.Minutes())
@@ -166,8 +251,66 @@ func LoginRateLimitMiddleware(c *fiber.Ctx) error {
 			minutes = 1
 		}
 		log.Printf("[RATE LIMIT] Blocked login attempt from IP: %s (remaining: %dm)", ip, minutes)
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(remaining)))
 		return c.Redirect("/login?error=rate_limited")
 	}
 
 	return c.Next()
 }
+
+// ==================== STORES ====================
+
+type memoryRateLimitStore struct {
+	entries map[string]*db.RateLimitEntry
+}
+
+func (s *memoryRateLimitStore) get(key string) (*db.RateLimitEntry, error) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *entry
+	return &copied, nil
+}
+
+func (s *memoryRateLimitStore) put(key string, e *db.RateLimitEntry) error {
+	copied := *e
+	s.entries[key] = &copied
+	return nil
+}
+
+func (s *memoryRateLimitStore) remove(key string) error {
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryRateLimitStore) cleanup(prefix string, windowStartBefore, now int64) error {
+	for key, e := range s.entries {
+		if e.WindowStart < windowStartBefore && e.BlockedUntil < now {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
+
+type persistentRateLimitStore struct{}
+
+func (persistentRateLimitStore) get(key string) (*db.RateLimitEntry, error) {
+	entry, err := store.GetRateLimit(key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+func (persistentRateLimitStore) put(key string, e *db.RateLimitEntry) error {
+	return store.SaveRateLimit(key, e)
+}
+
+func (persistentRateLimitStore) remove(key string) error {
+	return store.DeleteRateLimit(key)
+}
+
+func (persistentRateLimitStore) cleanup(prefix string, windowStartBefore, now int64) error {
+	return store.CleanRateLimits(prefix, windowStartBefore, now)
+}
@@ -10,16 +10,20 @@ import (
 
 // GetSections returns all sections with items (for full page render)
 func GetSections(c *fiber.Ctx) error {
-	sections, err := db.GetAllSections()
+	activeList, status, msg := checkActiveListRole(c, db.RoleViewer)
+	if status != 0 {
+		return c.Status(status).SendString(msg)
+	}
+
+	sections, err := store.GetSectionsByList(activeList.ID)
 	if err != nil {
 		return c.Status(500).SendString("Failed to fetch sections")
 	}
 
-	stats := db.GetStats()
+	stats := store.GetListStats(activeList.ID)
 
 	// Get lists for dropdown
-	lists, _ := db.GetAllLists()
-	activeList, _ := db.GetActiveList()
+	lists, _ := store.GetAllLists(CurrentUserID(c))
 
 	return c.Render("list", fiber.Map{
 		"Sections":     sections,
@@ -34,26 +38,20 @@ func GetSections(c *fiber.Ctx) error {
 
 // CreateSection creates a new section
 func CreateSection(c *fiber.Ctx) error {
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Name is required")
-	}
-	if len(name) > MaxSectionNameLength {
-		return c.Status(400).SendString("Name too long (max 100 characters)")
+	activeList, err := store.GetActiveList(CurrentUserID(c))
+	if err != nil {
+		return c.Status(500).SendString("No active list found")
 	}
 
-	section, err := db.CreateSection(name)
+	section, err := svc.CreateSection(CurrentUserID(c), activeList.ID, c.FormValue("name"))
 	if err != nil {
-		return c.Status(500).SendString("Failed to create section")
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("section_created", section)
-
 	// Return the new section partial for HTMX
 	return c.Render("partials/section", fiber.Map{
 		"Section":  section,
-		"Sections": getSectionsForDropdown(),
+		"Sections": getSectionsForDropdown(activeList.ID),
 	}, "")
 }
 
@@ -64,26 +62,15 @@ func UpdateSection(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Name is required")
-	}
-	if len(name) > MaxSectionNameLength {
-		return c.Status(400).SendString("Name too long (max 100 characters)")
-	}
-
-	section, err := db.UpdateSection(id, name)
+	section, err := svc.UpdateSection(CurrentUserID(c), id, c.FormValue("name"))
 	if err != nil {
-		return c.Status(500).SendString("Failed to update section")
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("section_updated", section)
-
 	// Return updated section partial
 	return c.Render("partials/section", fiber.Map{
 		"Section":  section,
-		"Sections": getSectionsForDropdown(),
+		"Sections": getSectionsForDropdown(section.ListID),
 	}, "")
 }
 
@@ -94,14 +81,10 @@ func DeleteSection(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.DeleteSection(id)
-	if err != nil {
-		return c.Status(500).SendString("Failed to delete section")
+	if err := svc.DeleteSection(CurrentUserID(c), id); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("section_deleted", map[string]int64{"id": id})
-
 	// Return empty string (HTMX will remove the element)
 	return c.SendString("")
 }
@@ -113,14 +96,13 @@ func MoveSectionUp(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.MoveSectionUp(id)
+	section, err := svc.MoveSectionUp(CurrentUserID(c), id)
 	if err != nil {
-		return c.Status(500).SendString("Failed to move section")
+		return serviceError(c, err)
 	}
 
-	// Broadcast and return full sections list
-	BroadcastUpdate("sections_reordered", nil)
-	return returnAllSections(c)
+	// Return full sections list
+	return returnAllSections(c, section.ListID)
 }
 
 // MoveSectionDown moves a section down in order
@@ -130,19 +112,18 @@ func MoveSectionDown(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.MoveSectionDown(id)
+	section, err := svc.MoveSectionDown(CurrentUserID(c), id)
 	if err != nil {
-		return c.Status(500).SendString("Failed to move section")
+		return serviceError(c, err)
 	}
 
-	// Broadcast and return full sections list
-	BroadcastUpdate("sections_reordered", nil)
-	return returnAllSections(c)
+	// Return full sections list
+	return returnAllSections(c, section.ListID)
 }
 
-// Helper to return all sections as HTML partials
-func returnAllSections(c *fiber.Ctx) error {
-	sections, err := db.GetAllSections()
+// Helper to return all sections of a list as HTML partials
+func returnAllSections(c *fiber.Ctx, listID int64) error {
+	sections, err := store.GetSectionsByList(listID)
 	if err != nil {
 		return c.Status(500).SendString("Failed to fetch sections")
 	}
@@ -152,9 +133,9 @@ func returnAllSections(c *fiber.Ctx) error {
 	}, "")
 }
 
-// Helper to get sections for dropdown
-func getSectionsForDropdown() []db.Section {
-	sections, _ := db.GetAllSections()
+// Helper to get sections of a list for dropdown
+func getSectionsForDropdown(listID int64) []db.Section {
+	sections, _ := store.GetSectionsByList(listID)
 	return sections
 }
 
@@ -176,18 +157,10 @@ func BatchDeleteSections(c *fiber.Ctx) error {
 		ids = append(ids, id)
 	}
 
-	if len(ids) == 0 {
-		return c.Status(400).SendString("No valid IDs provided")
-	}
-
-	err := db.DeleteSections(ids)
-	if err != nil {
-		return c.Status(500).SendString("Failed to delete sections")
+	if err := svc.DeleteSections(CurrentUserID(c), ids); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("sections_deleted", map[string]interface{}{"ids": ids})
-
 	// Return updated sections list for modal
 	return returnSectionsForModal(c)
 }
@@ -232,7 +205,12 @@ func trimSpace(s string) string {
 
 // Helper to return sections for modal
 func returnSectionsForModal(c *fiber.Ctx) error {
-	sections, err := db.GetAllSections()
+	activeList, status, msg := checkActiveListRole(c, db.RoleViewer)
+	if status != 0 {
+		return c.Status(status).SendString(msg)
+	}
+
+	sections, err := store.GetSectionsByList(activeList.ID)
 	if err != nil {
 		return c.Status(500).SendString("Failed to fetch sections")
 	}
@@ -246,7 +224,11 @@ func returnSectionsForModal(c *fiber.Ctx) error {
 func GetSectionsListForModal(c *fiber.Ctx) error {
 	// Check if JSON format is requested
 	if c.Query("format") == "json" {
-		sections, err := db.GetAllSections()
+		activeList, status, msg := checkActiveListRole(c, db.RoleViewer)
+		if status != 0 {
+			return c.Status(status).JSON(fiber.Map{"error": msg})
+		}
+		sections, err := store.GetSectionsByList(activeList.ID)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch sections"})
 		}
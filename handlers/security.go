@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"log"
+	"shopping-list/db"
+	"shopping-list/i18n"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// TwoFactorCodeRequest is the body for endpoints confirming a code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" form:"code"`
+}
+
+// GetSecurityPage renders the account security settings
+func GetSecurityPage(c *fiber.Ctx) error {
+	userID := CurrentUserID(c)
+
+	var username string
+	hasPassword := false
+	if userID != 0 {
+		if user, err := store.GetUserByID(userID); err == nil {
+			username = user.Username
+		}
+		hash, _ := store.GetUserPasswordHash(userID)
+		hasPassword = hash != ""
+	}
+
+	return c.Render("security", fiber.Map{
+		"Username":     username,
+		"HasAccount":   userID != 0,
+		"HasPassword":  hasPassword,
+		"Translations": i18n.GetAllLocales(),
+		"Locales":      i18n.AvailableLocales(),
+		"DefaultLang":  i18n.GetDefaultLang(),
+	})
+}
+
+// GetTwoFactorStatus returns whether 2FA is on and how many recovery codes are left (JSON)
+func GetTwoFactorStatus(c *fiber.Ctx) error {
+	userID := CurrentUserID(c)
+	if userID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Two-factor authentication requires a user account"})
+	}
+
+	enabled, err := store.IsTOTPEnabled(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	status := fiber.Map{"enabled": enabled, "recovery_codes_left": 0}
+	if enabled {
+		status["recovery_codes_left"] = store.CountRecoveryCodes(userID)
+	}
+	return c.JSON(status)
+}
+
+// SetupTwoFactor generates a new secret and returns it with its QR code (JSON).
+// 2FA stays off until EnableTwoFactor confirms a code from the app.
+func SetupTwoFactor(c *fiber.Ctx) error {
+	userID := CurrentUserID(c)
+	if userID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Two-factor authentication requires a user account"})
+	}
+
+	user, err := store.GetUserByID(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if enabled, _ := store.IsTOTPEnabled(userID); enabled {
+		return c.Status(409).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+
+	secret := generateTOTPSecret()
+	if err := store.SaveTOTPSecret(userID, secret); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save secret"})
+	}
+
+	otpURL := totpURL(user.Username, secret)
+	png, err := qrcode.Encode(otpURL, qrcode.Medium, 256)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate QR code"})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":      secret,
+		"otpauth_url": otpURL,
+		"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// EnableTwoFactor turns on 2FA once a code proves the app is set up,
+// returning the recovery codes (JSON). They are only shown this once.
+func EnableTwoFactor(c *fiber.Ctx) error {
+	userID := CurrentUserID(c)
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	totp, err := store.GetUserTOTP(userID)
+	if err == sql.ErrNoRows {
+		return c.Status(400).JSON(fiber.Map{"error": "Start the setup first"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if totp.Enabled {
+		return c.Status(409).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+
+	step := matchTOTP(totp.Secret, req.Code, time.Now())
+	if step == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	codes, hashes := generateRecoveryCodes()
+	if err := store.EnableTOTP(userID, step, hashes); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+	}
+	log.Printf("[2FA] Enabled for user %d", userID)
+
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns off 2FA after checking a current or recovery code (JSON)
+func DisableTwoFactor(c *fiber.Ctx) error {
+	totp, status, msg := requireTwoFactorCode(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := store.DisableTOTP(totp.UserID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to disable two-factor authentication"})
+	}
+	log.Printf("[2FA] Disabled for user %d", totp.UserID)
+
+	return c.JSON(fiber.Map{"enabled": false})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a code (JSON)
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	totp, status, msg := requireTwoFactorCode(c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	codes, hashes := generateRecoveryCodes()
+	if err := store.ReplaceRecoveryCodes(totp.UserID, hashes); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate recovery codes"})
+	}
+
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// requireTwoFactorCode loads the enabled enrolment of the current user and checks
+// the submitted code, returning the status and message to reject with or 0
+func requireTwoFactorCode(c *fiber.Ctx) (*db.UserTOTP, int, string) {
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, 400, "Invalid request body"
+	}
+
+	totp, err := store.GetUserTOTP(CurrentUserID(c))
+	if err == sql.ErrNoRows || (err == nil && !totp.Enabled) {
+		return nil, 400, "Two-factor authentication is not enabled"
+	}
+	if err != nil {
+		return nil, 500, "Database error"
+	}
+
+	if !verifySecondFactor(totp, req.Code) {
+		return nil, 400, "Invalid code"
+	}
+	return totp, 0, ""
+}
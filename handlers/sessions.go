@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"shopping-list/db"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// sessionLocal is the fiber.Ctx locals key holding the current *db.Session
+	sessionLocal = "session"
+
+	MaxUserAgentLength   = 500
+	MaxDeviceLabelLength = 100
+)
+
+// RenameSessionRequest is the body for changing a session's device label
+type RenameSessionRequest struct {
+	Label string `json:"label" form:"label"`
+}
+
+// CurrentSession returns the session of a cookie-authenticated request, or nil
+func CurrentSession(c *fiber.Ctx) *db.Session {
+	session, _ := c.Locals(sessionLocal).(*db.Session)
+	return session
+}
+
+// deviceLabel derives a readable name like "Firefox on Android" from a user agent
+func deviceLabel(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	// Order matters: most user agents also claim to be Safari/Chrome/Mozilla
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"samsungbrowser", "Samsung Internet"},
+		{"firefox/", "Firefox"},
+		{"fxios", "Firefox"},
+		{"crios", "Chrome"},
+		{"chrome/", "Chrome"},
+		{"safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, o := range []struct{ token, name string }{
+		{"iphone", "iPhone"},
+		{"ipad", "iPad"},
+		{"android", "Android"},
+		{"windows", "Windows"},
+		{"mac os x", "macOS"},
+		{"cros", "ChromeOS"},
+		{"linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			platform = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
+
+// GetSessions lists the active sessions of the current user (JSON).
+// Without authentication (user 0) the sessions of all users are listed.
+func GetSessions(c *fiber.Ctx) error {
+	sessions, err := store.GetSessions(CurrentUserID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+
+	if current := CurrentSession(c); current != nil {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == current.ID
+		}
+	}
+	return c.JSON(fiber.Map{"sessions": sessions})
+}
+
+// RenameSession changes the device label of a session (JSON)
+func RenameSession(c *fiber.Ctx) error {
+	var req RenameSessionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	label := strings.TrimSpace(req.Label)
+	if label == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Label is required"})
+	}
+	if len(label) > MaxDeviceLabelLength {
+		return c.Status(400).JSON(fiber.Map{"error": "Label too long"})
+	}
+
+	if err := store.RenameSession(c.Params("id"), CurrentUserID(c), label); err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to rename session"})
+	}
+	return c.JSON(fiber.Map{"id": c.Params("id"), "device_label": label})
+}
+
+// RevokeSession logs out a single device (JSON)
+func RevokeSession(c *fiber.Ctx) error {
+	if err := RevokeSessionByPublicID(c.Params("id"), CurrentUserID(c)); err != nil {
+		if fe, ok := err.(*fiber.Error); ok {
+			return c.Status(fe.Code).JSON(fiber.Map{"error": fe.Message})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke session"})
+	}
+	return c.SendStatus(204)
+}
+
+// RevokeOtherSessions logs out every device of the current user except this one (JSON)
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	current := CurrentSession(c)
+	if current == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Not logged in with a session"})
+	}
+
+	count, err := RevokeUserSessions(current.UserID, current.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+	}
+	return c.JSON(fiber.Map{"revoked": count})
+}
+
+// RevokeSessionByPublicID deletes a session and disconnects its WebSockets.
+// userID 0 may revoke any session. A missing session is returned as *fiber.Error.
+func RevokeSessionByPublicID(publicID string, userID int64) error {
+	// Resolve first so the WebSocket connections of the session can be found
+	sessions, err := store.GetSessions(userID)
+	if err != nil {
+		return err
+	}
+	var target *db.Session
+	for i := range sessions {
+		if sessions[i].PublicID == publicID {
+			target = &sessions[i]
+			break
+		}
+	}
+	if target == nil {
+		return fiber.NewError(fiber.StatusNotFound, "Session not found")
+	}
+
+	if err := store.RevokeSession(publicID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, "Session not found")
+		}
+		return err
+	}
+	disconnectSessions(target.ID)
+	log.Printf("[AUTH] Session %s (%s) of %s revoked", target.PublicID, target.DeviceLabel, target.Username)
+	return nil
+}
+
+// RevokeUserSessions deletes all sessions of a user except keepID (may be empty)
+// and disconnects their WebSockets
+func RevokeUserSessions(userID int64, keepID string) (int64, error) {
+	if userID == 0 {
+		return 0, nil
+	}
+
+	sessions, err := store.GetSessions(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := store.RevokeOtherSessions(userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []string
+	for _, s := range sessions {
+		if s.ID != keepID {
+			ids = append(ids, s.ID)
+		}
+	}
+	disconnectSessions(ids...)
+	log.Printf("[AUTH] Revoked %d session(s) of user %d", count, userID)
+	return count, nil
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"shopping-list/db"
+	"testing"
+)
+
+// sessionIDs returns the public IDs listed by GET /settings/sessions and the
+// one marked current
+func (env *testEnv) sessionIDs(session *db.Session) ([]string, string) {
+	env.t.Helper()
+	status, body := env.serve(webRequest("GET", "/settings/sessions", session, nil))
+	var resp struct {
+		Sessions []db.Session `json:"sessions"`
+	}
+	if status != 200 || json.Unmarshal([]byte(body), &resp) != nil {
+		env.t.Fatalf("sessions = %d %s", status, body)
+	}
+	var ids []string
+	current := ""
+	for _, s := range resp.Sessions {
+		ids = append(ids, s.PublicID)
+		if s.Current {
+			current = s.PublicID
+		}
+	}
+	return ids, current
+}
+
+func TestRevokeSession(t *testing.T) {
+	env := newTestEnv(t)
+	phone, laptop := env.login(env.alice), env.login(env.alice)
+	bobs := env.login(env.bob)
+
+	ids, current := env.sessionIDs(phone)
+	if len(ids) != 2 || current != phone.PublicID {
+		t.Fatalf("alice's sessions = %v, current %q", ids, current)
+	}
+
+	// Sessions of other users are not found
+	if status, _ := env.serve(webRequest("DELETE", "/settings/sessions/"+bobs.PublicID, phone, nil)); status != 404 {
+		t.Errorf("revoking bob's session = %d", status)
+	}
+
+	if status, body := env.serve(webRequest("DELETE", "/settings/sessions/"+laptop.PublicID, phone, nil)); status != 204 {
+		t.Fatalf("revoking the laptop = %d %s", status, body)
+	}
+	if _, err := env.store.GetSession(laptop.ID); err != sql.ErrNoRows {
+		t.Errorf("revoked session: %v", err)
+	}
+	// The revoked cookie no longer logs in
+	if status, _ := env.serve(webRequest("GET", "/whoami", laptop, nil)); status != 302 {
+		t.Errorf("request with the revoked session = %d", status)
+	}
+	if status, _ := env.serve(webRequest("GET", "/whoami", phone, nil)); status != 200 {
+		t.Errorf("request with the remaining session = %d", status)
+	}
+	if _, err := env.store.GetSession(bobs.ID); err != nil {
+		t.Errorf("bob's session: %v", err)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	env := newTestEnv(t)
+	phone := env.login(env.alice)
+	others := []*db.Session{env.login(env.alice), env.login(env.alice)}
+	bobs := env.login(env.bob)
+
+	status, body := env.serve(webRequest("POST", "/settings/sessions/revoke-others", phone, nil))
+	if status != 200 || body != `{"revoked":2}` {
+		t.Fatalf("revoke others = %d %s", status, body)
+	}
+	for _, s := range others {
+		if _, err := env.store.GetSession(s.ID); err != sql.ErrNoRows {
+			t.Errorf("other session: %v", err)
+		}
+	}
+	if ids, _ := env.sessionIDs(phone); len(ids) != 1 || ids[0] != phone.PublicID {
+		t.Errorf("sessions left = %v", ids)
+	}
+	if _, err := env.store.GetSession(bobs.ID); err != nil {
+		t.Errorf("bob's session: %v", err)
+	}
+}
+
+func TestDeviceLabel(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1": "Safari on iPhone",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 Edg/120.0":                   "Edge on Windows",
+		"Mozilla/5.0 (Android 14; Mobile; rv:121.0) Gecko/121.0 Firefox/121.0":                                                                    "Firefox on Android",
+		"curl/8.4.0": "curl",
+		"":           "Unknown device",
+	}
+	for ua, want := range tests {
+		if got := deviceLabel(ua); got != want {
+			t.Errorf("deviceLabel(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
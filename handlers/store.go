@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"shopping-list/db"
+	"shopping-list/service"
+)
+
+// store is where all handlers read and write data
+var store db.Store
+
+// svc performs the changes to lists, sections and items
+var svc *service.Service
+
+// SetStore injects the store used by the handlers; call it before serving requests
+func SetStore(s db.Store) {
+	store = s
+}
+
+// SetService injects the service used for changes; call it before serving requests
+func SetService(s *service.Service) {
+	svc = s
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"shopping-list/db"
+	"shopping-list/service"
 	"strconv"
 	"strings"
 
@@ -22,7 +23,7 @@ func GetSuggestions(c *fiber.Ctx) error {
 
 	// If no query, return all suggestions (for offline cache)
 	if query == "" {
-		suggestions, err := db.GetAllItemSuggestions(limit)
+		suggestions, err := store.GetAllItemSuggestions(limit)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch suggestions"})
 		}
@@ -32,7 +33,7 @@ func GetSuggestions(c *fiber.Ctx) error {
 		return c.JSON(suggestions)
 	}
 
-	suggestions, err := db.GetItemSuggestions(query, limit)
+	suggestions, err := store.GetItemSuggestions(query, limit)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch suggestions"})
 	}
@@ -46,7 +47,7 @@ func GetSuggestions(c *fiber.Ctx) error {
 
 // GetHistory returns all history items for management UI
 func GetHistory(c *fiber.Ctx) error {
-	items, err := db.GetItemHistoryList()
+	items, err := store.GetItemHistoryList()
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch history"})
 	}
@@ -65,9 +66,9 @@ func DeleteHistoryItem(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
 	}
 
-	err = db.DeleteItemHistory(id)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete history item"})
+	if err := svc.DeleteHistory(id); err != nil {
+		e := service.AsError(err)
+		return c.Status(e.Status()).JSON(fiber.Map{"error": e.Message})
 	}
 
 	return c.JSON(fiber.Map{"success": true})
@@ -81,7 +82,7 @@ func BatchDeleteHistory(c *fiber.Ctx) error {
 	}
 
 	idStrings := strings.Split(idsStr, ",")
-	if len(idStrings) > 100 {
+	if len(idStrings) > service.MaxHistoryBatch {
 		return c.Status(400).JSON(fiber.Map{"error": "Too many IDs (max 100)"})
 	}
 	ids := make([]int64, 0, len(idStrings))
@@ -98,9 +99,10 @@ func BatchDeleteHistory(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "No valid IDs provided"})
 	}
 
-	deleted, err := db.DeleteItemHistoryBatch(ids)
+	deleted, err := svc.DeleteHistoryBatch(ids)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete history items"})
+		e := service.AsError(err)
+		return c.Status(e.Status()).JSON(fiber.Map{"error": e.Message})
 	}
 
 	return c.JSON(fiber.Map{"deleted": deleted})
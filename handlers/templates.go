@@ -9,7 +9,7 @@ import (
 
 // GetTemplates returns all templates
 func GetTemplates(c *fiber.Ctx) error {
-	templates, err := db.GetAllTemplates()
+	templates, err := store.GetAllTemplates()
 	if err != nil {
 		return c.Status(500).SendString("Failed to fetch templates")
 	}
@@ -31,7 +31,7 @@ func GetTemplate(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	template, err := db.GetTemplateByID(id)
+	template, err := store.GetTemplateByID(id)
 	if err != nil {
 		return c.Status(404).SendString("Template not found")
 	}
@@ -48,21 +48,11 @@ func GetTemplate(c *fiber.Ctx) error {
 
 // CreateTemplate creates a new template
 func CreateTemplate(c *fiber.Ctx) error {
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Name is required")
-	}
-
-	description := c.FormValue("description")
-
-	template, err := db.CreateTemplate(name, description)
+	template, err := svc.CreateTemplate(c.FormValue("name"), c.FormValue("description"))
 	if err != nil {
-		return c.Status(500).SendString("Failed to create template")
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_created", template)
-
 	// Return the new template partial
 	return c.Render("partials/template_item", fiber.Map{
 		"Template": template,
@@ -76,21 +66,11 @@ func UpdateTemplate(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Name is required")
-	}
-
-	description := c.FormValue("description")
-
-	template, err := db.UpdateTemplate(id, name, description)
+	template, err := svc.UpdateTemplate(id, c.FormValue("name"), c.FormValue("description"))
 	if err != nil {
-		return c.Status(500).SendString("Failed to update template")
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_updated", template)
-
 	// Return updated template partial
 	return c.Render("partials/template_item", fiber.Map{
 		"Template": template,
@@ -104,14 +84,10 @@ func DeleteTemplate(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.DeleteTemplate(id)
-	if err != nil {
-		return c.Status(500).SendString("Failed to delete template")
+	if err := svc.DeleteTemplate(id); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_deleted", map[string]int64{"id": id})
-
 	return c.SendString("")
 }
 
@@ -122,21 +98,9 @@ func AddTemplateItem(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid template ID")
 	}
 
-	sectionName := c.FormValue("section_name")
-	if sectionName == "" {
-		return c.Status(400).SendString("Section name is required")
-	}
-
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Item name is required")
-	}
-
-	description := c.FormValue("description")
-
-	item, err := db.AddTemplateItem(templateID, sectionName, name, description)
+	item, err := svc.AddTemplateItem(templateID, c.FormValue("section_name"), c.FormValue("name"), c.FormValue("description"))
 	if err != nil {
-		return c.Status(500).SendString("Failed to add item to template")
+		return serviceError(c, err)
 	}
 
 	// Return the template item partial
@@ -152,21 +116,9 @@ func UpdateTemplateItem(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid item ID")
 	}
 
-	sectionName := c.FormValue("section_name")
-	if sectionName == "" {
-		return c.Status(400).SendString("Section name is required")
-	}
-
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Item name is required")
-	}
-
-	description := c.FormValue("description")
-
-	item, err := db.UpdateTemplateItem(itemID, sectionName, name, description)
+	item, err := svc.UpdateTemplateItem(itemID, c.FormValue("section_name"), c.FormValue("name"), c.FormValue("description"))
 	if err != nil {
-		return c.Status(500).SendString("Failed to update template item")
+		return serviceError(c, err)
 	}
 
 	return c.Render("partials/template_item_row", fiber.Map{
@@ -181,9 +133,8 @@ func DeleteTemplateItem(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid item ID")
 	}
 
-	err = db.DeleteTemplateItem(itemID)
-	if err != nil {
-		return c.Status(500).SendString("Failed to delete template item")
+	if err := svc.DeleteTemplateItem(itemID); err != nil {
+		return serviceError(c, err)
 	}
 
 	return c.SendString("")
@@ -196,22 +147,15 @@ func ApplyTemplate(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid template ID")
 	}
 
-	activeList, err := db.GetActiveList()
-	if err != nil {
-		return c.Status(500).SendString("No active list found")
+	activeList, status, msg := checkActiveListRole(c, db.RoleEditor)
+	if status != 0 {
+		return c.Status(status).SendString(msg)
 	}
 
-	err = db.ApplyTemplateToList(templateID, activeList.ID)
-	if err != nil {
-		return c.Status(500).SendString("Failed to apply template")
+	if err := svc.ApplyTemplate(CurrentUserID(c), templateID, activeList.ID); err != nil {
+		return serviceError(c, err)
 	}
 
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_applied", map[string]interface{}{
-		"template_id": templateID,
-		"list_id":     activeList.ID,
-	})
-
 	// Trigger a full refresh
 	c.Set("HX-Trigger", "refreshList, refresh")
 	return c.SendString("")
@@ -219,26 +163,16 @@ func ApplyTemplate(c *fiber.Ctx) error {
 
 // CreateTemplateFromList creates a template from the active list
 func CreateTemplateFromList(c *fiber.Ctx) error {
-	name := c.FormValue("name")
-	if name == "" {
-		return c.Status(400).SendString("Template name is required")
+	activeList, status, msg := checkActiveListRole(c, db.RoleViewer)
+	if status != 0 {
+		return c.Status(status).SendString(msg)
 	}
 
-	description := c.FormValue("description")
-
-	activeList, err := db.GetActiveList()
+	template, err := svc.CreateTemplateFromList(CurrentUserID(c), activeList.ID, c.FormValue("name"), c.FormValue("description"))
 	if err != nil {
-		return c.Status(500).SendString("No active list found")
+		return serviceError(c, err)
 	}
 
-	template, err := db.CreateTemplateFromList(activeList.ID, name, description)
-	if err != nil {
-		return c.Status(500).SendString("Failed to create template from list")
-	}
-
-	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_created", template)
-
 	// Return the new template partial
 	return c.Render("partials/template_item", fiber.Map{
 		"Template": template,
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"shopping-list/db"
+	"shopping-list/i18n"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TOTP parameters (RFC 6238 defaults understood by all authenticator apps)
+const (
+	totpPeriod      = 30
+	totpDigits      = 6
+	totpSkew        = 1 // accept one step before/after to tolerate clock drift
+	totpSecretBytes = 20
+	totpIssuer      = "Koffan"
+
+	recoveryCodeCount = 10
+
+	// Pending second-step logins
+	TwoFactorCookieName   = "login_challenge"
+	twoFactorChallengeTTL = 5 * time.Minute
+	twoFactorMaxAttempts  = 5
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret returns a random base32 encoded secret
+func generateTOTPSecret() string {
+	bytes := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(bytes); err != nil {
+		log.Fatal("Failed to generate secure random bytes:", err)
+	}
+	return base32NoPadding.EncodeToString(bytes)
+}
+
+// totpCode computes the code for a time step
+func totpCode(secret string, step int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// matchTOTP returns the time step the code belongs to, or 0 if it doesn't match
+func matchTOTP(secret, code string, now time.Time) int64 {
+	code = normalizeCode(code)
+	if len(code) != totpDigits {
+		return 0
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return 0
+}
+
+// verifyTOTP checks a code against the user's secret and consumes its time step,
+// so the same code can't be used twice
+func verifyTOTP(t *db.UserTOTP, code string) bool {
+	step := matchTOTP(t.Secret, code, time.Now())
+	if step == 0 {
+		return false
+	}
+	ok, err := store.UseTOTPStep(t.UserID, step)
+	if err != nil {
+		log.Printf("[2FA] Failed to record code use for user %d: %v", t.UserID, err)
+		return false
+	}
+	return ok
+}
+
+// totpURL builds the otpauth:// URL encoded in the enrolment QR code
+func totpURL(username, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("period", fmt.Sprint(totpPeriod))
+	params.Set("digits", fmt.Sprint(totpDigits))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// normalizeCode strips spaces and dashes users type or paste along with codes
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// generateRecoveryCodes returns plaintext codes (shown once) and their hashes (stored)
+func generateRecoveryCodes() ([]string, []string) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		bytes := make([]byte, 8)
+		for j := range bytes {
+			// rand.Int is uniform, unlike a random byte modulo the alphabet size
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				log.Fatal("Failed to generate secure random bytes:", err)
+			}
+			bytes[j] = alphabet[n.Int64()]
+		}
+		codes[i] = string(bytes[:4]) + "-" + string(bytes[4:])
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code
+func verifySecondFactor(t *db.UserTOTP, code string) bool {
+	if len(normalizeCode(code)) == totpDigits {
+		return verifyTOTP(t, code)
+	}
+
+	ok, err := store.UseRecoveryCode(t.UserID, hashRecoveryCode(code))
+	if err != nil {
+		log.Printf("[2FA] Failed to check recovery code for user %d: %v", t.UserID, err)
+		return false
+	}
+	if ok {
+		log.Printf("[2FA] Recovery code used by user %d (%d left)", t.UserID, store.CountRecoveryCodes(t.UserID))
+	}
+	return ok
+}
+
+// ==================== LOGIN CHALLENGE ====================
+
+// twoFactorChallenge is a password login waiting for its second factor
+type twoFactorChallenge struct {
+	userID    int64
+	expiresAt time.Time
+	attempts  int
+}
+
+var (
+	twoFactorChallenges   = make(map[string]*twoFactorChallenge)
+	twoFactorChallengesMu sync.Mutex
+)
+
+// beginTwoFactor parks a verified password login and sends the user to the code step
+func beginTwoFactor(c *fiber.Ctx, user *db.User) error {
+	token := generateSessionID()
+
+	twoFactorChallengesMu.Lock()
+	now := time.Now()
+	for t, ch := range twoFactorChallenges {
+		if now.After(ch.expiresAt) {
+			delete(twoFactorChallenges, t)
+		}
+	}
+	twoFactorChallenges[token] = &twoFactorChallenge{
+		userID:    user.ID,
+		expiresAt: now.Add(twoFactorChallengeTTL),
+	}
+	twoFactorChallengesMu.Unlock()
+
+	c.Cookie(&fiber.Cookie{
+		Name:     TwoFactorCookieName,
+		Value:    token,
+		Expires:  now.Add(twoFactorChallengeTTL),
+		HTTPOnly: true,
+		Secure:   isSecureConnection(c),
+		SameSite: "Lax",
+		Path:     "/login",
+	})
+	return c.Redirect("/login/2fa")
+}
+
+// pendingTwoFactor returns the challenge for the request's cookie, if still valid
+func pendingTwoFactor(c *fiber.Ctx) (string, *twoFactorChallenge) {
+	token := c.Cookies(TwoFactorCookieName)
+	if token == "" {
+		return "", nil
+	}
+
+	twoFactorChallengesMu.Lock()
+	defer twoFactorChallengesMu.Unlock()
+	ch, ok := twoFactorChallenges[token]
+	if !ok {
+		return "", nil
+	}
+	if time.Now().After(ch.expiresAt) {
+		delete(twoFactorChallenges, token)
+		return "", nil
+	}
+	return token, ch
+}
+
+func endTwoFactor(c *fiber.Ctx, token string) {
+	twoFactorChallengesMu.Lock()
+	delete(twoFactorChallenges, token)
+	twoFactorChallengesMu.Unlock()
+
+	c.Cookie(&fiber.Cookie{
+		Name:     TwoFactorCookieName,
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+		Secure:   isSecureConnection(c),
+		SameSite: "Lax",
+		Path:     "/login",
+	})
+}
+
+// LoginTwoFactorPage renders the code prompt of a pending login
+func LoginTwoFactorPage(c *fiber.Ctx) error {
+	if _, ch := pendingTwoFactor(c); ch == nil {
+		return c.Redirect("/login")
+	}
+	return c.Render("login_2fa", fiber.Map{
+		"Error":        c.Query("error"),
+		"Translations": i18n.GetAllLocales(),
+		"Locales":      i18n.AvailableLocales(),
+		"DefaultLang":  i18n.GetDefaultLang(),
+	}, "")
+}
+
+// LoginTwoFactor checks the authenticator or recovery code and completes the login
+func LoginTwoFactor(c *fiber.Ctx) error {
+	token, ch := pendingTwoFactor(c)
+	if ch == nil {
+		return c.Redirect("/login")
+	}
+	ip := ClientIP(c)
+
+	user, err := store.GetUserByID(ch.userID)
+	if err != nil {
+		endTwoFactor(c, token)
+		return c.Redirect("/login")
+	}
+	totp, err := store.GetUserTOTP(user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(500).SendString("Session creation failed")
+	}
+	if err == sql.ErrNoRows || !totp.Enabled {
+		// 2FA was switched off meanwhile - the password was already verified
+		if loginLimiter != nil {
+			loginLimiter.ResetAttempts(ip)
+		}
+		endTwoFactor(c, token)
+		if err := startSession(c, user); err != nil {
+			return c.Status(500).SendString("Session creation failed")
+		}
+		return c.Redirect("/")
+	}
+
+	if !verifySecondFactor(totp, c.FormValue("code")) {
+		log.Printf("[2FA] Invalid code for %s from %s", user.Username, ip)
+
+		twoFactorChallengesMu.Lock()
+		ch.attempts++
+		exhausted := ch.attempts >= twoFactorMaxAttempts
+		twoFactorChallengesMu.Unlock()
+
+		limited := loginLimiter != nil && loginLimiter.RecordAttempt(ip)
+		if exhausted || limited {
+			// Start over with the password so codes can't be brute-forced
+			endTwoFactor(c, token)
+			if limited {
+				return c.Redirect("/login?error=rate_limited")
+			}
+			return c.Redirect("/login?error=2fa")
+		}
+		return c.Redirect("/login/2fa?error=1")
+	}
+
+	if loginLimiter != nil {
+		loginLimiter.ResetAttempts(ip)
+	}
+	endTwoFactor(c, token)
+
+	if err := startSession(c, user); err != nil {
+		return c.Status(500).SendString("Session creation failed")
+	}
+	return c.Redirect("/")
+}
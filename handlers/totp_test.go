@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"shopping-list/db"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// enableTOTP turns on two-factor authentication for a user and returns the
+// secret and recovery codes
+func (env *testEnv) enableTOTP(user *db.User) (string, []string) {
+	env.t.Helper()
+	secret := generateTOTPSecret()
+	codes, hashes := generateRecoveryCodes()
+	if err := env.store.SaveTOTPSecret(user.ID, secret); err != nil {
+		env.t.Fatal(err)
+	}
+	// The step the enrolment was confirmed with is used up
+	if err := env.store.EnableTOTP(user.ID, time.Now().Unix()/totpPeriod-totpSkew-1, hashes); err != nil {
+		env.t.Fatal(err)
+	}
+	return secret, codes
+}
+
+func currentCode(t *testing.T, secret string, offset int64) string {
+	code, err := totpCode(secret, time.Now().Unix()/totpPeriod+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		if got, err := totpCode(rfcSecret, unix/totpPeriod); err != nil || got != want {
+			t.Errorf("code at %d = %q, %v; want %q", unix, got, err, want)
+		}
+	}
+
+	now := time.Unix(1111111109, 0)
+	tests := []struct {
+		code string
+		step int64
+	}{
+		{"081804", 1111111109 / totpPeriod},
+		{"081 804", 1111111109 / totpPeriod},
+		{"050471", 1111111109/totpPeriod + 1},
+		{"000000", 0},
+		{"08180", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := matchTOTP(rfcSecret, tt.code, now); got != tt.step {
+			t.Errorf("matchTOTP(%q) = %d, want %d", tt.code, got, tt.step)
+		}
+	}
+}
+
+func TestVerifyTOTPReplay(t *testing.T) {
+	env := newTestEnv(t)
+	secret, _ := env.enableTOTP(env.alice)
+	totp := must(env.store.GetUserTOTP(env.alice.ID))
+
+	code := currentCode(t, secret, 0)
+	if !verifyTOTP(totp, code) {
+		t.Fatal("current code was rejected")
+	}
+	if verifyTOTP(totp, code) {
+		t.Error("code was accepted twice")
+	}
+	// Codes of earlier steps are used up along with the current one
+	if verifyTOTP(totp, currentCode(t, secret, -1)) {
+		t.Error("code of an earlier step was accepted after a later one")
+	}
+	if !verifyTOTP(totp, currentCode(t, secret, 1)) {
+		t.Error("code of the next step was rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	env := newTestEnv(t)
+	_, codes := env.enableTOTP(env.alice)
+	totp := must(env.store.GetUserTOTP(env.alice.ID))
+
+	format := regexp.MustCompile(`^[a-hjkmnp-z2-9]{4}-[a-hjkmnp-z2-9]{4}$`)
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if !format.MatchString(code) || seen[code] {
+			t.Errorf("recovery code %q", code)
+		}
+		seen[code] = true
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes", len(codes))
+	}
+
+	// Codes may be typed in capitals and without the dash, but work once
+	typed := strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))
+	if !verifySecondFactor(totp, typed) {
+		t.Fatal("recovery code was rejected")
+	}
+	if verifySecondFactor(totp, codes[0]) {
+		t.Error("recovery code was accepted twice")
+	}
+	if verifySecondFactor(totp, "aaaa-aaaa") {
+		t.Error("made-up recovery code was accepted")
+	}
+	if left := env.store.CountRecoveryCodes(env.alice.ID); left != recoveryCodeCount-1 {
+		t.Errorf("%d recovery codes left", left)
+	}
+}
+
+// loginWithPassword starts a password login and returns the challenge cookie
+func (env *testEnv) loginWithPassword(username, password string) *http.Cookie {
+	env.t.Helper()
+	resp := must(env.web.Test(webRequest("POST", "/login", nil, url.Values{"username": {username}, "password": {password}}), -1))
+	if location := resp.Header.Get("Location"); location != "/login/2fa" {
+		env.t.Fatalf("password login redirected to %q", location)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == TwoFactorCookieName {
+			return cookie
+		}
+	}
+	env.t.Fatal("password login set no challenge cookie")
+	return nil
+}
+
+// sendCode submits a second factor and returns where the login continues
+func (env *testEnv) sendCode(challenge *http.Cookie, code string) (string, *http.Cookie) {
+	env.t.Helper()
+	req := webRequest("POST", "/login/2fa", nil, url.Values{"code": {code}})
+	req.AddCookie(challenge)
+	resp := must(env.web.Test(req, -1))
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == SessionCookieName {
+			return resp.Header.Get("Location"), cookie
+		}
+	}
+	return resp.Header.Get("Location"), nil
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	env := newTestEnv(t)
+	t.Setenv("APP_USERS", "alice:correct horse")
+	if err := env.store.SetUserPasswordHash(env.alice.ID, must(HashPassword("correct horse"))); err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := env.enableTOTP(env.alice)
+
+	// The password alone gives no session
+	challenge := env.loginWithPassword("alice", "correct horse")
+	if sessions := must(env.store.GetSessions(env.alice.ID)); len(sessions) != 0 {
+		t.Fatalf("%d sessions before the second factor", len(sessions))
+	}
+
+	location, cookie := env.sendCode(challenge, currentCode(t, secret, 0))
+	if location != "/" || cookie == nil {
+		t.Fatalf("login with a valid code went to %q", location)
+	}
+	session := must(env.store.GetSession(cookie.Value))
+	if session.UserID != env.alice.ID {
+		t.Errorf("session of user %d", session.UserID)
+	}
+
+	// The challenge ends with the login
+	if location, _ := env.sendCode(challenge, currentCode(t, secret, 1)); location != "/login" {
+		t.Errorf("reused challenge went to %q", location)
+	}
+}
+
+func TestTwoFactorAttemptLimit(t *testing.T) {
+	env := newTestEnv(t)
+	t.Setenv("APP_USERS", "alice:correct horse")
+	if err := env.store.SetUserPasswordHash(env.alice.ID, must(HashPassword("correct horse"))); err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := env.enableTOTP(env.alice)
+
+	challenge := env.loginWithPassword("alice", "correct horse")
+	for i := 1; i < twoFactorMaxAttempts; i++ {
+		if location, _ := env.sendCode(challenge, "000000"); location != "/login/2fa?error=1" {
+			t.Fatalf("wrong code %d went to %q", i, location)
+		}
+	}
+	if location, _ := env.sendCode(challenge, "000000"); location != "/login?error=2fa" {
+		t.Fatalf("wrong code %d went to %q", twoFactorMaxAttempts, location)
+	}
+
+	// After the last attempt even the right code needs the password again
+	if location, cookie := env.sendCode(challenge, currentCode(t, secret, 0)); location != "/login" || cookie != nil {
+		t.Errorf("valid code after the limit went to %q", location)
+	}
+}
@@ -3,17 +3,33 @@ package handlers
 import (
 	"encoding/json"
 	"log"
+	"shopping-list/db"
+	"shopping-list/service"
 	"sync"
 
 	"github.com/gofiber/websocket/v2"
 )
 
-// WebSocket client connections
+// wsClient identifies who opened a WebSocket connection
+type wsClient struct {
+	userID    int64
+	sessionID string // empty for proxy-authenticated or unauthenticated connections
+}
+
+// WebSocket client connections mapped to the user and session that opened them
 var (
-	clients   = make(map[*websocket.Conn]bool)
+	clients   = make(map[*websocket.Conn]wsClient)
 	clientsMu sync.RWMutex
 )
 
+// Audience decides whether a user should receive a broadcast
+type Audience func(userID int64) bool
+
+// Everyone is the audience for updates that are not tied to a single list
+func Everyone(userID int64) bool {
+	return true
+}
+
 // WebSocketMessage represents a message sent to clients
 type WebSocketMessage struct {
 	Type string      `json:"type"`
@@ -22,9 +38,15 @@ type WebSocketMessage struct {
 
 // WebSocketHandler handles WebSocket connections
 func WebSocketHandler(c *websocket.Conn) {
+	client := wsClient{}
+	client.userID, _ = c.Locals(UserIDLocal).(int64)
+	if session, ok := c.Locals(sessionLocal).(*db.Session); ok {
+		client.sessionID = session.ID
+	}
+
 	// Register client
 	clientsMu.Lock()
-	clients[c] = true
+	clients[c] = client
 	clientsMu.Unlock()
 
 	log.Printf("WebSocket client connected. Total clients: %d", len(clients))
@@ -62,6 +84,31 @@ func WebSocketHandler(c *websocket.Conn) {
 
 // BroadcastUpdate sends an update to all connected WebSocket clients
 func BroadcastUpdate(eventType string, data interface{}) {
+	BroadcastTo(Everyone, eventType, data)
+}
+
+// aclAudience returns an audience of users allowed to see a list with the given permissions
+func aclAudience(acl *db.ListACL) Audience {
+	if acl == nil {
+		// Only system connections may receive updates for a list we can't check
+		return func(userID int64) bool { return userID == 0 }
+	}
+	return func(userID int64) bool {
+		return db.RoleAtLeast(acl.Role(userID), db.RoleViewer)
+	}
+}
+
+// BroadcastEvent forwards a service event to the clients allowed to see it
+func BroadcastEvent(e service.Event) {
+	if e.ListID == 0 {
+		BroadcastTo(Everyone, e.Type, e.Data)
+		return
+	}
+	BroadcastTo(aclAudience(e.ACL), e.Type, e.Data)
+}
+
+// BroadcastTo sends an update to connected WebSocket clients in the audience
+func BroadcastTo(audience Audience, eventType string, data interface{}) {
 	message := WebSocketMessage{
 		Type: eventType,
 		Data: data,
@@ -74,12 +121,14 @@ func BroadcastUpdate(eventType string, data interface{}) {
 	}
 
 	clientsMu.RLock()
-	clientCount := len(clients)
-	log.Printf("Broadcasting %s to %d clients", eventType, clientCount)
-
+	clientCount := 0
 	successCount := 0
-	for client := range clients {
-		err := client.WriteMessage(websocket.TextMessage, messageBytes)
+	for conn, client := range clients {
+		if !audience(client.userID) {
+			continue
+		}
+		clientCount++
+		err := conn.WriteMessage(websocket.TextMessage, messageBytes)
 		if err != nil {
 			log.Printf("Failed to send WebSocket message to client: %v", err)
 			// Don't remove client here, let the read loop handle it
@@ -92,6 +141,24 @@ func BroadcastUpdate(eventType string, data interface{}) {
 	log.Printf("Broadcast %s completed: %d/%d clients received", eventType, successCount, clientCount)
 }
 
+// disconnectSessions closes the WebSocket connections opened by revoked sessions,
+// so a removed device stops receiving updates immediately
+func disconnectSessions(sessionIDs ...string) {
+	revoked := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		revoked[id] = true
+	}
+
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+	for conn, client := range clients {
+		if client.sessionID != "" && revoked[client.sessionID] {
+			// The read loop notices the closed connection and unregisters it
+			conn.Close()
+		}
+	}
+}
+
 // WebSocketUpgrade middleware to upgrade HTTP to WebSocket
 func WebSocketUpgrade(c *websocket.Conn) error {
 	return nil
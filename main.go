@@ -5,10 +5,19 @@ import (
 	"html/template"
 	"log"
 	"os"
+	"os/signal"
 	"shopping-list/api"
+	"shopping-list/caldav"
 	"shopping-list/db"
 	"shopping-list/handlers"
 	"shopping-list/i18n"
+	"shopping-list/mqtt"
+	"shopping-list/service"
+	"shopping-list/smtpd"
+	"shopping-list/webhooks"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -17,13 +26,45 @@ import (
 	"github.com/gofiber/websocket/v2"
 )
 
+// shutdownTimeout bounds how long open requests may run after a SIGTERM
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	// Maintenance commands (e.g. reset-password) run instead of the server
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+	serve()
+}
+
+// serve starts the web server; it is the default command
+func serve() {
 	// Initialize database
-	db.Init()
+	store := db.Init()
 	defer db.Close()
+	handlers.SetStore(store)
+
+	// Changes go through the service, which notifies WebSocket clients
+	svc := service.New(store)
+	svc.Subscribe(handlers.BroadcastEvent)
+	svc.Subscribe(webhooks.HandleEvent)
+	handlers.SetService(svc)
+
+	// Write rotating snapshots if BACKUP_DIR is set, ship the WAL if REPLICA_DIR is set
+	db.StartScheduledBackups()
+	db.StartReplication()
+
+	// Deliver queued webhook events in the background
+	webhooks.Start(store)
+
+	// Publish list states and events to MQTT if MQTT_BROKER is set
+	mqtt.Start(svc, store)
+
+	// Receive email to lists if SMTP_LISTEN is set
+	smtpd.Start(svc)
 
 	// Clean expired sessions on startup
-	db.CleanExpiredSessions()
+	store.CleanExpiredSessions()
 
 	// Initialize i18n
 	if err := i18n.Init(); err != nil {
@@ -35,8 +76,24 @@ func main() {
 		i18n.SetDefaultLang(lang)
 	}
 
+	// Store hashed passwords seeded from APP_PASSWORD / APP_USERS
+	handlers.InitPasswords()
+
+	// Initialize client IP detection behind reverse proxies
+	handlers.InitTrustedProxies()
+
 	// Initialize login rate limiter
 	handlers.InitLoginRateLimiter()
+	handlers.InitHookRateLimiter()
+
+	// Initialize OpenID Connect single sign-on (if configured)
+	handlers.InitOIDC()
+
+	// Initialize trusted reverse-proxy header authentication (if configured)
+	handlers.InitProxyAuth()
+
+	// Initialize CSRF protection
+	handlers.InitCSRF()
 
 	// Initialize template engine
 	engine := html.New("./templates", ".html")
@@ -58,6 +115,7 @@ func main() {
 			}
 			return dict
 		},
+		"t": i18n.T,
 		"add": func(a, b int) int {
 			return a + b
 		},
@@ -100,6 +158,12 @@ func main() {
 	app := fiber.New(fiber.Config{
 		Views:       engine,
 		ViewsLayout: "layout",
+		// Makes the CSRF token available to every template
+		PassLocalsToViews: true,
+		// WebDAV methods for CalDAV clients
+		RequestMethods: append(append([]string{}, fiber.DefaultMethods...), caldav.Methods...),
+		// Restored backups and imports are larger than Fiber's 4 MB default
+		BodyLimit: maxUploadSize(),
 	})
 
 	// Middleware
@@ -112,20 +176,41 @@ func main() {
 	// Auth routes (before middleware)
 	app.Get("/login", handlers.LoginPage)
 	app.Post("/login", handlers.LoginRateLimitMiddleware, handlers.Login)
-	app.Post("/logout", handlers.Logout)
+	app.Get("/login/2fa", handlers.LoginTwoFactorPage)
+	app.Post("/login/2fa", handlers.LoginRateLimitMiddleware, handlers.LoginTwoFactor)
+	app.Get("/auth/oidc/login", handlers.OIDCLoginRateLimitMiddleware, handlers.OIDCLogin)
+	app.Get("/auth/oidc/callback", handlers.OIDCCallback)
 
 	// i18n API (before auth middleware - needed for login page)
 	app.Get("/locales", handlers.GetLocales)
 
 	// REST API (before auth middleware - uses token auth)
-	api.Register(app)
+	api.Register(app, store, svc)
+
+	// CalDAV (before auth middleware - uses token auth)
+	caldav.Register(app, store, svc)
+
+	// Inbound add-item hooks (before auth middleware - the token is in the URL)
+	app.Get("/hook/:token/add", handlers.HookAdd)
+	app.Post("/hook/:token/add", handlers.HookAdd)
 
 	// Auth middleware for all other routes
 	app.Use(handlers.AuthMiddleware)
 
+	// CSRF protection for state-changing requests of logged-in users
+	app.Use(handlers.CSRFMiddleware)
+
+	// Logout needs the CSRF token too, so other sites can't end the session
+	app.Post("/logout", handlers.Logout)
+
 	// WebSocket upgrade middleware
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
+			// Cookies are sent with cross-site WebSocket handshakes too
+			if !handlers.CheckOrigin(c) {
+				log.Printf("[CSRF] Rejected WebSocket from origin %s", c.Get(fiber.HeaderOrigin))
+				return c.SendStatus(fiber.StatusForbidden)
+			}
 			c.Locals("allowed", true)
 			return c.Next()
 		}
@@ -157,6 +242,12 @@ func main() {
 	app.Post("/lists/:id/activate", handlers.SetActiveList)
 	app.Post("/lists/:id/move-up", handlers.MoveListUp)
 	app.Post("/lists/:id/move-down", handlers.MoveListDown)
+	app.Get("/lists/:id/export", handlers.ExportListText)
+	app.Post("/lists/:id/import-text", handlers.ImportListText)
+	app.Get("/lists/:id/print", handlers.GetPrintView)
+	app.Get("/lists/:id/pdf", handlers.GetListPDF)
+	app.Get("/lists/:id/permissions", handlers.GetListPermissions)
+	app.Put("/lists/:id/permissions", handlers.UpdateListPermissions)
 
 	// Templates API
 	app.Get("/templates", handlers.GetTemplates)
@@ -181,6 +272,19 @@ func main() {
 	app.Post("/items/:id/move-up", handlers.MoveItemUp)
 	app.Post("/items/:id/move-down", handlers.MoveItemDown)
 
+	// Account security settings
+	app.Get("/settings/security", handlers.GetSecurityPage)
+	app.Get("/settings/2fa", handlers.GetTwoFactorStatus)
+	app.Post("/settings/2fa/setup", handlers.SetupTwoFactor)
+	app.Post("/settings/2fa/enable", handlers.EnableTwoFactor)
+	app.Post("/settings/2fa/disable", handlers.DisableTwoFactor)
+	app.Post("/settings/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+	app.Post("/settings/password", handlers.ChangePassword)
+	app.Get("/settings/sessions", handlers.GetSessions)
+	app.Post("/settings/sessions/revoke-others", handlers.RevokeOtherSessions)
+	app.Put("/settings/sessions/:id", handlers.RenameSession)
+	app.Delete("/settings/sessions/:id", handlers.RevokeSession)
+
 	// Stats API
 	app.Get("/stats", handlers.GetStats)
 
@@ -203,6 +307,31 @@ func main() {
 		port = "3000"
 	}
 
+	// On SIGINT or SIGTERM, finish open requests and return, so the deferred
+	// db.Close stops the replicator after it ships the last WAL frames
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		log.Println("Shutting down...")
+		if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			log.Printf("Shutdown: %v", err)
+		}
+	}()
+
 	log.Printf("Starting server on port %s", port)
-	log.Fatal(app.Listen(":" + port))
+	if err := app.Listen(":" + port); err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+	log.Println("Server stopped")
+}
+
+// maxUploadSize is the largest request body accepted, MAX_UPLOAD_MB megabytes
+func maxUploadSize() int {
+	mb, err := strconv.Atoi(os.Getenv("MAX_UPLOAD_MB"))
+	if err != nil || mb <= 0 {
+		mb = 64
+	}
+	return mb << 20
 }
@@ -0,0 +1,301 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Packet types of MQTT 3.1.1, shifted into the first header byte
+const (
+	packetConnect    = 1 << 4
+	packetConnack    = 2 << 4
+	packetPublish    = 3 << 4
+	packetPuback     = 4 << 4
+	packetSubscribe  = 8<<4 | 2
+	packetSuback     = 9 << 4
+	packetPingreq    = 12 << 4
+	packetPingresp   = 13 << 4
+	packetDisconnect = 14 << 4
+)
+
+// maxPacketSize bounds packets read from the broker
+const maxPacketSize = 256 << 10
+
+// will is the message the broker publishes if the connection is lost
+type will struct {
+	topic   string
+	payload []byte
+}
+
+// message is a PUBLISH received from the broker
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// client is a minimal MQTT 3.1.1 client: it publishes at QoS 0, subscribes at
+// QoS 1 and keeps the connection alive. It does not reconnect by itself.
+type client struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	keepAlive time.Duration
+
+	mu     sync.Mutex // serializes writes
+	nextID uint16
+}
+
+// dial connects and sends CONNECT with a clean session. The broker URL is
+// tcp://, mqtt://, ssl://, tls:// or mqtts://host[:port].
+func dial(broker, clientID, username, password string, keepAlive time.Duration, lastWill *will) (*client, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid broker URL %q", broker)
+	}
+	host := u.Host
+	secure := false
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		secure = true
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(u.Hostname(), "8883")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &client{conn: conn, r: bufio.NewReader(conn), keepAlive: keepAlive}
+	if err := c.connect(clientID, username, password, lastWill); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *client) connect(clientID, username, password string, lastWill *will) error {
+	flags := byte(0x02) // clean session
+	payload := appendString(nil, clientID)
+	if lastWill != nil {
+		flags |= 0x04 | 0x20 // retained will at QoS 0
+		payload = appendString(payload, lastWill.topic)
+		payload = appendBytes(payload, lastWill.payload)
+	}
+	if username != "" {
+		flags |= 0x80
+		payload = appendString(payload, username)
+		if password != "" {
+			flags |= 0x40
+			payload = appendString(payload, password)
+		}
+	}
+
+	header := appendString(nil, "MQTT")
+	header = append(header, 4, flags)
+	header = binary.BigEndian.AppendUint16(header, uint16(c.keepAlive/time.Second))
+	if err := c.write(packetConnect, append(header, payload...)); err != nil {
+		return err
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	kind, body, err := c.read()
+	c.conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+	if kind != packetConnack || len(body) != 2 {
+		return errors.New("broker did not acknowledge the connection")
+	}
+	if code := body[1]; code != 0 {
+		return fmt.Errorf("broker refused the connection: %s", connackError(code))
+	}
+	return nil
+}
+
+// publish sends a message at QoS 0
+func (c *client) publish(topic string, payload []byte, retain bool) error {
+	first := byte(packetPublish)
+	if retain {
+		first |= 0x01
+	}
+	return c.write(first, append(appendString(nil, topic), payload...))
+}
+
+// subscribe asks for the messages of a topic filter at QoS 1. The SUBACK
+// arrives through receive.
+func (c *client) subscribe(filter string) error {
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	c.mu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	return c.write(packetSubscribe, append(body, 1))
+}
+
+func (c *client) ping() error {
+	return c.write(packetPingreq, nil)
+}
+
+// close says goodbye to the broker, so it doesn't send the will, and closes
+// the connection
+func (c *client) close() {
+	c.write(packetDisconnect, nil)
+	c.conn.Close()
+}
+
+// receive reads packets until a PUBLISH arrives, acknowledging QoS 1
+// messages. It fails when nothing, not even a PINGRESP, comes for one and a
+// half keep-alive periods.
+func (c *client) receive() (*message, error) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		kind, body, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		switch kind & 0xF0 {
+		case packetPublish:
+			qos := (kind >> 1) & 0x03
+			topic, rest, ok := readString(body)
+			if !ok {
+				return nil, errors.New("malformed PUBLISH")
+			}
+			if qos > 0 {
+				if len(rest) < 2 {
+					return nil, errors.New("malformed PUBLISH")
+				}
+				// QoS 2 is not requested, so the broker only sends 0 or 1
+				if err := c.write(packetPuback, rest[:2]); err != nil {
+					return nil, err
+				}
+				rest = rest[2:]
+			}
+			return &message{topic: topic, payload: rest}, nil
+		case packetSuback:
+			if len(body) >= 3 && body[2] == 0x80 {
+				return nil, errors.New("broker refused the subscription")
+			}
+		case packetPingresp, packetPuback:
+		default:
+			return nil, fmt.Errorf("unexpected packet type %d", kind>>4)
+		}
+	}
+}
+
+// write sends one packet
+func (c *client) write(first byte, body []byte) error {
+	packet := []byte{first}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// read returns the first header byte and the rest of one packet
+func (c *client) read() (byte, []byte, error) {
+	first, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("malformed packet length")
+		}
+	}
+	if length > maxPacketSize {
+		return 0, nil, fmt.Errorf("packet of %d bytes is too large", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return first, body, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+func readString(b []byte) (string, []byte, bool) {
+	if len(b) < 2 {
+		return "", nil, false
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, false
+	}
+	return string(b[2 : 2+n]), b[2+n:], true
+}
+
+func connackError(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client ID rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
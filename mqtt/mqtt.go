@@ -0,0 +1,286 @@
+// Package mqtt connects Koffan to an MQTT broker for home automation. It
+// publishes the stats of every list as a retained state message and each
+// change as an event, and takes commands to add and check off items.
+//
+// Topics, below MQTT_TOPIC_PREFIX ("koffan" by default):
+//
+//	koffan/status          "online", or "offline" once the connection is lost (retained)
+//	koffan/<list>/state    list name and item counts (retained)
+//	koffan/<list>/events   every change to the list
+//	koffan/<list>/command  commands Koffan listens to
+//	koffan/<list>/result   the outcome of each command
+package mqtt
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"shopping-list/db"
+	"shopping-list/service"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// keepAlive is how often the connection is checked
+	keepAlive = 60 * time.Second
+	// Delays before reconnecting, doubling after each failure
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+	// queueSize is how many events wait while the broker is slow or away;
+	// more are dropped, but the states are published again on reconnect
+	queueSize = 256
+)
+
+// State is the retained message of a list
+type State struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Icon   string `json:"icon"`
+	Active bool   `json:"active"`
+	db.Stats
+	OpenItems int `json:"open_items"`
+}
+
+// Event is the message sent for each change
+type Event struct {
+	Event     string      `json:"event"`
+	ListID    int64       `json:"list_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+type config struct {
+	broker   string
+	clientID string
+	username string
+	password string
+	prefix   string
+	readOnly bool
+}
+
+var (
+	cfg    config
+	svc    *service.Service
+	store  db.ListStore
+	events = make(chan service.Event, queueSize)
+)
+
+// Start connects to the broker in MQTT_BROKER, if set, and keeps publishing
+// changes made through s in the background, reconnecting when needed
+func Start(s *service.Service, lists db.ListStore) {
+	cfg = config{
+		broker:   os.Getenv("MQTT_BROKER"),
+		clientID: os.Getenv("MQTT_CLIENT_ID"),
+		username: os.Getenv("MQTT_USERNAME"),
+		password: os.Getenv("MQTT_PASSWORD"),
+		prefix:   strings.Trim(os.Getenv("MQTT_TOPIC_PREFIX"), "/"),
+		readOnly: os.Getenv("MQTT_READ_ONLY") == "true",
+	}
+	if cfg.broker == "" {
+		return
+	}
+	if cfg.clientID == "" {
+		cfg.clientID = "koffan"
+	}
+	if cfg.prefix == "" {
+		cfg.prefix = "koffan"
+	}
+	if strings.ContainsAny(cfg.prefix, "+#") {
+		log.Printf("MQTT: MQTT_TOPIC_PREFIX may not contain wildcards, not connecting")
+		return
+	}
+
+	svc = s
+	store = lists
+	svc.Subscribe(handleEvent)
+	go run()
+}
+
+// handleEvent queues an event for publishing. It is a service subscriber and
+// never blocks.
+func handleEvent(e service.Event) {
+	select {
+	case events <- e:
+	default:
+	}
+}
+
+// run keeps a connection to the broker open
+func run() {
+	delay := minRetryDelay
+	for {
+		c, err := dial(cfg.broker, cfg.clientID, cfg.username, cfg.password, keepAlive,
+			&will{topic: cfg.prefix + "/status", payload: []byte("offline")})
+		if err != nil {
+			log.Printf("MQTT: failed to connect to %s: %v", cfg.broker, err)
+			time.Sleep(delay)
+			delay = min(delay*2, maxRetryDelay)
+			continue
+		}
+		log.Printf("MQTT: connected to %s", cfg.broker)
+		delay = minRetryDelay
+
+		err = serve(c)
+		c.close()
+		log.Printf("MQTT: connection to %s lost: %v", cfg.broker, err)
+		time.Sleep(delay)
+	}
+}
+
+// serve publishes on a connection until it fails. Commands are handled as
+// they arrive; the events they cause come back through the queue.
+func serve(c *client) error {
+	if !cfg.readOnly {
+		if err := c.subscribe(cfg.prefix + "/+/command"); err != nil {
+			return err
+		}
+	}
+	if err := c.publish(cfg.prefix+"/status", []byte("online"), true); err != nil {
+		return err
+	}
+	if err := publishStates(c); err != nil {
+		return err
+	}
+
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			m, err := c.receive()
+			if err != nil {
+				failed <- err
+				return
+			}
+			handleCommand(c, m)
+		}
+	}()
+
+	ping := time.NewTicker(keepAlive / 2)
+	defer ping.Stop()
+	for {
+		select {
+		case e := <-events:
+			if err := publishEvent(c, e); err != nil {
+				return err
+			}
+		case <-ping.C:
+			if err := c.ping(); err != nil {
+				return err
+			}
+		case err := <-failed:
+			return err
+		}
+	}
+}
+
+// publishEvent sends an event and the state of the list it changed. Events
+// without a list, like imports, and switching lists update every state.
+func publishEvent(c *client, e service.Event) error {
+	topic := cfg.prefix + "/events"
+	if e.ListID != 0 {
+		topic = listTopic(e.ListID, "events")
+	}
+	if err := publishJSON(c, topic, Event{Event: e.Type, ListID: e.ListID, Timestamp: time.Now().UTC(), Data: e.Data}, false); err != nil {
+		return err
+	}
+
+	switch {
+	case e.Type == service.EventListDeleted:
+		// An empty retained message removes the state from the broker
+		return c.publish(listTopic(e.ListID, "state"), nil, true)
+	case e.ListID == 0 || e.Type == service.EventListActivated:
+		return publishStates(c)
+	}
+	list, err := store.GetListByID(e.ListID)
+	if err != nil {
+		// Deleted meanwhile
+		return nil
+	}
+	return publishJSON(c, listTopic(list.ID, "state"), listState(*list), true)
+}
+
+// publishStates sends the state of every list
+func publishStates(c *client) error {
+	lists, err := store.GetAllLists(0)
+	if err != nil {
+		log.Printf("MQTT: failed to load lists: %v", err)
+		return nil
+	}
+	for _, list := range lists {
+		if err := publishJSON(c, listTopic(list.ID, "state"), listState(list), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleCommand runs a command sent to <list>/command with full access and
+// publishes the outcome to <list>/result. The payload is a service.ListCommand
+// as JSON, or plain text to add.
+func handleCommand(c *client, m *message) {
+	rest, ok := strings.CutPrefix(m.topic, cfg.prefix+"/")
+	if !ok {
+		return
+	}
+	id, ok := strings.CutSuffix(rest, "/command")
+	if !ok {
+		return
+	}
+	listID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return
+	}
+
+	payload := strings.TrimSpace(string(m.payload))
+	var cmd service.ListCommand
+	if strings.HasPrefix(payload, "{") {
+		if err := json.Unmarshal([]byte(payload), &cmd); err != nil {
+			publishResult(c, listID, nil, &service.Error{Kind: service.KindInvalid, Code: "invalid_json", Message: "Invalid JSON"})
+			return
+		}
+	} else {
+		cmd = service.ListCommand{Action: service.CommandAdd, Text: payload}
+	}
+
+	result, err := svc.RunListCommand(0, listID, cmd)
+	publishResult(c, listID, result, err)
+}
+
+func publishResult(c *client, listID int64, result *service.CommandResult, err error) {
+	reply := map[string]interface{}{"ok": err == nil}
+	if err != nil {
+		e := service.AsError(err)
+		reply["error"] = e.Code
+		reply["message"] = e.Message
+		log.Printf("MQTT: command for list %d failed: %s", listID, e.Message)
+	} else {
+		reply["result"] = result
+	}
+	// A failed publish also breaks the connection, which serve notices
+	publishJSON(c, listTopic(listID, "result"), reply, false)
+}
+
+func publishJSON(c *client, topic string, v interface{}, retain bool) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("MQTT: failed to encode message for %s: %v", topic, err)
+		return nil
+	}
+	return c.publish(topic, payload, retain)
+}
+
+func listTopic(listID int64, name string) string {
+	return cfg.prefix + "/" + strconv.FormatInt(listID, 10) + "/" + name
+}
+
+func listState(list db.List) State {
+	return State{
+		ID:        list.ID,
+		Name:      list.Name,
+		Icon:      list.Icon,
+		Active:    list.IsActive,
+		Stats:     list.Stats,
+		OpenItems: list.Stats.TotalItems - list.Stats.CompletedItems,
+	}
+}
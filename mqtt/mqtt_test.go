@@ -0,0 +1,326 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"shopping-list/db"
+	"shopping-list/service"
+	"testing"
+	"time"
+)
+
+// fakeBroker accepts MQTT connections on a loopback port. Its side of each
+// connection reuses the client's packet reader and writer.
+type fakeBroker struct {
+	t     *testing.T
+	ln    net.Listener
+	conns chan net.Conn
+}
+
+// brokerConn is a connection the broker has accepted
+type brokerConn struct {
+	*client
+	t       *testing.T
+	connect connectPacket
+	// seen keeps messages read while waiting for other topics
+	seen map[string]published
+}
+
+// connectPacket holds the fields of a CONNECT
+type connectPacket struct {
+	clientID, username, password string
+	willTopic, willPayload       string
+	willRetained                 bool
+	keepAlive                    uint16
+}
+
+// published is a PUBLISH the broker received
+type published struct {
+	payload []byte
+	retain  bool
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{t: t, ln: ln, conns: make(chan net.Conn, 1)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.conns <- conn
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+// accept waits for a client, reads its CONNECT and accepts it
+func (b *fakeBroker) accept() *brokerConn {
+	b.t.Helper()
+	var conn net.Conn
+	select {
+	case conn = <-b.conns:
+	case <-time.After(5 * time.Second):
+		b.t.Fatal("no client connected")
+	}
+	b.t.Cleanup(func() { conn.Close() })
+
+	bc := &brokerConn{client: &client{conn: conn, r: bufio.NewReader(conn)}, t: b.t, seen: make(map[string]published)}
+	kind, body := bc.read()
+	if kind != packetConnect {
+		b.t.Fatalf("first packet is type %d, want CONNECT", kind>>4)
+	}
+	bc.connect = parseConnect(b.t, body)
+	if err := bc.write(packetConnack, []byte{0, 0}); err != nil {
+		b.t.Fatal(err)
+	}
+	return bc
+}
+
+func parseConnect(t *testing.T, body []byte) connectPacket {
+	t.Helper()
+	protocol, rest, ok := readString(body)
+	if !ok || protocol != "MQTT" || len(rest) < 4 || rest[0] != 4 {
+		t.Fatalf("CONNECT is not MQTT 3.1.1: %q", body)
+	}
+	flags := rest[1]
+	p := connectPacket{keepAlive: binary.BigEndian.Uint16(rest[2:4]), willRetained: flags&0x20 != 0}
+	rest = rest[4:]
+
+	next := func() string {
+		s, r, ok := readString(rest)
+		if !ok {
+			t.Fatalf("malformed CONNECT payload: %q", body)
+		}
+		rest = r
+		return s
+	}
+	p.clientID = next()
+	if flags&0x04 != 0 {
+		p.willTopic, p.willPayload = next(), next()
+	}
+	if flags&0x80 != 0 {
+		p.username = next()
+	}
+	if flags&0x40 != 0 {
+		p.password = next()
+	}
+	return p
+}
+
+// read returns the next packet, failing the test if none comes soon
+func (bc *brokerConn) read() (byte, []byte) {
+	bc.t.Helper()
+	bc.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	kind, body, err := bc.client.read()
+	if err != nil {
+		bc.t.Fatalf("reading from the client: %v", err)
+	}
+	return kind, body
+}
+
+// expectSubscribe reads a SUBSCRIBE, acknowledges it and returns its filter
+func (bc *brokerConn) expectSubscribe() string {
+	bc.t.Helper()
+	kind, body := bc.read()
+	if kind != packetSubscribe {
+		bc.t.Fatalf("got packet type %d, want SUBSCRIBE", kind>>4)
+	}
+	filter, rest, ok := readString(body[2:])
+	if !ok || len(rest) != 1 || rest[0] != 1 {
+		bc.t.Fatalf("malformed SUBSCRIBE: %q", body)
+	}
+	if err := bc.write(packetSuback, append(body[:2:2], 1)); err != nil {
+		bc.t.Fatal(err)
+	}
+	return filter
+}
+
+// expect reads messages until one arrived on each topic and returns them.
+// Messages on other topics are kept for later calls.
+func (bc *brokerConn) expect(topics ...string) map[string]published {
+	bc.t.Helper()
+	got := make(map[string]published)
+	for _, topic := range topics {
+		for {
+			if m, ok := bc.seen[topic]; ok {
+				delete(bc.seen, topic)
+				got[topic] = m
+				break
+			}
+			kind, body := bc.read()
+			if kind&0xF0 != packetPublish {
+				continue
+			}
+			t, payload, ok := readString(body)
+			if !ok {
+				bc.t.Fatalf("malformed PUBLISH: %q", body)
+			}
+			bc.seen[t] = published{payload: payload, retain: kind&0x01 != 0}
+		}
+	}
+	return got
+}
+
+// send publishes a message to the client at QoS 1
+func (bc *brokerConn) send(topic, payload string, id uint16) {
+	bc.t.Helper()
+	body := appendString(nil, topic)
+	body = binary.BigEndian.AppendUint16(body, id)
+	if err := bc.write(packetPublish|0x02, append(body, payload...)); err != nil {
+		bc.t.Fatal(err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	broker := newFakeBroker(t)
+	dialed := make(chan *client, 1)
+	go func() {
+		c, err := dial(broker.url(), "koffan-test", "user", "secret", time.Minute, &will{topic: "koffan/status", payload: []byte("offline")})
+		if err != nil {
+			t.Error(err)
+		}
+		dialed <- c
+	}()
+
+	bc := broker.accept()
+	c := <-dialed
+	if c == nil {
+		t.FailNow()
+	}
+	defer c.close()
+
+	want := connectPacket{
+		clientID: "koffan-test", username: "user", password: "secret",
+		willTopic: "koffan/status", willPayload: "offline", willRetained: true, keepAlive: 60,
+	}
+	if bc.connect != want {
+		t.Errorf("CONNECT = %+v, want %+v", bc.connect, want)
+	}
+
+	if err := c.subscribe("koffan/+/command"); err != nil {
+		t.Fatal(err)
+	}
+	if filter := bc.expectSubscribe(); filter != "koffan/+/command" {
+		t.Errorf("subscribed to %q", filter)
+	}
+
+	// QoS 1 messages come out of receive and are acknowledged
+	bc.send("koffan/1/command", "Milk", 7)
+	m, err := c.receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.topic != "koffan/1/command" || string(m.payload) != "Milk" {
+		t.Errorf("received %q on %q", m.payload, m.topic)
+	}
+	if kind, body := bc.read(); kind != packetPuback || binary.BigEndian.Uint16(body) != 7 {
+		t.Errorf("got packet type %d %v, want PUBACK of 7", kind>>4, body)
+	}
+
+	if err := c.publish("koffan/1/state", []byte(`{}`), true); err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.expect("koffan/1/state")["koffan/1/state"]; !got.retain || string(got.payload) != `{}` {
+		t.Errorf("published %+v", got)
+	}
+}
+
+func TestServe(t *testing.T) {
+	s := db.NewMemoryStore()
+	list := must(s.CreateList("Groceries", "", 0))
+	if err := s.SetActiveList(0, list.ID); err != nil {
+		t.Fatal(err)
+	}
+	cfg = config{clientID: "koffan", prefix: "koffan"}
+	store = s
+	svc = service.New(s)
+	svc.Subscribe(handleEvent)
+
+	broker := newFakeBroker(t)
+	served := make(chan error, 1)
+	go func() {
+		c, err := dial(broker.url(), cfg.clientID, "", "", time.Minute, nil)
+		if err != nil {
+			served <- err
+			return
+		}
+		defer c.close()
+		served <- serve(c)
+	}()
+	bc := broker.accept()
+
+	if filter := bc.expectSubscribe(); filter != "koffan/+/command" {
+		t.Errorf("subscribed to %q", filter)
+	}
+	got := bc.expect("koffan/status", "koffan/1/state")
+	if m := got["koffan/status"]; !m.retain || string(m.payload) != "online" {
+		t.Errorf("status = %+v", m)
+	}
+	var state State
+	if m := got["koffan/1/state"]; !m.retain || json.Unmarshal(m.payload, &state) != nil || state.Name != "Groceries" || !state.Active {
+		t.Errorf("state = %s", m.payload)
+	}
+
+	// A plain text command adds items; the event and new state follow
+	bc.send("koffan/1/command", "Milk, Bread", 1)
+	got = bc.expect("koffan/1/result", "koffan/1/events", "koffan/1/state")
+	var result struct {
+		OK     bool                  `json:"ok"`
+		Result service.CommandResult `json:"result"`
+	}
+	if err := json.Unmarshal(got["koffan/1/result"].payload, &result); err != nil || !result.OK || result.Result.Added == nil || len(result.Result.Added.Added) != 2 {
+		t.Errorf("result = %s", got["koffan/1/result"].payload)
+	}
+	var event Event
+	if err := json.Unmarshal(got["koffan/1/events"].payload, &event); err != nil || event.Event != service.EventBatchCreated || event.ListID != list.ID {
+		t.Errorf("event = %s", got["koffan/1/events"].payload)
+	}
+	if err := json.Unmarshal(got["koffan/1/state"].payload, &state); err != nil || state.TotalItems != 2 || state.OpenItems != 2 {
+		t.Errorf("state after adding = %s", got["koffan/1/state"].payload)
+	}
+
+	// Failures are reported on the result topic
+	bc.send("koffan/1/command", `{"action":`, 2)
+	var failure struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if m := bc.expect("koffan/1/result")["koffan/1/result"]; json.Unmarshal(m.payload, &failure) != nil || failure.OK || failure.Error != "invalid_json" {
+		t.Errorf("result of invalid JSON = %s", m.payload)
+	}
+	bc.send("koffan/99/command", "Milk", 3)
+	if m := bc.expect("koffan/99/result")["koffan/99/result"]; json.Unmarshal(m.payload, &failure) != nil || failure.OK || failure.Error != "not_found" {
+		t.Errorf("result for a missing list = %s", m.payload)
+	}
+
+	// Losing the broker ends serve
+	bc.conn.Close()
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Error("serve returned without an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("serve kept running after the connection closed")
+	}
+}
+
+// must returns v, failing the test by panicking if err is set
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
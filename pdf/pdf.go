@@ -0,0 +1,199 @@
+// Package pdf writes simple PDF documents: text in the standard Helvetica
+// fonts, lines and rectangles. Besides Western European letters, the fonts
+// are given Cyrillic and Central European code pages. It has no dependencies,
+// so printable lists need no font files or external tools.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Page sizes in points (1/72 inch)
+var (
+	A4     = Size{595.28, 841.89}
+	Letter = Size{612, 792}
+)
+
+// Size is a page width and height in points
+type Size struct {
+	Width, Height float64
+}
+
+// Document is a PDF being drawn page by page. Coordinates are in points
+// from the top-left corner of the page.
+type Document struct {
+	size  Size
+	title string
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+}
+
+// New creates an empty document with pages of the given size
+func New(size Size, title string) *Document {
+	return &Document{size: size, title: title}
+}
+
+// Size returns the page size
+func (d *Document) Size() Size {
+	return d.size
+}
+
+// AddPage starts a new page; drawing goes to it from now on
+func (d *Document) AddPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+}
+
+// Text draws a line of text with its baseline at y
+func (d *Document) Text(x, y, size float64, bold bool, gray float64, text string) {
+	fmt.Fprintf(d.page, "BT %s g %s %s Td", num(gray), num(x), num(d.size.Height-y))
+	for _, r := range encode(text) {
+		// F1 and F2 are regular and bold, F3 and F4 their Cyrillic versions
+		// and F5 and F6 the Central European ones
+		font := 1 + 2*r.font
+		if bold {
+			font++
+		}
+		fmt.Fprintf(d.page, " /F%d %s Tf (%s) Tj", font, num(size), escape(r.text))
+	}
+	d.page.WriteString(" ET\n")
+}
+
+// Line draws a straight line
+func (d *Document) Line(x1, y1, x2, y2, width, gray float64) {
+	fmt.Fprintf(d.page, "%s G %s w %s %s m %s %s l S\n", num(gray), num(width),
+		num(x1), num(d.size.Height-y1), num(x2), num(d.size.Height-y2))
+}
+
+// Rect draws the outline of a rectangle whose top-left corner is at x, y
+func (d *Document) Rect(x, y, w, h, width, gray float64) {
+	fmt.Fprintf(d.page, "%s G %s w %s %s %s %s re S\n", num(gray), num(width),
+		num(x), num(d.size.Height-y-h), num(w), num(h))
+}
+
+// WriteTo writes the finished document
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1 to 4 are the catalog, the page tree, the fonts and the
+	// document info; each page is followed by its content stream
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := &bytes.Buffer{}
+	for i := range d.pages {
+		fmt.Fprintf(kids, "%d 0 R ", 5+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Count %d /Kids [%s] /MediaBox [0 0 %s %s] >>",
+		len(d.pages), kids.String(), num(d.size.Width), num(d.size.Height)))
+	fonts := &bytes.Buffer{}
+	for font, letters := range fontLetters {
+		encoding := "/WinAnsiEncoding"
+		if letters != nil {
+			encoding = encodingWith(letters)
+		}
+		for i, base := range []string{"Helvetica", "Helvetica-Bold"} {
+			fmt.Fprintf(fonts, " /F%d << /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding %s >>", 1+2*font+i, base, encoding)
+		}
+	}
+	object("<<" + fonts.String() + " >>")
+	object("<< /Title " + textString(d.title) + " /Producer (Koffan) >>")
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font 3 0 R >> /Contents %d 0 R >>", 6+2*i))
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(page.Bytes())
+		zw.Close()
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(offsets), compressed.Len())
+		out.Write(compressed.Bytes())
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+// encodingWith returns the encoding of a font with letters in place of
+// WinAnsiEncoding, named by glyphNames or their Unicode code point
+func encodingWith(letters map[byte]letter) string {
+	codes := make([]int, 0, len(letters))
+	for code := range letters {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+
+	var b bytes.Buffer
+	b.WriteString("<< /Type /Encoding /BaseEncoding /WinAnsiEncoding /Differences [")
+	for i, code := range codes {
+		if i == 0 || code != codes[i-1]+1 {
+			fmt.Fprintf(&b, " %d", code)
+		}
+		r := letters[byte(code)].r
+		if name, ok := glyphNames[r]; ok {
+			b.WriteString(" /" + name)
+		} else {
+			fmt.Fprintf(&b, " /uni%04X", r)
+		}
+	}
+	b.WriteString(" ] >>")
+	return b.String()
+}
+
+// textString encodes text outside of pages, such as the title, as UTF-16
+func textString(text string) string {
+	var b bytes.Buffer
+	b.WriteString("<FEFF")
+	for _, c := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&b, "%04X", c)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// escape encodes a run of text for a PDF string literal. Control codes are
+// written in octal, as readers would turn a carriage return into a line feed.
+func escape(text []byte) string {
+	var b bytes.Buffer
+	for _, c := range text {
+		switch {
+		case c < 0x20:
+			fmt.Fprintf(&b, "\\%03o", c)
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// num formats a number with at most two decimals
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,195 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parsedPDF is what readPDF found in a document
+type parsedPDF struct {
+	objects  map[int]string
+	contents []string
+}
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+	streamPattern    = regexp.MustCompile(`(?s)^<< /Length (\d+) /Filter /FlateDecode >>\nstream\n`)
+)
+
+// readPDF checks the structure of a document the way a reader finds its
+// objects: through startxref and the cross-reference table. It returns the
+// objects and the uncompressed content streams.
+func readPDF(t *testing.T, data []byte) *parsedPDF {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) {
+		t.Fatal("no PDF header")
+	}
+	m := startxrefPattern.FindSubmatch(data)
+	if m == nil {
+		t.Fatal("no startxref at the end")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if xref >= len(data) || !bytes.HasPrefix(data[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d doesn't point to the xref table", xref)
+	}
+
+	lines := strings.Split(string(data[xref:]), "\n")
+	var count int
+	if _, err := fmt.Sscanf(lines[1], "0 %d", &count); err != nil {
+		t.Fatalf("xref header %q: %v", lines[1], err)
+	}
+	if !strings.Contains(string(data[xref:]), fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>", count)) {
+		t.Error("the trailer doesn't match the xref table")
+	}
+
+	doc := &parsedPDF{objects: make(map[int]string)}
+	for i := 1; i < count; i++ {
+		entry := lines[2+i]
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Fatalf("xref entry %d is %q", i, entry)
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		header := fmt.Sprintf("%d 0 obj\n", i)
+		if !bytes.HasPrefix(data[offset:], []byte(header)) {
+			t.Fatalf("object %d isn't at offset %d", i, offset)
+		}
+		body := data[offset+len(header):]
+
+		if sm := streamPattern.FindSubmatch(body); sm != nil {
+			length, _ := strconv.Atoi(string(sm[1]))
+			stream := body[len(sm[0]):]
+			if !bytes.HasPrefix(stream[length:], []byte("\nendstream\nendobj\n")) {
+				t.Fatalf("the stream of object %d isn't %d bytes long", i, length)
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(stream[:length]))
+			if err != nil {
+				t.Fatalf("stream of object %d: %v", i, err)
+			}
+			content, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("stream of object %d: %v", i, err)
+			}
+			doc.contents = append(doc.contents, string(content))
+			continue
+		}
+		end := bytes.Index(body, []byte("\nendobj\n"))
+		if end < 0 {
+			t.Fatalf("object %d doesn't end", i)
+		}
+		doc.objects[i] = string(body[:end])
+	}
+	return doc
+}
+
+// differences returns the glyph name of each code in the encoding of a font
+func differences(t *testing.T, fonts, font string) map[int]string {
+	t.Helper()
+	start := strings.Index(fonts, "/"+font+" << ")
+	if start < 0 {
+		t.Fatalf("font %s is missing", font)
+	}
+	rest := fonts[start:]
+	open := strings.Index(rest, "/Differences [")
+	if open < 0 || open > strings.Index(rest, ">>") {
+		return nil
+	}
+	rest = rest[open+len("/Differences ["):]
+	names := make(map[int]string)
+	code := 0
+	for _, token := range strings.Fields(rest[:strings.Index(rest, "]")]) {
+		if n, err := strconv.Atoi(token); err == nil {
+			code = n
+			continue
+		}
+		names[code] = strings.TrimPrefix(token, "/")
+		code++
+	}
+	return names
+}
+
+func TestWriteTo(t *testing.T) {
+	doc := New(A4, "Zakupy – Łódź")
+	doc.AddPage()
+	doc.Text(40, 60, 18, true, 0, "Żółć (bold)")
+	doc.Text(40, 90, 12, false, 0.3, "Ąžuolas ėjo")
+	doc.Line(40, 100, 200, 100, 0.5, 0.8)
+	doc.AddPage()
+	doc.Text(40, 60, 12, false, 0, "Молоко")
+	doc.Rect(40, 70, 10, 10, 0.5, 0)
+
+	var buf bytes.Buffer
+	n, err := doc.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo = %d, %v", n, err)
+	}
+	parsed := readPDF(t, buf.Bytes())
+
+	if !strings.Contains(parsed.objects[2], "/Count 2") {
+		t.Errorf("page tree = %s", parsed.objects[2])
+	}
+	if want := "/Title " + textString("Zakupy – Łódź"); !strings.Contains(parsed.objects[4], want) {
+		t.Errorf("document info = %s", parsed.objects[4])
+	}
+	if len(parsed.contents) != 2 {
+		t.Fatalf("%d content streams, want 2", len(parsed.contents))
+	}
+
+	want := []string{
+		"BT 0 g 40 781.89 Td /F6 18 Tf (\xaf\xf3\xb3\xe6 \\(bold\\)) Tj ET",
+		"BT 0.3 g 40 751.89 Td /F5 12 Tf (\xa5\x9euolas \\006jo) Tj ET",
+		"0.8 G 0.5 w 40 741.89 m 200 741.89 l S",
+	}
+	for _, op := range want {
+		if !strings.Contains(parsed.contents[0], op) {
+			t.Errorf("first page doesn't contain %q:\n%s", op, parsed.contents[0])
+		}
+	}
+	if !strings.Contains(parsed.contents[1], "/F3 12 Tf (\xcc\xee\xeb\xee\xea\xee) Tj") {
+		t.Errorf("second page = %s", parsed.contents[1])
+	}
+
+	// The fonts name the glyph at each code they use
+	fonts := parsed.objects[3]
+	for _, font := range []string{"F1", "F2"} {
+		if differences(t, fonts, font) != nil {
+			t.Errorf("%s changes WinAnsiEncoding", font)
+		}
+	}
+	for _, font := range []string{"F3", "F4"} {
+		names := differences(t, fonts, font)
+		if names[0xCC] != "uni041C" || len(names) != len(cyrillicLetters) {
+			t.Errorf("%s encodes М as %q and has %d letters", font, names[0xCC], len(names))
+		}
+	}
+	for _, font := range []string{"F5", "F6"} {
+		names := differences(t, fonts, font)
+		for code, letter := range centralLetters {
+			if names[int(code)] != glyphNames[letter.r] {
+				t.Errorf("%s encodes %c at %d as %q", font, letter.r, code, names[int(code)])
+			}
+		}
+		if names[0xB3] != "lslash" || names[0x06] != "edotaccent" || len(names) != len(centralLetters) {
+			t.Errorf("%s has %d letters", font, len(names))
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := map[string]string{
+		"Milk":          "Milk",
+		"(a) \\ b":      "\\(a\\) \\\\ b",
+		"\x01\x0a\x0d":  "\\001\\012\\015",
+		"\xb3\x1e\x20!": "\xb3\\036 !",
+	}
+	for in, want := range tests {
+		if got := escape([]byte(in)); got != want {
+			t.Errorf("escape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package pdf
+
+import "strings"
+
+// winAnsiHigh maps the characters of WinAnsiEncoding (Windows-1252) between
+// 0x80 and 0x9F; 0xA0 to 0xFF are the same as Latin-1
+var winAnsiHigh = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B,
+	'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// latinExtendedA holds the base letter of U+0100 to U+017F, so that the
+// letters none of the fonts have, such as "ĉ" or "ŋ", print as "c" and "n"
+const latinExtendedA = "AaAaAaCcCcCcCcDdDdEeEeEeEeEeGgGgGgGgHhHhIiIiIiIiIiIiJjKkkLlLlLlLlLlNnNnNnnNnOoOoOoOoRrRrRrSsSsSsSsTtTtTtUuUuUuUuUuUuWwYyYZzZzZzs"
+
+// Fonts, each in a regular and a bold version: WinAnsiEncoding, and fonts
+// that have other letters at some of its codes
+const (
+	fontWinAnsi = iota
+	fontCyrillic
+	fontCentral
+)
+
+// letter is a letter added to a font with its widths in the regular and bold
+// font. The Cyrillic ones are close to those of Arial, which matches Helvetica.
+type letter struct {
+	r           rune
+	width, bold int
+}
+
+// cyrillicLetters are the letters of the Cyrillic fonts by their code in
+// Windows-1251, enough for Russian, Ukrainian, Belarusian and Bulgarian.
+// The other codes of those fonts are WinAnsiEncoding.
+var cyrillicLetters = map[byte]letter{
+	0xA1: {'Ў', 635, 667}, 0xA2: {'ў', 500, 556}, 0xA5: {'Ґ', 542, 615}, 0xA8: {'Ё', 667, 667},
+	0xAA: {'Є', 722, 722}, 0xAF: {'Ї', 278, 278}, 0xB2: {'І', 278, 278}, 0xB3: {'і', 222, 278},
+	0xB4: {'ґ', 365, 417}, 0xB8: {'ё', 556, 556}, 0xBA: {'є', 500, 556}, 0xBF: {'ї', 278, 278},
+	0xC0: {'А', 667, 722}, 0xC1: {'Б', 656, 719}, 0xC2: {'В', 667, 722}, 0xC3: {'Г', 542, 615},
+	0xC4: {'Д', 677, 719}, 0xC5: {'Е', 667, 667}, 0xC6: {'Ж', 923, 1004}, 0xC7: {'З', 604, 625},
+	0xC8: {'И', 719, 722}, 0xC9: {'Й', 719, 722}, 0xCA: {'К', 583, 719}, 0xCB: {'Л', 656, 719},
+	0xCC: {'М', 833, 833}, 0xCD: {'Н', 722, 722}, 0xCE: {'О', 778, 778}, 0xCF: {'П', 719, 722},
+	0xD0: {'Р', 667, 667}, 0xD1: {'С', 722, 722}, 0xD2: {'Т', 611, 611}, 0xD3: {'У', 635, 667},
+	0xD4: {'Ф', 760, 885}, 0xD5: {'Х', 667, 667}, 0xD6: {'Ц', 740, 771}, 0xD7: {'Ч', 667, 667},
+	0xD8: {'Ш', 917, 1010}, 0xD9: {'Щ', 938, 1031}, 0xDA: {'Ъ', 792, 865}, 0xDB: {'Ы', 885, 938},
+	0xDC: {'Ь', 656, 719}, 0xDD: {'Э', 719, 722}, 0xDE: {'Ю', 1010, 1083}, 0xDF: {'Я', 722, 740},
+	0xE0: {'а', 556, 556}, 0xE1: {'б', 573, 615}, 0xE2: {'в', 531, 583}, 0xE3: {'г', 365, 417},
+	0xE4: {'д', 583, 635}, 0xE5: {'е', 556, 556}, 0xE6: {'ж', 669, 896}, 0xE7: {'з', 458, 510},
+	0xE8: {'и', 559, 625}, 0xE9: {'й', 559, 625}, 0xEA: {'к', 438, 552}, 0xEB: {'л', 583, 615},
+	0xEC: {'м', 688, 729}, 0xED: {'н', 552, 625}, 0xEE: {'о', 556, 611}, 0xEF: {'п', 542, 625},
+	0xF0: {'р', 556, 611}, 0xF1: {'с', 500, 556}, 0xF2: {'т', 458, 500}, 0xF3: {'у', 500, 556},
+	0xF4: {'ф', 823, 917}, 0xF5: {'х', 500, 556}, 0xF6: {'ц', 573, 646}, 0xF7: {'ч', 521, 583},
+	0xF8: {'ш', 802, 885}, 0xF9: {'щ', 823, 906}, 0xFA: {'ъ', 625, 740}, 0xFB: {'ы', 719, 823},
+	0xFC: {'ь', 521, 583}, 0xFD: {'э', 510, 552}, 0xFE: {'ю', 750, 865}, 0xFF: {'я', 542, 583},
+}
+
+// centralLetters are the letters of the Central European fonts: those of
+// Windows-1250 for Polish, Czech, Slovak, Hungarian, Slovenian, Croatian and
+// Romanian at their codes there, and the Baltic and Turkish ones of
+// Windows-1257 and 1254 in place of the control codes. They are the letters of
+// Latin Extended-A that the standard Helvetica fonts have; their widths are
+// those of the Adobe font metrics. The other codes are WinAnsiEncoding.
+var centralLetters = map[byte]letter{
+	0x01: {'Ā', 667, 722}, 0x02: {'ā', 556, 556}, 0x03: {'Ē', 667, 667}, 0x04: {'ē', 556, 556},
+	0x05: {'Ė', 667, 667}, 0x06: {'ė', 556, 556}, 0x07: {'Ğ', 778, 778}, 0x08: {'ğ', 556, 611},
+	0x09: {'Ģ', 778, 778}, 0x0A: {'ģ', 556, 611}, 0x0B: {'Ī', 278, 278}, 0x0C: {'ī', 278, 278},
+	0x0D: {'Į', 278, 278}, 0x0E: {'į', 222, 278}, 0x0F: {'İ', 278, 278}, 0x10: {'ı', 278, 278},
+	0x11: {'Ķ', 667, 722}, 0x12: {'ķ', 500, 556}, 0x13: {'Ļ', 556, 611}, 0x14: {'ļ', 222, 278},
+	0x15: {'Ņ', 722, 722}, 0x16: {'ņ', 556, 611}, 0x17: {'Ō', 778, 778}, 0x18: {'ō', 556, 611},
+	0x19: {'Ŗ', 722, 722}, 0x1A: {'ŗ', 333, 389}, 0x1B: {'Ū', 722, 722}, 0x1C: {'ū', 556, 611},
+	0x1D: {'Ų', 722, 722}, 0x1E: {'ų', 556, 611}, 0x8C: {'Ś', 667, 667}, 0x8D: {'Ť', 611, 611},
+	0x8F: {'Ź', 611, 611}, 0x9C: {'ś', 500, 556}, 0x9D: {'ť', 317, 389}, 0x9F: {'ź', 500, 500},
+	0xA3: {'Ł', 556, 611}, 0xA5: {'Ą', 667, 722}, 0xAA: {'Ş', 667, 667}, 0xAF: {'Ż', 611, 611},
+	0xB3: {'ł', 222, 278}, 0xB9: {'ą', 556, 556}, 0xBA: {'ş', 500, 556}, 0xBC: {'Ľ', 556, 611},
+	0xBE: {'ľ', 299, 400}, 0xBF: {'ż', 500, 500}, 0xC0: {'Ŕ', 722, 722}, 0xC3: {'Ă', 667, 722},
+	0xC5: {'Ĺ', 556, 611}, 0xC6: {'Ć', 722, 722}, 0xC8: {'Č', 722, 722}, 0xCA: {'Ę', 667, 667},
+	0xCC: {'Ě', 667, 667}, 0xCF: {'Ď', 722, 722}, 0xD0: {'Đ', 722, 722}, 0xD1: {'Ń', 722, 722},
+	0xD2: {'Ň', 722, 722}, 0xD5: {'Ő', 778, 778}, 0xD8: {'Ř', 722, 722}, 0xD9: {'Ů', 722, 722},
+	0xDB: {'Ű', 722, 722}, 0xDE: {'Ţ', 611, 611}, 0xE0: {'ŕ', 333, 389}, 0xE3: {'ă', 556, 556},
+	0xE5: {'ĺ', 222, 278}, 0xE6: {'ć', 500, 556}, 0xE8: {'č', 500, 556}, 0xEA: {'ę', 556, 556},
+	0xEC: {'ě', 556, 556}, 0xEF: {'ď', 643, 743}, 0xF0: {'đ', 556, 611}, 0xF1: {'ń', 556, 611},
+	0xF2: {'ň', 556, 611}, 0xF5: {'ő', 556, 611}, 0xF8: {'ř', 333, 389}, 0xF9: {'ů', 556, 611},
+	0xFB: {'ű', 556, 611}, 0xFE: {'ţ', 278, 333},
+}
+
+// glyphNames are the names of the letters of centralLetters in the standard
+// fonts. Letters without a name here are named by their Unicode code point.
+var glyphNames = map[rune]string{
+	'Ā': "Amacron", 'ā': "amacron", 'Ē': "Emacron", 'ē': "emacron", 'Ė': "Edotaccent",
+	'ė': "edotaccent", 'Ğ': "Gbreve", 'ğ': "gbreve", 'Ģ': "Gcommaaccent", 'ģ': "gcommaaccent",
+	'Ī': "Imacron", 'ī': "imacron", 'Į': "Iogonek", 'į': "iogonek", 'İ': "Idotaccent",
+	'ı': "dotlessi", 'Ķ': "Kcommaaccent", 'ķ': "kcommaaccent", 'Ļ': "Lcommaaccent", 'ļ': "lcommaaccent",
+	'Ņ': "Ncommaaccent", 'ņ': "ncommaaccent", 'Ō': "Omacron", 'ō': "omacron", 'Ŗ': "Rcommaaccent",
+	'ŗ': "rcommaaccent", 'Ū': "Umacron", 'ū': "umacron", 'Ų': "Uogonek", 'ų': "uogonek",
+	'Ś': "Sacute", 'Ť': "Tcaron", 'Ź': "Zacute", 'ś': "sacute", 'ť': "tcaron",
+	'ź': "zacute", 'Ł': "Lslash", 'Ą': "Aogonek", 'Ş': "Scedilla", 'Ż': "Zdotaccent",
+	'ł': "lslash", 'ą': "aogonek", 'ş': "scedilla", 'Ľ': "Lcaron", 'ľ': "lcaron",
+	'ż': "zdotaccent", 'Ŕ': "Racute", 'Ă': "Abreve", 'Ĺ': "Lacute", 'Ć': "Cacute",
+	'Č': "Ccaron", 'Ę': "Eogonek", 'Ě': "Ecaron", 'Ď': "Dcaron", 'Đ': "Dcroat",
+	'Ń': "Nacute", 'Ň': "Ncaron", 'Ő': "Ohungarumlaut", 'Ř': "Rcaron", 'Ů': "Uring",
+	'Ű': "Uhungarumlaut", 'Ţ': "Tcommaaccent", 'ŕ': "racute", 'ă': "abreve", 'ĺ': "lacute",
+	'ć': "cacute", 'č': "ccaron", 'ę': "eogonek", 'ě': "ecaron", 'ď': "dcaron",
+	'đ': "dcroat", 'ń': "nacute", 'ň': "ncaron", 'ő': "ohungarumlaut", 'ř': "rcaron",
+	'ů': "uring", 'ű': "uhungarumlaut", 'ţ': "tcommaaccent",
+}
+
+// commaBelow maps the Romanian letters with a comma below to the ones with a
+// cedilla, which the fonts have and which were used for them before
+var commaBelow = map[rune]rune{'Ș': 'Ş', 'ș': 'ş', 'Ț': 'Ţ', 'ț': 'ţ'}
+
+// fontLetters are the letters each font has in place of WinAnsiEncoding
+var fontLetters = [...]map[byte]letter{
+	fontCyrillic: cyrillicLetters,
+	fontCentral:  centralLetters,
+}
+
+// letterCode is where a letter is in the fonts
+type letterCode struct {
+	font int
+	code byte
+}
+
+// letterCodes maps the added letters to their font and code
+var letterCodes = make(map[rune]letterCode)
+
+func init() {
+	for font, letters := range fontLetters {
+		for code, letter := range letters {
+			letterCodes[letter.r] = letterCode{font, code}
+		}
+	}
+}
+
+// run is text encoded for one of the fonts
+type run struct {
+	font int
+	text []byte
+}
+
+// encode splits text into runs of each font. Characters no font has are
+// replaced by their base letter, or "?".
+func encode(s string) []run {
+	var runs []run
+	add := func(c byte, font int, shared bool) {
+		if len(runs) == 0 || (!shared && runs[len(runs)-1].font != font) {
+			runs = append(runs, run{font: font})
+		}
+		runs[len(runs)-1].text = append(runs[len(runs)-1].text, c)
+	}
+	// A WinAnsiEncoding character continues the current run if its font
+	// didn't put a letter at its code
+	winAnsi := func(c byte) {
+		replaced := false
+		if len(runs) > 0 {
+			_, replaced = fontLetters[runs[len(runs)-1].font][c]
+		}
+		add(c, fontWinAnsi, !replaced)
+	}
+	for _, r := range s {
+		if cedilla, ok := commaBelow[r]; ok {
+			r = cedilla
+		}
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			add(' ', fontWinAnsi, true)
+		case r < 0x20:
+		case r < 0x80:
+			// ASCII is the same in all fonts, so it doesn't start a run
+			add(byte(r), fontWinAnsi, true)
+		case r >= 0xA0 && r <= 0xFF:
+			winAnsi(byte(r))
+		case winAnsiHigh[r] != 0:
+			winAnsi(winAnsiHigh[r])
+		case letterCodes[r].font != fontWinAnsi:
+			add(letterCodes[r].code, letterCodes[r].font, false)
+		case r >= 0x100 && r < 0x180:
+			add(latinExtendedA[r-0x100], fontWinAnsi, true)
+		case r == '\u200d' || r == '\ufe0f' || (r >= 0x1F000 && r < 0x20000):
+			// Emoji and their joiners are left out
+		default:
+			add('?', fontWinAnsi, true)
+		}
+	}
+	return runs
+}
+
+// Width returns the width of text in points
+func Width(text string, size float64, bold bool) float64 {
+	widths := &helvetica
+	if bold {
+		widths = &helveticaBold
+	}
+	total := 0
+	for _, r := range encode(text) {
+		for _, c := range r.text {
+			letter, ok := fontLetters[r.font][c]
+			switch {
+			case ok && bold:
+				total += letter.bold
+			case ok:
+				total += letter.width
+			case c >= 32:
+				total += widths[c-32]
+			}
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Wrap breaks text into lines no wider than width, at spaces where possible
+func Wrap(text string, size float64, bold bool, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if Width(candidate, size, bold) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		// Words longer than a line are cut
+		for Width(word, size, bold) > width {
+			cut := len([]rune(word)) - 1
+			for cut > 1 && Width(string([]rune(word)[:cut]), size, bold) > width {
+				cut--
+			}
+			lines = append(lines, string([]rune(word)[:cut]))
+			word = string([]rune(word)[cut:])
+		}
+		line = word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Glyph widths of Helvetica and Helvetica-Bold from the standard Adobe font
+// metrics, in 1/1000 of the font size, for WinAnsiEncoding codes 32 to 255
+var helvetica = [224]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, 350,
+	556, 350, 222, 556, 333, 1000, 556, 556, 333, 1000, 667, 333, 1000, 350, 611, 350,
+	350, 222, 222, 333, 333, 350, 556, 1000, 333, 1000, 500, 333, 944, 350, 500, 667,
+	278, 333, 556, 556, 556, 556, 260, 556, 333, 737, 370, 556, 584, 333, 737, 333,
+	400, 584, 333, 333, 333, 556, 537, 278, 333, 333, 365, 556, 834, 834, 834, 611,
+	667, 667, 667, 667, 667, 667, 1000, 722, 667, 667, 667, 667, 278, 278, 278, 278,
+	722, 722, 778, 778, 778, 778, 778, 584, 778, 722, 722, 722, 722, 667, 667, 611,
+	556, 556, 556, 556, 556, 556, 889, 500, 556, 556, 556, 556, 278, 278, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 584, 611, 556, 556, 556, 556, 500, 556, 500,
+}
+
+var helveticaBold = [224]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584, 350,
+	556, 350, 278, 556, 500, 1000, 556, 556, 333, 1000, 667, 333, 1000, 350, 611, 350,
+	350, 278, 278, 500, 500, 350, 556, 1000, 333, 1000, 556, 333, 944, 350, 500, 667,
+	278, 333, 556, 556, 556, 556, 280, 556, 333, 737, 370, 556, 584, 333, 737, 333,
+	400, 584, 333, 333, 333, 611, 556, 278, 333, 333, 365, 556, 834, 834, 834, 611,
+	722, 722, 722, 722, 722, 722, 1000, 722, 667, 667, 667, 667, 278, 278, 278, 278,
+	722, 722, 778, 778, 778, 778, 778, 584, 778, 722, 722, 722, 722, 667, 667, 611,
+	556, 556, 556, 556, 556, 556, 889, 556, 556, 556, 556, 556, 278, 278, 278, 278,
+	611, 611, 611, 611, 611, 611, 611, 584, 611, 611, 611, 611, 611, 556, 611, 556,
+}
@@ -0,0 +1,105 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// describeRuns renders runs as "font:text" with the codes above ASCII in hex
+func describeRuns(runs []run) string {
+	var parts []string
+	for _, r := range runs {
+		var b strings.Builder
+		for _, c := range r.text {
+			if c >= 0x20 && c < 0x80 {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "<%02X>", c)
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%d:%s", r.font, b.String()))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"Milk 2 l", "0:Milk 2 l"},
+		{"Crème brûlée €5", "0:Cr<E8>me br<FB>l<E9>e <80>5"},
+		{"Żółć", "2:<AF><F3><B3><E6>"},
+		{"Łódź – „pączki”", "2:<A3><F3>d<9F> <96> <84>p<B9>czki<94>"},
+		{"Ąžuolas ėjo į ūkį", "2:<A5><9E>uolas <06>jo <0E> <1C>k<0E>"},
+		{"Rīga, Ķekava", "0:R 2:<0C>ga, <11>ekava"},
+		{"Hlavní město", "0:Hlavn<ED> m 2:<EC>sto"},
+		{"Țară și Şiret", "2:<DE>ar<E3> <BA>i <AA>iret"},
+		{"Masło i sól ½ kg", "0:Mas 2:<B3>o i s<F3>l <BD> kg"},
+		// A code the Central European font took switches back to WinAnsiEncoding
+		{"ł¥", "2:<B3> 0:<A5>"},
+		{"Молоко и łosoś", "1:<CC><EE><EB><EE><EA><EE> <E8>  2:<B3>oso<9C>"},
+		{"Молоко ½", "1:<CC><EE><EB><EE><EA><EE> <BD>"},
+		{"Ĉu ŋ", "0:Cu n"},
+		{"Tea\tand\ncake\x00", "0:Tea and cake"},
+		{"🍎 Apples ❤️", "0: Apples ?"},
+		{"日本", "0:??"},
+	}
+	for _, tt := range tests {
+		if got := describeRuns(encode(tt.text)); got != tt.want {
+			t.Errorf("encode(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		bold bool
+		want float64
+	}{
+		{"", false, 0},
+		{"Milk", false, 833 + 222 + 222 + 500},
+		{"Milk", true, 833 + 278 + 278 + 556},
+		{"ł", false, 222},
+		{"ď", true, 743},
+		{"Я", false, 722},
+		{"Я", true, 740},
+	}
+	for _, tt := range tests {
+		if got := Width(tt.text, 1000, tt.bold); got != tt.want {
+			t.Errorf("Width(%q, bold %v) = %v, want %v", tt.text, tt.bold, got, tt.want)
+		}
+	}
+	if Width("Milk", 12, false) != Width("Milk", 24, false)/2 {
+		t.Error("width doesn't scale with the font size")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		text  string
+		width float64
+		want  []string
+	}{
+		{"", 100, nil},
+		{"Milk", 100, []string{"Milk"}},
+		{"  Milk   and\teggs ", 1000, []string{"Milk and eggs"}},
+		{"Milk and eggs", Width("Milk and", 10, false), []string{"Milk and", "eggs"}},
+		{"Milk and eggs", Width("eggs", 10, false), []string{"Milk", "and", "eggs"}},
+		// Words longer than a line are cut
+		{"Supercalifragilistic", Width("Supercal", 10, false), []string{"Supercal", "ifragilisti", "c"}},
+		{"Żółty ser, masło", Width("Żółty ser,", 10, false), []string{"Żółty ser,", "masło"}},
+	}
+	for _, tt := range tests {
+		got := Wrap(tt.text, 10, false, tt.width)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("Wrap(%q, %v) = %q, want %q", tt.text, tt.width, got, tt.want)
+		}
+		for _, line := range got {
+			if Width(line, 10, false) > tt.width {
+				t.Errorf("Wrap(%q, %v) made %q, which is wider", tt.text, tt.width, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+	"shopping-list/db"
+)
+
+// NewSection is a section to create together with its items
+type NewSection struct {
+	Name  string
+	Items []NewItem
+}
+
+// NewItem is an item to create
+type NewItem struct {
+	Name        string
+	Description string
+	Completed   bool
+}
+
+// BatchResult holds everything created by one batch
+type BatchResult struct {
+	List     *db.List
+	Sections []db.Section
+	Items    []db.Item
+}
+
+// NewList is a list to create together with its sections
+type NewList struct {
+	Name     string
+	Icon     string
+	Sections []NewSection
+}
+
+// CreateListWithSections creates a list with its sections and items in one transaction
+func (s *Service) CreateListWithSections(userID int64, name, icon string, sections []NewSection) (*BatchResult, error) {
+	results, err := s.CreateListsWithSections(userID, []NewList{{Name: name, Icon: icon, Sections: sections}})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// CreateListsWithSections creates several lists with their sections and items
+// in one transaction, so either all of them are created or none
+func (s *Service) CreateListsWithSections(userID int64, lists []NewList) ([]*BatchResult, error) {
+	for _, list := range lists {
+		if err := ValidateNewList(list); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]*BatchResult, len(lists))
+	err := s.batch(func(b db.BatchStore) error {
+		for i, input := range lists {
+			list, err := b.CreateList(input.Name, NormalizeIcon(input.Icon), userID)
+			if err != nil {
+				return internal("create_failed", "Failed to create list", err)
+			}
+			results[i] = &BatchResult{List: list}
+			if err := addSections(b, results[i], list.ID, 0, input.Sections); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		result.List.Stats = s.store.GetListStats(result.List.ID)
+		result.List.Role = db.RoleOwner
+		s.publish(result.List.ID, EventBatchCreated, map[string]interface{}{"list_id": result.List.ID})
+	}
+	return results, nil
+}
+
+// ValidateNewList checks a list as CreateListsWithSections does, without creating it
+func ValidateNewList(list NewList) error {
+	if err := validateName("List", list.Name, MaxListNameLength); err != nil {
+		return err
+	}
+	if err := validateIcon(list.Icon); err != nil {
+		return err
+	}
+	return ValidateSections(list.Sections)
+}
+
+// AddSections appends sections with their items to a list in one transaction
+func (s *Service) AddSections(userID, listID int64, sections []NewSection) (*BatchResult, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+		return nil, err
+	}
+	if err := ValidateSections(sections); err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{}
+	err := s.batch(func(b db.BatchStore) error {
+		return addSections(b, result, listID, b.MaxSectionOrder(listID)+1, sections)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(listID, EventBatchCreated, map[string]interface{}{"list_id": listID})
+	return result, nil
+}
+
+// AddItems appends items to a section in one transaction
+func (s *Service) AddItems(userID, sectionID int64, items []NewItem) (*BatchResult, error) {
+	listID, err := s.RequireSectionRole(userID, sectionID, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateItems(items); err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{}
+	err = s.batch(func(b db.BatchStore) error {
+		created, err := addItems(b, sectionID, b.MaxItemOrder(sectionID)+1, items)
+		result.Items = created
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(listID, EventBatchCreated, map[string]interface{}{"section_id": sectionID})
+	return result, nil
+}
+
+// batch runs fn in a store transaction; a failed commit is reported as commit_failed
+func (s *Service) batch(fn func(b db.BatchStore) error) error {
+	err := s.store.Batch(fn)
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return internal("commit_failed", "Failed to commit transaction", err)
+}
+
+func addSections(b db.BatchStore, result *BatchResult, listID int64, firstOrder int, sections []NewSection) error {
+	for i, input := range sections {
+		section, err := b.CreateSection(listID, input.Name, firstOrder+i)
+		if err != nil {
+			return internal("create_failed", "Failed to create section: "+input.Name, err)
+		}
+
+		section.Items, err = addItems(b, section.ID, 0, input.Items)
+		if err != nil {
+			return err
+		}
+		result.Sections = append(result.Sections, *section)
+		result.Items = append(result.Items, section.Items...)
+	}
+	return nil
+}
+
+func addItems(b db.BatchStore, sectionID int64, firstOrder int, items []NewItem) ([]db.Item, error) {
+	var created []db.Item
+	for i, input := range items {
+		item, err := b.CreateItem(sectionID, input.Name, input.Description, firstOrder+i)
+		if err != nil {
+			return nil, internal("create_failed", "Failed to create item: "+input.Name, err)
+		}
+		if input.Completed {
+			if err := b.SetItemStatus(item.ID, true, false); err != nil {
+				return nil, internal("create_failed", "Failed to create item: "+input.Name, err)
+			}
+			item.Completed = true
+		}
+		created = append(created, *item)
+
+		// Save to item history
+		b.SaveItemHistory(input.Name, sectionID)
+	}
+	return created, nil
+}
+
+// ValidateSections checks sections and their items as AddSections does, without creating them
+func ValidateSections(sections []NewSection) error {
+	for _, section := range sections {
+		if err := validateName("Section", section.Name, MaxSectionNameLength); err != nil {
+			return err
+		}
+		if err := validateItems(section.Items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateItems(items []NewItem) error {
+	for _, item := range items {
+		if err := validateName("Item", item.Name, MaxItemNameLength); err != nil {
+			return err
+		}
+		if err := validateDescription(item.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
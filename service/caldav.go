@@ -0,0 +1,206 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"shopping-list/db"
+	"strconv"
+	"strings"
+)
+
+// CalDAVItem is an item as a CalDAV VTODO resource in its list's collection
+type CalDAVItem struct {
+	db.Item
+	// Resource is the file name in the collection, UID the VTODO's UID
+	Resource string
+	UID      string
+}
+
+// CalDAVTodo holds what Koffan keeps of a VTODO a client sends
+type CalDAVTodo struct {
+	UID         string
+	Summary     string
+	Description string
+	Completed   bool
+}
+
+// ETag is derived from updated_at, so it changes with every change to the item
+func (i CalDAVItem) ETag() string {
+	return fmt.Sprintf(`"%d-%d"`, i.ID, i.UpdatedAt)
+}
+
+const calDAVNamePrefix = "koffan-item-"
+
+// MaxCalDAVNameLength is the longest resource name a client may choose
+const MaxCalDAVNameLength = 200
+
+// CalDAVItems returns the items of a list as CalDAV resources
+func (s *Service) CalDAVItems(userID, listID int64) ([]CalDAVItem, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleViewer); err != nil {
+		return nil, err
+	}
+	sections, err := s.store.GetSectionsByList(listID)
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch sections", err)
+	}
+	objects, err := s.store.GetCalDAVObjects(listID)
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch CalDAV objects", err)
+	}
+	byItem := make(map[int64]db.CalDAVObject, len(objects))
+	for _, o := range objects {
+		byItem[o.ItemID] = o
+	}
+
+	items := []CalDAVItem{}
+	for _, section := range sections {
+		for _, item := range section.Items {
+			items = append(items, calDAVItem(item, byItem[item.ID]))
+		}
+	}
+	return items, nil
+}
+
+// CalDAVItem returns the item of a list stored under a resource name
+func (s *Service) CalDAVItem(userID, listID int64, name string) (*CalDAVItem, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleViewer); err != nil {
+		return nil, err
+	}
+	itemID, object, err := s.resolveCalDAVName(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.calDAVItemByID(listID, itemID, object)
+}
+
+// PutCalDAVItem creates or replaces the item stored under a resource name.
+// A new item goes to the section an item of that name was last added to.
+// It reports whether the item was created.
+func (s *Service) PutCalDAVItem(userID, listID int64, name string, todo CalDAVTodo) (*CalDAVItem, bool, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+		return nil, false, err
+	}
+	if name == "" || len(name) > MaxCalDAVNameLength || strings.ContainsAny(name, "/\\") {
+		return nil, false, invalid("Invalid resource name")
+	}
+	todo.Summary = strings.TrimSpace(todo.Summary)
+
+	itemID, object, err := s.resolveCalDAVName(name)
+	if err != nil && AsError(err).Kind != KindNotFound {
+		return nil, false, err
+	}
+
+	if err == nil {
+		existing, err := s.calDAVItemByID(listID, itemID, object)
+		if err != nil {
+			return nil, false, err
+		}
+		if _, err := s.UpdateItem(userID, existing.ID, ItemUpdate{Name: &todo.Summary, Description: &todo.Description}); err != nil {
+			return nil, false, err
+		}
+		if _, err := s.SetItemCompleted(userID, existing.ID, todo.Completed); err != nil {
+			return nil, false, err
+		}
+		updated, err := s.calDAVItemByID(listID, existing.ID, object)
+		return updated, false, err
+	}
+
+	if todo.UID == "" {
+		return nil, false, invalid("The VTODO has no UID")
+	}
+	sectionID, err := s.sectionForItem(userID, listID, todo.Summary)
+	if err != nil {
+		return nil, false, err
+	}
+	item, err := s.CreateItem(userID, sectionID, todo.Summary, todo.Description)
+	if err != nil {
+		return nil, false, err
+	}
+	if todo.Completed {
+		if _, err := s.SetItemCompleted(userID, item.ID, true); err != nil {
+			return nil, false, err
+		}
+	}
+	object = &db.CalDAVObject{ItemID: item.ID, Name: name, UID: todo.UID}
+	if err := s.store.SaveCalDAVObject(*object); err != nil {
+		return nil, false, internal("create_failed", "Failed to save CalDAV object", err)
+	}
+	created, err := s.calDAVItemByID(listID, item.ID, object)
+	return created, true, err
+}
+
+// DeleteCalDAVItem deletes the item stored under a resource name
+func (s *Service) DeleteCalDAVItem(userID, listID int64, name string) error {
+	item, err := s.CalDAVItem(userID, listID, name)
+	if err != nil {
+		return err
+	}
+	return s.DeleteItem(userID, item.ID)
+}
+
+// resolveCalDAVName finds the item of a resource name: one chosen by a
+// client, or koffan-item-<id>.ics for any other item
+func (s *Service) resolveCalDAVName(name string) (int64, *db.CalDAVObject, error) {
+	object, err := s.store.GetCalDAVObjectByName(name)
+	if err == nil {
+		return object.ItemID, object, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, nil, internal("db_error", "Failed to fetch CalDAV object", err)
+	}
+	id, ok := strings.CutSuffix(strings.TrimPrefix(name, calDAVNamePrefix), ".ics")
+	if !ok || !strings.HasPrefix(name, calDAVNamePrefix) {
+		return 0, nil, notFound("Item")
+	}
+	itemID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, nil, notFound("Item")
+	}
+	return itemID, nil, nil
+}
+
+// calDAVItemByID returns an item if it is on the list
+func (s *Service) calDAVItemByID(listID, itemID int64, object *db.CalDAVObject) (*CalDAVItem, error) {
+	item, err := s.getItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	section, err := s.store.GetSectionByID(item.SectionID)
+	if err != nil || section.ListID != listID {
+		return nil, notFound("Item")
+	}
+	if object == nil {
+		object = &db.CalDAVObject{}
+	}
+	result := calDAVItem(*item, *object)
+	return &result, nil
+}
+
+// sectionForItem picks the section of a list a new item goes to: the one it
+// was last added to, the first one, or a new "Other" section
+func (s *Service) sectionForItem(userID, listID int64, name string) (int64, error) {
+	sections, err := s.store.GetSectionsByList(listID)
+	if err != nil {
+		return 0, internal("db_error", "Failed to fetch sections", err)
+	}
+	if suggestion := s.historyMatch(name); suggestion != nil && sectionIndex(sections, suggestion.LastSectionID) >= 0 {
+		return suggestion.LastSectionID, nil
+	}
+	if len(sections) > 0 {
+		return sections[0].ID, nil
+	}
+	section, err := s.CreateSection(userID, listID, DefaultSectionName)
+	if err != nil {
+		return 0, err
+	}
+	return section.ID, nil
+}
+
+func calDAVItem(item db.Item, object db.CalDAVObject) CalDAVItem {
+	result := CalDAVItem{Item: item, Resource: object.Name, UID: object.UID}
+	if result.Resource == "" {
+		result.Resource = calDAVNamePrefix + strconv.FormatInt(item.ID, 10) + ".ics"
+		result.UID = calDAVNamePrefix + strconv.FormatInt(item.ID, 10)
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"shopping-list/db"
+	"strings"
+)
+
+// List command actions
+const (
+	CommandAdd    = "add"
+	CommandToggle = "toggle"
+)
+
+// ListCommand is a change to a list sent as a message, as over MQTT. Add
+// takes free text like QuickAdd; toggle finds an item by ID or name and
+// checks or unchecks it, or sets it to Completed if that is given.
+type ListCommand struct {
+	Action    string `json:"action"`
+	Text      string `json:"text"`
+	Item      string `json:"item"`
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Completed *bool  `json:"completed"`
+}
+
+// CommandResult tells what a list command did
+type CommandResult struct {
+	Action string          `json:"action"`
+	Added  *QuickAddResult `json:"added,omitempty"`
+	Item   *db.Item        `json:"item,omitempty"`
+}
+
+// RunListCommand applies a command to a list
+func (s *Service) RunListCommand(userID, listID int64, cmd ListCommand) (*CommandResult, error) {
+	switch strings.ToLower(strings.TrimSpace(cmd.Action)) {
+	case CommandAdd, "":
+		text := strings.TrimSpace(cmd.Text)
+		if text == "" {
+			text = strings.TrimSpace(cmd.Item)
+		}
+		if text == "" {
+			text = strings.TrimSpace(cmd.Name)
+		}
+		result, err := s.QuickAdd(userID, listID, 0, text)
+		if err != nil {
+			return nil, err
+		}
+		return &CommandResult{Action: CommandAdd, Added: result}, nil
+
+	case CommandToggle:
+		itemID := cmd.ID
+		if itemID == 0 {
+			name := strings.TrimSpace(cmd.Name)
+			if name == "" {
+				name = strings.TrimSpace(cmd.Item)
+			}
+			if name == "" {
+				return nil, invalid("No item given")
+			}
+			if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+				return nil, err
+			}
+			item, err := s.findTodoItem(listID, name)
+			if err != nil {
+				return nil, err
+			}
+			itemID = item.ID
+		}
+		if err := s.requireTodoItem(userID, listID, itemID); err != nil {
+			return nil, err
+		}
+
+		var item *db.Item
+		var err error
+		if cmd.Completed != nil {
+			item, err = s.SetItemCompleted(userID, itemID, *cmd.Completed)
+		} else {
+			item, err = s.ToggleItemCompleted(userID, itemID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &CommandResult{Action: CommandToggle, Item: item}, nil
+	}
+	return nil, invalid("Unknown action: " + cmd.Action)
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Kind classifies an error so each transport can pick its status code
+type Kind int
+
+const (
+	KindInvalid Kind = iota + 1
+	KindNotFound
+	KindForbidden
+	KindInternal
+)
+
+// Error is returned by every service operation that fails.
+// Code is a stable identifier for API clients; Message is shown to users.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status code for the error
+func (e *Error) Status() int {
+	switch e.Kind {
+	case KindInvalid:
+		return http.StatusBadRequest
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindForbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// AsError returns err as an *Error, wrapping errors from outside the service
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return internal("internal_error", "Internal error", err)
+}
+
+func invalid(message string) *Error {
+	return &Error{Kind: KindInvalid, Code: "validation_error", Message: message}
+}
+
+func notFound(what string) *Error {
+	return &Error{Kind: KindNotFound, Code: "not_found", Message: what + " not found"}
+}
+
+func forbidden(min string) *Error {
+	return &Error{Kind: KindForbidden, Code: "forbidden", Message: "Requires " + min + " access to this list"}
+}
+
+func internal(code, message string, err error) *Error {
+	return &Error{Kind: KindInternal, Code: code, Message: message, Err: err}
+}
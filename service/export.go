@@ -0,0 +1,475 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"shopping-list/db"
+	"strings"
+	"time"
+)
+
+// ExportFormat identifies Koffan exports; ExportVersion is the version written
+// by Export. Import reads every version up to ExportVersion. Version 2 added
+// the permissions of lists, so older versions refuse files they'd make public.
+const (
+	ExportFormat  = "koffan"
+	ExportVersion = 2
+)
+
+// Import modes: merge adds the data next to the existing one, replace deletes
+// all lists, templates and history first
+const (
+	ImportMerge   = "merge"
+	ImportReplace = "replace"
+)
+
+// Export is all data of an instance. Users, passwords and sessions are not
+// included; lists name their owner and members by username.
+type Export struct {
+	Format     string           `json:"format"`
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Lists      []ExportList     `json:"lists"`
+	Templates  []ExportTemplate `json:"templates"`
+	History    []ExportHistory  `json:"history"`
+}
+
+// ExportList is a list with its permissions and its sections in display order
+type ExportList struct {
+	Name      string          `json:"name"`
+	Icon      string          `json:"icon,omitempty"`
+	Active    bool            `json:"active,omitempty"`
+	IsPrivate bool            `json:"is_private,omitempty"`
+	Owner     string          `json:"owner,omitempty"`
+	Members   []ExportMember  `json:"members,omitempty"`
+	Sections  []ExportSection `json:"sections"`
+}
+
+// ExportMember is a user a list is shared with
+type ExportMember struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// ExportSection is a section with its items in display order
+type ExportSection struct {
+	Name  string       `json:"name"`
+	Items []ExportItem `json:"items"`
+}
+
+// ExportItem is an item of a section
+type ExportItem struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Completed   bool   `json:"completed,omitempty"`
+	Uncertain   bool   `json:"uncertain,omitempty"`
+}
+
+// ExportTemplate is a template with its items in order
+type ExportTemplate struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Items       []ExportTemplateItem `json:"items"`
+}
+
+// ExportTemplateItem is an item of a template and the section it goes to
+type ExportTemplateItem struct {
+	Section     string `json:"section"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// ExportHistory is an auto-completion entry. List and Section name the
+// section the item was last added to, if it is part of the export.
+type ExportHistory struct {
+	Name       string `json:"name"`
+	UsageCount int    `json:"usage_count"`
+	LastUsedAt int64  `json:"last_used_at,omitempty"`
+	List       string `json:"list,omitempty"`
+	Section    string `json:"section,omitempty"`
+}
+
+// ImportResult counts what an import created. Replacing deletes the webhooks
+// and inbound hooks bound to a list along with the lists; they are named in
+// RemovedWebhooks and RemovedInboundHooks so they can be set up again.
+type ImportResult struct {
+	Mode                string   `json:"mode"`
+	Lists               int      `json:"lists"`
+	Sections            int      `json:"sections"`
+	Items               int      `json:"items"`
+	Templates           int      `json:"templates"`
+	History             int      `json:"history"`
+	RemovedWebhooks     []string `json:"removed_webhooks,omitempty"`
+	RemovedInboundHooks []string `json:"removed_inbound_hooks,omitempty"`
+}
+
+// Export returns the lists the user can see, all templates and the item
+// history. Users only get the history of their lists and of no list.
+func (s *Service) Export(userID int64) (*Export, error) {
+	lists, err := s.store.GetAllLists(userID)
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch lists", err)
+	}
+
+	export := &Export{
+		Format:     ExportFormat,
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Lists:      []ExportList{},
+		Templates:  []ExportTemplate{},
+		History:    []ExportHistory{},
+	}
+
+	// Where each exported section is, so history can refer to it by name
+	sectionRefs := make(map[int64][2]string)
+	for _, list := range lists {
+		sections, err := s.store.GetSectionsByList(list.ID)
+		if err != nil {
+			return nil, internal("db_error", "Failed to fetch sections", err)
+		}
+
+		el := ExportList{Name: list.Name, Icon: list.Icon, Active: list.IsActive, IsPrivate: list.IsPrivate, Sections: []ExportSection{}}
+		if list.OwnerID != 0 {
+			owner, err := s.store.GetUserByID(list.OwnerID)
+			if err != nil {
+				return nil, internal("db_error", "Failed to fetch list owner", err)
+			}
+			el.Owner = owner.Username
+		}
+		members, err := s.store.GetListMembers(list.ID)
+		if err != nil {
+			return nil, internal("db_error", "Failed to fetch list members", err)
+		}
+		for _, m := range members {
+			el.Members = append(el.Members, ExportMember{Username: m.Username, Role: m.Role})
+		}
+
+		for _, section := range sections {
+			es := ExportSection{Name: section.Name, Items: []ExportItem{}}
+			for _, item := range section.Items {
+				es.Items = append(es.Items, ExportItem{
+					Name:        item.Name,
+					Description: item.Description,
+					Completed:   item.Completed,
+					Uncertain:   item.Uncertain,
+				})
+			}
+			el.Sections = append(el.Sections, es)
+			sectionRefs[section.ID] = [2]string{list.Name, section.Name}
+		}
+		export.Lists = append(export.Lists, el)
+	}
+
+	templates, err := s.store.GetAllTemplates()
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch templates", err)
+	}
+	for _, t := range templates {
+		et := ExportTemplate{Name: t.Name, Description: t.Description, Items: []ExportTemplateItem{}}
+		for _, item := range t.Items {
+			et.Items = append(et.Items, ExportTemplateItem{
+				Section:     item.SectionName,
+				Name:        item.Name,
+				Description: item.Description,
+			})
+		}
+		export.Templates = append(export.Templates, et)
+	}
+
+	history, err := s.store.GetAllItemHistory()
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch history", err)
+	}
+	for _, h := range history {
+		ref, exported := sectionRefs[h.LastSectionID]
+		if userID != 0 && h.LastSectionID != 0 && !exported {
+			// Last added to a list the user can't see
+			continue
+		}
+		export.History = append(export.History, ExportHistory{
+			Name:       h.Name,
+			UsageCount: h.UsageCount,
+			LastUsedAt: h.LastUsedAt,
+			List:       ref[0],
+			Section:    ref[1],
+		})
+	}
+
+	return export, nil
+}
+
+// Import creates the data of an export in one transaction; nothing is saved
+// if any part is invalid. Imported lists are owned by the user, or with system
+// access by the owner they name. Replacing all data needs system access.
+func (s *Service) Import(userID int64, data *Export, mode string) (*ImportResult, error) {
+	if mode == "" {
+		mode = ImportMerge
+	}
+	if mode != ImportMerge && mode != ImportReplace {
+		return nil, invalid("Import mode must be \"merge\" or \"replace\"")
+	}
+	if mode == ImportReplace && userID != 0 {
+		return nil, &Error{Kind: KindForbidden, Code: "forbidden", Message: "Replacing all data requires full access"}
+	}
+	if err := validateExport(data, mode); err != nil {
+		return nil, err
+	}
+	users, err := s.exportUsers(userID, data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Mode: mode}
+	if mode == ImportReplace {
+		if err := s.listBoundHooks(result); err != nil {
+			return nil, err
+		}
+	}
+	err = s.batch(func(b db.BatchStore) error {
+		if mode == ImportReplace {
+			if err := b.DeleteAllData(); err != nil {
+				return internal("import_failed", "Failed to delete existing data", err)
+			}
+		}
+
+		sectionIDs := make(map[[2]string]int64)
+		// The first list marked active becomes active, or else the first list
+		var activeID, firstID int64
+		for _, el := range data.Lists {
+			ownerID := userID
+			if userID == 0 && el.Owner != "" {
+				ownerID = users[el.Owner]
+			}
+			list, err := b.CreateList(el.Name, NormalizeIcon(el.Icon), ownerID)
+			if err != nil {
+				return internal("import_failed", "Failed to create list: "+el.Name, err)
+			}
+			if el.IsPrivate || len(el.Members) > 0 {
+				members := make(map[int64]string, len(el.Members))
+				for _, m := range el.Members {
+					members[users[m.Username]] = m.Role
+				}
+				if err := b.ReplaceListPermissions(list.ID, &el.IsPrivate, ownerID, members); err != nil {
+					return internal("import_failed", "Failed to set the permissions of list: "+el.Name, err)
+				}
+			}
+			result.Lists++
+			if firstID == 0 {
+				firstID = list.ID
+			}
+			if el.Active && activeID == 0 {
+				activeID = list.ID
+			}
+
+			for i, es := range el.Sections {
+				section, err := b.CreateSection(list.ID, es.Name, i)
+				if err != nil {
+					return internal("import_failed", "Failed to create section: "+es.Name, err)
+				}
+				result.Sections++
+				key := [2]string{strings.ToLower(el.Name), strings.ToLower(es.Name)}
+				if _, ok := sectionIDs[key]; !ok {
+					sectionIDs[key] = section.ID
+				}
+
+				for j, ei := range es.Items {
+					item, err := b.CreateItem(section.ID, ei.Name, ei.Description, j)
+					if err != nil {
+						return internal("import_failed", "Failed to create item: "+ei.Name, err)
+					}
+					if ei.Completed || ei.Uncertain {
+						if err := b.SetItemStatus(item.ID, ei.Completed, ei.Uncertain); err != nil {
+							return internal("import_failed", "Failed to create item: "+ei.Name, err)
+						}
+					}
+					result.Items++
+				}
+			}
+		}
+
+		// Replacing removed the active list; merging keeps the current one
+		if mode == ImportReplace {
+			if activeID == 0 {
+				activeID = firstID
+			}
+			if err := b.SetActiveList(activeID); err != nil {
+				return internal("import_failed", "Failed to set the active list", err)
+			}
+		}
+
+		for _, et := range data.Templates {
+			t, err := b.CreateTemplate(et.Name, et.Description)
+			if err != nil {
+				return internal("import_failed", "Failed to create template: "+et.Name, err)
+			}
+			for i, item := range et.Items {
+				if _, err := b.CreateTemplateItem(t.ID, item.Section, item.Name, item.Description, i); err != nil {
+					return internal("import_failed", "Failed to create template item: "+item.Name, err)
+				}
+			}
+			result.Templates++
+		}
+
+		now := time.Now().Unix()
+		for _, h := range data.History {
+			sectionID := sectionIDs[[2]string{strings.ToLower(h.List), strings.ToLower(h.Section)}]
+			lastUsedAt := h.LastUsedAt
+			if lastUsedAt <= 0 {
+				lastUsedAt = now
+			}
+			if err := b.ImportItemHistory(h.Name, sectionID, max(h.UsageCount, 1), lastUsedAt); err != nil {
+				return internal("import_failed", "Failed to import history: "+h.Name, err)
+			}
+			result.History++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Lists appeared or disappeared for everyone; clients start over
+	s.publish(0, EventDataImported, result)
+	return result, nil
+}
+
+// validateExport checks the whole export before anything is written.
+// Messages name the offending entry, e.g. "lists[2].sections[0]: ...".
+// listBoundHooks names the webhooks and inbound hooks that go away with the
+// lists when all data is replaced
+func (s *Service) listBoundHooks(result *ImportResult) error {
+	webhooks, err := s.store.GetWebhooks()
+	if err != nil {
+		return internal("db_error", "Failed to fetch webhooks", err)
+	}
+	for _, w := range webhooks {
+		if w.ListID != 0 {
+			result.RemovedWebhooks = append(result.RemovedWebhooks, w.Name)
+		}
+	}
+	hooks, err := s.store.GetInboundHooks()
+	if err != nil {
+		return internal("db_error", "Failed to fetch inbound hooks", err)
+	}
+	for _, h := range hooks {
+		result.RemovedInboundHooks = append(result.RemovedInboundHooks, h.Name)
+	}
+	return nil
+}
+
+func validateExport(data *Export, mode string) error {
+	if data.Format != ExportFormat {
+		return invalid("Not a Koffan export (format must be \"" + ExportFormat + "\")")
+	}
+	if data.Version < 1 || data.Version > ExportVersion {
+		return invalid(fmt.Sprintf("Export version %d is not supported (this version reads 1 to %d)", data.Version, ExportVersion))
+	}
+	if mode == ImportReplace && len(data.Lists) == 0 {
+		return invalid("Replacing needs an export with at least one list")
+	}
+
+	for i, el := range data.Lists {
+		path := fmt.Sprintf("lists[%d]", i)
+		if err := validateName("List", el.Name, MaxListNameLength); err != nil {
+			return atPath(path, err)
+		}
+		if err := validateIcon(el.Icon); err != nil {
+			return atPath(path, err)
+		}
+		for j, m := range el.Members {
+			path := fmt.Sprintf("%s.members[%d]", path, j)
+			if strings.TrimSpace(m.Username) == "" {
+				return atPath(path, invalid("Username is required"))
+			}
+			if !db.IsValidMemberRole(m.Role) {
+				return atPath(path, invalid("Role must be editor or viewer"))
+			}
+		}
+		for j, es := range el.Sections {
+			path := fmt.Sprintf("%s.sections[%d]", path, j)
+			if err := validateName("Section", es.Name, MaxSectionNameLength); err != nil {
+				return atPath(path, err)
+			}
+			for k, ei := range es.Items {
+				path := fmt.Sprintf("%s.items[%d]", path, k)
+				if err := validateName("Item", ei.Name, MaxItemNameLength); err != nil {
+					return atPath(path, err)
+				}
+				if err := validateDescription(ei.Description); err != nil {
+					return atPath(path, err)
+				}
+			}
+		}
+	}
+
+	for i, et := range data.Templates {
+		path := fmt.Sprintf("templates[%d]", i)
+		if err := validateName("Template", et.Name, MaxListNameLength); err != nil {
+			return atPath(path, err)
+		}
+		if len(et.Description) > MaxDescriptionLength {
+			return atPath(path, invalid(fmt.Sprintf("Template description exceeds maximum length of %d characters", MaxDescriptionLength)))
+		}
+		for j, item := range et.Items {
+			path := fmt.Sprintf("%s.items[%d]", path, j)
+			if err := validateName("Section", item.Section, MaxSectionNameLength); err != nil {
+				return atPath(path, err)
+			}
+			if err := validateName("Item", item.Name, MaxItemNameLength); err != nil {
+				return atPath(path, err)
+			}
+			if err := validateDescription(item.Description); err != nil {
+				return atPath(path, err)
+			}
+		}
+	}
+
+	for i, h := range data.History {
+		if err := validateName("Item", h.Name, MaxItemNameLength); err != nil {
+			return atPath(fmt.Sprintf("history[%d]", i), err)
+		}
+	}
+	return nil
+}
+
+// exportUsers looks up the members the lists of an export name, and with
+// system access their owners. They must exist already, as permissions are
+// only ever granted to known users.
+func (s *Service) exportUsers(userID int64, data *Export) (map[string]int64, error) {
+	users := make(map[string]int64)
+	lookup := func(path, username string) error {
+		if _, ok := users[username]; ok {
+			return nil
+		}
+		user, err := s.store.GetUserByUsername(username)
+		if err == sql.ErrNoRows {
+			return atPath(path, invalid("Unknown user: "+username))
+		}
+		if err != nil {
+			return internal("db_error", "Failed to fetch user", err)
+		}
+		users[username] = user.ID
+		return nil
+	}
+
+	for i, el := range data.Lists {
+		path := fmt.Sprintf("lists[%d]", i)
+		if userID == 0 && el.Owner != "" {
+			if err := lookup(path, el.Owner); err != nil {
+				return nil, err
+			}
+		}
+		for j, m := range el.Members {
+			if err := lookup(fmt.Sprintf("%s.members[%d]", path, j), m.Username); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return users, nil
+}
+
+// atPath prefixes a validation error with the entry it is about
+func atPath(path string, err error) error {
+	e := AsError(err)
+	return &Error{Kind: e.Kind, Code: e.Code, Message: path + ": " + e.Message, Err: e.Err}
+}
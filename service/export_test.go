@@ -0,0 +1,206 @@
+package service
+
+import (
+	"errors"
+	"shopping-list/db"
+	"strings"
+	"testing"
+)
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// newExportTest returns a service with two lists, a template and webhooks and
+// an inbound hook bound to the first list
+func newExportTest(t *testing.T) (*Service, db.Store) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	s := New(store)
+
+	groceries := must(s.CreateList(0, "Groceries", ""))
+	dairy := must(s.CreateSection(0, groceries.ID, "Dairy"))
+	must(s.CreateItem(0, dairy.ID, "Milk", "2 l"))
+	eggs := must(s.CreateItem(0, dairy.ID, "Eggs", ""))
+	must(s.ToggleItemCompleted(0, eggs.ID))
+	if err := s.SetActiveList(0, groceries.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	hardware := must(s.CreateList(0, "Hardware", ""))
+	must(s.CreateSection(0, hardware.ID, "Tools"))
+
+	template := must(s.CreateTemplate("Weekly", "Every Saturday"))
+	must(s.AddTemplateItem(template.ID, "Dairy", "Butter", ""))
+
+	must(store.CreateWebhook(&db.Webhook{Name: "all lists", URL: "http://example.com/all", Events: []string{"*"}, Enabled: true}))
+	must(store.CreateWebhook(&db.Webhook{Name: "groceries", URL: "http://example.com/groceries", Events: []string{"*"}, ListID: groceries.ID, Enabled: true}))
+	must(store.CreateInboundHook(&db.InboundHook{Name: "shortcut", ListID: groceries.ID}, "hash"))
+	return s, store
+}
+
+func sectionNames(lists []ExportList) []string {
+	var names []string
+	for _, l := range lists {
+		for _, s := range l.Sections {
+			names = append(names, l.Name+"/"+s.Name)
+		}
+	}
+	return names
+}
+
+func TestExport(t *testing.T) {
+	s, _ := newExportTest(t)
+	export := must(s.Export(0))
+
+	if export.Format != ExportFormat || export.Version != ExportVersion {
+		t.Errorf("export is %s version %d", export.Format, export.Version)
+	}
+	if got := strings.Join(sectionNames(export.Lists), ", "); got != "Groceries/Dairy, Hardware/Tools" {
+		t.Errorf("exported sections = %s", got)
+	}
+	groceries := export.Lists[0]
+	if !groceries.Active || export.Lists[1].Active {
+		t.Error("the active list isn't marked")
+	}
+	items := groceries.Sections[0].Items
+	if len(items) != 2 || items[0] != (ExportItem{Name: "Milk", Description: "2 l"}) || items[1] != (ExportItem{Name: "Eggs", Completed: true}) {
+		t.Errorf("exported items = %+v", items)
+	}
+	if len(export.Templates) != 1 || len(export.Templates[0].Items) != 1 || export.Templates[0].Items[0].Section != "Dairy" {
+		t.Errorf("exported templates = %+v", export.Templates)
+	}
+}
+
+func TestImportValidatesFirst(t *testing.T) {
+	s, _ := newExportTest(t)
+	valid := must(s.Export(0))
+
+	tests := []struct {
+		name   string
+		change func(e *Export)
+		mode   string
+		want   string
+	}{
+		{"another format", func(e *Export) { e.Format = "other" }, ImportMerge, "Not a Koffan export"},
+		{"a newer version", func(e *Export) { e.Version = ExportVersion + 1 }, ImportMerge, "not supported"},
+		{"an unknown mode", func(e *Export) {}, "append", "Import mode"},
+		{"no lists to replace with", func(e *Export) { e.Lists = nil }, ImportReplace, "at least one list"},
+		{"an item without a name", func(e *Export) {
+			e.Lists[1].Sections[0].Items = []ExportItem{{Name: "Saw"}, {Name: ""}}
+		}, ImportMerge, "lists[1].sections[0].items[1]"},
+		{"an unknown member role", func(e *Export) {
+			e.Lists[0].Members = []ExportMember{{Username: "alice", Role: "owner"}}
+		}, ImportMerge, "lists[0].members[0]"},
+	}
+	for _, tt := range tests {
+		data := must(s.Export(0))
+		tt.change(data)
+		_, err := s.Import(0, data, tt.mode)
+		var serr *Error
+		if !errors.As(err, &serr) || serr.Kind != KindInvalid || !strings.Contains(serr.Message, tt.want) {
+			t.Errorf("importing %s = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Nothing of a rejected file is saved
+	after := must(s.Export(0))
+	if len(after.Lists) != len(valid.Lists) || len(after.Templates) != len(valid.Templates) {
+		t.Errorf("a rejected import left %d lists and %d templates", len(after.Lists), len(after.Templates))
+	}
+
+	if _, err := s.Import(1, valid, ImportReplace); err == nil {
+		t.Error("a user replaced all data")
+	}
+}
+
+func TestImportMerge(t *testing.T) {
+	s, store := newExportTest(t)
+	data := must(s.Export(0))
+
+	result := must(s.Import(0, data, ImportMerge))
+	if result.Lists != 2 || result.Sections != 2 || result.Items != 2 || result.Templates != 1 {
+		t.Errorf("merge result = %+v", result)
+	}
+	if result.RemovedWebhooks != nil || result.RemovedInboundHooks != nil {
+		t.Errorf("merging reported removed hooks: %+v", result)
+	}
+
+	after := must(s.Export(0))
+	want := "Groceries/Dairy, Hardware/Tools, Groceries/Dairy, Hardware/Tools"
+	if got := strings.Join(sectionNames(after.Lists), ", "); got != want {
+		t.Errorf("sections after merging = %s", got)
+	}
+	// Merging keeps the active list and the hooks
+	if !after.Lists[0].Active || after.Lists[2].Active {
+		t.Error("merging changed the active list")
+	}
+	if n := len(must(store.GetWebhooks())); n != 2 {
+		t.Errorf("%d webhooks after merging", n)
+	}
+	if n := len(must(store.GetInboundHooks())); n != 1 {
+		t.Errorf("%d inbound hooks after merging", n)
+	}
+}
+
+func TestImportReplace(t *testing.T) {
+	s, store := newExportTest(t)
+	data := must(s.Export(0))
+	data.Lists = data.Lists[1:]
+	data.Lists[0].Active = false
+	data.History = []ExportHistory{{Name: "Hammer", UsageCount: 3, List: "hardware", Section: "TOOLS"}}
+
+	var events []string
+	s.Subscribe(func(e Event) { events = append(events, e.Type) })
+
+	result := must(s.Import(0, data, ImportReplace))
+	if result.Lists != 1 || result.Sections != 1 || result.Items != 0 || result.Templates != 1 || result.History != 1 {
+		t.Errorf("replace result = %+v", result)
+	}
+	if !equalStrings(result.RemovedWebhooks, []string{"groceries"}) || !equalStrings(result.RemovedInboundHooks, []string{"shortcut"}) {
+		t.Errorf("removed hooks = %q and %q", result.RemovedWebhooks, result.RemovedInboundHooks)
+	}
+	if !equalStrings(events, []string{EventDataImported}) {
+		t.Errorf("events = %q", events)
+	}
+
+	after := must(s.Export(0))
+	if got := strings.Join(sectionNames(after.Lists), ", "); got != "Hardware/Tools" {
+		t.Errorf("sections after replacing = %s", got)
+	}
+	// Without an active list in the file the first one becomes active
+	if !after.Lists[0].Active {
+		t.Error("no list is active after replacing")
+	}
+	if len(after.Templates) != 1 {
+		t.Errorf("%d templates after replacing", len(after.Templates))
+	}
+	// History finds its section by name, ignoring case
+	if len(after.History) != 1 || after.History[0].List != "Hardware" || after.History[0].Section != "Tools" {
+		t.Errorf("history after replacing = %+v", after.History)
+	}
+
+	// Webhooks for all lists stay; the reported ones are gone
+	webhooks := must(store.GetWebhooks())
+	if len(webhooks) != 1 || webhooks[0].Name != "all lists" {
+		t.Errorf("webhooks after replacing = %+v", webhooks)
+	}
+	if n := len(must(store.GetInboundHooks())); n != 0 {
+		t.Errorf("%d inbound hooks after replacing", n)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
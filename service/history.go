@@ -0,0 +1,60 @@
+package service
+
+import (
+	"database/sql"
+	"shopping-list/db"
+)
+
+// MaxHistoryBatch is how many history entries one request may delete
+const MaxHistoryBatch = 100
+
+// SaveHistory remembers an item name for auto-completion, with the section
+// it was last added to if sectionID is set
+func (s *Service) SaveHistory(userID int64, name string, sectionID int64) error {
+	if err := validateName("Item", name, MaxItemNameLength); err != nil {
+		return err
+	}
+	if sectionID != 0 {
+		if _, err := s.RequireSectionRole(userID, sectionID, db.RoleEditor); err != nil {
+			return err
+		}
+	}
+
+	if err := s.store.SaveItemHistory(name, sectionID); err != nil {
+		return internal("create_failed", "Failed to save history", err)
+	}
+
+	s.publish(0, EventHistoryItemSaved, map[string]interface{}{"name": name, "section_id": sectionID})
+	return nil
+}
+
+// DeleteHistory forgets one item name
+func (s *Service) DeleteHistory(id int64) error {
+	if err := s.store.DeleteItemHistory(id); err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("History entry")
+		}
+		return internal("delete_failed", "Failed to delete history entry", err)
+	}
+
+	s.publish(0, EventHistoryItemDeleted, map[string]int64{"id": id})
+	return nil
+}
+
+// DeleteHistoryBatch forgets several item names and returns how many it found
+func (s *Service) DeleteHistoryBatch(ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, invalid("No IDs provided")
+	}
+	if len(ids) > MaxHistoryBatch {
+		return 0, invalid("Too many IDs (max 100)")
+	}
+
+	deleted, err := s.store.DeleteItemHistoryBatch(ids)
+	if err != nil {
+		return 0, internal("delete_failed", "Failed to delete history entries", err)
+	}
+
+	s.publish(0, EventHistoryItemsDeleted, map[string]interface{}{"ids": ids, "count": deleted})
+	return deleted, nil
+}
@@ -0,0 +1,534 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"shopping-list/db"
+	"sort"
+	"strings"
+)
+
+// ImportPlan is what importing a file exported by another app creates: new
+// lists, or with ListID sections added to that existing list
+type ImportPlan struct {
+	Format   string
+	Lists    []NewList
+	ListID   int64
+	Sections []NewSection
+	Skipped  int
+}
+
+// Counts returns how many lists, sections and items the plan creates
+func (p *ImportPlan) Counts() (lists, sections, items int) {
+	added := p.Sections
+	for _, l := range p.Lists {
+		lists++
+		added = append(added, l.Sections...)
+	}
+	sections = len(added)
+	for _, s := range added {
+		items += len(s.Items)
+	}
+	return lists, sections, items
+}
+
+// ImportFormats returns the names of the formats PlanImport reads
+func ImportFormats() []string {
+	formats := make([]string, 0, len(importers))
+	for format := range importers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// PlanImport parses a file exported by another app and validates what
+// importing it would create, without creating anything. list names the lists
+// the file doesn't name; with listID all items go to that list instead.
+func (s *Service) PlanImport(userID int64, format string, data []byte, list string, listID int64) (*ImportPlan, error) {
+	format = strings.ToLower(format)
+	parse, ok := importers[format]
+	if !ok {
+		return nil, &Error{Kind: KindInvalid, Code: "unsupported_format", Message: "Supported formats: " + strings.Join(ImportFormats(), ", ")}
+	}
+
+	parsed, err := parse(data, list)
+	if err == nil && len(parsed.newLists()) == 0 {
+		err = errNoItems
+	}
+	if err != nil {
+		return nil, &Error{Kind: KindInvalid, Code: "invalid_file", Message: "Could not import the file: " + err.Error()}
+	}
+
+	plan := &ImportPlan{Format: format, Lists: parsed.newLists(), Skipped: parsed.skipped}
+
+	// Adding to an existing list turns all lists into sections of that list
+	if listID != 0 {
+		if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+			return nil, err
+		}
+		merged := &importPlan{}
+		for _, l := range plan.Lists {
+			for _, section := range l.Sections {
+				for _, item := range section.Items {
+					merged.add(defaultImportList, section.Name, item.Name, item.Description)
+				}
+			}
+		}
+		plan.Lists, plan.ListID, plan.Sections = nil, listID, merged.lists[0].Sections
+		if err := ValidateSections(plan.Sections); err != nil {
+			return nil, err
+		}
+		return plan, nil
+	}
+
+	for _, l := range plan.Lists {
+		if err := ValidateNewList(l); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// RunImport creates what a plan describes in one transaction
+func (s *Service) RunImport(userID int64, plan *ImportPlan) ([]*BatchResult, error) {
+	if plan.ListID != 0 {
+		result, err := s.AddSections(userID, plan.ListID, plan.Sections)
+		if err != nil {
+			return nil, err
+		}
+		return []*BatchResult{result}, nil
+	}
+	return s.CreateListsWithSections(userID, plan.Lists)
+}
+
+// Names used when the imported file doesn't have one
+const (
+	defaultImportList    = "Imported"
+	defaultImportSection = "Other"
+)
+
+// importer parses a file exported by another app; list is the name for
+// lists the file doesn't name
+type importer func(data []byte, list string) (*importPlan, error)
+
+// importers maps the format names PlanImport accepts
+var importers = map[string]importer{
+	"csv":          parseCSVImport,
+	"text":         parseTextImport,
+	"ourgroceries": parseTextImport,
+	"anylist":      parseTextImport,
+	"keep":         parseKeepImport,
+	"todoist":      parseTodoistImport,
+}
+
+// errNoItems is returned when a file parses but contains nothing to import
+var errNoItems = errors.New("no items found")
+
+// importPlan collects the lists of an imported file in the order they appear.
+// Sections and lists with the same name (ignoring case) are merged.
+type importPlan struct {
+	lists   []*NewList
+	skipped int
+}
+
+func (p *importPlan) add(list, section, name, description string) {
+	list = cleanImportText(list)
+	if list == "" {
+		list = defaultImportList
+	}
+	section = cleanImportText(section)
+	if section == "" {
+		section = defaultImportSection
+	}
+	name = cleanImportText(name)
+	if name == "" {
+		return
+	}
+
+	var l *NewList
+	for _, existing := range p.lists {
+		if strings.EqualFold(existing.Name, list) {
+			l = existing
+			break
+		}
+	}
+	if l == nil {
+		l = &NewList{Name: list}
+		p.lists = append(p.lists, l)
+	}
+
+	var s *NewSection
+	for i := range l.Sections {
+		if strings.EqualFold(l.Sections[i].Name, section) {
+			s = &l.Sections[i]
+			break
+		}
+	}
+	if s == nil {
+		l.Sections = append(l.Sections, NewSection{Name: section})
+		s = &l.Sections[len(l.Sections)-1]
+	}
+	s.Items = append(s.Items, NewItem{Name: name, Description: cleanImportText(description)})
+}
+
+// newLists returns the lists that have items
+func (p *importPlan) newLists() []NewList {
+	lists := []NewList{}
+	for _, l := range p.lists {
+		if len(l.Sections) > 0 {
+			lists = append(lists, *l)
+		}
+	}
+	return lists
+}
+
+// cleanImportText trims whitespace and drops invalid UTF-8 and control characters
+func cleanImportText(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\t' {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// ==================== CSV ====================
+
+// csvColumns lists the header names recognized for each field, lower case
+var csvColumns = map[string][]string{
+	"list":        {"list", "list name", "shopping list"},
+	"section":     {"section", "category", "aisle", "department", "group"},
+	"name":        {"item", "name", "item name", "product", "title"},
+	"quantity":    {"quantity", "qty", "amount"},
+	"description": {"description", "notes", "note", "details", "comment"},
+	"done":        {"completed", "done", "checked", "crossed off", "purchased"},
+}
+
+// parseCSVImport reads a CSV file with a header row. The item column is
+// required; list, section, quantity, notes and completed columns are optional.
+// Comma, semicolon and tab separated files are accepted.
+func parseCSVImport(data []byte, list string) (*importPlan, error) {
+	rows, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errNoItems
+	}
+
+	columns := make(map[string]int)
+	for i, header := range rows[0] {
+		header = strings.ToLower(cleanImportText(strings.TrimPrefix(header, "\uFEFF")))
+		for field, names := range csvColumns {
+			if _, found := columns[field]; found {
+				continue
+			}
+			for _, name := range names {
+				if header == name {
+					columns[field] = i
+				}
+			}
+		}
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("the header row needs an item or name column")
+	}
+
+	plan := &importPlan{}
+	for _, row := range rows[1:] {
+		get := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		if isTruthy(get("done")) {
+			plan.skipped++
+			continue
+		}
+		listName := get("list")
+		if listName == "" {
+			listName = list
+		}
+		plan.add(listName, get("section"), get("name"), joinNonEmpty(get("quantity"), get("description")))
+	}
+	return plan, nil
+}
+
+// readCSV parses CSV with the delimiter that splits the header row most
+func readCSV(data []byte) ([][]string, error) {
+	header, _, _ := strings.Cut(string(data), "\n")
+	delimiter := ','
+	for _, d := range []rune{';', '\t'} {
+		if strings.Count(header, string(d)) > strings.Count(header, string(delimiter)) {
+			delimiter = d
+		}
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, errors.New("invalid CSV: " + err.Error())
+	}
+	return rows, nil
+}
+
+func isTruthy(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes", "y", "x", "done", "checked", "completed":
+		return true
+	}
+	return false
+}
+
+func joinNonEmpty(parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+// ==================== TEXT (OurGroceries, AnyList) ====================
+
+var (
+	// textBullet matches list markers in front of an item
+	textBullet = regexp.MustCompile(`^(?:[-*+•◦▪‣]|\d+[.)]|\[[ xX]?\]|[☐☑☒✓✔])\s*`)
+	// textChecked matches markers of items that are already crossed off
+	textChecked = regexp.MustCompile(`^(?:\[[xX]\]|[☑☒✓✔])`)
+	// textTrailingNote matches "Milk (2 l)"
+	textTrailingNote = regexp.MustCompile(`^(.+?)\s*\(([^()]+)\)$`)
+)
+
+// crossedOffHeadings are the headings under which OurGroceries and AnyList
+// list items that are already bought
+var crossedOffHeadings = []string{"crossed off", "checked off", "completed", "done"}
+
+// parseTextImport reads a list shared as text, as OurGroceries and AnyList do:
+//
+//	Groceries
+//
+//	Produce
+//	  Apples
+//	  Bananas (6)
+//	Dairy:
+//	- Milk - 2 l
+//
+// A first line followed by an empty line, or a "# " line, names the list.
+// A line is a section heading if it ends with ":" or is followed by indented or
+// bulleted items. Crossed off items and sections are skipped.
+func parseTextImport(data []byte, list string) (*importPlan, error) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	// Drop leading empty lines
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil, errNoItems
+	}
+
+	listName := list
+	if title, ok := strings.CutPrefix(strings.TrimSpace(lines[0]), "# "); ok {
+		if listName == "" {
+			listName = title
+		}
+		lines = lines[1:]
+	} else if len(lines) > 2 && strings.TrimSpace(lines[1]) == "" && !isTextItemLine(lines[0]) {
+		if listName == "" {
+			listName = strings.TrimSpace(lines[0])
+		}
+		lines = lines[2:]
+	}
+
+	plan := &importPlan{}
+	section := ""
+	crossedOff := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		heading := false
+		if !isTextItemLine(line) {
+			if name, ok := strings.CutSuffix(trimmed, ":"); ok {
+				heading, trimmed = true, name
+			} else if strings.HasPrefix(trimmed, "## ") {
+				heading, trimmed = true, strings.TrimPrefix(trimmed, "## ")
+			} else if next := nextTextLine(lines, i); next != "" && isTextItemLine(next) {
+				heading = true
+			}
+		}
+		if heading {
+			section = trimmed
+			crossedOff = false
+			for _, h := range crossedOffHeadings {
+				if strings.EqualFold(section, h) {
+					crossedOff = true
+				}
+			}
+			continue
+		}
+
+		if crossedOff || textChecked.MatchString(trimmed) {
+			plan.skipped++
+			continue
+		}
+		name, description := splitTextItem(textBullet.ReplaceAllString(trimmed, ""))
+		plan.add(listName, section, name, description)
+	}
+	return plan, nil
+}
+
+// isTextItemLine reports whether a line is indented or starts with a list marker
+func isTextItemLine(line string) bool {
+	if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+		return strings.TrimSpace(line) != ""
+	}
+	return textBullet.MatchString(line)
+}
+
+// nextTextLine returns the line after i; a blank line ends a section's items
+func nextTextLine(lines []string, i int) string {
+	if i+1 < len(lines) {
+		return lines[i+1]
+	}
+	return ""
+}
+
+// splitTextItem separates a note from the item name: "Milk - 2 l" or "Milk (2 l)"
+func splitTextItem(s string) (name, description string) {
+	if name, description, ok := strings.Cut(s, " - "); ok {
+		return name, description
+	}
+	if m := textTrailingNote.FindStringSubmatch(s); m != nil {
+		return m[1], m[2]
+	}
+	return s, ""
+}
+
+// ==================== GOOGLE KEEP ====================
+
+// keepNote is a note of a Google Takeout Keep export, one JSON file per note
+type keepNote struct {
+	Title       string `json:"title"`
+	IsTrashed   bool   `json:"isTrashed"`
+	IsArchived  bool   `json:"isArchived"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+}
+
+// parseKeepImport reads Google Keep checklists from Takeout: a single note
+// or an array of notes. Each checklist becomes a list; trashed notes, notes
+// without a checklist and checked items are skipped.
+func parseKeepImport(data []byte, list string) (*importPlan, error) {
+	var notes []keepNote
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &notes); err != nil {
+			return nil, errors.New("invalid Keep JSON: " + err.Error())
+		}
+	} else {
+		var note keepNote
+		if err := json.Unmarshal(trimmed, &note); err != nil {
+			return nil, errors.New("invalid Keep JSON: " + err.Error())
+		}
+		notes = []keepNote{note}
+	}
+
+	plan := &importPlan{}
+	for _, note := range notes {
+		if note.IsTrashed || len(note.ListContent) == 0 {
+			plan.skipped++
+			continue
+		}
+		name := note.Title
+		if name == "" {
+			name = list
+		}
+		for _, entry := range note.ListContent {
+			if entry.IsChecked {
+				plan.skipped++
+				continue
+			}
+			plan.add(name, "", entry.Text, "")
+		}
+	}
+	return plan, nil
+}
+
+// ==================== TODOIST ====================
+
+// parseTodoistImport reads a Todoist project exported as CSV. Section rows
+// start sections; task rows, including sub-tasks, become items with their
+// description. The project is one list, named by list.
+func parseTodoistImport(data []byte, list string) (*importPlan, error) {
+	rows, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errNoItems
+	}
+
+	columns := make(map[string]int)
+	for i, header := range rows[0] {
+		columns[strings.ToUpper(cleanImportText(strings.TrimPrefix(header, "\uFEFF")))] = i
+	}
+	for _, required := range []string{"TYPE", "CONTENT"} {
+		if _, ok := columns[required]; !ok {
+			return nil, errors.New("not a Todoist CSV export: missing the " + required + " column")
+		}
+	}
+
+	if list == "" {
+		list = "Todoist"
+	}
+	plan := &importPlan{}
+	section := ""
+	for _, row := range rows[1:] {
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		content := todoistMarkup(get("CONTENT"))
+		switch strings.ToLower(get("TYPE")) {
+		case "section":
+			section = content
+		case "task":
+			// "* " marks tasks that can't be completed, used as headings
+			if heading, ok := strings.CutPrefix(content, "* "); ok {
+				section = heading
+				continue
+			}
+			plan.add(list, section, content, todoistMarkup(get("DESCRIPTION")))
+		}
+	}
+	return plan, nil
+}
+
+// todoistLink matches Markdown links, which Todoist keeps in task names
+var todoistLink = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+
+// todoistMarkup reduces Todoist's Markdown to plain text
+func todoistMarkup(s string) string {
+	s = todoistLink.ReplaceAllString(s, "$1")
+	s = strings.NewReplacer("**", "", "__", "", "`", "").Replace(s)
+	return strings.TrimSpace(s)
+}
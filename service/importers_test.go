@@ -0,0 +1,198 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+// describeSections renders sections as "Section: Item (description), ...; ..."
+// with completed items marked by "x "
+func describeSections(sections []NewSection) string {
+	var parts []string
+	for _, s := range sections {
+		var items []string
+		for _, item := range s.Items {
+			text := item.Name
+			if item.Description != "" {
+				text += " (" + item.Description + ")"
+			}
+			if item.Completed {
+				text = "x " + text
+			}
+			items = append(items, text)
+		}
+		parts = append(parts, s.Name+": "+strings.Join(items, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// describePlan renders the lists of a plan as "List { sections } List { ... }"
+func describePlan(plan *importPlan) string {
+	var parts []string
+	for _, l := range plan.newLists() {
+		parts = append(parts, l.Name+" { "+describeSections(l.Sections)+" }")
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestImportParsers(t *testing.T) {
+	tests := []struct {
+		name, format, data, list string
+		want                     string
+		skipped                  int
+	}{
+		{
+			name:   "csv with all columns",
+			format: "csv",
+			data: "List,Category,Item,Qty,Notes,Done\n" +
+				"Groceries,Dairy,Milk,2 l,organic,\n" +
+				"Groceries,Dairy,Eggs,,,yes\n" +
+				"Groceries,Produce,Apples,6,,no\n" +
+				"Hardware,,Screws,,,\n",
+			want:    "Groceries { Dairy: Milk (2 l, organic); Produce: Apples (6) } Hardware { Other: Screws }",
+			skipped: 1,
+		},
+		{
+			name:   "csv with semicolons, a BOM and no list column",
+			format: "csv",
+			data:   "\uFEFFName;Aisle\nMilk;Dairy\n\"Bread; sliced\";Bakery\nmilk;dairy\n",
+			list:   "Weekly",
+			want:   "Weekly { Dairy: Milk, milk; Bakery: Bread; sliced }",
+		},
+		{
+			name:   "tab separated csv without a list name",
+			format: "csv",
+			data:   "item\tsection\nCoffee\tDrinks\n",
+			want:   "Imported { Drinks: Coffee }",
+		},
+		{
+			name:   "ourgroceries text",
+			format: "ourgroceries",
+			data: "Groceries\n\n" +
+				"Produce\n  Apples\n  Bananas (6)\n" +
+				"Dairy:\n- Milk - 2 l\n" +
+				"Crossed Off\n  Eggs\n",
+			want:    "Groceries { Produce: Apples, Bananas (6); Dairy: Milk (2 l) }",
+			skipped: 1,
+		},
+		{
+			name:    "anylist text with a title and checkboxes",
+			format:  "anylist",
+			data:    "# Party\n\n## Drinks\n[ ] Juice\n[x] Water\n☐ Lemonade\n✓ Cola\n",
+			want:    "Party { Drinks: Juice, Lemonade }",
+			skipped: 2,
+		},
+		{
+			name:   "text without headings",
+			format: "text",
+			data:   "\r\n- Milk\r\n- Bread\r\n",
+			list:   "Quick",
+			want:   "Quick { Other: Milk, Bread }",
+		},
+		{
+			name:   "a keep note",
+			format: "keep",
+			data: `{"title": "Groceries", "listContent": [
+				{"text": "Milk", "isChecked": false},
+				{"text": "Eggs", "isChecked": true},
+				{"text": "  ", "isChecked": false}]}`,
+			want:    "Groceries { Other: Milk }",
+			skipped: 1,
+		},
+		{
+			name:   "keep notes without titles, trashed or without a checklist",
+			format: "keep",
+			data: `[{"title": "", "listContent": [{"text": "Tea"}]},
+				{"title": "Old", "isTrashed": true, "listContent": [{"text": "Gone"}]},
+				{"title": "Text note", "textContent": "no checklist"},
+				{"title": "groceries", "listContent": [{"text": "Bread"}]},
+				{"title": "Groceries", "listContent": [{"text": "Butter"}]}]`,
+			list:    "Keep",
+			want:    "Keep { Other: Tea } groceries { Other: Bread, Butter }",
+			skipped: 2,
+		},
+		{
+			name:   "a todoist project",
+			format: "todoist",
+			data: "TYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT\n" +
+				"section,Produce,,,\n" +
+				"task,Apples,the **green** ones,1,1\n" +
+				"task,[Coffee](https://example.com/coffee),,1,2\n" +
+				"note,A comment,,,\n" +
+				"section,Dairy,,,\n" +
+				"task,* Cheese counter,,1,1\n" +
+				"task,`Gouda`,,1,1\n",
+			want: "Todoist { Produce: Apples (the green ones), Coffee; Cheese counter: Gouda }",
+		},
+	}
+	for _, tt := range tests {
+		plan, err := importers[tt.format]([]byte(tt.data), tt.list)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := describePlan(plan); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+		if plan.skipped != tt.skipped {
+			t.Errorf("%s: %d skipped, want %d", tt.name, plan.skipped, tt.skipped)
+		}
+	}
+}
+
+func TestImportParsersReject(t *testing.T) {
+	tests := []struct {
+		name, format, data, want string
+	}{
+		{"csv without an item column", "csv", "List,Quantity\nGroceries,2\n", "item or name column"},
+		{"an empty csv", "csv", "", "no items found"},
+		{"broken keep json", "keep", `{"title": `, "invalid Keep JSON"},
+		{"a csv that isn't from todoist", "todoist", "Item,Quantity\nMilk,1\n", "missing the TYPE column"},
+		{"an empty text", "text", "\n \n", "no items found"},
+	}
+	for _, tt := range tests {
+		_, err := importers[tt.format]([]byte(tt.data), "")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCleanImportText(t *testing.T) {
+	tests := map[string]string{
+		"  Milk  ":        "Milk",
+		"Milk\x00\x1b":    "Milk",
+		"Tab\tinside":     "Tab\tinside",
+		"bad\xffbyte":     "badbyte",
+		"Żółty ser\r\n":   "Żółty ser",
+		"\u00a0spaced\t ": "spaced",
+	}
+	for in, want := range tests {
+		if got := cleanImportText(in); got != want {
+			t.Errorf("cleanImportText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPlanImportIntoList(t *testing.T) {
+	s, _ := newExportTest(t)
+	lists := must(s.store.GetAllLists(0))
+
+	plan := must(s.PlanImport(0, "CSV", []byte("List,Section,Item\nA,Dairy,Milk\nB,dairy,Cheese\nB,Bakery,Bread\n"), "", lists[1].ID))
+	if plan.ListID != lists[1].ID || plan.Lists != nil {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if got := describeSections(plan.Sections); got != "Dairy: Milk, Cheese; Bakery: Bread" {
+		t.Errorf("sections added to the list = %s", got)
+	}
+	if lists, sections, items := plan.Counts(); lists != 0 || sections != 2 || items != 3 {
+		t.Errorf("counts = %d lists, %d sections, %d items", lists, sections, items)
+	}
+
+	if _, err := s.PlanImport(0, "pdf", []byte("x"), "", 0); err == nil || AsError(err).Code != "unsupported_format" {
+		t.Errorf("planning an unknown format = %v", err)
+	}
+	if _, err := s.PlanImport(0, "csv", []byte("Item,Done\nMilk,x\n"), "", 0); err == nil || AsError(err).Code != "invalid_file" {
+		t.Errorf("planning a file with only crossed off items = %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"database/sql"
+	"shopping-list/db"
+)
+
+// ItemUpdate holds the fields to change on an item; nil fields are kept
+type ItemUpdate struct {
+	Name        *string
+	Description *string
+}
+
+// CreateItem adds an item at the end of a section and remembers its name for suggestions
+func (s *Service) CreateItem(userID, sectionID int64, name, description string) (*db.Item, error) {
+	if err := validateName("Item", name, MaxItemNameLength); err != nil {
+		return nil, err
+	}
+	if err := validateDescription(description); err != nil {
+		return nil, err
+	}
+	listID, err := s.RequireSectionRole(userID, sectionID, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.store.CreateItem(sectionID, name, description)
+	if err != nil {
+		return nil, internal("create_failed", "Failed to create item", err)
+	}
+
+	// Save to item history for auto-completion
+	s.store.SaveItemHistory(name, sectionID)
+
+	s.publish(listID, EventItemCreated, item)
+	return item, nil
+}
+
+// UpdateItem changes an item's name or description
+func (s *Service) UpdateItem(userID, id int64, update ItemUpdate) (*db.Item, error) {
+	listID, err := s.RequireItemRole(userID, id, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.getItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	name, description := existing.Name, existing.Description
+	if update.Name != nil {
+		name = *update.Name
+	}
+	if update.Description != nil {
+		description = *update.Description
+	}
+	if err := validateName("Item", name, MaxItemNameLength); err != nil {
+		return nil, err
+	}
+	if err := validateDescription(description); err != nil {
+		return nil, err
+	}
+
+	item, err := s.store.UpdateItem(id, name, description)
+	if err != nil {
+		return nil, internal("update_failed", "Failed to update item", err)
+	}
+
+	s.publish(listID, EventItemUpdated, item)
+	return item, nil
+}
+
+// DeleteItem deletes an item
+func (s *Service) DeleteItem(userID, id int64) error {
+	listID, err := s.RequireItemRole(userID, id, db.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteItem(id); err != nil {
+		return internal("delete_failed", "Failed to delete item", err)
+	}
+
+	s.publish(listID, EventItemDeleted, map[string]int64{"id": id})
+	return nil
+}
+
+// DeleteCompletedItems deletes the completed items of a list.
+// Returns how many were deleted.
+func (s *Service) DeleteCompletedItems(userID, listID int64) (int64, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+		return 0, err
+	}
+
+	count, err := s.store.DeleteCompletedItems(listID)
+	if err != nil {
+		return 0, internal("delete_failed", "Failed to delete completed items", err)
+	}
+
+	s.publish(listID, EventCompletedItemsDeleted, map[string]int64{"count": count})
+	return count, nil
+}
+
+// ToggleItemCompleted checks or unchecks an item
+func (s *Service) ToggleItemCompleted(userID, id int64) (*db.Item, error) {
+	listID, err := s.RequireItemRole(userID, id, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.store.ToggleItemCompleted(id)
+	if err != nil {
+		return nil, internal("toggle_failed", "Failed to toggle item", err)
+	}
+
+	s.publish(listID, EventItemToggled, item)
+	return item, nil
+}
+
+// SetItemCompleted checks or unchecks an item; an item already in that state is left alone
+func (s *Service) SetItemCompleted(userID, id int64, completed bool) (*db.Item, error) {
+	if _, err := s.RequireItemRole(userID, id, db.RoleEditor); err != nil {
+		return nil, err
+	}
+	item, err := s.getItem(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Completed == completed {
+		return item, nil
+	}
+	return s.ToggleItemCompleted(userID, id)
+}
+
+// ToggleItemUncertain marks or unmarks an item as uncertain
+func (s *Service) ToggleItemUncertain(userID, id int64) (*db.Item, error) {
+	listID, err := s.RequireItemRole(userID, id, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.store.ToggleItemUncertain(id)
+	if err != nil {
+		return nil, internal("toggle_failed", "Failed to toggle item", err)
+	}
+
+	s.publish(listID, EventItemUpdated, item)
+	return item, nil
+}
+
+// MoveItemToSection moves an item to the end of another section.
+// The user must be able to edit both lists.
+func (s *Service) MoveItemToSection(userID, id, sectionID int64) (*db.Item, error) {
+	listID, err := s.RequireItemRole(userID, id, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if sectionID == 0 {
+		return nil, invalid("section_id is required")
+	}
+	targetListID, err := s.RequireSectionRole(userID, sectionID, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.store.MoveItemToSection(id, sectionID)
+	if err != nil {
+		return nil, internal("move_failed", "Failed to move item", err)
+	}
+
+	s.publish(listID, EventItemMoved, item)
+	if targetListID != listID {
+		s.publish(targetListID, EventItemMoved, item)
+	}
+	return item, nil
+}
+
+// MoveItemUp moves an item one place up within its section
+func (s *Service) MoveItemUp(userID, id int64) (*db.Item, error) {
+	return s.moveItem(userID, id, s.store.MoveItemUp)
+}
+
+// MoveItemDown moves an item one place down within its section
+func (s *Service) MoveItemDown(userID, id int64) (*db.Item, error) {
+	return s.moveItem(userID, id, s.store.MoveItemDown)
+}
+
+func (s *Service) moveItem(userID, id int64, move func(id int64) error) (*db.Item, error) {
+	listID, err := s.RequireItemRole(userID, id, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := move(id); err != nil {
+		return nil, internal("move_failed", "Failed to move item", err)
+	}
+
+	item, err := s.getItem(id)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(listID, EventItemsReordered, map[string]int64{"section_id": item.SectionID})
+	return item, nil
+}
+
+func (s *Service) getItem(id int64) (*db.Item, error) {
+	item, err := s.store.GetItemByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("Item")
+		}
+		return nil, internal("db_error", "Failed to fetch item", err)
+	}
+	return item, nil
+}
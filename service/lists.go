@@ -0,0 +1,205 @@
+package service
+
+import (
+	"database/sql"
+	"shopping-list/db"
+	"strings"
+)
+
+// ListUpdate holds the fields to change on a list; nil fields are kept
+type ListUpdate struct {
+	Name *string
+	Icon *string
+}
+
+// CreateList creates a list owned by the user
+func (s *Service) CreateList(userID int64, name, icon string) (*db.List, error) {
+	if err := validateName("List", name, MaxListNameLength); err != nil {
+		return nil, err
+	}
+	if err := validateIcon(icon); err != nil {
+		return nil, err
+	}
+
+	list, err := s.store.CreateList(name, NormalizeIcon(icon), userID)
+	if err != nil {
+		return nil, internal("create_failed", "Failed to create list", err)
+	}
+	list.Role = db.RoleOwner
+
+	s.publish(list.ID, EventListCreated, list)
+	return list, nil
+}
+
+// UpdateList renames a list or changes its icon
+func (s *Service) UpdateList(userID, id int64, update ListUpdate) (*db.List, error) {
+	if err := s.RequireListRole(userID, id, db.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.getList(id)
+	if err != nil {
+		return nil, err
+	}
+
+	name := existing.Name
+	if update.Name != nil {
+		name = *update.Name
+	}
+	icon := ""
+	if update.Icon != nil {
+		icon = *update.Icon
+	}
+	if err := validateName("List", name, MaxListNameLength); err != nil {
+		return nil, err
+	}
+	if err := validateIcon(icon); err != nil {
+		return nil, err
+	}
+
+	// An empty icon keeps the current one
+	list, err := s.store.UpdateList(id, name, NormalizeIcon(icon))
+	if err != nil {
+		return nil, internal("update_failed", "Failed to update list", err)
+	}
+
+	s.publish(id, EventListUpdated, list)
+	list.Role, _ = s.ListRole(userID, id)
+	return list, nil
+}
+
+// DeleteList deletes a list with all its sections and items
+func (s *Service) DeleteList(userID, id int64) error {
+	if err := s.RequireListRole(userID, id, db.RoleOwner); err != nil {
+		return err
+	}
+
+	// Capture who could see the list before its permissions are gone
+	acl := s.listACL(id)
+
+	if err := s.store.DeleteList(id); err != nil {
+		return internal("delete_failed", "Failed to delete list", err)
+	}
+
+	s.emit(Event{Type: EventListDeleted, ListID: id, ACL: acl, Data: map[string]int64{"id": id}})
+	return nil
+}
+
+// SetActiveList makes a list the one the user sees on the main page
+func (s *Service) SetActiveList(userID, id int64) error {
+	if err := s.RequireListRole(userID, id, db.RoleViewer); err != nil {
+		return err
+	}
+
+	if err := s.store.SetActiveList(userID, id); err != nil {
+		return internal("update_failed", "Failed to activate list", err)
+	}
+
+	s.publish(id, EventListActivated, map[string]int64{"id": id})
+	return nil
+}
+
+// MoveListUp moves a list one place up
+func (s *Service) MoveListUp(userID, id int64) (*db.List, error) {
+	return s.moveList(userID, id, s.store.MoveListUp)
+}
+
+// MoveListDown moves a list one place down
+func (s *Service) MoveListDown(userID, id int64) (*db.List, error) {
+	return s.moveList(userID, id, s.store.MoveListDown)
+}
+
+func (s *Service) moveList(userID, id int64, move func(id int64) error) (*db.List, error) {
+	// The order of lists is shared by everyone, so viewers may not change it
+	if err := s.RequireListRole(userID, id, db.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	if err := move(id); err != nil {
+		return nil, internal("move_failed", "Failed to move list", err)
+	}
+
+	s.publish(0, EventListsReordered, nil)
+	return s.getList(id)
+}
+
+func (s *Service) getList(id int64) (*db.List, error) {
+	list, err := s.store.GetListByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("List")
+		}
+		return nil, internal("db_error", "Failed to fetch list", err)
+	}
+	return list, nil
+}
+
+// UpdateListPermissions makes a list private or shared, unless private is nil,
+// and replaces its members. members maps usernames to roles; an empty role
+// revokes access. Only the owner may change permissions, and everything is
+// checked before anything is changed.
+func (s *Service) UpdateListPermissions(userID, listID int64, private *bool, members map[string]string) (*db.List, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	grants := make(map[int64]string, len(members))
+	for username, role := range members {
+		if strings.TrimSpace(username) == "" {
+			return nil, invalid("Username is required")
+		}
+		if role != db.RoleNone && !db.IsValidMemberRole(role) {
+			return nil, invalid("Role must be editor or viewer")
+		}
+		user, err := s.store.GetUserByUsername(username)
+		if err == sql.ErrNoRows {
+			return nil, invalid("Unknown user: " + username)
+		}
+		if err != nil {
+			return nil, internal("db_error", "Failed to fetch user", err)
+		}
+		if role != db.RoleNone {
+			grants[user.ID] = role
+		}
+	}
+
+	if err := s.store.ReplaceListPermissions(listID, private, userID, grants); err != nil {
+		return nil, internal("update_failed", "Failed to update permissions", err)
+	}
+
+	list, err := s.store.GetListByID(listID)
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch list", err)
+	}
+	s.publish(listID, EventListUpdated, list)
+	return list, nil
+}
+
+// SetListOwner makes a user the owner of a list, who may then delete it or
+// change its permissions. It requires system access.
+func (s *Service) SetListOwner(userID, listID int64, username string) (*db.List, error) {
+	if err := requireSystem(userID); err != nil {
+		return nil, err
+	}
+	user, err := s.store.GetUserByUsername(username)
+	if err == sql.ErrNoRows {
+		return nil, invalid("Unknown user: " + username)
+	}
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch user", err)
+	}
+
+	if err := s.store.SetListOwner(listID, user.ID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("List")
+		}
+		return nil, internal("update_failed", "Failed to update list", err)
+	}
+
+	list, err := s.getList(listID)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(listID, EventListUpdated, list)
+	return list, nil
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"database/sql"
+	"regexp"
+	"shopping-list/db"
+	"strings"
+)
+
+// Text formats a list can be exported to and pasted from
+const (
+	TextMarkdown = "markdown"
+	TextTodoTxt  = "todotxt"
+	TextPlain    = "text"
+)
+
+// DefaultSectionName is used for pasted items that come before any heading
+// when the list has no sections yet
+const DefaultSectionName = "Other"
+
+// ExportListText renders a list for pasting into chat or notes
+func (s *Service) ExportListText(userID, listID int64, format string) (string, error) {
+	if format == "" {
+		format = TextMarkdown
+	}
+	if format != TextMarkdown && format != TextTodoTxt && format != TextPlain {
+		return "", invalid("Format must be markdown, todotxt or text")
+	}
+	if err := s.RequireListRole(userID, listID, db.RoleViewer); err != nil {
+		return "", err
+	}
+
+	list, err := s.store.GetListByID(listID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", notFound("List")
+		}
+		return "", internal("db_error", "Failed to fetch list", err)
+	}
+	sections, err := s.store.GetSectionsByList(listID)
+	if err != nil {
+		return "", internal("db_error", "Failed to fetch sections", err)
+	}
+	return FormatListText(list, sections, format), nil
+}
+
+// FormatListText renders sections as headings and items as checkboxes.
+// Descriptions follow the name after " - ", which ParseListText reads back.
+func FormatListText(list *db.List, sections []db.Section, format string) string {
+	var b strings.Builder
+	switch format {
+	case TextTodoTxt:
+		project := " +" + todoTxtTag(list.Name)
+		for _, section := range sections {
+			for _, item := range section.Items {
+				if item.Completed {
+					b.WriteString("x ")
+				}
+				b.WriteString(itemText(item))
+				b.WriteString(" @" + todoTxtTag(section.Name) + project + "\n")
+			}
+		}
+	case TextPlain:
+		b.WriteString(list.Name + "\n")
+		for _, section := range sections {
+			b.WriteString("\n" + section.Name + "\n")
+			for _, item := range section.Items {
+				marker := "  "
+				if item.Completed {
+					marker = "  ✓ "
+				}
+				b.WriteString(marker + itemText(item) + "\n")
+			}
+		}
+	default:
+		b.WriteString("# " + strings.TrimSpace(list.Icon+" "+list.Name) + "\n")
+		for _, section := range sections {
+			b.WriteString("\n## " + section.Name + "\n")
+			for _, item := range section.Items {
+				box := "- [ ] "
+				if item.Completed {
+					box = "- [x] "
+				}
+				b.WriteString(box + itemText(item) + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+func itemText(item db.Item) string {
+	if item.Description == "" {
+		return item.Name
+	}
+	return item.Name + " - " + item.Description
+}
+
+// todoTxtTag makes a name usable as a todo.txt +project or @context
+func todoTxtTag(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
+
+var (
+	// pasteBullet matches list markers: "- [ ]", "- [x]", "-", "*", "•", "1.", "☐", "✓" ...
+	pasteBullet = regexp.MustCompile(`^(?:[-*+•◦▪‣]\s*(\[[ xX]?\])?|\d+[.)]|\[[ xX]?\]|[☐☑☒✓✔])\s*`)
+	// pasteChecked matches the markers of completed items
+	pasteChecked = regexp.MustCompile(`\[[xX]\]|[☑☒✓✔]`)
+	// todoTxtLine matches todo.txt lines: completion, priority or @context and +project tags
+	todoTxtLine = regexp.MustCompile(`^(?:x |\([A-Z]\) )|(?:^|\s)[@+]\S+`)
+	// todoTxtDate matches the completion and creation dates of todo.txt
+	todoTxtDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}\s+`)
+)
+
+// ParseListText reads a pasted list: the Markdown, todo.txt or text that
+// FormatListText writes, and looser variants of them such as plain lines,
+// bullets or "Dairy:" headings. Items before any heading get an empty section name.
+func ParseListText(text string) []NewSection {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if isTodoTxt(lines) {
+		return parseTodoTxt(lines)
+	}
+
+	p := &pasteParser{}
+	first := true
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			p.lastItem = nil
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		indented := indent > 0
+		bullet := pasteBullet.MatchString(trimmed)
+		isFirst := first
+		first = false
+
+		switch {
+		case strings.HasPrefix(trimmed, "# "):
+			// The list title
+		case strings.HasPrefix(trimmed, "#"):
+			p.section(strings.TrimLeft(trimmed, "# "))
+		case bullet:
+			marker := pasteBullet.FindString(trimmed)
+			p.item(trimmed[len(marker):], pasteChecked.MatchString(marker), true)
+			p.lastIndent = indent
+		case indented && p.lastItem != nil && p.lastBullet && indent > p.lastIndent:
+			// A line indented under a bulleted item is its description; one
+			// indented as far is the next item, as in "  ✓ Eggs\n  Milk"
+			p.lastItem.Description = strings.TrimSpace(p.lastItem.Description + " " + trimmed)
+		case indented:
+			p.item(trimmed, false, false)
+		case strings.HasSuffix(trimmed, ":"):
+			p.section(strings.TrimSuffix(trimmed, ":"))
+		case isFirst && nextLine(lines, i) == "" && startsSection(lines, i+1):
+			// A title followed by an empty line and a section, as the text format starts
+		case isPasteItemLine(nextLine(lines, i)):
+			p.section(trimmed)
+		default:
+			p.item(trimmed, false, false)
+		}
+	}
+	return p.sections
+}
+
+// pasteParser collects sections in the order they appear, merging repeated headings
+type pasteParser struct {
+	sections   []NewSection
+	current    int
+	lastItem   *NewItem
+	lastBullet bool
+	lastIndent int
+}
+
+func (p *pasteParser) section(name string) {
+	name = strings.TrimSpace(name)
+	p.lastItem = nil
+	for i, s := range p.sections {
+		if strings.EqualFold(s.Name, name) {
+			p.current = i
+			return
+		}
+	}
+	p.sections = append(p.sections, NewSection{Name: name})
+	p.current = len(p.sections) - 1
+}
+
+func (p *pasteParser) item(text string, completed, bullet bool) {
+	name, description := splitPastedItem(text)
+	if name == "" {
+		return
+	}
+	if len(p.sections) == 0 {
+		p.sections = append(p.sections, NewSection{})
+		p.current = 0
+	}
+	s := &p.sections[p.current]
+	s.Items = append(s.Items, NewItem{Name: name, Description: description, Completed: completed})
+	p.lastItem = &s.Items[len(s.Items)-1]
+	p.lastBullet = bullet
+}
+
+// splitPastedItem separates "Milk - 2 l" into name and description
+func splitPastedItem(text string) (name, description string) {
+	name, description, _ = strings.Cut(text, " - ")
+	return strings.TrimSpace(name), strings.TrimSpace(description)
+}
+
+func isPasteItemLine(line string) bool {
+	if strings.TrimSpace(line) == "" {
+		return false
+	}
+	return line[0] == ' ' || line[0] == '\t' || pasteBullet.MatchString(strings.TrimSpace(line))
+}
+
+func nextLine(lines []string, i int) string {
+	if i+1 < len(lines) {
+		return lines[i+1]
+	}
+	return ""
+}
+
+// startsSection reports whether the first non-empty line from i on is a
+// heading followed by items
+func startsSection(lines []string, i int) bool {
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.HasSuffix(line, ":") {
+			return true
+		}
+		return !isPasteItemLine(lines[i]) && isPasteItemLine(nextLine(lines, i))
+	}
+	return false
+}
+
+// isTodoTxt reports whether the lines look like todo.txt tasks: some have
+// @context or +project tags and none is a heading or bullet
+func isTodoTxt(lines []string) bool {
+	found := false
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.HasSuffix(line, ":") || pasteBullet.MatchString(line) {
+			return false
+		}
+		if todoTxtLine.MatchString(line) {
+			found = true
+		}
+	}
+	return found
+}
+
+// parseTodoTxt reads todo.txt tasks; the first @context is the section
+func parseTodoTxt(lines []string) []NewSection {
+	p := &pasteParser{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		completed := false
+		if rest, ok := strings.CutPrefix(line, "x "); ok {
+			completed, line = true, rest
+		}
+		if len(line) > 4 && line[0] == '(' && line[2] == ')' && line[3] == ' ' {
+			line = line[4:]
+		}
+		for todoTxtDate.MatchString(line) {
+			line = todoTxtDate.ReplaceAllString(line, "")
+		}
+
+		var words []string
+		section := ""
+		for _, word := range strings.Fields(line) {
+			switch {
+			case len(word) > 1 && word[0] == '@':
+				if section == "" {
+					section = strings.ReplaceAll(word[1:], "_", " ")
+				}
+			case len(word) > 1 && word[0] == '+':
+				// The list the task belongs to
+			default:
+				words = append(words, word)
+			}
+		}
+
+		if section != "" {
+			p.section(section)
+		} else if len(p.sections) > 0 && p.sections[p.current].Name != "" {
+			p.section("")
+		}
+		p.item(strings.Join(words, " "), completed, false)
+	}
+	return p.sections
+}
+
+// ImportListText adds pasted sections and items to a list in one transaction.
+// Sections are matched by name and created if missing; items already in their
+// section are skipped. Items before any heading go to the first section.
+func (s *Service) ImportListText(userID, listID int64, text string) (*BatchResult, int, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+		return nil, 0, err
+	}
+	parsed := ParseListText(text)
+	if len(parsed) == 0 {
+		return nil, 0, invalid("No items found in the text")
+	}
+
+	existing, err := s.store.GetSectionsByList(listID)
+	if err != nil {
+		return nil, 0, internal("db_error", "Failed to fetch sections", err)
+	}
+	for i := range parsed {
+		if parsed[i].Name == "" {
+			parsed[i].Name = DefaultSectionName
+			if len(existing) > 0 {
+				parsed[i].Name = existing[0].Name
+			}
+		}
+	}
+	if err := ValidateSections(parsed); err != nil {
+		return nil, 0, err
+	}
+
+	result := &BatchResult{}
+	skipped := 0
+	err = s.batch(func(b db.BatchStore) error {
+		nextSectionOrder := b.MaxSectionOrder(listID) + 1
+		for _, input := range parsed {
+			var sectionID int64
+			var names []string
+			for _, section := range existing {
+				if strings.EqualFold(section.Name, input.Name) {
+					sectionID = section.ID
+					for _, item := range section.Items {
+						names = append(names, item.Name)
+					}
+					break
+				}
+			}
+			if sectionID == 0 {
+				section, err := b.CreateSection(listID, input.Name, nextSectionOrder)
+				if err != nil {
+					return internal("create_failed", "Failed to create section: "+input.Name, err)
+				}
+				nextSectionOrder++
+				sectionID = section.ID
+				existing = append(existing, *section)
+				result.Sections = append(result.Sections, *section)
+			}
+
+			var missing []NewItem
+			for _, item := range input.Items {
+				if containsFold(names, item.Name) {
+					skipped++
+					continue
+				}
+				names = append(names, item.Name)
+				missing = append(missing, item)
+			}
+			created, err := addItems(b, sectionID, b.MaxItemOrder(sectionID)+1, missing)
+			if err != nil {
+				return err
+			}
+			result.Items = append(result.Items, created...)
+
+			// Later headings with the same name see the new items too
+			for i := range existing {
+				if existing[i].ID == sectionID {
+					existing[i].Items = append(existing[i].Items, created...)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.publish(listID, EventBatchCreated, map[string]interface{}{"list_id": listID})
+	return result, skipped, nil
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"shopping-list/db"
+	"testing"
+)
+
+func TestParseListText(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{
+			name: "markdown with checkboxes",
+			text: "# 🛒 Groceries\n\n## Dairy\n- [ ] Milk - 2 l\n- [x] Eggs\n\n## Bakery\n- [ ] Bread\n",
+			want: "Dairy: Milk (2 l), x Eggs; Bakery: Bread",
+		},
+		{
+			name: "the text format",
+			text: "Groceries\n\nDairy\n  Milk - 2 l\n  ✓ Eggs\n\nBakery\n  Bread\n",
+			want: "Dairy: Milk (2 l), x Eggs; Bakery: Bread",
+		},
+		{
+			name: "plain lines without headings",
+			text: "Milk\nEggs\r\nBread\n",
+			want: ": Milk, Eggs, Bread",
+		},
+		{
+			name: "colon headings and mixed bullets",
+			text: "Dairy:\n* Milk\n• Cheese\n1. Yogurt\nProduce:\n☐ Apples\n☑ Pears\n",
+			want: "Dairy: Milk, Cheese, Yogurt; Produce: Apples, x Pears",
+		},
+		{
+			name: "a heading followed by bullets, repeated later",
+			text: "Dairy\n- Milk\n\nBakery\n- Bread\n\ndairy\n- Cheese\n",
+			want: "Dairy: Milk, Cheese; Bakery: Bread",
+		},
+		{
+			name: "indented continuation lines",
+			text: "- Cake\n  for Saturday\n  chocolate\nTea\n",
+			want: ": Cake (for Saturday chocolate), Tea",
+		},
+		{
+			name: "indented items after a checked one",
+			text: "Dairy\n  ✓ Eggs\n  Milk\n    semi-skimmed\n",
+			want: "Dairy: x Eggs, Milk, semi-skimmed",
+		},
+		{
+			name: "items before the first heading",
+			text: "Milk\nEggs\n\n## Bakery\n- Bread\n",
+			want: ": Milk, Eggs; Bakery: Bread",
+		},
+		{
+			name: "todo.txt",
+			text: "Milk - 2 l @Dairy +Groceries\nx 2024-05-01 Eggs @Dairy +Groceries\n(A) 2024-04-30 Bread @Bakery\nSalt\n",
+			want: "Dairy: Milk (2 l), x Eggs; Bakery: Bread; : Salt",
+		},
+		{
+			name: "todo.txt contexts with underscores",
+			text: "Apples @Fruit_and_veg\n",
+			want: "Fruit and veg: Apples",
+		},
+		{
+			name: "empty bullets",
+			text: "- \n- [ ]\n",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		if got := describeSections(ParseListText(tt.text)); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListTextRoundTrip(t *testing.T) {
+	list := &db.List{Name: "Weekly shop", Icon: "🛒"}
+	sections := []db.Section{
+		{Name: "Dairy", Items: []db.Item{
+			{Name: "Milk", Description: "2 l"},
+			{Name: "Eggs", Completed: true},
+			{Name: "Cheese", Description: "gouda - sliced"},
+		}},
+		{Name: "Fruit and veg", Items: []db.Item{
+			{Name: "Apples (red)"},
+		}},
+		{Name: "Bakery", Items: []db.Item{
+			{Name: "Bread", Completed: true, Description: "rye"},
+		}},
+	}
+	want := "Dairy: Milk (2 l), x Eggs, Cheese (gouda - sliced); Fruit and veg: Apples (red); Bakery: x Bread (rye)"
+
+	for _, format := range []string{TextMarkdown, TextPlain, TextTodoTxt} {
+		text := FormatListText(list, sections, format)
+		if got := describeSections(ParseListText(text)); got != want {
+			t.Errorf("%s round trip:\n got %s\nwant %s\ntext:\n%s", format, got, want, text)
+		}
+	}
+}
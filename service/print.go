@@ -0,0 +1,209 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"shopping-list/db"
+	"shopping-list/pdf"
+	"strings"
+	"time"
+)
+
+// MaxPrintColumns is the most columns a printed list is split into
+const MaxPrintColumns = 4
+
+// PrintOptions controls how a list is printed
+type PrintOptions struct {
+	HideCompleted bool
+	Columns       int
+	// Paper is "a4" (the default) or "letter"; only the PDF uses it
+	Paper string
+}
+
+// Normalize fills in defaults and checks the options
+func (o *PrintOptions) Normalize() error {
+	if o.Columns == 0 {
+		o.Columns = 1
+	}
+	if o.Columns < 1 || o.Columns > MaxPrintColumns {
+		return invalid(fmt.Sprintf("Columns must be between 1 and %d", MaxPrintColumns))
+	}
+	o.Paper = strings.ToLower(o.Paper)
+	if o.Paper == "" {
+		o.Paper = "a4"
+	}
+	if o.Paper != "a4" && o.Paper != "letter" {
+		return invalid("Paper must be a4 or letter")
+	}
+	return nil
+}
+
+// PrintableList returns a list with the sections to print. Without completed
+// items, sections left empty are dropped.
+func (s *Service) PrintableList(userID, listID int64, opts PrintOptions) (*db.List, []db.Section, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, nil, err
+	}
+	if err := s.RequireListRole(userID, listID, db.RoleViewer); err != nil {
+		return nil, nil, err
+	}
+
+	list, err := s.store.GetListByID(listID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, notFound("List")
+		}
+		return nil, nil, internal("db_error", "Failed to fetch list", err)
+	}
+	sections, err := s.store.GetSectionsByList(listID)
+	if err != nil {
+		return nil, nil, internal("db_error", "Failed to fetch sections", err)
+	}
+
+	if opts.HideCompleted {
+		var open []db.Section
+		for _, section := range sections {
+			var items []db.Item
+			for _, item := range section.Items {
+				if !item.Completed {
+					items = append(items, item)
+				}
+			}
+			if len(items) > 0 {
+				section.Items = items
+				open = append(open, section)
+			}
+		}
+		sections = open
+	}
+	return list, sections, nil
+}
+
+// ListPDF renders a list as a PDF with checkboxes, split into columns
+func (s *Service) ListPDF(userID, listID int64, opts PrintOptions) ([]byte, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	list, sections, err := s.PrintableList(userID, listID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	paper := pdf.A4
+	if opts.Paper == "letter" {
+		paper = pdf.Letter
+	}
+	var buf bytes.Buffer
+	if _, err := renderListPDF(list, sections, opts.Columns, paper).WriteTo(&buf); err != nil {
+		return nil, internal("pdf_failed", "Failed to create PDF", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Layout of the printed list in points
+const (
+	pdfMargin      = 40.0
+	pdfColumnGap   = 24.0
+	pdfTitleSize   = 20.0
+	pdfSectionSize = 12.0
+	pdfItemSize    = 11.0
+	pdfNoteSize    = 9.0
+	pdfBox         = 8.0
+	pdfIndent      = 16.0
+)
+
+// renderListPDF lays the sections out top to bottom, then column by column
+// and page by page. A section heading is never left alone at the bottom.
+func renderListPDF(list *db.List, sections []db.Section, columns int, paper pdf.Size) *pdf.Document {
+	doc := pdf.New(paper, list.Name)
+	doc.AddPage()
+
+	y := pdfMargin + pdfTitleSize
+	for _, line := range pdf.Wrap(list.Name, pdfTitleSize, true, paper.Width-2*pdfMargin) {
+		doc.Text(pdfMargin, y, pdfTitleSize, true, 0, line)
+		y += pdfTitleSize * 1.2
+	}
+	total, done := 0, 0
+	for _, section := range sections {
+		for _, item := range section.Items {
+			total++
+			if item.Completed {
+				done++
+			}
+		}
+	}
+	subtitle := fmt.Sprintf("%s · %d/%d", time.Now().Format("2006-01-02"), done, total)
+	doc.Text(pdfMargin, y, pdfNoteSize, false, 0.45, subtitle)
+	top := y + 2*pdfSectionSize
+
+	columnWidth := (paper.Width - 2*pdfMargin - float64(columns-1)*pdfColumnGap) / float64(columns)
+	bottom := paper.Height - pdfMargin
+	column := 0
+	x := pdfMargin
+	y = top
+
+	// next moves to the next column, or the top of a new page
+	next := func() {
+		column++
+		if column == columns {
+			column = 0
+			doc.AddPage()
+			top = pdfMargin + pdfSectionSize
+		}
+		x = pdfMargin + float64(column)*(columnWidth+pdfColumnGap)
+		y = top
+	}
+
+	textWidth := columnWidth - pdfIndent
+	for _, section := range sections {
+		heading := pdf.Wrap(section.Name, pdfSectionSize, true, columnWidth)
+		headingHeight := float64(len(heading))*pdfSectionSize*1.25 + 4
+		firstItem := 0.0
+		if len(section.Items) > 0 {
+			firstItem = itemHeight(section.Items[0], textWidth)
+		}
+		if y+headingHeight+firstItem > bottom && y > top {
+			next()
+		}
+		for _, line := range heading {
+			doc.Text(x, y, pdfSectionSize, true, 0, line)
+			y += pdfSectionSize * 1.25
+		}
+		doc.Line(x, y-pdfSectionSize*0.8, x+columnWidth, y-pdfSectionSize*0.8, 0.5, 0.6)
+		y += 4
+
+		for _, item := range section.Items {
+			if y+itemHeight(item, textWidth) > bottom && y > top {
+				next()
+			}
+			gray := 0.0
+			if item.Completed {
+				gray = 0.55
+			}
+			doc.Rect(x, y-pdfBox, pdfBox, pdfBox, 0.8, gray)
+			if item.Completed {
+				doc.Line(x+1.5, y-pdfBox/2, x+pdfBox/2, y-1.5, 0.8, gray)
+				doc.Line(x+pdfBox/2, y-1.5, x+pdfBox-1, y-pdfBox-1, 0.8, gray)
+			}
+			for _, line := range pdf.Wrap(item.Name, pdfItemSize, false, textWidth) {
+				doc.Text(x+pdfIndent, y, pdfItemSize, false, gray, line)
+				y += pdfItemSize * 1.3
+			}
+			for _, line := range pdf.Wrap(item.Description, pdfNoteSize, false, textWidth) {
+				doc.Text(x+pdfIndent, y-2, pdfNoteSize, false, 0.45, line)
+				y += pdfNoteSize * 1.3
+			}
+			y += 3
+		}
+		y += pdfSectionSize
+	}
+	return doc
+}
+
+// itemHeight is the space an item takes in a column
+func itemHeight(item db.Item, width float64) float64 {
+	name := len(pdf.Wrap(item.Name, pdfItemSize, false, width))
+	note := len(pdf.Wrap(item.Description, pdfNoteSize, false, width))
+	return float64(name)*pdfItemSize*1.3 + float64(note)*pdfNoteSize*1.3 + 3
+}
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"regexp"
+	"shopping-list/db"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// HookTokenPrefix starts every inbound hook token
+const HookTokenPrefix = "koffan_hook_"
+
+// hookTouchInterval limits how often last_used_at is written for a hook
+const hookTouchInterval = 60
+
+// mailAliasLength is the length of the random address a hook receives mail at
+const mailAliasLength = 16
+
+// MaxQuickAddItems is the most items one quick add may create
+const MaxQuickAddItems = 50
+
+// NewInboundHook holds the fields of an inbound hook to create. Without a
+// section, items go where they were last added, or to the first section.
+type NewInboundHook struct {
+	Name      string
+	ListID    int64
+	SectionID int64
+	AllowGet  bool
+}
+
+// QuickAddResult tells what a quick add did with each item it understood
+type QuickAddResult struct {
+	// Added are the items created
+	Added []db.Item `json:"added"`
+	// Reopened are completed items put back on the list
+	Reopened []db.Item `json:"reopened"`
+	// Skipped are names already on the list and not completed
+	Skipped []string `json:"skipped"`
+}
+
+// InboundHooks returns all inbound hooks. Managing hooks requires system access.
+func (s *Service) InboundHooks(userID int64) ([]db.InboundHook, error) {
+	if err := requireSystem(userID); err != nil {
+		return nil, err
+	}
+	hooks, err := s.store.GetInboundHooks()
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch hooks", err)
+	}
+	return hooks, nil
+}
+
+// CreateInboundHook adds a hook and returns it with its token. Only a hash of
+// the token is stored, so it can't be shown again.
+func (s *Service) CreateInboundHook(userID int64, input NewInboundHook) (*db.InboundHook, string, error) {
+	if err := requireSystem(userID); err != nil {
+		return nil, "", err
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if err := validateName("Hook", input.Name, MaxListNameLength); err != nil {
+		return nil, "", err
+	}
+	if _, err := s.store.GetListByID(input.ListID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", notFound("List")
+		}
+		return nil, "", internal("db_error", "Failed to fetch list", err)
+	}
+	if input.SectionID != 0 {
+		listID, err := s.store.GetSectionListID(input.SectionID)
+		if err == sql.ErrNoRows || (err == nil && listID != input.ListID) {
+			return nil, "", invalid("Section does not belong to the list")
+		}
+		if err != nil {
+			return nil, "", internal("db_error", "Failed to fetch section", err)
+		}
+	}
+	hooks, err := s.store.GetInboundHooks()
+	if err != nil {
+		return nil, "", internal("db_error", "Failed to fetch hooks", err)
+	}
+	for _, h := range hooks {
+		if strings.EqualFold(h.Name, input.Name) {
+			return nil, "", invalid("A hook with this name already exists")
+		}
+	}
+
+	b := make([]byte, 24+mailAliasLength/2)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", internal("create_failed", "Failed to create hook token", err)
+	}
+	token := HookTokenPrefix + hex.EncodeToString(b[:24])
+
+	hook, err := s.store.CreateInboundHook(&db.InboundHook{
+		Name:      input.Name,
+		MailAlias: hex.EncodeToString(b[24:]),
+		ListID:    input.ListID,
+		SectionID: input.SectionID,
+		AllowGet:  input.AllowGet,
+	}, hashHookToken(token))
+	if err != nil {
+		return nil, "", internal("create_failed", "Failed to create hook", err)
+	}
+	return hook, token, nil
+}
+
+// DeleteInboundHook revokes a hook
+func (s *Service) DeleteInboundHook(userID, id int64) error {
+	if err := requireSystem(userID); err != nil {
+		return err
+	}
+	if err := s.store.DeleteInboundHook(id); err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("Hook")
+		}
+		return internal("delete_failed", "Failed to delete hook", err)
+	}
+	return nil
+}
+
+// InboundHookByToken returns the hook a token belongs to and records its use
+func (s *Service) InboundHookByToken(token string) (*db.InboundHook, error) {
+	if !strings.HasPrefix(token, HookTokenPrefix) {
+		return nil, notFound("Hook")
+	}
+	hook, err := s.store.GetInboundHookByHash(hashHookToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("Hook")
+		}
+		return nil, internal("db_error", "Failed to fetch hook", err)
+	}
+	if now := time.Now().Unix(); now-hook.LastUsedAt >= hookTouchInterval {
+		s.store.TouchInboundHook(hook.ID, now)
+	}
+	return hook, nil
+}
+
+// InboundHookByMailAlias returns the hook that receives mail at an alias and
+// records its use
+func (s *Service) InboundHookByMailAlias(alias string) (*db.InboundHook, error) {
+	if len(alias) != mailAliasLength {
+		return nil, notFound("Hook")
+	}
+	hook, err := s.store.GetInboundHookByMailAlias(strings.ToLower(alias))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("Hook")
+		}
+		return nil, internal("db_error", "Failed to fetch hook", err)
+	}
+	if now := time.Now().Unix(); now-hook.LastUsedAt >= hookTouchInterval {
+		s.store.TouchInboundHook(hook.ID, now)
+	}
+	return hook, nil
+}
+
+func hashHookToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// QuickAdd adds the items named in a short free text, as sent by a voice
+// assistant or shortcut: "add milk, 2 eggs and coffee to my list". Names are
+// spelled as in the item history and go to the section they were last added
+// to, unless sectionID fixes one. Items already on the list are not added
+// twice; completed ones are put back.
+func (s *Service) QuickAdd(userID, listID, sectionID int64, text string) (*QuickAddResult, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+		return nil, err
+	}
+	items := ParseQuickAdd(text)
+	if len(items) == 0 {
+		return nil, invalid("No items found in the text")
+	}
+	if len(items) > MaxQuickAddItems {
+		return nil, invalid("Too many items at once")
+	}
+	if err := validateItems(items); err != nil {
+		return nil, err
+	}
+
+	return s.addToList(listID, sectionID, items)
+}
+
+// addToList adds items to a list, each to sectionID if it is set, otherwise
+// to the section it was last added to. Items already on the list are skipped,
+// or put back if they were completed. Callers check permissions.
+func (s *Service) addToList(listID, sectionID int64, items []NewItem) (*QuickAddResult, error) {
+	sections, err := s.store.GetSectionsByList(listID)
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch sections", err)
+	}
+	if sectionID != 0 && sectionIndex(sections, sectionID) < 0 {
+		sectionID = 0
+	}
+
+	// Looked up before the transaction, which must only use b
+	matches := make([]*db.ItemSuggestion, len(items))
+	for i, input := range items {
+		matches[i] = s.historyMatch(input.Name)
+	}
+
+	result := &QuickAddResult{Added: []db.Item{}, Reopened: []db.Item{}, Skipped: []string{}}
+	err = s.batch(func(b db.BatchStore) error {
+		for i, input := range items {
+			if item := findItemFold(sections, input.Name); item != nil {
+				if !item.Completed {
+					result.Skipped = append(result.Skipped, item.Name)
+					continue
+				}
+				if err := b.SetItemStatus(item.ID, false, false); err != nil {
+					return internal("update_failed", "Failed to update item: "+item.Name, err)
+				}
+				item.Completed = false
+				result.Reopened = append(result.Reopened, *item)
+				continue
+			}
+
+			target := sectionID
+			if suggestion := matches[i]; suggestion != nil {
+				input.Name = suggestion.Name
+				if target == 0 && sectionIndex(sections, suggestion.LastSectionID) >= 0 {
+					target = suggestion.LastSectionID
+				}
+			}
+			if target == 0 && len(sections) > 0 {
+				target = sections[0].ID
+			}
+			if target == 0 {
+				section, err := b.CreateSection(listID, DefaultSectionName, b.MaxSectionOrder(listID)+1)
+				if err != nil {
+					return internal("create_failed", "Failed to create section: "+DefaultSectionName, err)
+				}
+				sections = append(sections, *section)
+				target = section.ID
+			}
+
+			created, err := addItems(b, target, b.MaxItemOrder(target)+1, []NewItem{input})
+			if err != nil {
+				return err
+			}
+			result.Added = append(result.Added, created...)
+			j := sectionIndex(sections, target)
+			sections[j].Items = append(sections[j].Items, created...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Added) > 0 || len(result.Reopened) > 0 {
+		s.publish(listID, EventBatchCreated, map[string]interface{}{"list_id": listID})
+	}
+	return result, nil
+}
+
+// historyMatch returns the history entry spelled like name, ignoring case
+func (s *Service) historyMatch(name string) *db.ItemSuggestion {
+	suggestions, err := s.store.GetItemSuggestions(name, 5)
+	if err != nil {
+		return nil
+	}
+	for _, suggestion := range suggestions {
+		if strings.EqualFold(suggestion.Name, name) {
+			return &suggestion
+		}
+	}
+	return nil
+}
+
+func sectionIndex(sections []db.Section, id int64) int {
+	for i := range sections {
+		if sections[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func findItemFold(sections []db.Section, name string) *db.Item {
+	for i := range sections {
+		for j := range sections[i].Items {
+			if strings.EqualFold(sections[i].Items[j].Name, name) {
+				return &sections[i].Items[j]
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	quickAddSeparator = regexp.MustCompile(`(?i)\s*(?:[,;\n]|\s&\s|\sand\s)\s*`)
+	quickAddCommand   = regexp.MustCompile(`(?i)^(?:please\s+)?(?:add|put|buy|get)\s+`)
+	quickAddTarget    = regexp.MustCompile(`(?i)\s+(?:to|on|onto)\s+(?:the|my|our)\s+(?:[\p{L}\p{N}'-]+\s+)*list$`)
+	quickAddAmount    = `\d+(?:[.,]\d+)?\s*(?:kg|g|l|ml|lb|lbs|oz|pcs|packs?|bottles?|cans?|boxes|box|bags?|dozen)?`
+	quickAddLeading   = regexp.MustCompile(`(?i)^(\d+\s*[x×]|` + quickAddAmount + `)\s+(.+)$`)
+	quickAddTrailing  = regexp.MustCompile(`(?i)^(.+?)\s+(?:[x×]\s*(\d+)|(\d+)\s*[x×]|\((.+)\))$`)
+)
+
+// ParseQuickAdd splits a short free text into items. Parts are separated by
+// commas, semicolons, new lines, "&" or "and"; a leading "add" and a trailing
+// "to my ... list" are dropped. Amounts such as "2 l milk", "coffee x2",
+// "eggs (10)" or "milk - 2 l" become the description.
+func ParseQuickAdd(text string) []NewItem {
+	text = strings.TrimSpace(text)
+	text = quickAddCommand.ReplaceAllString(text, "")
+	text = strings.TrimRight(text, ".!? ")
+	text = quickAddTarget.ReplaceAllString(text, "")
+
+	var items []NewItem
+	for _, part := range quickAddSeparator.Split(text, -1) {
+		part = strings.Trim(part, " \t\r.!?")
+		part = quickAddCommand.ReplaceAllString(part, "")
+		if part == "" {
+			continue
+		}
+		name, description := quickAddAmountSplit(part)
+		if name == "" {
+			continue
+		}
+		items = append(items, NewItem{Name: capitalizeFirst(name), Description: description})
+	}
+	return items
+}
+
+// quickAddAmountSplit moves an amount out of an item name
+func quickAddAmountSplit(text string) (name, description string) {
+	if name, description := splitPastedItem(text); description != "" {
+		return name, description
+	}
+	if m := quickAddLeading.FindStringSubmatch(text); m != nil {
+		amount := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(m[1]), "x×"))
+		return strings.TrimSpace(m[2]), amount
+	}
+	if m := quickAddTrailing.FindStringSubmatch(text); m != nil {
+		return strings.TrimSpace(m[1]), strings.TrimSpace(m[2] + m[3] + m[4])
+	}
+	return text, ""
+}
+
+// capitalizeFirst upper-cases the first letter of an all lower case name
+func capitalizeFirst(name string) string {
+	if strings.ToLower(name) != name {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
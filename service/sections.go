@@ -0,0 +1,122 @@
+package service
+
+import (
+	"database/sql"
+	"shopping-list/db"
+)
+
+// CreateSection adds a section at the end of a list
+func (s *Service) CreateSection(userID, listID int64, name string) (*db.Section, error) {
+	if err := validateName("Section", name, MaxSectionNameLength); err != nil {
+		return nil, err
+	}
+	if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	section, err := s.store.CreateSectionForList(listID, name)
+	if err != nil {
+		return nil, internal("create_failed", "Failed to create section", err)
+	}
+
+	s.publish(listID, EventSectionCreated, section)
+	return section, nil
+}
+
+// UpdateSection renames a section
+func (s *Service) UpdateSection(userID, id int64, name string) (*db.Section, error) {
+	listID, err := s.RequireSectionRole(userID, id, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateName("Section", name, MaxSectionNameLength); err != nil {
+		return nil, err
+	}
+
+	section, err := s.store.UpdateSection(id, name)
+	if err != nil {
+		return nil, internal("update_failed", "Failed to update section", err)
+	}
+
+	s.publish(listID, EventSectionUpdated, section)
+	return section, nil
+}
+
+// DeleteSection deletes a section and all its items
+func (s *Service) DeleteSection(userID, id int64) error {
+	listID, err := s.RequireSectionRole(userID, id, db.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteSection(id); err != nil {
+		return internal("delete_failed", "Failed to delete section", err)
+	}
+
+	s.publish(listID, EventSectionDeleted, map[string]int64{"id": id})
+	return nil
+}
+
+// DeleteSections deletes several sections at once; the user must be able to edit all of them
+func (s *Service) DeleteSections(userID int64, ids []int64) error {
+	if len(ids) == 0 {
+		return invalid("No valid IDs provided")
+	}
+
+	var listIDs []int64
+	seen := make(map[int64]bool)
+	for _, id := range ids {
+		listID, err := s.RequireSectionRole(userID, id, db.RoleEditor)
+		if err != nil {
+			return err
+		}
+		if !seen[listID] {
+			seen[listID] = true
+			listIDs = append(listIDs, listID)
+		}
+	}
+
+	if err := s.store.DeleteSections(ids); err != nil {
+		return internal("delete_failed", "Failed to delete sections", err)
+	}
+
+	for _, listID := range listIDs {
+		s.publish(listID, EventSectionsDeleted, map[string]interface{}{"ids": ids})
+	}
+	return nil
+}
+
+// MoveSectionUp moves a section one place up within its list
+func (s *Service) MoveSectionUp(userID, id int64) (*db.Section, error) {
+	return s.moveSection(userID, id, s.store.MoveSectionUp)
+}
+
+// MoveSectionDown moves a section one place down within its list
+func (s *Service) MoveSectionDown(userID, id int64) (*db.Section, error) {
+	return s.moveSection(userID, id, s.store.MoveSectionDown)
+}
+
+func (s *Service) moveSection(userID, id int64, move func(id int64) error) (*db.Section, error) {
+	listID, err := s.RequireSectionRole(userID, id, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := move(id); err != nil {
+		return nil, internal("move_failed", "Failed to move section", err)
+	}
+
+	s.publish(listID, EventSectionsReordered, nil)
+	return s.getSection(id)
+}
+
+func (s *Service) getSection(id int64) (*db.Section, error) {
+	section, err := s.store.GetSectionByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("Section")
+		}
+		return nil, internal("db_error", "Failed to fetch section", err)
+	}
+	return section, nil
+}
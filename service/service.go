@@ -0,0 +1,162 @@
+// Package service implements the operations on lists, sections and items.
+// It owns validation, permission checks, item history and change events, so
+// the HTMX handlers and the REST API behave the same; both only translate
+// requests and errors for their transport.
+package service
+
+import (
+	"database/sql"
+	"log"
+	"shopping-list/db"
+	"sync"
+)
+
+// Event describes a change. ListID is 0 for changes that concern every list.
+// ACL holds the list's permissions at the time of the change, so subscribers can
+// still tell who could see a deleted list; it is nil if they couldn't be loaded.
+type Event struct {
+	Type   string
+	ListID int64
+	ACL    *db.ListACL
+	Data   interface{}
+}
+
+// Event types, one for each kind of change the service publishes
+const (
+	EventListCreated    = "list_created"
+	EventListUpdated    = "list_updated"
+	EventListDeleted    = "list_deleted"
+	EventListActivated  = "list_activated"
+	EventListsReordered = "lists_reordered"
+
+	EventSectionCreated    = "section_created"
+	EventSectionUpdated    = "section_updated"
+	EventSectionDeleted    = "section_deleted"
+	EventSectionsDeleted   = "sections_deleted"
+	EventSectionsReordered = "sections_reordered"
+
+	EventItemCreated    = "item_created"
+	EventItemUpdated    = "item_updated"
+	EventItemToggled    = "item_toggled"
+	EventItemDeleted    = "item_deleted"
+	EventItemMoved      = "item_moved"
+	EventItemsReordered = "items_reordered"
+
+	EventCompletedItemsDeleted = "completed_items_deleted"
+	EventBatchCreated          = "batch_created"
+	EventDataImported          = "data_imported"
+
+	EventTemplateCreated     = "template_created"
+	EventTemplateUpdated     = "template_updated"
+	EventTemplateDeleted     = "template_deleted"
+	EventTemplateItemCreated = "template_item_created"
+	EventTemplateItemUpdated = "template_item_updated"
+	EventTemplateItemDeleted = "template_item_deleted"
+	EventTemplateApplied     = "template_applied"
+
+	EventHistoryItemSaved    = "history_item_saved"
+	EventHistoryItemDeleted  = "history_item_deleted"
+	EventHistoryItemsDeleted = "history_items_deleted"
+)
+
+// Service performs changes on behalf of a user. A userID of 0 is system access
+// (auth disabled or API token).
+type Service struct {
+	store db.Store
+
+	mu          sync.RWMutex
+	subscribers []func(Event)
+}
+
+// New returns a service working on store
+func New(store db.Store) *Service {
+	return &Service{store: store}
+}
+
+// Subscribe registers fn to be called after every change
+func (s *Service) Subscribe(fn func(Event)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// publish sends an event about a list to all subscribers
+func (s *Service) publish(listID int64, eventType string, data interface{}) {
+	var acl *db.ListACL
+	if listID != 0 {
+		acl = s.listACL(listID)
+	}
+	s.emit(Event{Type: eventType, ListID: listID, ACL: acl, Data: data})
+}
+
+func (s *Service) emit(e Event) {
+	s.mu.RLock()
+	subscribers := s.subscribers
+	s.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(e)
+	}
+}
+
+func (s *Service) listACL(listID int64) *db.ListACL {
+	acl, err := s.store.GetListACL(listID)
+	if err != nil {
+		log.Printf("Failed to load permissions for list %d: %v", listID, err)
+		return nil
+	}
+	return acl
+}
+
+// ==================== PERMISSIONS ====================
+
+// ListRole returns the user's role on a list.
+// Missing lists and lists hidden from the user both yield db.RoleNone.
+func (s *Service) ListRole(userID, listID int64) (string, error) {
+	role, err := s.store.GetListRole(listID, userID)
+	if err == sql.ErrNoRows {
+		return db.RoleNone, nil
+	}
+	return role, err
+}
+
+// RequireListRole fails unless the user has at least the min role on the list.
+// Lists the user can't see are reported as not found.
+func (s *Service) RequireListRole(userID, listID int64, min string) error {
+	role, err := s.ListRole(userID, listID)
+	if err != nil {
+		log.Printf("Permission check failed for list %d: %v", listID, err)
+		return internal("db_error", "Failed to check permissions", err)
+	}
+	if role == db.RoleNone {
+		return notFound("List")
+	}
+	if !db.RoleAtLeast(role, min) {
+		return forbidden(min)
+	}
+	return nil
+}
+
+// RequireSectionRole is RequireListRole for the list a section belongs to
+func (s *Service) RequireSectionRole(userID, sectionID int64, min string) (int64, error) {
+	listID, err := s.store.GetSectionListID(sectionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, notFound("Section")
+		}
+		return 0, internal("db_error", "Failed to fetch section", err)
+	}
+	return listID, s.RequireListRole(userID, listID, min)
+}
+
+// RequireItemRole is RequireListRole for the list an item belongs to
+func (s *Service) RequireItemRole(userID, itemID int64, min string) (int64, error) {
+	listID, err := s.store.GetItemListID(itemID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, notFound("Item")
+		}
+		return 0, internal("db_error", "Failed to fetch item", err)
+	}
+	return listID, s.RequireListRole(userID, listID, min)
+}
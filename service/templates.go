@@ -0,0 +1,182 @@
+package service
+
+import (
+	"database/sql"
+	"shopping-list/db"
+)
+
+// Templates are shared by the whole household, so every user may manage them;
+// only applying one to a list or making one from a list checks the list.
+
+// CreateTemplate adds an empty template
+func (s *Service) CreateTemplate(name, description string) (*db.Template, error) {
+	if err := validateName("Template", name, MaxListNameLength); err != nil {
+		return nil, err
+	}
+	if err := validateDescription(description); err != nil {
+		return nil, err
+	}
+
+	template, err := s.store.CreateTemplate(name, description)
+	if err != nil {
+		return nil, internal("create_failed", "Failed to create template", err)
+	}
+
+	s.publish(0, EventTemplateCreated, template)
+	return template, nil
+}
+
+// UpdateTemplate renames a template and changes its description
+func (s *Service) UpdateTemplate(id int64, name, description string) (*db.Template, error) {
+	if err := validateName("Template", name, MaxListNameLength); err != nil {
+		return nil, err
+	}
+	if err := validateDescription(description); err != nil {
+		return nil, err
+	}
+	if err := s.requireTemplate(id); err != nil {
+		return nil, err
+	}
+
+	template, err := s.store.UpdateTemplate(id, name, description)
+	if err != nil {
+		return nil, internal("update_failed", "Failed to update template", err)
+	}
+
+	s.publish(0, EventTemplateUpdated, template)
+	return template, nil
+}
+
+// DeleteTemplate deletes a template and its items
+func (s *Service) DeleteTemplate(id int64) error {
+	if err := s.requireTemplate(id); err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteTemplate(id); err != nil {
+		return internal("delete_failed", "Failed to delete template", err)
+	}
+
+	s.publish(0, EventTemplateDeleted, map[string]int64{"id": id})
+	return nil
+}
+
+// AddTemplateItem adds an item to a template
+func (s *Service) AddTemplateItem(templateID int64, sectionName, name, description string) (*db.TemplateItem, error) {
+	if err := validateTemplateItem(sectionName, name, description); err != nil {
+		return nil, err
+	}
+	if err := s.requireTemplate(templateID); err != nil {
+		return nil, err
+	}
+
+	item, err := s.store.AddTemplateItem(templateID, sectionName, name, description)
+	if err != nil {
+		return nil, internal("create_failed", "Failed to add item to template", err)
+	}
+
+	s.publish(0, EventTemplateItemCreated, item)
+	return item, nil
+}
+
+// UpdateTemplateItem changes a template item
+func (s *Service) UpdateTemplateItem(id int64, sectionName, name, description string) (*db.TemplateItem, error) {
+	if err := validateTemplateItem(sectionName, name, description); err != nil {
+		return nil, err
+	}
+	if _, err := s.templateItem(id); err != nil {
+		return nil, err
+	}
+
+	item, err := s.store.UpdateTemplateItem(id, sectionName, name, description)
+	if err != nil {
+		return nil, internal("update_failed", "Failed to update template item", err)
+	}
+
+	s.publish(0, EventTemplateItemUpdated, item)
+	return item, nil
+}
+
+// DeleteTemplateItem removes an item from a template
+func (s *Service) DeleteTemplateItem(id int64) error {
+	item, err := s.templateItem(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteTemplateItem(id); err != nil {
+		return internal("delete_failed", "Failed to delete template item", err)
+	}
+
+	s.publish(0, EventTemplateItemDeleted, map[string]int64{"id": id, "template_id": item.TemplateID})
+	return nil
+}
+
+// ApplyTemplate adds the items of a template to a list
+func (s *Service) ApplyTemplate(userID, templateID, listID int64) error {
+	if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+		return err
+	}
+	if err := s.requireTemplate(templateID); err != nil {
+		return err
+	}
+
+	if err := s.store.ApplyTemplateToList(templateID, listID); err != nil {
+		return internal("update_failed", "Failed to apply template", err)
+	}
+
+	s.publish(listID, EventTemplateApplied, map[string]int64{"template_id": templateID, "list_id": listID})
+	return nil
+}
+
+// CreateTemplateFromList makes a template of the items of a list
+func (s *Service) CreateTemplateFromList(userID, listID int64, name, description string) (*db.Template, error) {
+	if err := validateName("Template", name, MaxListNameLength); err != nil {
+		return nil, err
+	}
+	if err := validateDescription(description); err != nil {
+		return nil, err
+	}
+	if err := s.RequireListRole(userID, listID, db.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	template, err := s.store.CreateTemplateFromList(listID, name, description)
+	if err != nil {
+		return nil, internal("create_failed", "Failed to create template from list", err)
+	}
+
+	s.publish(0, EventTemplateCreated, template)
+	return template, nil
+}
+
+func (s *Service) requireTemplate(id int64) error {
+	if _, err := s.store.GetTemplateByID(id); err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("Template")
+		}
+		return internal("db_error", "Failed to fetch template", err)
+	}
+	return nil
+}
+
+func (s *Service) templateItem(id int64) (*db.TemplateItem, error) {
+	item, err := s.store.GetTemplateItemByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("Template item")
+		}
+		return nil, internal("db_error", "Failed to fetch template item", err)
+	}
+	return item, nil
+}
+
+func validateTemplateItem(sectionName, name, description string) error {
+	if err := validateName("Section", sectionName, MaxSectionNameLength); err != nil {
+		return err
+	}
+	if err := validateName("Item", name, MaxItemNameLength); err != nil {
+		return err
+	}
+	return validateDescription(description)
+}
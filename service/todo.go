@@ -0,0 +1,272 @@
+package service
+
+import (
+	"database/sql"
+	"shopping-list/db"
+	"strconv"
+)
+
+// To-do item statuses, as Home Assistant names them
+const (
+	TodoNeedsAction = "needs_action"
+	TodoCompleted   = "completed"
+)
+
+// TodoList is a list as a to-do integration sees it
+type TodoList struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+	Icon string `json:"icon"`
+	// Open counts the items that still need action
+	Open int `json:"open"`
+}
+
+// TodoItem is an item as a to-do integration sees it. The UID is the item ID;
+// Section tells where the item sits, since to-do lists have no sections.
+type TodoItem struct {
+	UID         string `json:"uid"`
+	Summary     string `json:"summary"`
+	Status      string `json:"status"`
+	Description string `json:"description,omitempty"`
+	Section     string `json:"section"`
+}
+
+// TodoItemUpdate holds the fields to change; nil fields are kept
+type TodoItemUpdate struct {
+	Summary     *string
+	Description *string
+	Status      *string
+}
+
+// TodoLists returns the lists the user can see
+func (s *Service) TodoLists(userID int64) ([]TodoList, error) {
+	lists, err := s.store.GetAllLists(userID)
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch lists", err)
+	}
+	todo := []TodoList{}
+	for _, list := range lists {
+		role, err := s.ListRole(userID, list.ID)
+		if err != nil {
+			return nil, internal("db_error", "Failed to check permissions", err)
+		}
+		if role == db.RoleNone {
+			continue
+		}
+		stats := s.store.GetListStats(list.ID)
+		todo = append(todo, TodoList{
+			UID:  strconv.FormatInt(list.ID, 10),
+			Name: list.Name,
+			Icon: list.Icon,
+			Open: stats.TotalItems - stats.CompletedItems,
+		})
+	}
+	return todo, nil
+}
+
+// TodoItems returns the items of a list in the order they are shown,
+// section by section
+func (s *Service) TodoItems(userID, listID int64) ([]TodoItem, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleViewer); err != nil {
+		return nil, err
+	}
+	sections, err := s.store.GetSectionsByList(listID)
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch sections", err)
+	}
+	items := []TodoItem{}
+	for _, section := range sections {
+		for _, item := range section.Items {
+			items = append(items, todoItem(item, section.Name))
+		}
+	}
+	return items, nil
+}
+
+// CreateTodoItem adds an item to a list. It goes to sectionID if set,
+// otherwise to the section it was last added to; an item of the same name
+// already on the list is returned instead, put back if it was completed.
+func (s *Service) CreateTodoItem(userID, listID, sectionID int64, summary, description, status string) (*TodoItem, error) {
+	if err := s.RequireListRole(userID, listID, db.RoleEditor); err != nil {
+		return nil, err
+	}
+	if err := validateTodoStatus(status); err != nil {
+		return nil, err
+	}
+	input := []NewItem{{Name: summary, Description: description}}
+	if err := validateItems(input); err != nil {
+		return nil, err
+	}
+
+	result, err := s.addToList(listID, sectionID, input)
+	if err != nil {
+		return nil, err
+	}
+	var item *db.Item
+	switch {
+	case len(result.Added) > 0:
+		item = &result.Added[0]
+	case len(result.Reopened) > 0:
+		item = &result.Reopened[0]
+	default:
+		if item, err = s.findTodoItem(listID, result.Skipped[0]); err != nil {
+			return nil, err
+		}
+	}
+	if status == TodoCompleted {
+		if item, err = s.SetItemCompleted(userID, item.ID, true); err != nil {
+			return nil, err
+		}
+	}
+	return s.todoItemByID(listID, item.ID)
+}
+
+// UpdateTodoItem changes the summary, description or status of an item.
+// All changes are saved together, or none if one of them fails.
+func (s *Service) UpdateTodoItem(userID, listID, itemID int64, update TodoItemUpdate) (*TodoItem, error) {
+	if err := s.requireTodoItem(userID, listID, itemID); err != nil {
+		return nil, err
+	}
+	existing, err := s.getItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	name, description, completed := existing.Name, existing.Description, existing.Completed
+	if update.Summary != nil {
+		name = *update.Summary
+	}
+	if update.Description != nil {
+		description = *update.Description
+	}
+	if update.Status != nil {
+		if err := validateTodoStatus(*update.Status); err != nil {
+			return nil, err
+		}
+		completed = *update.Status == TodoCompleted
+	}
+	if err := validateName("Item", name, MaxItemNameLength); err != nil {
+		return nil, err
+	}
+	if err := validateDescription(description); err != nil {
+		return nil, err
+	}
+
+	err = s.batch(func(b db.BatchStore) error {
+		if err := b.UpdateItem(itemID, name, description, completed); err != nil {
+			return internal("update_failed", "Failed to update item", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.getItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	if name != existing.Name || description != existing.Description {
+		s.publish(listID, EventItemUpdated, item)
+	}
+	if completed != existing.Completed {
+		s.publish(listID, EventItemToggled, item)
+	}
+	return s.todoItemByID(listID, itemID)
+}
+
+// DeleteTodoItems deletes items of a list in one transaction. All of them
+// must be on the list, otherwise none is deleted.
+func (s *Service) DeleteTodoItems(userID, listID int64, itemIDs []int64) error {
+	if len(itemIDs) == 0 {
+		return invalid("No items given")
+	}
+	for _, id := range itemIDs {
+		if err := s.requireTodoItem(userID, listID, id); err != nil {
+			return err
+		}
+	}
+
+	err := s.batch(func(b db.BatchStore) error {
+		for _, id := range itemIDs {
+			if err := b.DeleteItem(id); err != nil {
+				return internal("delete_failed", "Failed to delete item", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range itemIDs {
+		s.publish(listID, EventItemDeleted, map[string]int64{"id": id})
+	}
+	return nil
+}
+
+// requireTodoItem checks that an item is on the list and the user may edit it
+func (s *Service) requireTodoItem(userID, listID, itemID int64) error {
+	itemListID, err := s.RequireItemRole(userID, itemID, db.RoleEditor)
+	if err != nil {
+		return err
+	}
+	if itemListID != listID {
+		return notFound("Item")
+	}
+	return nil
+}
+
+// todoItemByID returns an item of a list with the name of its section
+func (s *Service) todoItemByID(listID, itemID int64) (*TodoItem, error) {
+	item, err := s.getItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	section, err := s.store.GetSectionByID(item.SectionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("Section")
+		}
+		return nil, internal("db_error", "Failed to fetch section", err)
+	}
+	if section.ListID != listID {
+		return nil, notFound("Item")
+	}
+	todo := todoItem(*item, section.Name)
+	return &todo, nil
+}
+
+// findTodoItem returns the item of a list with a name, ignoring case
+func (s *Service) findTodoItem(listID int64, name string) (*db.Item, error) {
+	sections, err := s.store.GetSectionsByList(listID)
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch sections", err)
+	}
+	if item := findItemFold(sections, name); item != nil {
+		return item, nil
+	}
+	return nil, notFound("Item")
+}
+
+func todoItem(item db.Item, section string) TodoItem {
+	status := TodoNeedsAction
+	if item.Completed {
+		status = TodoCompleted
+	}
+	return TodoItem{
+		UID:         strconv.FormatInt(item.ID, 10),
+		Summary:     item.Name,
+		Status:      status,
+		Description: item.Description,
+		Section:     section,
+	}
+}
+
+// validateTodoStatus accepts the two statuses, or none for needs_action
+func validateTodoStatus(status string) error {
+	if status != "" && status != TodoNeedsAction && status != TodoCompleted {
+		return invalid("Status must be needs_action or completed")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// Input length limits
+const (
+	MaxListNameLength    = 100
+	MaxIconLength        = 20 // emoji can be multi-byte
+	MaxSectionNameLength = 100
+	MaxItemNameLength    = 200
+	MaxDescriptionLength = 500
+)
+
+// validateName checks a required name against its length limit
+func validateName(what, name string, max int) error {
+	if name == "" {
+		return invalid(what + " name is required")
+	}
+	if len(name) > max {
+		return invalid(fmt.Sprintf("%s name exceeds maximum length of %d characters", what, max))
+	}
+	return nil
+}
+
+func validateDescription(description string) error {
+	if len(description) > MaxDescriptionLength {
+		return invalid(fmt.Sprintf("Item description exceeds maximum length of %d characters", MaxDescriptionLength))
+	}
+	return nil
+}
+
+func validateIcon(icon string) error {
+	if len(icon) > MaxIconLength {
+		return invalid(fmt.Sprintf("Icon exceeds maximum length of %d characters", MaxIconLength))
+	}
+	return nil
+}
+
+// iconAliases maps string aliases to emoji icons
+var iconAliases = map[string]string{
+	"cart":      "🛒",
+	"shopping":  "🛒",
+	"home":      "🏠",
+	"house":     "🏠",
+	"gift":      "🎁",
+	"present":   "🎁",
+	"christmas": "🎄",
+	"xmas":      "🎄",
+	"birthday":  "🎂",
+	"cake":      "🎂",
+	"food":      "🍕",
+	"pizza":     "🍕",
+	"salad":     "🥗",
+	"healthy":   "🥗",
+	"medicine":  "💊",
+	"health":    "💊",
+	"pills":     "💊",
+	"pet":       "🐕",
+	"pets":      "🐕",
+	"dog":       "🐕",
+	"cleaning":  "🧹",
+	"clean":     "🧹",
+	"package":   "📦",
+	"packages":  "📦",
+	"box":       "📦",
+	"travel":    "✈️",
+	"trip":      "✈️",
+	"flight":    "✈️",
+	"fitness":   "🏋️",
+	"gym":       "🏋️",
+	"workout":   "🏋️",
+	"books":     "📚",
+	"book":      "📚",
+	"reading":   "📚",
+	"tools":     "🛠️",
+	"tool":      "🛠️",
+	"work":      "💼",
+	"office":    "💼",
+	"business":  "💼",
+}
+
+// DefaultIcon is the fallback icon when invalid input is provided
+const DefaultIcon = "🛒"
+
+// isEmoji checks if a string starts with an emoji character
+func isEmoji(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		// Check for common emoji ranges
+		if r >= 0x1F300 && r <= 0x1F9FF { // Miscellaneous Symbols and Pictographs, Emoticons, etc.
+			return true
+		}
+		if r >= 0x2600 && r <= 0x26FF { // Miscellaneous Symbols
+			return true
+		}
+		if r >= 0x2700 && r <= 0x27BF { // Dingbats
+			return true
+		}
+		if r >= 0x1F600 && r <= 0x1F64F { // Emoticons
+			return true
+		}
+		if r >= 0x1F680 && r <= 0x1F6FF { // Transport and Map Symbols
+			return true
+		}
+		// If first rune is a letter or digit, it's not an emoji
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return false
+}
+
+// NormalizeIcon converts string aliases to emoji, validates emoji input,
+// or returns default icon for invalid input
+func NormalizeIcon(icon string) string {
+	if icon == "" {
+		return ""
+	}
+	// Check if it's a known alias
+	if emoji, ok := iconAliases[icon]; ok {
+		return emoji
+	}
+	// Check if it's already a valid emoji
+	if isEmoji(icon) {
+		return icon
+	}
+	// Invalid input - return default icon
+	return DefaultIcon
+}
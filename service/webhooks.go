@@ -0,0 +1,260 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"shopping-list/db"
+	"sort"
+	"strings"
+)
+
+// WebhookEvents are the event types webhooks can subscribe to: all the ones
+// the service publishes. "*" subscribes to all of them.
+var WebhookEvents = []string{
+	EventListCreated, EventListUpdated, EventListDeleted, EventListActivated, EventListsReordered,
+	EventSectionCreated, EventSectionUpdated, EventSectionDeleted, EventSectionsDeleted, EventSectionsReordered,
+	EventItemCreated, EventItemUpdated, EventItemToggled, EventItemDeleted, EventItemMoved, EventItemsReordered,
+	EventCompletedItemsDeleted, EventBatchCreated, EventDataImported,
+	EventTemplateCreated, EventTemplateUpdated, EventTemplateDeleted, EventTemplateItemCreated, EventTemplateItemUpdated, EventTemplateItemDeleted, EventTemplateApplied,
+	EventHistoryItemSaved, EventHistoryItemDeleted, EventHistoryItemsDeleted,
+}
+
+// MaxWebhookURLLength is the longest URL a webhook may have
+const MaxWebhookURLLength = 2000
+
+// NewWebhook holds the fields of a webhook to create. An empty Secret gets a
+// random one; no Events means all of them.
+type NewWebhook struct {
+	Name   string
+	URL    string
+	Secret string
+	Events []string
+	ListID int64
+}
+
+// WebhookUpdate holds the fields to change; nil fields are kept
+type WebhookUpdate struct {
+	Name    *string
+	URL     *string
+	Secret  *string
+	Events  *[]string
+	ListID  *int64
+	Enabled *bool
+}
+
+// Webhooks returns all webhooks. Managing webhooks requires system access.
+func (s *Service) Webhooks(userID int64) ([]db.Webhook, error) {
+	if err := requireSystem(userID); err != nil {
+		return nil, err
+	}
+	webhooks, err := s.store.GetWebhooks()
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch webhooks", err)
+	}
+	return webhooks, nil
+}
+
+// Webhook returns one webhook
+func (s *Service) Webhook(userID, id int64) (*db.Webhook, error) {
+	if err := requireSystem(userID); err != nil {
+		return nil, err
+	}
+	w, err := s.store.GetWebhook(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("Webhook")
+		}
+		return nil, internal("db_error", "Failed to fetch webhook", err)
+	}
+	return w, nil
+}
+
+// CreateWebhook adds an enabled webhook
+func (s *Service) CreateWebhook(userID int64, input NewWebhook) (*db.Webhook, error) {
+	if err := requireSystem(userID); err != nil {
+		return nil, err
+	}
+	if input.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return nil, internal("create_failed", "Failed to create webhook secret", err)
+		}
+		input.Secret = secret
+	}
+	w := &db.Webhook{
+		Name:    strings.TrimSpace(input.Name),
+		URL:     strings.TrimSpace(input.URL),
+		Secret:  input.Secret,
+		Events:  input.Events,
+		ListID:  input.ListID,
+		Enabled: true,
+	}
+	if err := s.validateWebhook(w); err != nil {
+		return nil, err
+	}
+
+	created, err := s.store.CreateWebhook(w)
+	if err != nil {
+		return nil, internal("create_failed", "Failed to create webhook", err)
+	}
+	return created, nil
+}
+
+// UpdateWebhook changes the given fields of a webhook
+func (s *Service) UpdateWebhook(userID, id int64, update WebhookUpdate) (*db.Webhook, error) {
+	w, err := s.Webhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if update.Name != nil {
+		w.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.URL != nil {
+		w.URL = strings.TrimSpace(*update.URL)
+	}
+	if update.Secret != nil {
+		w.Secret = *update.Secret
+		if w.Secret == "" {
+			if w.Secret, err = newWebhookSecret(); err != nil {
+				return nil, internal("update_failed", "Failed to create webhook secret", err)
+			}
+		}
+	}
+	if update.Events != nil {
+		w.Events = *update.Events
+	}
+	if update.ListID != nil {
+		w.ListID = *update.ListID
+	}
+	if update.Enabled != nil {
+		w.Enabled = *update.Enabled
+	}
+	if err := s.validateWebhook(w); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.store.UpdateWebhook(w)
+	if err != nil {
+		return nil, internal("update_failed", "Failed to update webhook", err)
+	}
+	return updated, nil
+}
+
+// DeleteWebhook removes a webhook with its delivery log
+func (s *Service) DeleteWebhook(userID, id int64) error {
+	if err := requireSystem(userID); err != nil {
+		return err
+	}
+	if err := s.store.DeleteWebhook(id); err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("Webhook")
+		}
+		return internal("delete_failed", "Failed to delete webhook", err)
+	}
+	return nil
+}
+
+// WebhookDeliveries returns the latest deliveries of a webhook, newest first
+func (s *Service) WebhookDeliveries(userID, id int64, limit int) ([]db.WebhookDelivery, error) {
+	if _, err := s.Webhook(userID, id); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.store.GetWebhookDeliveries(id, limit)
+	if err != nil {
+		return nil, internal("db_error", "Failed to fetch deliveries", err)
+	}
+	return deliveries, nil
+}
+
+// validateWebhook checks a webhook and normalizes its events
+func (s *Service) validateWebhook(w *db.Webhook) error {
+	if err := validateName("Webhook", w.Name, MaxListNameLength); err != nil {
+		return err
+	}
+	if len(w.URL) > MaxWebhookURLLength {
+		return invalid("Webhook URL is too long")
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalid("Webhook URL must be an http:// or https:// URL")
+	}
+
+	events, err := normalizeWebhookEvents(w.Events)
+	if err != nil {
+		return err
+	}
+	w.Events = events
+
+	if w.ListID != 0 {
+		if _, err := s.store.GetListByID(w.ListID); err != nil {
+			if err == sql.ErrNoRows {
+				return notFound("List")
+			}
+			return internal("db_error", "Failed to fetch list", err)
+		}
+	}
+	return nil
+}
+
+// normalizeWebhookEvents checks event types and sorts them; none or "*" is all
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "*" {
+			return []string{"*"}, nil
+		}
+		if !containsString(WebhookEvents, event) {
+			return nil, invalid("Unknown event type: " + event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			normalized = append(normalized, event)
+		}
+	}
+	if len(normalized) == 0 {
+		return []string{"*"}, nil
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// WebhookWants reports whether a webhook subscribes to an event
+func WebhookWants(w db.Webhook, e Event) bool {
+	if !w.Enabled {
+		return false
+	}
+	if w.ListID != 0 && w.ListID != e.ListID {
+		return false
+	}
+	return containsString(w.Events, "*") || containsString(w.Events, e.Type)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// newWebhookSecret returns a random key for signing payloads
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// requireSystem fails unless the caller has system access
+func requireSystem(userID int64) error {
+	if userID != 0 {
+		return &Error{Kind: KindForbidden, Code: "forbidden", Message: "This requires full access"}
+	}
+	return nil
+}
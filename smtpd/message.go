@@ -0,0 +1,196 @@
+package smtpd
+
+import (
+	"encoding/base64"
+	"errors"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// maxPartDepth bounds nested multiparts and forwarded messages
+const maxPartDepth = 5
+
+var errNoItems = errors.New("No items found in the message")
+
+var (
+	// Lines that introduce forwarded or quoted mail, and its header lines
+	forwardMarker = regexp.MustCompile(`(?i)^(?:-+\s*(?:forwarded message|original message)\s*-+|begin forwarded message:|sent from my .+)$`)
+	headerLine    = regexp.MustCompile(`(?i)^(?:from|to|cc|date|sent|subject|reply-to):\s`)
+	listBullet    = regexp.MustCompile(`^(?:[-*+•◦▪‣·–]|\d+[.)]|\[[ xX]?\]|[☐☑☒✓✔])\s*`)
+	subjectPrefix = regexp.MustCompile(`(?i)^(?:re|fwd?|aw|wg|sv|vs):\s*`)
+
+	htmlDrop  = regexp.MustCompile(`(?is)<(?:style|script|head)\b.*?</(?:style|script|head)>`)
+	htmlBreak = regexp.MustCompile(`(?i)<(?:br|/p|/div|/li|li|/tr|/h\d)\b[^>]*>`)
+	htmlTag   = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// messageText returns the text of a message to parse for items: its plain
+// text, or its HTML without markup, less quoted replies, forwarding headers,
+// signatures, headings and sentences. Without any, it is the subject.
+func messageText(msg *mail.Message) (string, error) {
+	plain, htmlText, err := findText(textproto.MIMEHeader(msg.Header), msg.Body, 0)
+	if err != nil {
+		return "", errors.New("Unreadable message body")
+	}
+	body := plain
+	if strings.TrimSpace(body) == "" {
+		body = stripHTML(htmlText)
+	}
+
+	text := cleanText(body)
+	if text == "" {
+		text = subject(msg.Header)
+	}
+	if text == "" {
+		return "", errNoItems
+	}
+	return text, nil
+}
+
+// findText returns the first plain text and the first HTML part of a body,
+// looking into multiparts and forwarded messages
+func findText(header textproto.MIMEHeader, r io.Reader, depth int) (plain, htmlText string, err error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition")); disposition == "attachment" && mediaType != "message/rfc822" {
+		return "", "", nil
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if depth >= maxPartDepth {
+			return "", "", nil
+		}
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return plain, htmlText, err
+			}
+			p, h, err := findText(part.Header, part, depth+1)
+			if err != nil {
+				return plain, htmlText, err
+			}
+			if plain == "" {
+				plain = p
+			}
+			if htmlText == "" {
+				htmlText = h
+			}
+		}
+		return plain, htmlText, nil
+
+	case mediaType == "message/rfc822":
+		if depth >= maxPartDepth {
+			return "", "", nil
+		}
+		inner, err := mail.ReadMessage(decodeTransfer(header, r))
+		if err != nil {
+			return "", "", nil
+		}
+		return findText(textproto.MIMEHeader(inner.Header), inner.Body, depth+1)
+
+	case mediaType == "text/plain", mediaType == "text/html":
+		b, err := io.ReadAll(io.LimitReader(decodeTransfer(header, r), maxMessageSize))
+		if err != nil {
+			return "", "", err
+		}
+		text := toUTF8(b, params["charset"])
+		if mediaType == "text/html" {
+			return "", text, nil
+		}
+		return text, "", nil
+	}
+	return "", "", nil
+}
+
+// decodeTransfer undoes a base64 or quoted-printable transfer encoding
+func decodeTransfer(header textproto.MIMEHeader, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// toUTF8 converts text in Latin-1 to UTF-8; other charsets are read as UTF-8
+func toUTF8(b []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	}
+	return strings.ToValidUTF8(string(b), "")
+}
+
+func stripHTML(s string) string {
+	s = htmlDrop.ReplaceAllString(s, "")
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+// cleanText keeps the lines of a body that may name items
+func cleanText(body string) string {
+	var kept []string
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		if line == "-- " {
+			// The signature follows
+			break
+		}
+		line = strings.TrimSpace(strings.ReplaceAll(line, "\u00a0", " "))
+		if strings.HasPrefix(line, ">") || forwardMarker.MatchString(line) || headerLine.MatchString(line) {
+			continue
+		}
+		line = strings.TrimSpace(listBullet.ReplaceAllString(line, ""))
+		if line == "" || strings.HasSuffix(line, ":") || isSentence(line) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// isSentence tells prose, like the steps of a recipe, from item lines: a
+// sentence ends in a full stop or has a part of more than eight words
+func isSentence(line string) bool {
+	if strings.ContainsAny(line[len(line)-1:], ".!?") && len(strings.Fields(line)) >= 3 {
+		return true
+	}
+	for _, part := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ';' }) {
+		if len(strings.Fields(part)) > 8 {
+			return true
+		}
+	}
+	return false
+}
+
+// subject returns the decoded subject without reply and forward prefixes
+func subject(header mail.Header) string {
+	s, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil {
+		s = header.Get("Subject")
+	}
+	s = strings.TrimSpace(s)
+	for subjectPrefix.MatchString(s) {
+		s = strings.TrimSpace(subjectPrefix.ReplaceAllString(s, ""))
+	}
+	return s
+}
@@ -0,0 +1,433 @@
+// Package smtpd receives email sent to a list: forward a recipe or send
+// "milk, eggs" to <mail alias>@koffan.local and the items are added like
+// through the add-item hook the alias belongs to. Only senders on an
+// allow-list are accepted, and nothing is ever relayed.
+package smtpd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"os"
+	"shopping-list/db"
+	"shopping-list/service"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxMessageSize is the largest message accepted, attachments included
+	maxMessageSize = 10 << 20
+	// maxRecipients is how many lists one message may go to
+	maxRecipients = 10
+	// maxConnections bounds the sessions served at once
+	maxConnections = 20
+	// commandTimeout closes idle sessions
+	commandTimeout = 5 * time.Minute
+	// maxLineLength bounds command lines; RFC 5321 allows 512 octets
+	maxLineLength = 4096
+)
+
+type config struct {
+	listen  string
+	domain  string
+	senders []string
+}
+
+var (
+	cfg config
+	svc *service.Service
+)
+
+// Start listens for mail on SMTP_LISTEN, if set, in the background
+func Start(s *service.Service) {
+	cfg = loadConfig()
+	if cfg.listen == "" {
+		return
+	}
+	if len(cfg.senders) == 0 {
+		log.Printf("SMTP: SMTP_ALLOWED_SENDERS is empty, not accepting mail")
+		return
+	}
+
+	ln, err := net.Listen("tcp", cfg.listen)
+	if err != nil {
+		log.Printf("SMTP: failed to listen on %s: %v", cfg.listen, err)
+		return
+	}
+	log.Printf("SMTP: accepting mail for %s on %s", cfg.domain, cfg.listen)
+
+	svc = s
+	go serve(ln)
+}
+
+// Address returns the email address of an inbound hook, or "" if the SMTP
+// receiver is not configured
+func Address(hook *db.InboundHook) string {
+	c := loadConfig()
+	if c.listen == "" {
+		return ""
+	}
+	return hook.MailAlias + "@" + c.domain
+}
+
+func loadConfig() config {
+	c := config{
+		listen: os.Getenv("SMTP_LISTEN"),
+		domain: os.Getenv("SMTP_DOMAIN"),
+	}
+	if c.domain == "" {
+		c.domain = "koffan.local"
+	}
+	for _, sender := range strings.Split(os.Getenv("SMTP_ALLOWED_SENDERS"), ",") {
+		if sender = strings.ToLower(strings.TrimSpace(sender)); sender != "" {
+			c.senders = append(c.senders, strings.TrimPrefix(sender, "*"))
+		}
+	}
+	return c
+}
+
+// allowedSender checks an address against SMTP_ALLOWED_SENDERS, which holds
+// addresses and whole domains written as @example.com
+func allowedSender(address string) bool {
+	address = strings.ToLower(strings.TrimSpace(address))
+	at := strings.LastIndex(address, "@")
+	if at <= 0 {
+		return false
+	}
+	for _, sender := range cfg.senders {
+		if sender == address || (strings.HasPrefix(sender, "@") && sender == address[at:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func serve(ln net.Listener) {
+	slots := make(chan struct{}, maxConnections)
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("SMTP: accept failed: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+		default:
+			conn.Write([]byte("421 4.3.2 Too many connections, try again later\r\n"))
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer func() { <-slots }()
+			newSession(conn).run()
+		}()
+	}
+}
+
+// session is one SMTP conversation. A mail transaction is MAIL, one or more
+// RCPT and DATA.
+type session struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	w     *bufio.Writer
+	greet bool
+	from  string
+	hooks []*db.InboundHook
+}
+
+func newSession(conn net.Conn) *session {
+	return &session{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+func (s *session) run() {
+	defer s.conn.Close()
+	s.reply(220, cfg.domain+" Koffan ESMTP ready")
+
+	for {
+		s.conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := s.readLine()
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				s.reply(500, "5.5.2 Line too long")
+				continue
+			}
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			s.greet = true
+			s.reset()
+			s.reply(250, cfg.domain)
+		case "EHLO":
+			s.greet = true
+			s.reset()
+			s.reply(250, cfg.domain, "SIZE "+strconv.Itoa(maxMessageSize), "8BITMIME", "ENHANCEDSTATUSCODES")
+		case "MAIL":
+			s.mail(arg)
+		case "RCPT":
+			s.rcpt(arg)
+		case "DATA":
+			s.data()
+		case "RSET":
+			s.reset()
+			s.reply(250, "2.0.0 OK")
+		case "NOOP":
+			s.reply(250, "2.0.0 OK")
+		case "VRFY":
+			s.reply(252, "2.5.0 Cannot verify addresses")
+		case "QUIT":
+			s.reply(221, "2.0.0 Bye")
+			return
+		default:
+			s.reply(502, "5.5.1 Command not implemented")
+		}
+	}
+}
+
+func (s *session) reset() {
+	s.from = ""
+	s.hooks = nil
+}
+
+func (s *session) mail(arg string) {
+	if !s.greet {
+		s.reply(503, "5.5.1 Say HELO first")
+		return
+	}
+	if s.from != "" {
+		s.reply(503, "5.5.1 Sender already given")
+		return
+	}
+	address, params, ok := pathArg(arg, "FROM:")
+	if !ok {
+		s.reply(501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+	for _, param := range strings.Fields(params) {
+		if size, ok := strings.CutPrefix(strings.ToUpper(param), "SIZE="); ok {
+			if n, err := strconv.Atoi(size); err == nil && n > maxMessageSize {
+				s.reply(552, "5.3.4 Message too large")
+				return
+			}
+		}
+	}
+	if !allowedSender(address) {
+		log.Printf("SMTP: refused mail from %q (%s)", address, s.conn.RemoteAddr())
+		s.reply(550, "5.7.1 Sender not allowed")
+		return
+	}
+	s.from = address
+	s.reply(250, "2.1.0 OK")
+}
+
+func (s *session) rcpt(arg string) {
+	if s.from == "" {
+		s.reply(503, "5.5.1 Need MAIL first")
+		return
+	}
+	address, _, ok := pathArg(arg, "TO:")
+	if !ok {
+		s.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(s.hooks) >= maxRecipients {
+		s.reply(452, "4.5.3 Too many recipients")
+		return
+	}
+	hook, err := svc.InboundHookByMailAlias(addressAlias(address))
+	if err != nil {
+		if service.AsError(err).Kind == service.KindNotFound {
+			s.reply(550, "5.1.1 No such list")
+		} else {
+			s.reply(451, "4.3.0 Try again later")
+		}
+		return
+	}
+	for _, h := range s.hooks {
+		if h.ID == hook.ID {
+			s.reply(250, "2.1.5 OK")
+			return
+		}
+	}
+	s.hooks = append(s.hooks, hook)
+	s.reply(250, "2.1.5 OK")
+}
+
+func (s *session) data() {
+	if len(s.hooks) == 0 {
+		s.reply(503, "5.5.1 Need RCPT first")
+		return
+	}
+	s.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+	data, err := s.readData()
+	defer s.reset()
+	if errors.Is(err, errTooLarge) {
+		s.reply(552, "5.3.4 Message too large")
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	code, message := deliver(s.from, s.hooks, data)
+	s.reply(code, message)
+}
+
+// deliver adds the items of a message to the list of each hook and returns
+// the SMTP reply
+func deliver(from string, hooks []*db.InboundHook, data []byte) (int, string) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return 554, "5.6.0 Malformed message"
+	}
+	// The header sender must be allowed as well, not just the envelope one
+	if addresses, err := msg.Header.AddressList("From"); err == nil {
+		for _, a := range addresses {
+			if !allowedSender(a.Address) {
+				log.Printf("SMTP: refused mail from %q sent as %q", a.Address, from)
+				return 550, "5.7.1 Sender not allowed"
+			}
+		}
+	}
+
+	text, err := messageText(msg)
+	if err != nil {
+		return 554, "5.6.0 " + err.Error()
+	}
+
+	var added []string
+	var failed error
+	for _, hook := range hooks {
+		// Like an add-item hook, mail acts with full access on its own list
+		result, err := svc.QuickAdd(0, hook.ListID, hook.SectionID, text)
+		if err != nil {
+			failed = err
+			continue
+		}
+		count := len(result.Added) + len(result.Reopened)
+		added = append(added, fmt.Sprintf("%d item(s) to %s", count, hook.ListName))
+		log.Printf("SMTP: added %d item(s) to %s from %s", count, hook.ListName, from)
+	}
+	if len(added) == 0 {
+		return 550, "5.6.0 " + service.AsError(failed).Message
+	}
+	return 250, "2.0.0 Added " + strings.Join(added, ", ")
+}
+
+// pathArg reads "FROM:<address> params" or "TO:<address>"
+func pathArg(arg, prefix string) (address, params string, ok bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", "", false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", "", false
+	}
+	end := strings.Index(rest, ">")
+	if end < 0 {
+		return "", "", false
+	}
+	return rest[1:end], rest[end+1:], true
+}
+
+// addressAlias takes the mail alias out of alias@domain or name+alias@domain
+func addressAlias(address string) string {
+	local := address
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		local = address[:at]
+	}
+	if plus := strings.LastIndex(local, "+"); plus >= 0 {
+		local = local[plus+1:]
+	}
+	return strings.ToLower(local)
+}
+
+var (
+	errLineTooLong = errors.New("line too long")
+	errTooLarge    = errors.New("message too large")
+)
+
+// readLine reads a command line without its line ending
+func (s *session) readLine() (string, error) {
+	var line []byte
+	for {
+		part, more, err := s.r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, part...)
+		if len(line) > maxLineLength {
+			for more {
+				if _, more, err = s.r.ReadLine(); err != nil {
+					return "", err
+				}
+			}
+			return "", errLineTooLong
+		}
+		if !more {
+			return string(line), nil
+		}
+	}
+}
+
+// readData reads the message up to the line with a single dot, undoing dot
+// stuffing. A message over the size limit is read to its end and dropped.
+func (s *session) readData() ([]byte, error) {
+	var data bytes.Buffer
+	tooLarge := false
+	// atStart is false while reading the rest of a line longer than the buffer
+	atStart := true
+	for {
+		s.conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := s.r.ReadSlice('\n')
+		partial := errors.Is(err, bufio.ErrBufferFull)
+		if err != nil && !partial {
+			return nil, err
+		}
+		if atStart && !partial && bytes.Equal(bytes.TrimRight(line, "\r\n"), []byte(".")) {
+			break
+		}
+		if atStart && len(line) > 0 && line[0] == '.' {
+			line = line[1:]
+		}
+		atStart = !partial
+		if tooLarge {
+			continue
+		}
+		data.Write(line)
+		if data.Len() > maxMessageSize {
+			tooLarge = true
+			data.Reset()
+		}
+	}
+	if tooLarge {
+		return nil, errTooLarge
+	}
+	return data.Bytes(), nil
+}
+
+// reply sends a reply, with one line for each text
+func (s *session) reply(code int, texts ...string) {
+	for i, text := range texts {
+		sep := " "
+		if i < len(texts)-1 {
+			sep = "-"
+		}
+		fmt.Fprintf(s.w, "%d%s%s\r\n", code, sep, text)
+	}
+	s.w.Flush()
+}
@@ -0,0 +1,142 @@
+package smtpd
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"shopping-list/db"
+	"shopping-list/service"
+	"strings"
+	"testing"
+)
+
+// newTestServer serves mail on a loopback port for a list with one hook and
+// returns the address to dial, the store and the hook with its token
+func newTestServer(t *testing.T) (string, *db.MemoryStore, *db.InboundHook, string) {
+	s := db.NewMemoryStore()
+	list := must(s.CreateList("Groceries", "", 0))
+	must(s.CreateSectionForList(list.ID, "Dairy"))
+
+	cfg = config{listen: "127.0.0.1:0", domain: "koffan.local", senders: []string{"me@example.com", "@family.example"}}
+	svc = service.New(s)
+	hook, token, err := svc.CreateInboundHook(0, service.NewInboundHook{Name: "email", ListID: list.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", cfg.listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go serve(ln)
+	return ln.Addr().String(), s, hook, token
+}
+
+// send mails a message and returns the first error and its SMTP code
+func send(t *testing.T, addr, from, to, message string) (int, error) {
+	t.Helper()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Mail(from)
+	if err == nil {
+		err = c.Rcpt(to)
+	}
+	if err == nil {
+		w, dataErr := c.Data()
+		if dataErr != nil {
+			return code(dataErr), dataErr
+		}
+		if _, err = w.Write([]byte(strings.ReplaceAll(message, "\n", "\r\n"))); err == nil {
+			err = w.Close()
+		}
+	}
+	if err != nil {
+		return code(err), err
+	}
+	return 250, c.Quit()
+}
+
+func code(err error) int {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code
+	}
+	return 0
+}
+
+// itemNames returns the names of all items of a store
+func itemNames(t *testing.T, s *db.MemoryStore) []string {
+	t.Helper()
+	var names []string
+	for _, section := range must(s.GetSectionsByList(1)) {
+		for _, item := range must(s.GetItemsBySection(section.ID)) {
+			names = append(names, item.Name)
+		}
+	}
+	return names
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestReceiveMail(t *testing.T) {
+	addr, s, hook, _ := newTestServer(t)
+	if len(hook.MailAlias) != 16 {
+		t.Fatalf("mail alias = %q", hook.MailAlias)
+	}
+
+	message := "From: Me <me@example.com>\nSubject: Shopping\n\nMilk, eggs\n\n-- \nSent with love\n"
+	if status, err := send(t, addr, "me@example.com", hook.MailAlias+"@koffan.local", message); err != nil {
+		t.Fatalf("send = %d %v", status, err)
+	}
+	if names := itemNames(t, s); strings.Join(names, ",") != "Milk,Eggs" {
+		t.Errorf("items = %q", names)
+	}
+
+	// Plus addressing and any domain work, as does a sender's whole domain
+	message = "From: kid@family.example\nSubject: Fwd: Bread\n\n"
+	if status, err := send(t, addr, "kid@family.example", "shopping+"+strings.ToUpper(hook.MailAlias)+"@example.org", message); err != nil {
+		t.Fatalf("send with plus addressing = %d %v", status, err)
+	}
+	if names := itemNames(t, s); len(names) != 3 || names[2] != "Bread" {
+		t.Errorf("items = %q", names)
+	}
+}
+
+func TestRefusedMail(t *testing.T) {
+	addr, s, hook, token := newTestServer(t)
+	to := hook.MailAlias + "@koffan.local"
+
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		message string
+		code    int
+	}{
+		{"from an envelope sender not allowed", "someone@example.net", to, "From: someone@example.net\n\nMilk\n", 550},
+		{"from a header sender not allowed", "me@example.com", to, "From: someone@example.net\n\nMilk\n", 550},
+		// The hook token must not work as an address
+		{"to the hook token", "me@example.com", token + "@koffan.local", "From: me@example.com\n\nMilk\n", 550},
+		{"to an unknown alias", "me@example.com", "0123456789abcdef@koffan.local", "From: me@example.com\n\nMilk\n", 550},
+		{"without items", "me@example.com", to, "From: me@example.com\n\nThanks for shopping, see you at home later.\n", 554},
+	}
+	for _, tt := range tests {
+		if status, _ := send(t, addr, tt.from, tt.to, tt.message); status != tt.code {
+			t.Errorf("mail %s = %d, want %d", tt.name, status, tt.code)
+		}
+	}
+	if names := itemNames(t, s); len(names) != 0 {
+		t.Errorf("refused mail added %q", names)
+	}
+}
@@ -70,6 +70,8 @@ function shoppingList() {
         showEditModal: false,
         showSettings: false,
         showOfflineModal: false,
+        showPasteModal: false,
+        pasteText: '',
 
         // Section management
         selectMode: false,
@@ -551,6 +553,11 @@ function shoppingList() {
                         this.refreshList();
                         this.refreshStats();
                         break;
+                    case 'database_restored':
+                    case 'data_imported':
+                        // Everything may have changed - start over
+                        window.location.reload();
+                        break;
                     case 'pong':
                         break;
                     default:
@@ -934,6 +941,53 @@ function shoppingList() {
             }
         },
 
+        // Copy the list as Markdown or plain text
+        async copyListText(format) {
+            try {
+                const response = await fetch('/lists/' + window.currentListId + '/export?format=' + format);
+                if (!response.ok) {
+                    window.Toast.show(await response.text(), 'warning');
+                    return;
+                }
+                await navigator.clipboard.writeText(await response.text());
+                window.Toast.show(t('list_text.copied'), 'success', 2000);
+            } catch (error) {
+                console.error('[App] Failed to copy list:', error);
+                window.Toast.show(t('list_text.copy_failed'), 'warning');
+            }
+        },
+
+        // Add the sections and items of pasted text to the list
+        async submitPastedList() {
+            if (!this.isOnline) {
+                window.Toast.show(t('offline.action_blocked'), 'warning');
+                return;
+            }
+
+            try {
+                const body = new URLSearchParams({ text: this.pasteText });
+                const response = await fetch('/lists/' + window.currentListId + '/import-text', { method: 'POST', body });
+                if (!response.ok) {
+                    window.Toast.show(await response.text(), 'warning');
+                    return;
+                }
+                const result = await response.json();
+                this.showPasteModal = false;
+                this.pasteText = '';
+                this.refreshList();
+                this.refreshStats();
+
+                let message = t('list_text.added') + ': ' + result.items;
+                if (result.skipped > 0) {
+                    message += ' (' + t('list_text.skipped') + ': ' + result.skipped + ')';
+                }
+                window.Toast.show(message, 'success');
+            } catch (error) {
+                console.error('[App] Failed to import pasted list:', error);
+                window.Toast.show(t('error.generic'), 'warning');
+            }
+        },
+
         // History management methods
         async fetchHistory() {
             if (!this.isOnline) return;
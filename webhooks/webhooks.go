@@ -0,0 +1,302 @@
+// Package webhooks sends change events to the HTTP endpoints configured by an
+// admin. Events are queued in the database and delivered by a background
+// worker, which retries failed deliveries with increasing delays.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"shopping-list/db"
+	"shopping-list/service"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Delays before each retry; a delivery fails for good after the last one
+var retryDelays = []time.Duration{
+	30 * time.Second,
+	2 * time.Minute,
+	10 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+}
+
+const (
+	// pollInterval is how often the worker looks for retries that are due
+	pollInterval = 15 * time.Second
+	// requestTimeout bounds each delivery attempt
+	requestTimeout = 10 * time.Second
+	// logRetention is how long delivered and failed deliveries are kept
+	logRetention = 30 * 24 * time.Hour
+	// batchSize is how many due deliveries the worker sends per round
+	batchSize = 50
+	// maxParallel is how many webhooks are sent to at the same time
+	maxParallel = 4
+	// maxErrorLength shortens response bodies kept in the delivery log
+	maxErrorLength = 500
+)
+
+// Payload is the JSON body of every delivery
+type Payload struct {
+	Event     string      `json:"event"`
+	ListID    int64       `json:"list_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+var (
+	store  db.WebhookStore
+	client = &http.Client{Timeout: requestTimeout}
+	wake   = make(chan struct{}, 1)
+)
+
+// Start begins delivering queued events from s in the background
+func Start(s db.WebhookStore) {
+	store = s
+	go worker()
+}
+
+// HandleEvent queues an event for every webhook subscribed to it.
+// It is a service subscriber; delivery happens in the background.
+func HandleEvent(e service.Event) {
+	if store == nil {
+		return
+	}
+	webhooks, err := store.GetWebhooks()
+	if err != nil {
+		log.Printf("Webhooks: failed to load webhooks: %v", err)
+		return
+	}
+
+	var body []byte
+	queued := false
+	for _, w := range webhooks {
+		if !service.WebhookWants(w, e) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(Payload{Event: e.Type, ListID: e.ListID, Timestamp: time.Now().UTC(), Data: e.Data}); err != nil {
+				log.Printf("Webhooks: failed to encode %s event: %v", e.Type, err)
+				return
+			}
+		}
+		_, err := store.CreateWebhookDelivery(&db.WebhookDelivery{
+			WebhookID:     w.ID,
+			Event:         e.Type,
+			Payload:       string(body),
+			Status:        db.WebhookPending,
+			NextAttemptAt: time.Now().Unix(),
+		})
+		if err != nil {
+			log.Printf("Webhooks: failed to queue %s event for webhook %d: %v", e.Type, w.ID, err)
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Test sends a "ping" event to a webhook right away, whether it is enabled or
+// not, and returns the logged delivery. It is not retried.
+func Test(w *db.Webhook) (*db.WebhookDelivery, error) {
+	body, err := json.Marshal(Payload{
+		Event:     "ping",
+		Timestamp: time.Now().UTC(),
+		Data:      map[string]interface{}{"webhook_id": w.ID, "name": w.Name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	d, err := store.CreateWebhookDelivery(&db.WebhookDelivery{
+		WebhookID: w.ID,
+		Event:     "ping",
+		Payload:   string(body),
+		Status:    db.WebhookPending,
+		// Far in the future, so the worker leaves it alone meanwhile
+		NextAttemptAt: time.Now().Add(24 * time.Hour).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attempt(w, d, false)
+	return d, store.UpdateWebhookDelivery(d)
+}
+
+// Sign returns the signature sent in the X-Koffan-Signature header: the
+// HMAC-SHA256 of the X-Koffan-Timestamp header, a dot and the body. Signing
+// the time lets receivers reject old deliveries sent again.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// worker sends due deliveries whenever events are queued or retries are due
+func worker() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		deliverDue()
+
+		if time.Since(lastPrune) > time.Hour {
+			if err := store.DeleteWebhookDeliveries(time.Now().Add(-logRetention).Unix()); err != nil {
+				log.Printf("Webhooks: failed to prune the delivery log: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue sends pending deliveries until none are due. Each webhook is
+// sent to by its own goroutine, up to maxParallel at a time, so a slow
+// endpoint doesn't hold up the others; each gets its deliveries in order.
+func deliverDue() {
+	for {
+		deliveries, err := store.GetDueWebhookDeliveries(time.Now().Unix(), batchSize)
+		if err != nil {
+			log.Printf("Webhooks: failed to load the delivery queue: %v", err)
+			return
+		}
+
+		var order []int64
+		queues := make(map[int64][]*db.WebhookDelivery)
+		for i := range deliveries {
+			d := &deliveries[i]
+			if _, ok := queues[d.WebhookID]; !ok {
+				order = append(order, d.WebhookID)
+			}
+			queues[d.WebhookID] = append(queues[d.WebhookID], d)
+		}
+
+		var wg sync.WaitGroup
+		var failed atomic.Bool
+		slots := make(chan struct{}, maxParallel)
+		for _, id := range order {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(id int64, queue []*db.WebhookDelivery) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				if !deliverTo(id, queue) {
+					failed.Store(true)
+				}
+			}(id, queues[id])
+		}
+		wg.Wait()
+
+		// After a database error the rest waits for the next round
+		if failed.Load() || len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// deliverTo sends the due deliveries of one webhook in order. It returns
+// false if the database failed, leaving the rest of them due.
+func deliverTo(webhookID int64, deliveries []*db.WebhookDelivery) bool {
+	w, err := store.GetWebhook(webhookID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Webhooks: failed to load webhook %d: %v", webhookID, err)
+		return false
+	}
+
+	for _, d := range deliveries {
+		if w == nil {
+			// Deleted meanwhile; don't leave its deliveries due
+			d.Status = db.WebhookFailed
+			d.FinishedAt = time.Now().Unix()
+			d.Error = "webhook deleted"
+		} else {
+			attempt(w, d, true)
+		}
+		if err := store.UpdateWebhookDelivery(d); err != nil {
+			// It would still be due; stop instead of sending it again
+			log.Printf("Webhooks: failed to save delivery %d: %v", d.ID, err)
+			return false
+		}
+	}
+	return true
+}
+
+// attempt sends a delivery once and records the outcome in d. With retry,
+// a failed delivery is scheduled again until the retries run out.
+func attempt(w *db.Webhook, d *db.WebhookDelivery, retry bool) {
+	d.Attempts++
+	d.ResponseCode, d.Error = send(w, d)
+
+	now := time.Now()
+	switch {
+	case d.Error == "":
+		d.Status = db.WebhookDelivered
+		d.FinishedAt = now.Unix()
+	case retry && d.Attempts <= len(retryDelays):
+		d.NextAttemptAt = now.Add(retryDelays[d.Attempts-1]).Unix()
+	default:
+		d.Status = db.WebhookFailed
+		d.FinishedAt = now.Unix()
+		log.Printf("Webhooks: giving up on delivery %d to %q after %d attempts: %s", d.ID, w.Name, d.Attempts, d.Error)
+	}
+}
+
+// send posts the payload and returns the response status and an error
+// message, which is empty for 2xx responses
+func send(w *db.Webhook, d *db.WebhookDelivery) (int, string) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Koffan-Webhook")
+	req.Header.Set("X-Koffan-Event", d.Event)
+	req.Header.Set("X-Koffan-Delivery", strconv.FormatInt(d.ID, 10))
+	timestamp := time.Now().Unix()
+	req.Header.Set("X-Koffan-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Koffan-Signature", Sign(w.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return resp.StatusCode, ""
+	}
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+	message := fmt.Sprintf("HTTP %d", resp.StatusCode)
+	if len(bytes.TrimSpace(text)) > 0 {
+		message += ": " + string(bytes.TrimSpace(text))
+	}
+	return resp.StatusCode, message
+}
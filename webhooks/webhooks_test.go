@@ -0,0 +1,253 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"shopping-list/db"
+	"shopping-list/service"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// received is a request a test receiver got
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is an endpoint that answers with status and records what it got
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []received
+	status   int
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	r := &receiver{status: status}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, received{req.Header.Clone(), body})
+		status := r.status
+		r.mu.Unlock()
+		w.WriteHeader(status)
+		if status >= 300 {
+			w.Write([]byte("  try later \n"))
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) got() []received {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]received(nil), r.requests...)
+}
+
+// useStore makes the package deliver from a new memory store
+func useStore(t *testing.T) *db.MemoryStore {
+	s := db.NewMemoryStore()
+	store = s
+	t.Cleanup(func() { store = nil })
+	return s
+}
+
+func addWebhook(s *db.MemoryStore, url string, events ...string) *db.Webhook {
+	return must(s.CreateWebhook(&db.Webhook{Name: url, URL: url, Secret: "s3cret", Events: events, Enabled: true}))
+}
+
+func deliveries(s *db.MemoryStore, w *db.Webhook) []db.WebhookDelivery {
+	return must(s.GetWebhookDeliveries(w.ID, 100))
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"ping"}`)
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("key", 1700000000, body); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if Sign("key", 1700000001, body) == want {
+		t.Error("the signature doesn't depend on the timestamp")
+	}
+	if Sign("other", 1700000000, body) == want {
+		t.Error("the signature doesn't depend on the secret")
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	s := useStore(t)
+	r := newReceiver(t, http.StatusNoContent)
+	w := addWebhook(s, r.URL, service.EventItemCreated)
+	other := addWebhook(s, r.URL+"/other", service.EventListCreated)
+
+	HandleEvent(service.Event{Type: service.EventItemCreated, ListID: 3, Data: map[string]string{"name": "Milk"}})
+	before := time.Now().Unix()
+	deliverDue()
+
+	got := r.got()
+	if len(got) != 1 {
+		t.Fatalf("%d requests, want 1", len(got))
+	}
+	h, body := got[0].header, got[0].body
+	timestamp, err := strconv.ParseInt(h.Get("X-Koffan-Timestamp"), 10, 64)
+	if err != nil || timestamp < before || timestamp > time.Now().Unix() {
+		t.Errorf("X-Koffan-Timestamp = %q", h.Get("X-Koffan-Timestamp"))
+	}
+	if h.Get("X-Koffan-Signature") != Sign("s3cret", timestamp, body) {
+		t.Error("the signature doesn't match the timestamp and body")
+	}
+	if h.Get("X-Koffan-Event") != service.EventItemCreated || h.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", h)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Event != service.EventItemCreated || payload.ListID != 3 {
+		t.Errorf("payload = %s", body)
+	}
+
+	d := deliveries(s, w)
+	if len(d) != 1 || d[0].Status != db.WebhookDelivered || d[0].Attempts != 1 || d[0].ResponseCode != 204 {
+		t.Errorf("delivery log = %+v", d)
+	}
+	if h.Get("X-Koffan-Delivery") != strconv.FormatInt(d[0].ID, 10) {
+		t.Errorf("X-Koffan-Delivery = %q", h.Get("X-Koffan-Delivery"))
+	}
+	if n := len(deliveries(s, other)); n != 0 {
+		t.Errorf("%d deliveries for a webhook without the event", n)
+	}
+}
+
+func TestRetryAndGiveUp(t *testing.T) {
+	s := useStore(t)
+	r := newReceiver(t, http.StatusServiceUnavailable)
+	w := addWebhook(s, r.URL, "*")
+
+	HandleEvent(service.Event{Type: service.EventListCreated})
+	deliverDue()
+
+	d := deliveries(s, w)[0]
+	if d.Status != db.WebhookPending || d.Attempts != 1 || d.ResponseCode != 503 || d.Error != "HTTP 503: try later" {
+		t.Fatalf("delivery after a failed attempt = %+v", d)
+	}
+	if wait := d.NextAttemptAt - time.Now().Unix(); wait < 29 || wait > 30 {
+		t.Errorf("first retry in %ds, want 30s", wait)
+	}
+
+	// Not due yet, so nothing is sent
+	deliverDue()
+	if n := len(r.got()); n != 1 {
+		t.Fatalf("%d requests before the retry was due", n)
+	}
+
+	// Each retry waits longer
+	d.NextAttemptAt = time.Now().Unix()
+	if err := s.UpdateWebhookDelivery(&d); err != nil {
+		t.Fatal(err)
+	}
+	deliverDue()
+	d = deliveries(s, w)[0]
+	if d.Attempts != 2 || d.Status != db.WebhookPending {
+		t.Fatalf("delivery after the first retry = %+v", d)
+	}
+	if wait := d.NextAttemptAt - time.Now().Unix(); wait < 119 || wait > 120 {
+		t.Errorf("second retry in %ds, want 2m", wait)
+	}
+
+	// After the last retry it fails for good
+	d.Attempts = len(retryDelays)
+	d.NextAttemptAt = time.Now().Unix()
+	if err := s.UpdateWebhookDelivery(&d); err != nil {
+		t.Fatal(err)
+	}
+	deliverDue()
+	d = deliveries(s, w)[0]
+	if d.Status != db.WebhookFailed || d.Attempts != len(retryDelays)+1 || d.FinishedAt == 0 {
+		t.Errorf("delivery after the last retry = %+v", d)
+	}
+	if n := len(r.got()); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+
+	// A receiver that recovers gets new events
+	r.mu.Lock()
+	r.status = http.StatusOK
+	r.mu.Unlock()
+	HandleEvent(service.Event{Type: service.EventListCreated})
+	deliverDue()
+	if d := deliveries(s, w); d[0].Status != db.WebhookDelivered {
+		t.Errorf("newest delivery = %+v", d[0])
+	}
+}
+
+func TestDeliverDeletedWebhook(t *testing.T) {
+	s := useStore(t)
+	r := newReceiver(t, http.StatusOK)
+	w := addWebhook(s, r.URL, "*")
+
+	HandleEvent(service.Event{Type: service.EventListCreated})
+	queued := deliveries(s, w)[0]
+	if err := s.DeleteWebhook(w.ID); err != nil {
+		t.Fatal(err)
+	}
+	deliverTo(w.ID, []*db.WebhookDelivery{&queued})
+	if queued.Status != db.WebhookFailed || queued.Error != "webhook deleted" {
+		t.Errorf("delivery of a deleted webhook = %+v", queued)
+	}
+	if len(r.got()) != 0 {
+		t.Error("sent to a deleted webhook")
+	}
+}
+
+func TestDeliverInParallel(t *testing.T) {
+	s := useStore(t)
+
+	// The slow receiver answers once the fast one got its request, which
+	// only happens in time if they are sent to at the same time
+	fastDone := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-fastDone:
+		case <-time.After(3 * time.Second):
+			w.WriteHeader(http.StatusGatewayTimeout)
+		}
+	}))
+	defer slow.Close()
+	var once sync.Once
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(fastDone) })
+	}))
+	defer fast.Close()
+
+	slowHook := addWebhook(s, slow.URL, "*")
+	fastHook := addWebhook(s, fast.URL, "*")
+	HandleEvent(service.Event{Type: service.EventListCreated})
+	HandleEvent(service.Event{Type: service.EventListUpdated})
+	deliverDue()
+
+	for _, w := range []*db.Webhook{slowHook, fastHook} {
+		for _, d := range deliveries(s, w) {
+			if d.Status != db.WebhookDelivered {
+				t.Errorf("delivery %d to %s = %s %s", d.ID, w.Name, d.Status, d.Error)
+			}
+		}
+	}
+}